@@ -0,0 +1,246 @@
+package accounts
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"subvault/internal/crypto"
+	"subvault/internal/database"
+	"subvault/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidCredentials 用户名不存在或主密钥错误，两者不加区分
+	ErrInvalidCredentials = errors.New("invalid username or passphrase")
+	// ErrUsernameTaken 用户名已被注册
+	ErrUsernameTaken = errors.New("username already taken")
+	// ErrRegistrationClosed 管理员已关闭注册
+	ErrRegistrationClosed = errors.New("registration is disabled")
+	// ErrSetupRequired 第一个用户（管理员）注册时没有出示有效的初始化凭据
+	ErrSetupRequired = errors.New("setup authorization required")
+	// ErrInvalidUsername 用户名格式不合法
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrWeakPassphrase 主密钥过短
+	ErrWeakPassphrase = errors.New("passphrase too short")
+)
+
+// MinPassphraseLength 注册时主密钥的最小长度
+const MinPassphraseLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,31}$`)
+
+// dummyHash 用户不存在时也做一次 bcrypt 比较，避免通过响应时间探测用户名
+var dummyHash, _ = crypto.HashPassword("subvault-dummy-passphrase")
+
+// NormalizeUsername 用户名不区分大小写，统一存小写
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Lookup 按用户名查找用户，不校验主密钥；不存在时返回 ErrInvalidCredentials。
+// username 为空时兼容只有一个用户的旧客户端：若只存在一个用户则返回该用户。
+func Lookup(db *gorm.DB, username string) (models.User, error) {
+	var user models.User
+	var err error
+	if username = NormalizeUsername(username); username != "" {
+		err = db.Where("username = ?", username).First(&user).Error
+	} else {
+		var users []models.User
+		err = db.Limit(2).Find(&users).Error
+		if err == nil && len(users) != 1 {
+			err = gorm.ErrRecordNotFound
+		} else if err == nil {
+			user = users[0]
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, err
+}
+
+// Authenticate 校验用户名和主密钥，返回对应用户。
+// username 为空时兼容只有一个用户的旧客户端：若只存在一个用户则直接校验该用户。
+func Authenticate(db *gorm.DB, username, passphrase string) (models.User, error) {
+	user, err := Lookup(db, username)
+	if err == ErrInvalidCredentials {
+		crypto.CheckPasswordHash(passphrase, dummyHash)
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var vault models.Vault
+	if err := db.Where("id = ?", user.VaultID).First(&vault).Error; err != nil {
+		return models.User{}, err
+	}
+	if vault.KeyBcrypt == "" || !crypto.CheckPasswordHash(passphrase, vault.KeyBcrypt) {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// VerifyPassphrase 已登录时再次校验保险库的主密钥，用于导出等敏感操作；不匹配时返回 ErrInvalidCredentials
+func VerifyPassphrase(db *gorm.DB, vaultID, passphrase string) error {
+	var vault models.Vault
+	if err := db.Where("id = ?", vaultID).First(&vault).Error; err != nil {
+		return err
+	}
+	if vault.KeyBcrypt == "" || !crypto.CheckPasswordHash(passphrase, vault.KeyBcrypt) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// Register 注册新用户并为其创建保险库。
+// 第一个注册的用户成为管理员且不受注册开关限制，但须由调用方核对过初始化凭据（setupAuthorized），
+// 否则返回 ErrSetupRequired；之后是否允许注册由管理员决定，setupAuthorized 不再起作用。
+func Register(db *gorm.DB, username, passphrase string, setupAuthorized bool) (models.User, error) {
+	username = NormalizeUsername(username)
+	if !usernamePattern.MatchString(username) {
+		return models.User{}, ErrInvalidUsername
+	}
+	if len(passphrase) < MinPassphraseLength {
+		return models.User{}, ErrWeakPassphrase
+	}
+	hash, err := crypto.HashPassword(passphrase)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 && !setupAuthorized {
+			return ErrSetupRequired
+		}
+		if count > 0 {
+			open, err := registrationEnabled(tx)
+			if err != nil {
+				return err
+			}
+			if !open {
+				return ErrRegistrationClosed
+			}
+		}
+		var taken int64
+		if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrUsernameTaken
+		}
+
+		vaultID := uuid.New().String()
+		vault := models.Vault{ID: vaultID, KeyHash: vaultID, KeyBcrypt: hash}
+		if err := tx.Create(&vault).Error; err != nil {
+			return err
+		}
+		user = models.User{Username: username, VaultID: vault.ID, IsAdmin: count == 0}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// RegistrationOpen 当前是否允许注册：还没有任何用户时总是允许（需出示初始化凭据）
+func RegistrationOpen(db *gorm.DB) (bool, error) {
+	setup, err := NeedsSetup(db)
+	if err != nil || setup {
+		return setup, err
+	}
+	return registrationEnabled(db)
+}
+
+// NeedsSetup 还没有任何用户，下一个注册的用户将成为管理员
+func NeedsSetup(db *gorm.DB) (bool, error) {
+	var count int64
+	if err := db.Model(&models.User{}).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// SetRegistrationEnabled 管理员开关注册
+func SetRegistrationEnabled(db *gorm.DB, enabled bool) error {
+	if _, err := database.LoadInstallation(db); err != nil {
+		return err
+	}
+	return db.Model(&models.Installation{}).Where("id = ?", 1).UpdateColumn("registration_enabled", enabled).Error
+}
+
+func registrationEnabled(db *gorm.DB) (bool, error) {
+	inst, err := database.LoadInstallation(db)
+	if err != nil {
+		return false, err
+	}
+	return inst.RegistrationEnabled, nil
+}
+
+// ForVault 返回保险库所属的用户
+func ForVault(db *gorm.DB, vaultID string) (models.User, error) {
+	var user models.User
+	err := db.Where("vault_id = ?", vaultID).First(&user).Error
+	return user, err
+}
+
+// IsAdmin 保险库所属用户是否为管理员
+func IsAdmin(db *gorm.DB, vaultID string) bool {
+	user, err := ForVault(db, vaultID)
+	return err == nil && user.IsAdmin
+}
+
+// AdoptLegacyVault 升级前只有一个由 MASTER_KEY 解锁的保险库、没有用户账户。
+// 尚无任何用户时，把最早创建的保险库认领为管理员 username 的保险库，
+// 并用当前 MASTER_KEY 重设其 bcrypt 哈希（旧版本只比对环境变量，库里的哈希可能已过期）。
+// 返回是否做了认领。
+func AdoptLegacyVault(db *gorm.DB, username, masterKey string) (bool, error) {
+	adopted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		var vault models.Vault
+		err := tx.Order("created_at ASC").First(&vault).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if masterKey != "" {
+			hash, err := crypto.HashPassword(masterKey)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&vault).UpdateColumn("key_bcrypt", hash).Error; err != nil {
+				return err
+			}
+		} else if vault.KeyBcrypt == "" {
+			return errors.New("旧保险库没有主密钥哈希，请设置 MASTER_KEY 后重启")
+		}
+
+		user := models.User{Username: NormalizeUsername(username), VaultID: vault.ID, IsAdmin: true}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		adopted = true
+		return nil
+	})
+	return adopted, err
+}
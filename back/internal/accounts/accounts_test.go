@@ -0,0 +1,82 @@
+package accounts
+
+import (
+	"testing"
+
+	"subvault/internal/crypto"
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Vault{}, &models.User{}, &models.Installation{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAdoptLegacyVault(t *testing.T) {
+	db := openTestDB(t)
+	stale, _ := crypto.HashPassword("old-master-key")
+	legacy := models.Vault{KeyHash: "sole-vault-v1", KeyBcrypt: stale}
+	db.Create(&legacy)
+
+	adopted, err := AdoptLegacyVault(db, "Admin", "current-master-key")
+	if err != nil || !adopted {
+		t.Fatalf("应认领旧保险库: %v %v", adopted, err)
+	}
+	user, err := Authenticate(db, "admin", "current-master-key")
+	if err != nil || user.VaultID != legacy.ID || !user.IsAdmin {
+		t.Fatalf("应能用当前 MASTER_KEY 解锁原有保险库: %+v %v", user, err)
+	}
+	if _, err := Authenticate(db, "admin", "old-master-key"); err != ErrInvalidCredentials {
+		t.Fatal("旧的哈希应被当前 MASTER_KEY 取代")
+	}
+
+	if adopted, err := AdoptLegacyVault(db, "admin", "current-master-key"); err != nil || adopted {
+		t.Fatal("已有用户时不应重复认领")
+	}
+}
+
+func TestRegisterValidatesInput(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := Register(db, "a", "long-enough-passphrase", true); err != ErrInvalidUsername {
+		t.Fatalf("过短的用户名应拒绝: %v", err)
+	}
+	if _, err := Register(db, "alice", "short", true); err != ErrWeakPassphrase {
+		t.Fatalf("过短的主密钥应拒绝: %v", err)
+	}
+	if open, _ := RegistrationOpen(db); !open {
+		t.Fatal("还没有用户时应允许注册")
+	}
+	if _, err := Register(db, "alice", "long-enough-passphrase", false); err != ErrSetupRequired {
+		t.Fatalf("第一个用户未出示初始化凭据时应拒绝: %v", err)
+	}
+	if _, err := Register(db, "alice", "long-enough-passphrase", true); err != nil {
+		t.Fatal(err)
+	}
+	if open, _ := RegistrationOpen(db); open {
+		t.Fatal("有用户后注册默认关闭")
+	}
+}
+
+func TestVerifyPassphrase(t *testing.T) {
+	db := openTestDB(t)
+	user, err := Register(db, "alice", "long-enough-passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPassphrase(db, user.VaultID, "long-enough-passphrase"); err != nil {
+		t.Fatalf("正确的主密钥应通过: %v", err)
+	}
+	if err := VerifyPassphrase(db, user.VaultID, "wrong-passphrase"); err != ErrInvalidCredentials {
+		t.Fatalf("错误的主密钥应返回 ErrInvalidCredentials: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidToken 令牌不存在、已过期或已吊销
+	ErrInvalidToken = errors.New("invalid api token")
+	// ErrInvalidScope 请求了不存在的权限
+	ErrInvalidScope = errors.New("invalid api token scope")
+	// ErrInvalidName 令牌名称为空或过长
+	ErrInvalidName = errors.New("invalid api token name")
+)
+
+// Prefix 个人访问令牌的固定前缀，AuthMiddleware 据此与 JWT 区分
+const Prefix = "svt_"
+
+// touchInterval 最近使用时间的最小写入间隔，避免每个请求都写库
+const touchInterval = time.Minute
+
+const maxNameLength = 64
+
+// 令牌可访问的资源；每个资源有 read、write 两种权限，write 隐含 read
+const (
+	ResourceSubscriptions = "subscriptions"
+	ResourceCredentials   = "credentials"
+	ResourceMemos         = "memos"
+	ResourceTags          = "tags"
+	ResourceAnalytics     = "analytics" // 数据分析、洞察、即将到期，只有 read
+)
+
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// AllScopes 可授予的全部权限，例如 subscriptions:read
+var AllScopes = []string{
+	ResourceSubscriptions + ":" + ActionRead, ResourceSubscriptions + ":" + ActionWrite,
+	ResourceCredentials + ":" + ActionRead, ResourceCredentials + ":" + ActionWrite,
+	ResourceMemos + ":" + ActionRead, ResourceMemos + ":" + ActionWrite,
+	ResourceTags + ":" + ActionRead, ResourceTags + ":" + ActionWrite,
+	ResourceAnalytics + ":" + ActionRead,
+}
+
+// NormalizeScopes 去重、排序并校验权限列表，至少需要一项
+func NormalizeScopes(scopes []string) ([]string, error) {
+	valid := make(map[string]bool, len(AllScopes))
+	for _, s := range AllScopes {
+		valid[s] = true
+	}
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !valid[s] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidScope
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ScopeList 拆分令牌上保存的权限
+func ScopeList(token models.APIToken) []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+// Allows 权限列表是否允许对资源执行操作；write 权限同时允许 read
+func Allows(scopes []string, resource, action string) bool {
+	for _, s := range scopes {
+		if s == resource+":"+action || (action == ActionRead && s == resource+":"+ActionWrite) {
+			return true
+		}
+	}
+	return false
+}
+
+// Create 为保险库新建令牌，返回令牌记录和明文令牌（只出现这一次）。
+// ttl 为 0 表示永不过期。
+func Create(db *gorm.DB, vaultID, name string, scopes []string, ttl time.Duration) (models.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxNameLength {
+		return models.APIToken{}, "", ErrInvalidName
+	}
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return models.APIToken{}, "", err
+	}
+	plain, err := randomToken()
+	if err != nil {
+		return models.APIToken{}, "", err
+	}
+	token := models.APIToken{
+		VaultID:   vaultID,
+		Name:      name,
+		Prefix:    plain[:len(Prefix)+6],
+		TokenHash: hashToken(plain),
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return models.APIToken{}, "", err
+	}
+	return token, plain, nil
+}
+
+// Authenticate 校验明文令牌，返回未吊销、未过期的令牌记录
+func Authenticate(db *gorm.DB, plain string) (models.APIToken, error) {
+	if !strings.HasPrefix(plain, Prefix) {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	var token models.APIToken
+	if err := db.Where("token_hash = ?", hashToken(plain)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.APIToken{}, ErrInvalidToken
+		}
+		return models.APIToken{}, err
+	}
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return models.APIToken{}, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// Touch 记录令牌最近使用时间和来源 IP，一分钟内重复调用不写库
+func Touch(db *gorm.DB, id, ip string) {
+	now := time.Now()
+	db.Model(&models.APIToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-touchInterval)).
+		Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		})
+}
+
+// List 返回保险库未吊销的令牌（含已过期的，便于用户清理），最新创建的在前
+func List(db *gorm.DB, vaultID string) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := db.Where("vault_id = ? AND revoked_at IS NULL", vaultID).
+		Order("created_at desc").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeForVault 吊销指定保险库下的令牌，令牌不属于该保险库时返回 false
+func RevokeForVault(db *gorm.DB, vaultID, id string) (bool, error) {
+	result := db.Model(&models.APIToken{}).
+		Where("id = ? AND vault_id = ? AND revoked_at IS NULL", id, vaultID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,117 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.APIToken{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCreateStoresOnlyHash(t *testing.T) {
+	db := openTestDB(t)
+	token, plain, err := Create(db, "vault-1", "cron", []string{"subscriptions:read", "subscriptions:read", "memos:write"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, Prefix) || !strings.HasPrefix(plain, token.Prefix) {
+		t.Fatalf("明文令牌格式不对: %q %q", plain, token.Prefix)
+	}
+
+	var stored models.APIToken
+	db.First(&stored, "id = ?", token.ID)
+	if stored.TokenHash == plain || strings.Contains(stored.TokenHash, plain[len(Prefix):]) {
+		t.Fatal("库里不应保存明文令牌")
+	}
+	if stored.Scopes != "memos:write,subscriptions:read" {
+		t.Fatalf("权限应去重排序: %q", stored.Scopes)
+	}
+
+	got, err := Authenticate(db, plain)
+	if err != nil || got.ID != token.ID {
+		t.Fatalf("应能用明文令牌认证: %v", err)
+	}
+	if _, err := Authenticate(db, plain+"x"); err != ErrInvalidToken {
+		t.Fatal("错误的令牌应被拒绝")
+	}
+}
+
+func TestCreateValidatesInput(t *testing.T) {
+	db := openTestDB(t)
+	if _, _, err := Create(db, "vault-1", "cron", []string{"subscriptions:admin"}, 0); err != ErrInvalidScope {
+		t.Fatalf("未知权限应被拒绝: %v", err)
+	}
+	if _, _, err := Create(db, "vault-1", "cron", nil, 0); err != ErrInvalidScope {
+		t.Fatalf("至少需要一项权限: %v", err)
+	}
+	if _, _, err := Create(db, "vault-1", "  ", []string{"tags:read"}, 0); err != ErrInvalidName {
+		t.Fatalf("名称不能为空: %v", err)
+	}
+}
+
+func TestExpiredAndRevokedTokensRejected(t *testing.T) {
+	db := openTestDB(t)
+	expired, plain, _ := Create(db, "vault-1", "old", []string{"tags:read"}, time.Hour)
+	db.Model(&expired).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := Authenticate(db, plain); err != ErrInvalidToken {
+		t.Fatal("过期令牌应被拒绝")
+	}
+
+	forever, plain, _ := Create(db, "vault-1", "forever", []string{"tags:read"}, 0)
+	if forever.ExpiresAt != nil {
+		t.Fatal("ttl 为 0 时不应设置过期时间")
+	}
+	if ok, _ := RevokeForVault(db, "vault-2", forever.ID); ok {
+		t.Fatal("不应能吊销其他保险库的令牌")
+	}
+	if ok, _ := RevokeForVault(db, "vault-1", forever.ID); !ok {
+		t.Fatal("应能吊销自己的令牌")
+	}
+	if _, err := Authenticate(db, plain); err != ErrInvalidToken {
+		t.Fatal("吊销后的令牌应被拒绝")
+	}
+	if tokens, _ := List(db, "vault-1"); len(tokens) != 1 || tokens[0].ID != expired.ID {
+		t.Fatalf("列表应只含未吊销的令牌: %+v", tokens)
+	}
+}
+
+func TestTouchRecordsLastUse(t *testing.T) {
+	db := openTestDB(t)
+	token, _, _ := Create(db, "vault-1", "cron", []string{"tags:read"}, 0)
+	Touch(db, token.ID, "10.0.0.1")
+	db.First(&token, "id = ?", token.ID)
+	if token.LastUsedAt == nil || token.LastUsedIP != "10.0.0.1" {
+		t.Fatalf("应记录最近使用: %+v", token)
+	}
+	first := *token.LastUsedAt
+	Touch(db, token.ID, "10.0.0.2")
+	db.First(&token, "id = ?", token.ID)
+	if !token.LastUsedAt.Equal(first) || token.LastUsedIP != "10.0.0.1" {
+		t.Fatal("一分钟内重复使用不应写库")
+	}
+}
+
+func TestAllowsWriteImpliesRead(t *testing.T) {
+	scopes := []string{"subscriptions:write", "memos:read"}
+	if !Allows(scopes, ResourceSubscriptions, ActionRead) || !Allows(scopes, ResourceSubscriptions, ActionWrite) {
+		t.Fatal("write 应同时允许读写")
+	}
+	if Allows(scopes, ResourceMemos, ActionWrite) || Allows(scopes, ResourceCredentials, ActionRead) {
+		t.Fatal("不应允许未授予的权限")
+	}
+}
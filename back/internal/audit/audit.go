@@ -0,0 +1,158 @@
+// Package audit 追加写入安全审计日志并按条件分页查询。
+package audit
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidFilter 筛选条件中有未知的动作或结果
+var ErrInvalidFilter = errors.New("invalid audit filter")
+
+// 审计动作
+const (
+	ActionUnlock           = "auth.unlock"
+	ActionPasskeyUnlock    = "auth.passkey_unlock"
+	ActionRegister         = "auth.register"
+	ActionLogout           = "auth.logout"
+	ActionTotpSetup        = "totp.setup"
+	ActionTotpEnable       = "totp.enable"
+	ActionTotpDisable      = "totp.disable"
+	ActionRecoveryRenew    = "totp.recovery_regenerate"
+	ActionPasskeyRegister  = "webauthn.register"
+	ActionPasskeyDelete    = "webauthn.delete"
+	ActionCredentialsRead  = "credentials.read"
+	ActionSharedCredential = "credentials.shared_read" // 其他成员读取了本保险库共享出去的凭证
+	ActionBackupExport     = "backup.export"
+	ActionBackupImport     = "backup.import"
+	ActionCredentialExport = "credentials.export"
+)
+
+// 结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeLocked  = "locked"
+)
+
+// Actions 可供筛选的全部动作
+var Actions = []string{
+	ActionUnlock, ActionPasskeyUnlock, ActionRegister, ActionLogout,
+	ActionTotpSetup, ActionTotpEnable, ActionTotpDisable, ActionRecoveryRenew,
+	ActionPasskeyRegister, ActionPasskeyDelete,
+	ActionCredentialsRead, ActionSharedCredential,
+	ActionBackupExport, ActionBackupImport, ActionCredentialExport,
+}
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+const (
+	maxDetailLength    = 512
+	maxUserAgentLength = 256
+)
+
+// Record 追加一条审计日志。写入失败只记录到服务日志，不影响业务请求。
+func Record(db *gorm.DB, event models.AuditEvent) {
+	if event.ActorVaultID == "" {
+		event.ActorVaultID = event.VaultID
+	}
+	event.Detail = truncate(event.Detail, maxDetailLength)
+	event.UserAgent = truncate(event.UserAgent, maxUserAgentLength)
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("写入审计日志失败 (%s): %v", event.Action, err)
+	}
+}
+
+// Filter 查询条件，零值表示不限
+type Filter struct {
+	Actions  []string
+	Outcome  string
+	Since    time.Time
+	Until    time.Time
+	Page     int // 从 1 开始
+	PageSize int
+}
+
+// Query 按时间倒序分页返回保险库的审计日志和符合条件的总数
+func Query(db *gorm.DB, vaultID string, f Filter) ([]models.AuditEvent, int64, error) {
+	q := db.Model(&models.AuditEvent{}).Where("vault_id = ?", vaultID)
+	if len(f.Actions) > 0 {
+		q = q.Where("action IN ?", f.Actions)
+	}
+	switch f.Outcome {
+	case "":
+	case OutcomeSuccess, OutcomeFailure, OutcomeLocked:
+		q = q.Where("outcome = ?", f.Outcome)
+	default:
+		return nil, 0, ErrInvalidFilter
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	page, size := NormalizePage(f.Page, f.PageSize)
+	events := []models.AuditEvent{}
+	err := q.Order("created_at desc, id desc").Limit(size).Offset((page - 1) * size).Find(&events).Error
+	return events, total, err
+}
+
+// NormalizePage 页码至少为 1，每页条数限制在 1 到 MaxPageSize
+func NormalizePage(page, size int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+	return page, size
+}
+
+// ParseActions 拆分逗号分隔的动作列表，含未知动作时返回 ErrInvalidFilter
+func ParseActions(raw string) ([]string, error) {
+	valid := make(map[string]bool, len(Actions))
+	for _, a := range Actions {
+		valid[a] = true
+	}
+	var out []string
+	for _, a := range strings.Split(raw, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		if !valid[a] {
+			return nil, ErrInvalidFilter
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// truncate 截断到 max 字节以内，不切断多字节字符（PostgreSQL 拒绝不完整的 UTF-8）
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
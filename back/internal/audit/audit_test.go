@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.AuditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestQueryFiltersAndPaginates(t *testing.T) {
+	db := openTestDB(t)
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		db.Create(&models.AuditEvent{VaultID: "v1", Action: ActionUnlock, Outcome: OutcomeFailure, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	Record(db, models.AuditEvent{VaultID: "v1", Action: ActionUnlock, Outcome: OutcomeSuccess})
+	Record(db, models.AuditEvent{VaultID: "v1", Action: ActionTotpDisable, Outcome: OutcomeSuccess})
+	Record(db, models.AuditEvent{VaultID: "v2", Action: ActionUnlock, Outcome: OutcomeFailure})
+
+	events, total, err := Query(db, "v1", Filter{})
+	if err != nil || total != 7 || len(events) != 7 {
+		t.Fatalf("应只返回本保险库的 7 条: %d %d %v", total, len(events), err)
+	}
+	if events[0].CreatedAt.Before(events[len(events)-1].CreatedAt) {
+		t.Fatal("应按时间倒序")
+	}
+	if events[0].ActorVaultID != "v1" {
+		t.Fatal("未指定操作者时应为保险库本身")
+	}
+
+	_, total, _ = Query(db, "v1", Filter{Actions: []string{ActionUnlock}, Outcome: OutcomeFailure})
+	if total != 5 {
+		t.Fatalf("按动作和结果筛选应得到 5 条: %d", total)
+	}
+	_, total, _ = Query(db, "v1", Filter{Outcome: OutcomeFailure, Since: base.Add(90 * time.Second), Until: base.Add(4 * time.Minute)})
+	if total != 2 {
+		t.Fatalf("按时间范围筛选应得到 2 条: %d", total)
+	}
+
+	page2, total, _ := Query(db, "v1", Filter{Page: 2, PageSize: 3})
+	if total != 7 || len(page2) != 3 {
+		t.Fatalf("第 2 页应有 3 条: %d %d", total, len(page2))
+	}
+
+	if _, _, err := Query(db, "v1", Filter{Outcome: "maybe"}); !errors.Is(err, ErrInvalidFilter) {
+		t.Fatalf("未知结果应返回 ErrInvalidFilter: %v", err)
+	}
+}
+
+func TestEventsAreAppendOnly(t *testing.T) {
+	db := openTestDB(t)
+	Record(db, models.AuditEvent{VaultID: "v1", Action: ActionUnlock, Outcome: OutcomeFailure})
+
+	var event models.AuditEvent
+	if err := db.First(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&event).Update("outcome", OutcomeSuccess).Error; !errors.Is(err, models.ErrAuditAppendOnly) {
+		t.Fatalf("审计日志不应允许修改: %v", err)
+	}
+	if err := db.Delete(&event).Error; !errors.Is(err, models.ErrAuditAppendOnly) {
+		t.Fatalf("审计日志不应允许删除: %v", err)
+	}
+	var count int64
+	db.Model(&models.AuditEvent{}).Where("outcome = ?", OutcomeFailure).Count(&count)
+	if count != 1 {
+		t.Fatal("审计日志应保持原样")
+	}
+}
+
+func TestParseActions(t *testing.T) {
+	got, err := ParseActions(" auth.unlock, totp.disable ,")
+	if err != nil || len(got) != 2 || got[1] != ActionTotpDisable {
+		t.Fatalf("ParseActions = %v, %v", got, err)
+	}
+	if _, err := ParseActions("auth.unlock,drop"); !errors.Is(err, ErrInvalidFilter) {
+		t.Fatal("未知动作应返回 ErrInvalidFilter")
+	}
+}
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+	got := truncate("审计日志", 7)
+	if got != "审计" {
+		t.Fatalf("truncate = %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+// Package backup 定义整库备份文件的格式，并用用户提供的口令加密。
+// 备份文件自带密钥派生参数和盐值，只凭口令就能解开，不依赖服务端的 ENCRYPTION_KEY 和数据库。
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"subvault/internal/crypto"
+	"subvault/internal/models"
+)
+
+const (
+	// Format 备份文件的 format 字段，用来识别不是备份文件的上传
+	Format = "subvault-backup"
+	// Version 当前的备份格式版本
+	Version = 1
+
+	// MinPassphraseLength 口令的最短长度
+	MinPassphraseLength = 8
+)
+
+var (
+	// ErrInvalidFile 不是备份文件，或版本不受支持
+	ErrInvalidFile = errors.New("invalid backup file")
+	// ErrWrongPassphrase 口令错误或备份内容被篡改
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted backup")
+)
+
+// Bundle 备份的明文内容。凭证的密码、备注和备忘录内容在这里是明文，整体加密后才写入文件
+type Bundle struct {
+	Version       int                         `json:"version"`
+	VaultID       string                      `json:"vaultId"` // 导出的保险库，导入同一保险库时沿用记录 ID
+	ExportedAt    time.Time                   `json:"exportedAt"`
+	Subscriptions []models.Subscription       `json:"subscriptions"`
+	Credentials   []models.Credential         `json:"credentials"`
+	Memos         []models.Memo               `json:"memos"`
+	Tags          []models.Tag                `json:"tags"`
+	Settings      *models.NotificationSetting `json:"settings,omitempty"`
+	PriceHistory  []models.PriceHistory       `json:"priceHistory"`
+	RenewalEvents []models.RenewalEvent       `json:"renewalEvents"`
+}
+
+// File 备份文件，data 为 Bundle 的 JSON 经口令派生的密钥加密后的密文
+type File struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`  // crypto.KDFParams 的编码
+	Salt    string `json:"salt"` // 每个文件单独生成的盐值
+	Data    string `json:"data"`
+}
+
+// aad 把密文绑定到文件头中的盐值，替换盐值或拼接别的文件的密文都会解密失败
+func (f File) aad() crypto.AAD {
+	return crypto.AAD{Table: Format, RowID: f.Salt, Field: "data"}
+}
+
+// Seal 用口令加密 bundle，密钥用 Argon2id 默认参数加随机盐值派生
+func Seal(bundle Bundle, passphrase string) (File, error) {
+	salt, err := crypto.GenerateSalt()
+	if err != nil {
+		return File{}, err
+	}
+	file := File{Format: Format, Version: Version, KDF: crypto.DefaultKDFParams.String(), Salt: salt}
+
+	bundle.Version = Version
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return File{}, err
+	}
+	cipher, err := file.cipher(passphrase)
+	if err != nil {
+		return File{}, err
+	}
+	if file.Data, err = cipher.Encrypt(string(plaintext), file.aad()); err != nil {
+		return File{}, err
+	}
+	return file, nil
+}
+
+// Open 用口令解开备份文件
+func Open(file File, passphrase string) (Bundle, error) {
+	if file.Format != Format || file.Version != Version || file.Data == "" || crypto.IsLegacy(file.Data) {
+		return Bundle{}, ErrInvalidFile
+	}
+	cipher, err := file.cipher(passphrase)
+	if err != nil {
+		return Bundle{}, err
+	}
+	plaintext, err := cipher.Decrypt(file.Data, file.aad())
+	if err != nil {
+		return Bundle{}, ErrWrongPassphrase
+	}
+	var bundle Bundle
+	if err := json.Unmarshal([]byte(plaintext), &bundle); err != nil || bundle.Version != Version {
+		return Bundle{}, ErrInvalidFile
+	}
+	return bundle, nil
+}
+
+// maxMemoryKiB 导入时允许的 Argon2id 内存上限，防止上传的文件让服务端一次分配过多内存
+const maxMemoryKiB = 4 * 64 * 1024
+
+// cipher 按文件头中的参数从口令派生密钥。只接受 Argon2id，且参数不能超过上限，
+// 避免上传的文件指定弱参数或拖垮服务端的参数
+func (f File) cipher(passphrase string) (*crypto.Cipher, error) {
+	params, err := crypto.ParseKDFParams(f.KDF)
+	if err != nil || params.Algorithm != crypto.KDFArgon2id || params.MemoryKiB > maxMemoryKiB || params.Time > 10 || params.Threads > 16 {
+		return nil, ErrInvalidFile
+	}
+	salt, err := crypto.DecodeSalt(f.Salt)
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	return crypto.NewCipher(crypto.KDF{Params: params, Salt: salt}, passphrase), nil
+}
@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"subvault/internal/models"
+)
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	bundle := Bundle{
+		VaultID:     "vault-1",
+		Credentials: []models.Credential{{ID: "c1", Label: "GitHub", Password: "hunter2"}},
+		Memos:       []models.Memo{{ID: "m1", Title: "Wi-Fi", Content: "密码 12345678"}},
+	}
+	file, err := Seal(bundle, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(file.Data, "hunter2") || file.Format != Format || file.Version != Version {
+		t.Fatalf("备份文件格式不正确: %+v", file)
+	}
+
+	got, err := Open(file, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.VaultID != "vault-1" || got.Credentials[0].Password != "hunter2" || got.Memos[0].Content != "密码 12345678" {
+		t.Fatalf("解开后内容不一致: %+v", got)
+	}
+}
+
+func TestOpenRejectsWrongPassphraseAndTampering(t *testing.T) {
+	file, err := Seal(Bundle{VaultID: "vault-1"}, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(file, "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("口令错误应返回 ErrWrongPassphrase，实际 %v", err)
+	}
+
+	other, _ := Seal(Bundle{VaultID: "vault-1"}, "correct horse")
+	swapped := file
+	swapped.Salt = other.Salt
+	if _, err := Open(swapped, "correct horse"); err == nil {
+		t.Fatal("替换盐值后不应能解开")
+	}
+
+	for _, bad := range []File{
+		{Format: "other", Version: Version, KDF: file.KDF, Salt: file.Salt, Data: file.Data},
+		{Format: Format, Version: Version + 1, KDF: file.KDF, Salt: file.Salt, Data: file.Data},
+		{Format: Format, Version: Version, KDF: "pbkdf2-sha256$i=1", Salt: file.Salt, Data: file.Data},
+		{Format: Format, Version: Version, KDF: "argon2id$v=19$m=4194304,t=3,p=4", Salt: file.Salt, Data: file.Data},
+	} {
+		if _, err := Open(bad, "correct horse"); !errors.Is(err, ErrInvalidFile) {
+			t.Fatalf("%+v 应被拒绝，实际 %v", bad.KDF, err)
+		}
+	}
+}
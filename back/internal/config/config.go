@@ -5,14 +5,31 @@ import (
 	"encoding/hex"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"subvault/internal/crypto"
 )
 
 type Config struct {
-	JWTSecret     string
-	EncryptionKey string // 用于加密敏感数据的密钥
-	MasterKey     string // 唯一登录主密钥，来自环境变量
-	DatabasePath  string
-	Environment   string
+	JWTSecret              string
+	EncryptionKey          string   // 用于加密敏感数据的密钥
+	PreviousEncryptionKeys []string // 轮换前的旧加密密钥，只用于解密
+	MasterKey              string   // 升级前唯一保险库的主密钥，仅用于把它认领为管理员账户
+	AdminUsername          string   // 认领旧保险库时创建的管理员用户名
+	SetupToken             string   // 第一个用户（管理员）注册时需出示的初始化令牌
+	SetupTokenGenerated    bool     // 未设置 SETUP_TOKEN，SetupToken 为本次启动随机生成
+	DatabasePath           string
+	DatabaseURL            string // PostgreSQL 连接串，设置后忽略 DatabasePath
+	Environment            string
+	AccessTokenTTL         time.Duration    // 访问令牌有效期
+	RefreshTokenTTL        time.Duration    // 刷新令牌（会话）有效期
+	KDF                    crypto.KDFParams // 主密钥和数据密钥的 Argon2id 参数
+	WebAuthnRPID           string           // 通行密钥绑定的域名，需与前端访问的域名一致
+	WebAuthnOrigins        []string         // 允许发起通行密钥注册和验证的前端来源
+	TrashRetention         time.Duration    // 回收站中的记录保留多久后自动彻底删除
+	TrustedProxies         []string         // 可信反向代理的 IP 或网段，只有来自它们的 X-Forwarded-For 才用于识别客户端 IP
 }
 
 func Load() *Config {
@@ -39,27 +56,125 @@ func Load() *Config {
 		log.Printf("警告: 未设置 ENCRYPTION_KEY，已生成临时密钥（仅用于开发环境）")
 	}
 
-	masterKey := os.Getenv("MASTER_KEY")
-	if masterKey == "" {
-		if env == "production" {
-			log.Fatal("生产环境必须设置 MASTER_KEY 环境变量")
+	var previousKeys []string
+	for _, key := range strings.Split(os.Getenv("ENCRYPTION_KEY_PREVIOUS"), ",") {
+		if key = strings.TrimSpace(key); key != "" && key != encryptionKey {
+			previousKeys = append(previousKeys, key)
 		}
-		masterKey = "subvault"
-		log.Printf("警告: 未设置 MASTER_KEY，开发环境默认主密钥为 subvault")
+	}
+
+	// 多用户之后 MASTER_KEY 只用于认领升级前的唯一保险库，新部署可不设置
+	masterKey := os.Getenv("MASTER_KEY")
+	adminUsername := os.Getenv("ADMIN_USERNAME")
+	if adminUsername == "" {
+		adminUsername = "admin"
+	}
+
+	// 未设置时每次启动随机生成，还没有用户时打印到启动日志，只有能看到日志的部署者可以注册管理员
+	setupToken := strings.TrimSpace(os.Getenv("SETUP_TOKEN"))
+	setupTokenGenerated := setupToken == ""
+	if setupTokenGenerated {
+		setupToken = generateRandomKey(16)
 	}
 
 	dbPath := os.Getenv("DATABASE_PATH")
 	if dbPath == "" {
 		dbPath = "./data/subvault.db"
 	}
+	dbURL := strings.TrimSpace(os.Getenv("DATABASE_URL"))
+	if dbURL != "" && !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		log.Fatal("DATABASE_URL 只支持 postgres:// 连接串，SQLite 请使用 DATABASE_PATH")
+	}
 
 	return &Config{
-		JWTSecret:     jwtSecret,
-		EncryptionKey: encryptionKey,
-		MasterKey:     masterKey,
-		DatabasePath:  dbPath,
-		Environment:   env,
+		JWTSecret:              jwtSecret,
+		EncryptionKey:          encryptionKey,
+		PreviousEncryptionKeys: previousKeys,
+		MasterKey:              masterKey,
+		AdminUsername:          adminUsername,
+		SetupToken:             setupToken,
+		SetupTokenGenerated:    setupTokenGenerated,
+		DatabasePath:           dbPath,
+		DatabaseURL:            dbURL,
+		Environment:            env,
+		AccessTokenTTL:         durationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:        durationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		KDF:                    loadKDFParams(),
+		WebAuthnRPID:           stringEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnOrigins:        listEnv("WEBAUTHN_ORIGINS", []string{"http://localhost:5173", "http://localhost:3000"}),
+		TrashRetention:         durationEnv("TRASH_RETENTION", 30*24*time.Hour),
+		TrustedProxies:         listEnv("TRUSTED_PROXIES", nil),
+	}
+}
+
+// DatabaseTarget 返回传给 database.Init 的连接目标：设置了 DATABASE_URL 时为 PostgreSQL，否则为 SQLite 文件
+func (c *Config) DatabaseTarget() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	return c.DatabasePath
+}
+
+// stringEnv 读取字符串，未设置时使用默认值
+func stringEnv(name, fallback string) string {
+	if raw := strings.TrimSpace(os.Getenv(name)); raw != "" {
+		return raw
+	}
+	return fallback
+}
+
+// listEnv 读取逗号分隔的列表，未设置时使用默认值
+func listEnv(name string, fallback []string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return fallback
+	}
+	return out
+}
+
+// loadKDFParams 读取 Argon2id 参数，未设置的项使用 crypto.DefaultKDFParams
+func loadKDFParams() crypto.KDFParams {
+	params := crypto.DefaultKDFParams
+	params.MemoryKiB = uint32(uintEnv("KDF_MEMORY_KIB", uint64(params.MemoryKiB), 32))
+	params.Time = uint32(uintEnv("KDF_TIME", uint64(params.Time), 32))
+	params.Threads = uint8(uintEnv("KDF_THREADS", uint64(params.Threads), 8))
+	if err := params.Validate(); err != nil {
+		log.Fatalf("KDF 参数无效: %v", err)
+	}
+	return params
+}
+
+// uintEnv 读取正整数，未设置或无效时使用默认值
+func uintEnv(name string, fallback uint64, bits int) uint64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.ParseUint(raw, 10, bits)
+	if err != nil || n == 0 {
+		log.Printf("警告: %s=%q 无效，使用默认值 %d", name, raw, fallback)
+		return fallback
+	}
+	return n
+}
+
+// durationEnv 读取形如 15m、720h 的时长，未设置或无效时使用默认值
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("警告: %s=%q 无效，使用默认值 %s", name, raw, fallback)
+		return fallback
 	}
+	return d
 }
 
 // generateRandomKey 生成随机密钥
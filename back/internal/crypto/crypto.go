@@ -4,14 +4,13 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"io"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
-	"golang.org/x/crypto/pbkdf2"
 )
 
 // HashPassword 使用 bcrypt 哈希密码（用于主密钥）
@@ -27,70 +26,156 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 // DeriveKeyFromPassword 从密码派生固定长度的密钥（用于查找 Vault）
-// 使用 PBKDF2 + 固定盐值生成可重复的哈希
-func DeriveKeyFromPassword(password string, salt string) string {
-	key := pbkdf2.Key([]byte(password), []byte(salt), 100000, 32, sha256.New)
-	return hex.EncodeToString(key)
+// 同一安装内相同密码、相同参数总得到相同的结果
+func DeriveKeyFromPassword(password string, kdf KDF) string {
+	return hex.EncodeToString(kdf.Derive(password))
 }
 
-// Encrypt 使用 AES-256-GCM 加密数据
-func Encrypt(plaintext string, key string) (string, error) {
-	if plaintext == "" {
-		return "", nil
+// GenerateDataKey 生成随机数据密钥（DEK），以十六进制字符串返回
+// DEK 由主密钥包裹后保存，本身就是 32 字节随机数，字段加密时直接作为 AES 密钥，见 NewDataKeyCipher
+func GenerateDataKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
 	}
+	return hex.EncodeToString(buf), nil
+}
 
-	// 确保密钥是 32 字节
-	keyBytes := deriveAESKey(key)
+// 密文格式
+//
+//	v2:base64(nonce || ciphertext)   AES-256-GCM，附加数据 = 表名\x00行 ID\x00字段名
+//	base64(nonce || ciphertext)      旧格式（v1），无版本前缀、无附加数据，只读
+//
+// 附加数据把密文绑定到所在位置，把一行的密文挪到另一行或另一个字段会解密失败。
+const (
+	VersionV2 = "v2"
 
-	block, err := aes.NewCipher(keyBytes)
-	if err != nil {
-		return "", err
+	v2Prefix = VersionV2 + ":"
+)
+
+// AAD 密文所在位置，作为 GCM 附加数据参与认证；零值表示不附加数据
+type AAD struct {
+	Table string
+	RowID string
+	Field string
+}
+
+func (a AAD) bytes() []byte {
+	if a == (AAD{}) {
+		return nil
 	}
+	return []byte(a.Table + "\x00" + a.RowID + "\x00" + a.Field)
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+// IsLegacy 判断密文是否为无版本前缀的旧格式
+func IsLegacy(ciphertext string) bool {
+	return ciphertext != "" && !strings.HasPrefix(ciphertext, v2Prefix)
+}
+
+// Cipher 持有派生好的 AES 密钥对应的 AEAD，构造一次后可被多个请求并发复用，
+// 避免每个字段加解密都重新跑一遍 PBKDF2。
+type Cipher struct {
+	aead     cipher.AEAD
+	previous []cipher.AEAD
+}
+
+// NewCipher 用 kdf 从密钥派生 AES-256-GCM，密钥派生只在这里执行一次。
+// previous 为轮换前的旧密钥，当前密钥解不开时依次尝试，保证轮换过程中旧数据仍可读。
+func NewCipher(kdf KDF, key string, previous ...string) *Cipher {
+	c := &Cipher{aead: newGCM(kdf.Derive(key))}
+	for _, prev := range previous {
+		if prev == "" || prev == key {
+			continue
+		}
+		c.previous = append(c.previous, newGCM(kdf.Derive(prev)))
+	}
+	return c
+}
+
+// NewDataKeyCipher 把 GenerateDataKey 生成的 DEK 直接作为 AES-256-GCM 密钥。
+// DEK 已是均匀随机的 32 字节，不需要也不应再经过 KDF 拉伸
+func NewDataKeyCipher(dek string) (*Cipher, error) {
+	key, err := hex.DecodeString(dek)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("invalid data key")
 	}
+	return &Cipher{aead: newGCM(key)}, nil
+}
 
-	nonce := make([]byte, gcm.NonceSize())
+// Current 返回只使用当前密钥、不回退到旧密钥的 Cipher
+func (c *Cipher) Current() *Cipher {
+	return &Cipher{aead: c.aead}
+}
+
+// Encrypt 使用 AES-256-GCM 加密数据，输出 v2 格式并绑定 aad
+func (c *Cipher) Encrypt(plaintext string, aad AAD) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	ciphertext := c.aead.Seal(nonce, nonce, []byte(plaintext), aad.bytes())
+	return v2Prefix + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt 使用 AES-256-GCM 解密数据
-func Decrypt(ciphertext string, key string) (string, error) {
+// Decrypt 使用 AES-256-GCM 解密数据，兼容旧格式
+func (c *Cipher) Decrypt(ciphertext string, aad AAD) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
 
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	var additional []byte
+	encoded := ciphertext
+	if strings.HasPrefix(ciphertext, v2Prefix) {
+		encoded = strings.TrimPrefix(ciphertext, v2Prefix)
+		additional = aad.bytes()
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", err
 	}
 
-	keyBytes := deriveAESKey(key)
+	plaintext, err := open(c.aead, data, additional)
+	if err == nil {
+		return plaintext, nil
+	}
+	for _, prev := range c.previous {
+		if plaintext, prevErr := open(prev, data, additional); prevErr == nil {
+			return plaintext, nil
+		}
+	}
+	return "", err
+}
 
-	block, err := aes.NewCipher(keyBytes)
-	if err != nil {
-		return "", err
+// EncryptField 加密单个字段，空字符串返回空字符串
+func (c *Cipher) EncryptField(plaintext string, aad AAD) (string, error) {
+	if plaintext == "" {
+		return "", nil
 	}
+	return c.Encrypt(plaintext, aad)
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+// DecryptField 解密单个字段，空字符串返回空字符串
+func (c *Cipher) DecryptField(ciphertext string, aad AAD) (string, error) {
+	if ciphertext == "" {
+		return "", nil
 	}
+	return c.Decrypt(ciphertext, aad)
+}
 
-	nonceSize := gcm.NonceSize()
+func open(aead cipher.AEAD, data []byte, additional []byte) (string, error) {
+	nonceSize := aead.NonceSize()
 	if len(data) < nonceSize {
 		return "", errors.New("ciphertext too short")
 	}
 
 	nonce, cipherData := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, cipherData, nil)
+	plaintext, err := aead.Open(nil, nonce, cipherData, additional)
 	if err != nil {
 		return "", err
 	}
@@ -98,25 +183,15 @@ func Decrypt(ciphertext string, key string) (string, error) {
 	return string(plaintext), nil
 }
 
-// deriveAESKey 从任意长度的密钥派生 32 字节的 AES 密钥
-// 使用 PBKDF2 增强安全性
-func deriveAESKey(key string) []byte {
-	const aesKeySalt = "subvault-aes-key-salt-v1"
-	return pbkdf2.Key([]byte(key), []byte(aesKeySalt), 100000, 32, sha256.New)
-}
-
-// EncryptField 加密单个字段，空字符串返回空字符串
-func EncryptField(plaintext, key string) (string, error) {
-	if plaintext == "" {
-		return "", nil
+func newGCM(aesKey []byte) cipher.AEAD {
+	// 派生密钥固定 32 字节、GCM 使用标准 nonce 长度，这里不会出错
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		panic(err)
 	}
-	return Encrypt(plaintext, key)
-}
-
-// DecryptField 解密单个字段，空字符串返回空字符串
-func DecryptField(ciphertext, key string) (string, error) {
-	if ciphertext == "" {
-		return "", nil
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
 	}
-	return Decrypt(ciphertext, key)
+	return gcm
 }
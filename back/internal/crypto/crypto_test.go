@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKey = "test-encryption-key"
+
+var testAAD = AAD{Table: "credentials", RowID: "row-1", Field: "password"}
+
+var testKDF = KDF{
+	Params: KDFParams{Algorithm: KDFArgon2id, Time: 1, MemoryKiB: 1024, Threads: 1},
+	Salt:   []byte("0123456789abcdef"),
+}
+
+// sealLegacy 生成旧格式密文：无版本前缀、无附加数据
+func sealLegacy(t *testing.T, c *Cipher, plaintext string) string {
+	out, err := c.Encrypt(plaintext, AAD{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(out, v2Prefix)
+}
+
+func TestEncryptWritesVersionedCiphertext(t *testing.T) {
+	c := NewCipher(testKDF, testKey)
+	ct, err := c.Encrypt("hunter2", testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ct, "v2:") || IsLegacy(ct) {
+		t.Fatalf("密文应带 v2 前缀: %q", ct)
+	}
+	got, err := c.Decrypt(ct, testAAD)
+	if err != nil || got != "hunter2" {
+		t.Fatalf("解密失败: %q %v", got, err)
+	}
+	// 同一个密钥重新构造的 Cipher 应能解开
+	if got, err := NewCipher(testKDF, testKey).Decrypt(ct, testAAD); err != nil || got != "hunter2" {
+		t.Fatalf("新构造的 Cipher 解密失败: %q %v", got, err)
+	}
+}
+
+func TestDecryptRejectsMovedCiphertext(t *testing.T) {
+	c := NewCipher(testKDF, testKey)
+	ct, err := c.Encrypt("hunter2", testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, aad := range []AAD{
+		{Table: "credentials", RowID: "row-2", Field: "password"},
+		{Table: "credentials", RowID: "row-1", Field: "notes"},
+		{Table: "memos", RowID: "row-1", Field: "password"},
+	} {
+		if _, err := c.Decrypt(ct, aad); err == nil {
+			t.Fatalf("挪到 %+v 的密文不应能解密", aad)
+		}
+	}
+}
+
+func TestDecryptReadsLegacyCiphertext(t *testing.T) {
+	c := NewCipher(testKDF, testKey)
+	legacy := sealLegacy(t, c, "hunter2")
+	if !IsLegacy(legacy) {
+		t.Fatal("无前缀密文应识别为旧格式")
+	}
+	got, err := c.Decrypt(legacy, testAAD)
+	if err != nil || got != "hunter2" {
+		t.Fatalf("旧格式密文应可读: %q %v", got, err)
+	}
+}
+
+func TestDecryptFallsBackToPreviousKeys(t *testing.T) {
+	value, err := NewCipher(testKDF, "old-key").Encrypt("secret", testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCipher(testKDF, testKey).DecryptField(value, testAAD); err == nil {
+		t.Fatal("没有旧密钥时应解密失败")
+	}
+	rotating := NewCipher(testKDF, testKey, "old-key")
+	got, err := rotating.DecryptField(value, testAAD)
+	if err != nil || got != "secret" {
+		t.Fatalf("应回退到旧密钥解密: %q %v", got, err)
+	}
+	if _, err := rotating.Current().DecryptField(value, testAAD); err == nil {
+		t.Fatal("Current 不应回退到旧密钥")
+	}
+}
+
+func BenchmarkCipherDecrypt(b *testing.B) {
+	c := NewCipher(testKDF, testKey)
+	ct, err := c.Encrypt("hunter2", testAAD)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Decrypt(ct, testAAD); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDataKeyCipherUsesKeyDirectly(t *testing.T) {
+	dek, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDataKeyCipher(dek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := c.Encrypt("hunter2", testAAD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Decrypt(ct, testAAD); err != nil || got != "hunter2" {
+		t.Fatalf("解密失败: %q %v", got, err)
+	}
+	// 不经过 KDF：按参数从 DEK 派生的密钥解不开
+	if _, err := NewCipher(testKDF, dek).Decrypt(ct, testAAD); err == nil {
+		t.Fatal("DEK 应直接作为 AES 密钥，而不是再派生")
+	}
+	for _, bad := range []string{"", "not-hex", dek[:32]} {
+		if _, err := NewDataKeyCipher(bad); err == nil {
+			t.Fatalf("无效的数据密钥应报错: %q", bad)
+		}
+	}
+}
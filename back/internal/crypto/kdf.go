@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	KDFArgon2id = "argon2id"
+	KDFPBKDF2   = "pbkdf2-sha256" // 旧算法，只用于读取迁移前的数据
+
+	// legacyAESKeySalt 旧版本所有安装共用的固定盐值
+	legacyAESKeySalt = "subvault-aes-key-salt-v1"
+)
+
+// KDFParams 密钥派生算法及参数，编码后随保险库保存（Vault.KDF）
+type KDFParams struct {
+	Algorithm string
+	Time      uint32 // Argon2id 迭代次数；PBKDF2 为迭代轮数
+	MemoryKiB uint32 // Argon2id 内存开销（KiB）
+	Threads   uint8  // Argon2id 并行度
+}
+
+// LegacyKDFParams 迁移前使用的 PBKDF2-SHA256 参数
+var LegacyKDFParams = KDFParams{Algorithm: KDFPBKDF2, Time: 100000}
+
+// DefaultKDFParams Argon2id 默认参数：64 MiB 内存、3 次迭代、4 线程
+var DefaultKDFParams = KDFParams{Algorithm: KDFArgon2id, Time: 3, MemoryKiB: 64 * 1024, Threads: 4}
+
+// String 编码为 PHC 风格字符串，例如 argon2id$v=19$m=65536,t=3,p=4
+func (p KDFParams) String() string {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		return fmt.Sprintf("%s$v=%d$m=%d,t=%d,p=%d", KDFArgon2id, argon2.Version, p.MemoryKiB, p.Time, p.Threads)
+	case KDFPBKDF2:
+		return fmt.Sprintf("%s$i=%d", KDFPBKDF2, p.Time)
+	}
+	return ""
+}
+
+// Validate 检查参数是否可用
+func (p KDFParams) Validate() error {
+	switch p.Algorithm {
+	case KDFArgon2id:
+		if p.Time == 0 || p.Threads == 0 || p.MemoryKiB < 8*uint32(p.Threads) {
+			return fmt.Errorf("invalid argon2id params: %s", p)
+		}
+	case KDFPBKDF2:
+		if p.Time == 0 {
+			return fmt.Errorf("invalid pbkdf2 params: %s", p)
+		}
+	default:
+		return fmt.Errorf("unknown kdf algorithm %q", p.Algorithm)
+	}
+	return nil
+}
+
+// ParseKDFParams 解析 String 的输出；空字符串表示迁移前的保险库，返回 LegacyKDFParams
+func ParseKDFParams(s string) (KDFParams, error) {
+	if s == "" {
+		return LegacyKDFParams, nil
+	}
+	parts := strings.Split(s, "$")
+	var p KDFParams
+	switch {
+	case parts[0] == KDFArgon2id && len(parts) == 3:
+		var version int
+		if _, err := fmt.Sscanf(parts[1], "v=%d", &version); err != nil || version != argon2.Version {
+			return KDFParams{}, fmt.Errorf("unsupported argon2 version in %q", s)
+		}
+		p.Algorithm = KDFArgon2id
+		if _, err := fmt.Sscanf(parts[2], "m=%d,t=%d,p=%d", &p.MemoryKiB, &p.Time, &p.Threads); err != nil {
+			return KDFParams{}, fmt.Errorf("invalid kdf params %q: %w", s, err)
+		}
+	case parts[0] == KDFPBKDF2 && len(parts) == 2:
+		p.Algorithm = KDFPBKDF2
+		if _, err := fmt.Sscanf(parts[1], "i=%d", &p.Time); err != nil {
+			return KDFParams{}, fmt.Errorf("invalid kdf params %q: %w", s, err)
+		}
+	default:
+		return KDFParams{}, fmt.Errorf("invalid kdf params %q", s)
+	}
+	if err := p.Validate(); err != nil {
+		return KDFParams{}, err
+	}
+	return p, nil
+}
+
+// KDF 派生参数加上本安装的随机盐值
+type KDF struct {
+	Params KDFParams
+	Salt   []byte // 每个安装首次启动时随机生成，之后固定不变；旧算法忽略，使用固定盐值
+}
+
+// LegacyKDF 迁移前的派生方式：PBKDF2-SHA256 + 固定盐值
+var LegacyKDF = KDF{Params: LegacyKDFParams}
+
+// Derive 从任意长度的密钥派生 32 字节的 AES 密钥
+func (k KDF) Derive(secret string) []byte {
+	p := k.Params
+	if p.Algorithm == KDFArgon2id {
+		return argon2.IDKey([]byte(secret), k.Salt, p.Time, p.MemoryKiB, p.Threads, 32)
+	}
+	return pbkdf2.Key([]byte(secret), []byte(legacyAESKeySalt), int(p.Time), 32, sha256.New)
+}
+
+// GenerateSalt 生成安装级随机盐值，以十六进制字符串返回
+func GenerateSalt() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// DecodeSalt 解析 GenerateSalt 生成的盐值
+func DecodeSalt(s string) ([]byte, error) {
+	salt, err := hex.DecodeString(s)
+	if err != nil || len(salt) < 16 {
+		return nil, errors.New("invalid install salt")
+	}
+	return salt, nil
+}
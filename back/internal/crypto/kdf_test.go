@@ -0,0 +1,45 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestKDFParamsRoundTrip(t *testing.T) {
+	for _, p := range []KDFParams{DefaultKDFParams, LegacyKDFParams, testKDF.Params} {
+		got, err := ParseKDFParams(p.String())
+		if err != nil || got != p {
+			t.Fatalf("%s 解析结果不一致: %+v %v", p, got, err)
+		}
+	}
+	if got, err := ParseKDFParams(""); err != nil || got != LegacyKDFParams {
+		t.Fatalf("空字符串应视为旧版 PBKDF2: %+v %v", got, err)
+	}
+	for _, bad := range []string{"argon2id$v=19$m=0,t=1,p=1", "argon2id$v=16$m=1024,t=1,p=1", "scrypt$n=1", "argon2id"} {
+		if _, err := ParseKDFParams(bad); err == nil {
+			t.Fatalf("%q 应解析失败", bad)
+		}
+	}
+}
+
+func TestLegacyKDFMatchesPreviousDerivation(t *testing.T) {
+	// 迁移前的数据必须仍能用 LegacyKDF 派生出相同的密钥
+	want := pbkdf2.Key([]byte("secret"), []byte("subvault-aes-key-salt-v1"), 100000, 32, sha256.New)
+	if !bytes.Equal(LegacyKDF.Derive("secret"), want) {
+		t.Fatal("LegacyKDF 与旧的 PBKDF2 派生结果不一致")
+	}
+}
+
+func TestArgon2idUsesInstallSalt(t *testing.T) {
+	other := testKDF
+	other.Salt = []byte("fedcba9876543210")
+	if bytes.Equal(testKDF.Derive("secret"), other.Derive("secret")) {
+		t.Fatal("不同安装的盐值应派生出不同的密钥")
+	}
+	if !bytes.Equal(testKDF.Derive("secret"), testKDF.Derive("secret")) {
+		t.Fatal("相同盐值和参数应派生出相同的密钥")
+	}
+}
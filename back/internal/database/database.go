@@ -1,58 +1,87 @@
 package database
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"subvault/internal/crypto"
 	"subvault/internal/models"
 
 	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// 支持的数据库方言，与 gorm Dialector.Name() 一致
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+)
 
-func Init(dbPath string) error {
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+// Dialect 根据连接目标判断方言：postgres:// 或 postgresql:// 开头的是 PostgreSQL 连接串，其余视为 SQLite 文件路径
+func Dialect(target string) string {
+	if strings.HasPrefix(target, "postgres://") || strings.HasPrefix(target, "postgresql://") {
+		return DialectPostgres
 	}
+	return DialectSQLite
+}
 
-	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+// Init 打开数据库并执行待执行的迁移。返回的连接由 main 注入到路由和后台任务，包内不保存全局连接。
+func Init(target string) (*gorm.DB, error) {
+	db, err := Open(target)
 	if err != nil {
-		return err
-	}
-
-	// 自动迁移
-	if err := DB.AutoMigrate(
-		&models.Vault{},
-		&models.Credential{},
-		&models.Subscription{},
-		&models.Tag{},
-		&models.NotificationSetting{},
-		&models.WebhookDelivery{},
-		&models.AIConfig{},
-		&models.AIChat{},
-		&models.AIReport{},
-		&models.Memo{},
-		&models.TotpSetting{},
-		&models.PriceHistory{},
-		&models.RenewalEvent{},
-		&models.TotpRecoveryCode{},
-	); err != nil {
-		return err
-	}
-
-	// 旧库 unique 不含 kind，重建以免试用/优惠提醒与续费提醒互相挡住
-	_ = DB.Exec("DROP INDEX IF EXISTS idx_webhook_delivery").Error
-	_ = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_delivery ON webhook_deliveries (vault_id, subscription_id, days_left, sent_date, kind)").Error
-	return nil
+		return nil, err
+	}
+	if _, err := Migrate(db, false); err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
-func GetDB() *gorm.DB {
-	return DB
+// Open 打开数据库但不执行迁移，供 migrate -dry-run 查看计划。
+// target 为 PostgreSQL 连接串或 SQLite 文件路径。
+func Open(target string) (*gorm.DB, error) {
+	cfg := &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}
+	if Dialect(target) == DialectPostgres {
+		return gorm.Open(postgres.Open(target), cfg)
+	}
+
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return gorm.Open(sqlite.Open(target), cfg)
+}
+
+// LoadInstallation 读取安装级设置，首次调用时随机生成 KDF 盐值并保存
+func LoadInstallation(db *gorm.DB) (models.Installation, error) {
+	var inst models.Installation
+	err := db.First(&inst, 1).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		salt, genErr := crypto.GenerateSalt()
+		if genErr != nil {
+			return inst, genErr
+		}
+		// 多个进程同时首次启动时只有一个能写入，其余读取已保存的盐值
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Installation{ID: 1, KDFSalt: salt}).Error; err != nil {
+			return inst, err
+		}
+		err = db.First(&inst, 1).Error
+	}
+	return inst, err
+}
+
+// InstallSalt 返回本安装的 KDF 盐值
+func InstallSalt(db *gorm.DB) ([]byte, error) {
+	inst, err := LoadInstallation(db)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecodeSalt(inst.KDFSalt)
 }
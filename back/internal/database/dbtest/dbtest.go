@@ -0,0 +1,62 @@
+// Package dbtest 为测试提供隔离的数据库连接目标，设置 TEST_DATABASE_URL 时使用 PostgreSQL。
+package dbtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Postgres 返回 TEST_DATABASE_URL，未设置时为空
+func Postgres() string {
+	return os.Getenv("TEST_DATABASE_URL")
+}
+
+// Target 返回可传给 database.Init 的连接目标和清理函数。
+// 设置了 TEST_DATABASE_URL 时在该库中新建一个独立 schema 并通过 search_path 指向它，
+// 否则返回一个临时 SQLite 文件。
+func Target(t testing.TB) (string, func()) {
+	if base := Postgres(); base != "" {
+		return postgresSchema(t, base)
+	}
+	f, err := os.CreateTemp("", "subvault_test_*.db")
+	if err != nil {
+		t.Fatalf("创建临时数据库失败: %v", err)
+	}
+	f.Close()
+	return f.Name(), func() { os.Remove(f.Name()) }
+}
+
+func postgresSchema(t testing.TB, base string) (string, func()) {
+	admin, err := gorm.Open(postgres.Open(base), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("连接 TEST_DATABASE_URL 失败: %v", err)
+	}
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	schema := "test_" + hex.EncodeToString(buf)
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("创建 schema 失败: %v", err)
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL 无效: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String(), func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew 数据库已被更新版本的程序迁移过，继续运行可能损坏数据
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// Migration 一个编号的升级迁移，对应 migrations/<方言> 目录下的 NNNN_name.sql。
+// 每个方言的目录须有相同编号和名称的迁移。
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Plan 迁移计划：当前版本、程序内置的最新版本和待执行的迁移
+type Plan struct {
+	Current int
+	Latest  int
+	// Legacy 数据库由引入版本化迁移之前的程序用 AutoMigrate 建立，需先补齐到基线
+	Legacy  bool
+	Pending []Migration
+}
+
+// Migrations 返回指定方言内置的全部迁移，按版本号升序，版本号必须从 1 开始连续
+func Migrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		num, label, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("迁移文件名应为 NNNN_name.sql: %s", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Migration{Version: version, Name: label, SQL: string(data)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("迁移版本号不连续: 期望 %d，实际 %d (%s)", i+1, m.Version, m.Name)
+		}
+	}
+	return out, nil
+}
+
+// PlanMigrations 读取数据库当前版本并计算待执行的迁移，不做任何修改。
+// 数据库版本高于程序内置的最新版本时返回 ErrSchemaTooNew。
+func PlanMigrations(db *gorm.DB) (Plan, error) {
+	all, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return Plan{}, err
+	}
+	plan := Plan{Latest: len(all)}
+
+	if db.Migrator().HasTable(&models.SchemaVersion{}) {
+		var current *int
+		if err := db.Model(&models.SchemaVersion{}).Select("MAX(version)").Scan(&current).Error; err != nil {
+			return Plan{}, err
+		}
+		if current != nil {
+			plan.Current = *current
+		}
+	} else {
+		// 版本化迁移之前只支持 SQLite
+		plan.Legacy = db.Dialector.Name() == DialectSQLite && db.Migrator().HasTable(&models.Vault{})
+	}
+
+	if plan.Current > plan.Latest {
+		return plan, fmt.Errorf("%w: 数据库为版本 %d，本程序最高支持 %d", ErrSchemaTooNew, plan.Current, plan.Latest)
+	}
+	plan.Pending = all[plan.Current:]
+	return plan, nil
+}
+
+// Migrate 依次执行待执行的迁移，每个迁移和它的版本记录在同一事务内提交。
+// dryRun 为 true 时只返回计划，不修改数据库。
+func Migrate(db *gorm.DB, dryRun bool) (Plan, error) {
+	plan, err := PlanMigrations(db)
+	if err != nil || dryRun {
+		return plan, err
+	}
+
+	if !db.Migrator().HasTable(&models.SchemaVersion{}) {
+		if err := db.Migrator().CreateTable(&models.SchemaVersion{}); err != nil {
+			return plan, err
+		}
+	}
+	for _, m := range plan.Pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range Statements(m.SQL) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			// 旧库的表已存在，基线只会补上缺少的表和索引，缺少的列在这里补齐
+			if m.Version == 1 && plan.Legacy {
+				if err := addMissingColumns(tx, m.SQL); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&models.SchemaVersion{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return plan, fmt.Errorf("迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+	}
+	return plan, nil
+}
+
+// Statements 按行尾分号拆分迁移脚本，忽略 -- 注释行
+func Statements(script string) []string {
+	var out []string
+	var buf strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			out = append(out, strings.TrimSpace(buf.String()))
+			buf.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(buf.String()); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+// addMissingColumns 在内存库中建立基线，把旧库各表缺少的列按基线定义补上。
+// SQLite 不能追加没有默认值的 NOT NULL 列，这类列补上时去掉 NOT NULL。
+func addMissingColumns(tx *gorm.DB, baseline string) error {
+	scratch, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := scratch.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	for _, stmt := range Statements(baseline) {
+		if err := scratch.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	tables, err := scratch.Migrator().GetTables()
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		want, err := tableColumns(scratch, table)
+		if err != nil {
+			return err
+		}
+		have, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		for _, col := range want {
+			if _, ok := have[col.Name]; ok || col.PK > 0 {
+				continue
+			}
+			def := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, col.Name, col.Type)
+			if col.Default != nil {
+				def += " DEFAULT " + *col.Default
+				if col.NotNull {
+					def += " NOT NULL"
+				}
+			}
+			if err := tx.Exec(def).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// columnInfo PRAGMA table_info 的一行
+type columnInfo struct {
+	Name    string  `gorm:"column:name"`
+	Type    string  `gorm:"column:type"`
+	NotNull bool    `gorm:"column:notnull"`
+	Default *string `gorm:"column:dflt_value"`
+	PK      int     `gorm:"column:pk"`
+}
+
+func tableColumns(db *gorm.DB, table string) (map[string]columnInfo, error) {
+	var cols []columnInfo
+	if err := db.Raw(fmt.Sprintf("PRAGMA table_info(`%s`)", table)).Scan(&cols).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]columnInfo, len(cols))
+	for _, col := range cols {
+		out[col.Name] = col
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"subvault/internal/database/dbtest"
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// allModels 全部持久化模型；新增模型或字段时须同时新增迁移
+var allModels = []interface{}{
+	&models.Vault{},
+	&models.Credential{},
+	&models.Subscription{},
+	&models.Tag{},
+	&models.NotificationSetting{},
+	&models.WebhookDelivery{},
+	&models.AIConfig{},
+	&models.AIChat{},
+	&models.AIReport{},
+	&models.Memo{},
+	&models.TotpSetting{},
+	&models.PriceHistory{},
+	&models.RenewalEvent{},
+	&models.TotpRecoveryCode{},
+	&models.Session{},
+	&models.Installation{},
+	&models.User{},
+	&models.Collection{},
+	&models.CollectionMember{},
+	&models.APIToken{},
+	&models.WebAuthnCredential{},
+	&models.WebAuthnChallenge{},
+	&models.LoginFailure{},
+	&models.AuditEvent{},
+	&models.CredentialHistory{},
+	&models.IdempotencyKey{},
+	&models.SyncRemoval{},
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	checkMigratedSchema(t, openTestDB(t))
+}
+
+// TestPostgresMigrationsMatchModels 需要 TEST_DATABASE_URL 指向可建 schema 的 PostgreSQL
+func TestPostgresMigrationsMatchModels(t *testing.T) {
+	if dbtest.Postgres() == "" {
+		t.Skip("未设置 TEST_DATABASE_URL")
+	}
+	target, cleanup := dbtest.Target(t)
+	defer cleanup()
+	db, err := gorm.Open(postgres.Open(target), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	checkMigratedSchema(t, db)
+}
+
+func TestDialectsHaveSameMigrations(t *testing.T) {
+	lite, err := Migrations(DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg, err := Migrations(DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lite) != len(pg) {
+		t.Fatalf("SQLite 有 %d 个迁移，PostgreSQL 有 %d 个", len(lite), len(pg))
+	}
+	for i := range lite {
+		if lite[i].Name != pg[i].Name {
+			t.Fatalf("迁移 %d 名称不一致: %s / %s", lite[i].Version, lite[i].Name, pg[i].Name)
+		}
+	}
+}
+
+// checkMigratedSchema 在空库上执行全部迁移，检查每个模型的每个字段都有对应的列
+func checkMigratedSchema(t *testing.T, db *gorm.DB) {
+	plan, err := Migrate(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Legacy || plan.Current != 0 || len(plan.Pending) != plan.Latest {
+		t.Fatalf("新库应执行全部迁移: %+v", plan)
+	}
+
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Fatalf("迁移后缺少表 %s", stmt.Schema.Table)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("迁移后表 %s 缺少列 %s", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
+	// 审计日志由触发器保证只能追加，绕过模型钩子直接执行 SQL 也改不了
+	if err := db.Create(&models.AuditEvent{VaultID: "v1", Action: "vault.unlock", Outcome: "failure"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE audit_events SET outcome = 'success'").Error; err == nil {
+		t.Error("审计日志不应允许 UPDATE")
+	}
+	if err := db.Exec("DELETE FROM audit_events").Error; err == nil {
+		t.Error("审计日志不应允许 DELETE")
+	}
+	var outcome string
+	db.Raw("SELECT outcome FROM audit_events").Scan(&outcome)
+	if outcome != "failure" {
+		t.Fatalf("审计日志应保持原样: %q", outcome)
+	}
+
+	// 再次执行不应有待执行的迁移
+	plan, err = Migrate(db, false)
+	if err != nil || len(plan.Pending) != 0 || plan.Current != plan.Latest {
+		t.Fatalf("重复执行应为空操作: %+v %v", plan, err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	db := openTestDB(t)
+	plan, err := Migrate(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Pending) == 0 || plan.Pending[0].Version != 1 {
+		t.Fatalf("应列出全部迁移: %+v", plan)
+	}
+	if db.Migrator().HasTable(&models.SchemaVersion{}) || db.Migrator().HasTable(&models.Vault{}) {
+		t.Fatal("dry-run 不应修改数据库")
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := openTestDB(t)
+	plan, err := Migrate(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.SchemaVersion{Version: plan.Latest + 1, Name: "future", AppliedAt: time.Now()})
+
+	if _, err := Migrate(db, false); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("数据库版本更新时应拒绝运行: %v", err)
+	}
+	if _, err := Migrate(db, true); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("dry-run 也应报告版本过新: %v", err)
+	}
+}
+
+func TestMigrateAdoptsLegacySchema(t *testing.T) {
+	db := openTestDB(t)
+	// 早期版本的表：缺少 kdf 列和 kind 列，唯一索引不含 kind
+	db.Exec("CREATE TABLE `vaults` (`id` text,`key_hash` text NOT NULL,`key_bcrypt` text,`data_key` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`))")
+	db.Exec("CREATE TABLE `webhook_deliveries` (`id` text,`vault_id` text NOT NULL,`subscription_id` text NOT NULL,`days_left` integer,`sent_date` text,`created_at` datetime,PRIMARY KEY (`id`))")
+	db.Exec("CREATE UNIQUE INDEX idx_webhook_delivery ON webhook_deliveries (vault_id, subscription_id, days_left, sent_date)")
+	db.Exec("INSERT INTO vaults (id, key_hash) VALUES ('v1', 'hash')")
+
+	plan, err := Migrate(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Legacy {
+		t.Fatal("应识别为旧库")
+	}
+	if !db.Migrator().HasColumn(&models.Vault{}, "kdf") || !db.Migrator().HasColumn(&models.WebhookDelivery{}, "kind") {
+		t.Fatal("应补齐旧库缺少的列")
+	}
+	if !db.Migrator().HasTable(&models.AuditEvent{}) {
+		t.Fatal("应补齐旧库缺少的表")
+	}
+	var count int64
+	db.Model(&models.Vault{}).Count(&count)
+	if count != 1 {
+		t.Fatal("旧库数据应保留")
+	}
+
+	var indexSQL string
+	db.Raw("SELECT sql FROM sqlite_master WHERE name = 'idx_webhook_delivery'").Scan(&indexSQL)
+	if !strings.Contains(indexSQL, "kind") {
+		t.Fatalf("唯一索引应包含 kind: %s", indexSQL)
+	}
+	// 同一天同一订阅的续费提醒和试用提醒可以共存
+	db.Create(&models.WebhookDelivery{VaultID: "v1", SubscriptionID: "s1", DaysLeft: 1, SentDate: "2024-01-01", Kind: "renewal"})
+	if err := db.Create(&models.WebhookDelivery{VaultID: "v1", SubscriptionID: "s1", DaysLeft: 1, SentDate: "2024-01-01", Kind: "trial"}).Error; err != nil {
+		t.Fatalf("不同类型的提醒不应冲突: %v", err)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	got := Statements("-- 注释\nCREATE TABLE a (\n  id text\n);\n\nDROP INDEX b;\n")
+	if len(got) != 2 || !strings.HasPrefix(got[0], "CREATE TABLE a (") || got[1] != "DROP INDEX b;" {
+		t.Fatalf("Statements = %q", got)
+	}
+}
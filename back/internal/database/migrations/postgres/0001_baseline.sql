@@ -0,0 +1,342 @@
+-- 基线：与 SQLite 基线相同的表结构，类型换成 PostgreSQL 对应的类型
+
+CREATE TABLE IF NOT EXISTS "vaults" (
+    "id" text,
+    "key_hash" text NOT NULL,
+    "key_bcrypt" text,
+    "data_key" text,
+    "kdf" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_vaults_key_hash" ON "vaults"("key_hash");
+
+CREATE TABLE IF NOT EXISTS "credentials" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "username" text NOT NULL,
+    "password" text,
+    "label" text NOT NULL,
+    "notes" text,
+    "website" text,
+    "category" text DEFAULT '其他',
+    "collection_id" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_credentials_collection_id" ON "credentials"("collection_id");
+CREATE INDEX IF NOT EXISTS "idx_credentials_vault_id" ON "credentials"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "subscriptions" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "name" text NOT NULL,
+    "cost" double precision NOT NULL,
+    "currency" text DEFAULT 'CNY',
+    "frequency_amount" bigint DEFAULT 1,
+    "frequency_unit" text DEFAULT 'MONTHS',
+    "renewal_date" text,
+    "start_date" text,
+    "category" text DEFAULT '生活',
+    "credential_id" text,
+    "website" text,
+    "active" boolean DEFAULT true,
+    "auto_rotate" boolean DEFAULT false,
+    "status" text DEFAULT 'active',
+    "payment_method" text,
+    "card_last4" text,
+    "cancel_url" text,
+    "trial_ends_on" text,
+    "promo_ends_on" text,
+    "reminder_days" text,
+    "notes" text,
+    "collection_id" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_subscriptions_vault_id" ON "subscriptions"("vault_id");
+CREATE INDEX IF NOT EXISTS "idx_subscriptions_collection_id" ON "subscriptions"("collection_id");
+
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "name" text NOT NULL,
+    "color" text DEFAULT '#3B82F6',
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_tags_vault_id" ON "tags"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "subscription_tags" (
+    "subscription_id" text,
+    "tag_id" text,
+    PRIMARY KEY ("subscription_id","tag_id"),
+    CONSTRAINT "fk_subscription_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id"),
+    CONSTRAINT "fk_subscription_tags_subscription" FOREIGN KEY ("subscription_id") REFERENCES "subscriptions"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "notification_settings" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "enabled" boolean DEFAULT true,
+    "days_before_list" text DEFAULT '1,3,7',
+    "webhook_enabled" boolean DEFAULT false,
+    "webhook_url" text,
+    "webhook_platform" text DEFAULT 'auto',
+    "webhook_days_before" text DEFAULT '1,2,3',
+    "webhook_secret" text,
+    "calendar_token" text,
+    "base_currency" text DEFAULT 'CNY',
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_notification_settings_vault_id" ON "notification_settings"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "subscription_id" text NOT NULL,
+    "days_left" bigint,
+    "sent_date" text,
+    "kind" text DEFAULT 'renewal',
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "ai_configs" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "base_url" text,
+    "api_key" text,
+    "model" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_ai_configs_vault_id" ON "ai_configs"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "ai_chats" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "role" text NOT NULL,
+    "content" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_ai_chats_vault_id" ON "ai_chats"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "ai_reports" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "total_monthly" double precision,
+    "total_yearly" double precision,
+    "categories" text,
+    "insights" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_ai_reports_vault_id" ON "ai_reports"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "memos" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "title" text NOT NULL,
+    "content" text,
+    "category" text DEFAULT '其他',
+    "is_pinned" boolean DEFAULT false,
+    "collection_id" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_memos_collection_id" ON "memos"("collection_id");
+CREATE INDEX IF NOT EXISTS "idx_memos_vault_id" ON "memos"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "totp_settings" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "secret" text NOT NULL,
+    "enabled" boolean DEFAULT true,
+    "verified" boolean DEFAULT false,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_totp_settings_vault_id" ON "totp_settings"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "price_histories" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "subscription_id" text NOT NULL,
+    "old_cost" double precision,
+    "new_cost" double precision,
+    "currency" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_price_histories_subscription_id" ON "price_histories"("subscription_id");
+CREATE INDEX IF NOT EXISTS "idx_price_histories_vault_id" ON "price_histories"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "renewal_events" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "subscription_id" text NOT NULL,
+    "amount" double precision,
+    "currency" text,
+    "occurred_on" text,
+    "source" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_renewal_events_occurred_on" ON "renewal_events"("occurred_on");
+CREATE INDEX IF NOT EXISTS "idx_renewal_events_subscription_id" ON "renewal_events"("subscription_id");
+CREATE INDEX IF NOT EXISTS "idx_renewal_events_vault_id" ON "renewal_events"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "totp_recovery_codes" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "code_hash" text NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_totp_recovery_codes_vault_id" ON "totp_recovery_codes"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "refresh_hash" text NOT NULL,
+    "previous_hash" text,
+    "user_agent" text,
+    "ip" text,
+    "last_seen_at" timestamptz,
+    "expires_at" timestamptz,
+    "revoked_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_previous_hash" ON "sessions"("previous_hash");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_refresh_hash" ON "sessions"("refresh_hash");
+CREATE INDEX IF NOT EXISTS "idx_sessions_vault_id" ON "sessions"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "installations" (
+    "id" bigserial PRIMARY KEY,
+    "kdf_salt" text NOT NULL,
+    "registration_enabled" boolean DEFAULT false,
+    "created_at" timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" text,
+    "username" text NOT NULL,
+    "vault_id" text NOT NULL,
+    "is_admin" boolean DEFAULT false,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_vault_id" ON "users"("vault_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users"("username");
+
+CREATE TABLE IF NOT EXISTS "collections" (
+    "id" text,
+    "owner_vault_id" text NOT NULL,
+    "name" text NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_collections_owner_vault_id" ON "collections"("owner_vault_id");
+
+CREATE TABLE IF NOT EXISTS "collection_members" (
+    "id" text,
+    "collection_id" text NOT NULL,
+    "vault_id" text NOT NULL,
+    "role" text NOT NULL DEFAULT 'viewer',
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_collection_members_vault_id" ON "collection_members"("vault_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_collection_member" ON "collection_members"("collection_id","vault_id");
+
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "name" text NOT NULL,
+    "prefix" text,
+    "token_hash" text NOT NULL,
+    "scopes" text NOT NULL,
+    "expires_at" timestamptz,
+    "last_used_at" timestamptz,
+    "last_used_ip" text,
+    "revoked_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens"("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_vault_id" ON "api_tokens"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "web_authn_credentials" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "name" text NOT NULL,
+    "credential_id" text NOT NULL,
+    "public_key" bytea NOT NULL,
+    "sign_count" bigint,
+    "aa_guid" text,
+    "transports" text,
+    "passwordless" boolean DEFAULT false,
+    "device_secret_hash" text,
+    "last_used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_web_authn_credentials_credential_id" ON "web_authn_credentials"("credential_id");
+CREATE INDEX IF NOT EXISTS "idx_web_authn_credentials_vault_id" ON "web_authn_credentials"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "web_authn_challenges" (
+    "id" text,
+    "vault_id" text,
+    "challenge" text NOT NULL,
+    "purpose" text NOT NULL,
+    "expires_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_web_authn_challenges_expires_at" ON "web_authn_challenges"("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_web_authn_challenges_vault_id" ON "web_authn_challenges"("vault_id");
+
+CREATE TABLE IF NOT EXISTS "login_failures" (
+    "id" text,
+    "subject" text NOT NULL,
+    "failures" bigint,
+    "lockouts" bigint,
+    "locked_until" timestamptz,
+    "last_failure_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_login_failures_subject" ON "login_failures"("subject");
+
+CREATE TABLE IF NOT EXISTS "audit_events" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "actor_vault_id" text,
+    "action" text NOT NULL,
+    "outcome" text NOT NULL,
+    "target_id" text,
+    "detail" text,
+    "ip" text,
+    "user_agent" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_events_action" ON "audit_events"("action");
+CREATE INDEX IF NOT EXISTS "idx_audit_vault_time" ON "audit_events"("vault_id","created_at");
@@ -0,0 +1,3 @@
+-- 旧库的唯一索引不含 kind，试用/优惠提醒会与同一天的续费提醒互相挡住
+DROP INDEX IF EXISTS idx_webhook_delivery;
+CREATE UNIQUE INDEX idx_webhook_delivery ON webhook_deliveries (vault_id, subscription_id, days_left, sent_date, kind);
@@ -0,0 +1,4 @@
+-- 订阅、凭证、备忘录的版本号，每次修改加一，用于 If-Match 乐观并发控制
+ALTER TABLE "subscriptions" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "credentials" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "memos" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
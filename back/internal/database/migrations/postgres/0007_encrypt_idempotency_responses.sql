@@ -0,0 +1,3 @@
+-- 幂等键保存的响应改为用保险库数据密钥加密；此前以明文保存的响应（可能含解密后的密码）直接清除，
+-- 这些键在 24 小时内重试时按新请求处理
+DELETE FROM idempotency_keys;
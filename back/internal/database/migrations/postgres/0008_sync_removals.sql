@@ -0,0 +1,11 @@
+-- 记录从保险库视野中消失的日志（移出集合、退出集合、集合删除、彻底删除），供增量同步返回
+CREATE TABLE IF NOT EXISTS "sync_removals" (
+    "id" text,
+    "vault_id" text NOT NULL,
+    "kind" text NOT NULL,
+    "record_id" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sync_removals_vault_id" ON "sync_removals"("vault_id");
+CREATE INDEX IF NOT EXISTS "idx_sync_removals_created_at" ON "sync_removals"("created_at");
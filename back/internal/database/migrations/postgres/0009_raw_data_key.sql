@@ -0,0 +1,2 @@
+-- 数据密钥（DEK）直接作为 AES 密钥使用；false 表示本库密文仍用 Argon2id 从 DEK 派生的密钥加密，首次访问时改写
+ALTER TABLE "vaults" ADD COLUMN IF NOT EXISTS "raw_data_key" boolean NOT NULL DEFAULT false;
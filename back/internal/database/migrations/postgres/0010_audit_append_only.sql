@@ -0,0 +1,5 @@
+-- 审计日志只能追加：模型钩子之外，数据库层面也拒绝修改和删除，直接执行 SQL 同样无法篡改。
+-- 迁移脚本按行尾分号拆分语句，函数体须写在一行内
+CREATE OR REPLACE FUNCTION "audit_events_append_only"() RETURNS trigger AS $$ BEGIN RAISE EXCEPTION 'audit log is append-only'; END; $$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS "audit_events_append_only" ON "audit_events";
+CREATE TRIGGER "audit_events_append_only" BEFORE UPDATE OR DELETE ON "audit_events" FOR EACH ROW EXECUTE PROCEDURE "audit_events_append_only"();
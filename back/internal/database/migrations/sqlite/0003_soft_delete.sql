@@ -0,0 +1,9 @@
+-- 订阅、凭证、备忘录、分组改为软删除：删除时只写 deleted_at，回收站中可恢复，到期后由后台任务彻底清除
+ALTER TABLE `subscriptions` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_subscriptions_deleted_at` ON `subscriptions`(`deleted_at`);
+ALTER TABLE `credentials` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_credentials_deleted_at` ON `credentials`(`deleted_at`);
+ALTER TABLE `memos` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_memos_deleted_at` ON `memos`(`deleted_at`);
+ALTER TABLE `tags` ADD COLUMN `deleted_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_tags_deleted_at` ON `tags`(`deleted_at`);
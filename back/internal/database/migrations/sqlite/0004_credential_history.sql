@@ -0,0 +1,15 @@
+-- 凭证修改前的密码和备注，按所属保险库的数据密钥加密
+CREATE TABLE IF NOT EXISTS `credential_histories` (
+    `id` text,
+    `vault_id` text NOT NULL,
+    `credential_id` text NOT NULL,
+    `password` text,
+    `notes` text,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_credential_histories_credential_id` ON `credential_histories`(`credential_id`);
+CREATE INDEX IF NOT EXISTS `idx_credential_histories_vault_id` ON `credential_histories`(`vault_id`);
+
+-- 每条凭证保留的历史版本数，0 表示默认值
+ALTER TABLE `notification_settings` ADD COLUMN `password_history_limit` integer DEFAULT 0;
@@ -0,0 +1,13 @@
+-- 批量写接口的幂等键及保存的响应
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+    `id` text,
+    `vault_id` text NOT NULL,
+    `key` text NOT NULL,
+    `fingerprint` text NOT NULL,
+    `status_code` integer,
+    `response` text,
+    `created_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_idempotency_key` ON `idempotency_keys`(`vault_id`,`key`);
+CREATE INDEX IF NOT EXISTS `idx_idempotency_keys_created_at` ON `idempotency_keys`(`created_at`);
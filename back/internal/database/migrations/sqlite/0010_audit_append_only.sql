@@ -0,0 +1,4 @@
+-- 审计日志只能追加：模型钩子之外，数据库层面也拒绝修改和删除，直接执行 SQL 同样无法篡改。
+-- 迁移脚本按行尾分号拆分语句，触发器须写在一行内
+CREATE TRIGGER IF NOT EXISTS `audit_events_no_update` BEFORE UPDATE ON `audit_events` BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS `audit_events_no_delete` BEFORE DELETE ON `audit_events` BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
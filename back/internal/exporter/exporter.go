@@ -0,0 +1,258 @@
+// Package exporter 把凭证写成其他密码管理器能导入的格式：Bitwarden JSON、KeePass XML 和通用 CSV。
+// 只负责格式转换，输入的字段均为明文，取数据和身份确认由调用方负责。
+package exporter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Format 导出格式
+type Format string
+
+const (
+	FormatBitwardenJSON Format = "bitwarden-json"
+	FormatKeePassXML    Format = "keepass-xml"
+	FormatCSV           Format = "csv"
+)
+
+// ErrUnknownFormat 不支持的导出格式
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Item 一条待导出的凭证，字段均为明文
+type Item struct {
+	ID        string
+	Label     string
+	Username  string
+	Password  string
+	Website   string
+	Notes     string
+	Folder    string // 所在分组，多级时用 / 连接，为空表示不放入文件夹
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// File 导出结果
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// ParseFormat 校验请求中的格式名
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case FormatBitwardenJSON, FormatKeePassXML, FormatCSV:
+		return f, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Write 按格式生成导出文件，文件名带上导出日期
+func Write(format Format, items []Item, now time.Time) (File, error) {
+	name := "subvault-credentials-" + now.Format("20060102")
+	switch format {
+	case FormatBitwardenJSON:
+		data, err := writeBitwardenJSON(items)
+		return File{Name: name + ".json", ContentType: "application/json", Data: data}, err
+	case FormatKeePassXML:
+		data, err := writeKeePassXML(items, now)
+		return File{Name: name + ".xml", ContentType: "application/xml", Data: data}, err
+	case FormatCSV:
+		data, err := writeCSV(items)
+		return File{Name: name + ".csv", ContentType: "text/csv; charset=utf-8", Data: data}, err
+	}
+	return File{}, ErrUnknownFormat
+}
+
+type bitwardenFolder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type bitwardenURI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+type bitwardenItem struct {
+	ID             string  `json:"id"`
+	OrganizationID *string `json:"organizationId"`
+	FolderID       *string `json:"folderId"`
+	Type           int     `json:"type"`
+	Reprompt       int     `json:"reprompt"`
+	Name           string  `json:"name"`
+	Notes          *string `json:"notes"`
+	Favorite       bool    `json:"favorite"`
+	Login          struct {
+		URIs     []bitwardenURI `json:"uris"`
+		Username *string        `json:"username"`
+		Password *string        `json:"password"`
+		TOTP     *string        `json:"totp"`
+	} `json:"login"`
+	CollectionIDs []string `json:"collectionIds"`
+}
+
+// writeBitwardenJSON 生成 Bitwarden 未加密的个人导出格式，分组对应文件夹
+func writeBitwardenJSON(items []Item) ([]byte, error) {
+	export := struct {
+		Encrypted bool              `json:"encrypted"`
+		Folders   []bitwardenFolder `json:"folders"`
+		Items     []bitwardenItem   `json:"items"`
+	}{Folders: []bitwardenFolder{}, Items: []bitwardenItem{}}
+
+	folderIDs := map[string]string{}
+	for _, it := range items {
+		out := bitwardenItem{ID: it.ID, Type: 1, Name: it.Label, Notes: optional(it.Notes)}
+		if it.Folder != "" {
+			id, ok := folderIDs[it.Folder]
+			if !ok {
+				id = uuid.New().String()
+				folderIDs[it.Folder] = id
+				export.Folders = append(export.Folders, bitwardenFolder{ID: id, Name: it.Folder})
+			}
+			out.FolderID = &id
+		}
+		out.Login.Username = optional(it.Username)
+		out.Login.Password = optional(it.Password)
+		if it.Website != "" {
+			out.Login.URIs = []bitwardenURI{{URI: it.Website}}
+		}
+		export.Items = append(export.Items, out)
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// optional Bitwarden 用 null 表示空字段
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+type keePassString struct {
+	Key   string       `xml:"Key"`
+	Value keePassValue `xml:"Value"`
+}
+
+type keePassValue struct {
+	ProtectInMemory string `xml:"ProtectInMemory,attr,omitempty"`
+	Text            string `xml:",chardata"`
+}
+
+type keePassTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+}
+
+type keePassEntry struct {
+	UUID    string          `xml:"UUID"`
+	Times   keePassTimes    `xml:"Times"`
+	Strings []keePassString `xml:"String"`
+}
+
+type keePassGroup struct {
+	UUID    string          `xml:"UUID"`
+	Name    string          `xml:"Name"`
+	Entries []keePassEntry  `xml:"Entry"`
+	Groups  []*keePassGroup `xml:"Group"`
+}
+
+// writeKeePassXML 生成 KeePass 2.x 的 XML 导出格式。顶层分组是数据库本身，分组路径对应嵌套分组
+func writeKeePassXML(items []Item, now time.Time) ([]byte, error) {
+	root := &keePassGroup{UUID: keePassUUID(""), Name: "SubVault"}
+	groups := map[string]*keePassGroup{"": root}
+	var groupFor func(path string) *keePassGroup
+	groupFor = func(path string) *keePassGroup {
+		if g, ok := groups[path]; ok {
+			return g
+		}
+		parent, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, name = path[:i], path[i+1:]
+		}
+		g := &keePassGroup{UUID: keePassUUID(""), Name: name}
+		p := groupFor(parent)
+		p.Groups = append(p.Groups, g)
+		groups[path] = g
+		return g
+	}
+
+	for _, it := range items {
+		entry := keePassEntry{
+			UUID:  keePassUUID(it.ID),
+			Times: keePassTimes{CreationTime: keePassTime(it.CreatedAt, now), LastModificationTime: keePassTime(it.UpdatedAt, now)},
+			Strings: []keePassString{
+				{Key: "Title", Value: keePassValue{Text: it.Label}},
+				{Key: "UserName", Value: keePassValue{Text: it.Username}},
+				{Key: "Password", Value: keePassValue{ProtectInMemory: "True", Text: it.Password}},
+				{Key: "URL", Value: keePassValue{Text: it.Website}},
+				{Key: "Notes", Value: keePassValue{Text: it.Notes}},
+			},
+		}
+		g := groupFor(strings.Trim(it.Folder, "/"))
+		g.Entries = append(g.Entries, entry)
+	}
+
+	file := struct {
+		XMLName xml.Name `xml:"KeePassFile"`
+		Meta    struct {
+			Generator    string `xml:"Generator"`
+			DatabaseName string `xml:"DatabaseName"`
+		} `xml:"Meta"`
+		Root struct {
+			Group *keePassGroup `xml:"Group"`
+		} `xml:"Root"`
+	}{}
+	file.Meta.Generator = "SubVault"
+	file.Meta.DatabaseName = "SubVault"
+	file.Root.Group = root
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+	if err := enc.Encode(file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// keePassUUID KeePass 的 UUID 是 16 字节的 base64；记录 ID 不是 UUID 时随机生成
+func keePassUUID(id string) string {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		u = uuid.New()
+	}
+	return base64.StdEncoding.EncodeToString(u[:])
+}
+
+func keePassTime(t, fallback time.Time) string {
+	if t.IsZero() {
+		t = fallback
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvHeader 通用 CSV 的列，前四列与 Chrome 导出一致，Chromium 浏览器和多数密码管理器可直接导入
+var csvHeader = []string{"name", "url", "username", "password", "note", "folder"}
+
+func writeCSV(items []Item) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(csvHeader)
+	for _, it := range items {
+		w.Write([]string{it.Label, it.Website, it.Username, it.Password, it.Notes, it.Folder})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,61 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"subvault/internal/importer"
+)
+
+var sampleItems = []Item{
+	{ID: "5f0c1a3e-8d2b-4c6e-9a7f-1b2c3d4e5f60", Label: "GitHub", Username: "me", Password: `p"w,<&>`, Website: "https://github.com", Notes: "第一行\n第二行", Folder: "工作/开发"},
+	{ID: "legacy-id", Label: "Wi-Fi", Password: "12345678"},
+}
+
+// 导出的文件应能被对应格式的导入器原样读回
+func TestWriteRoundTripsThroughImporter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, c := range []struct {
+		format Format
+		parsed importer.Format
+	}{
+		{FormatBitwardenJSON, importer.FormatBitwardenJSON},
+		{FormatKeePassXML, importer.FormatKeePassXML},
+		{FormatCSV, importer.FormatChromeCSV},
+	} {
+		file, err := Write(c.format, sampleItems, now)
+		if err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		if !strings.HasPrefix(file.Name, "subvault-credentials-20260102.") {
+			t.Fatalf("%s: 文件名不正确: %s", c.format, file.Name)
+		}
+		if importer.Detect(file.Data) != c.parsed {
+			t.Fatalf("%s: 导出文件应被识别为 %s", c.format, c.parsed)
+		}
+		result, err := importer.Parse(c.parsed, file.Data)
+		if err != nil {
+			t.Fatalf("%s: 读回失败: %v", c.format, err)
+		}
+		if len(result.Items) != len(sampleItems) {
+			t.Fatalf("%s: 条目数不一致: %+v", c.format, result.Items)
+		}
+		// KeePass 按分组输出，顺序可能与输入不同，按名称对应
+		byLabel := map[string]Item{}
+		for _, it := range sampleItems {
+			byLabel[it.Label] = it
+		}
+		for i, got := range result.Items {
+			want := byLabel[got.Label]
+			if got.Label != want.Label || got.Username != want.Username || got.Password != want.Password ||
+				got.Website != want.Website || got.Notes != want.Notes || got.Folder != want.Folder {
+				t.Fatalf("%s: 第 %d 条不一致: %+v", c.format, i, got)
+			}
+		}
+	}
+
+	if _, err := ParseFormat("lastpass"); err != ErrUnknownFormat {
+		t.Fatalf("不支持的格式应返回 ErrUnknownFormat: %v", err)
+	}
+}
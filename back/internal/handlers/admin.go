@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"subvault/internal/accounts"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	db *gorm.DB
+}
+
+func NewAdminHandler(db *gorm.DB) *AdminHandler {
+	return &AdminHandler{db: db}
+}
+
+type RegistrationSetting struct {
+	Enabled bool `json:"enabled"`
+}
+
+// GetRegistration 查看是否允许新用户注册
+// GET /api/v1/admin/registration
+func (h *AdminHandler) GetRegistration(c *gin.Context) {
+	open, err := accounts.RegistrationOpen(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取注册状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, RegistrationSetting{Enabled: open})
+}
+
+// UpdateRegistration 开启或关闭新用户注册
+// PUT /api/v1/admin/registration
+func (h *AdminHandler) UpdateRegistration(c *gin.Context) {
+	var input RegistrationSetting
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设置"})
+		return
+	}
+	if err := accounts.SetRegistrationEnabled(h.db, input.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存注册设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, input)
+}
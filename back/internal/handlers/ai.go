@@ -10,19 +10,24 @@ import (
 	"strings"
 
 	"subvault/internal/config"
-	"subvault/internal/crypto"
-	"subvault/internal/database"
+	"subvault/internal/keyring"
 	"subvault/internal/models"
+	"subvault/internal/store"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type AIHandler struct {
-	cfg *config.Config
+	cfg   *config.Config
+	keys  *keyring.Keyring
+	db    *gorm.DB
+	store *store.Store
 }
 
-func NewAIHandler(cfg *config.Config) *AIHandler {
-	return &AIHandler{cfg: cfg}
+func NewAIHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB, st *store.Store) *AIHandler {
+	return &AIHandler{cfg: cfg, keys: keys, db: db, store: st}
 }
 
 // GetAIConfig 获取 AI 配置
@@ -30,7 +35,11 @@ func (h *AIHandler) GetAIConfig(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var aiConfig models.AIConfig
-	result := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig)
+	result := h.db.Where("vault_id = ?", vaultID).First(&aiConfig)
+	// 密文绑定行 ID，新配置需在加密前确定
+	if result.Error != nil {
+		aiConfig.ID = uuid.New().String()
+	}
 
 	if result.Error != nil {
 		c.JSON(http.StatusOK, models.AIConfig{
@@ -45,7 +54,7 @@ func (h *AIHandler) GetAIConfig(c *gin.Context) {
 	// 解密 API Key 后隐藏部分显示
 	decryptedKey := ""
 	if aiConfig.APIKey != "" {
-		decrypted, err := crypto.Decrypt(aiConfig.APIKey, h.cfg.EncryptionKey)
+		decrypted, err := h.getDecryptedAPIKey(aiConfig)
 		if err == nil && len(decrypted) > 8 {
 			decryptedKey = decrypted[:4] + "****" + decrypted[len(decrypted)-4:]
 		} else if err == nil {
@@ -78,12 +87,20 @@ func (h *AIHandler) SaveAIConfig(c *gin.Context) {
 	}
 
 	var aiConfig models.AIConfig
-	result := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig)
+	result := h.db.Where("vault_id = ?", vaultID).First(&aiConfig)
+	// 密文绑定行 ID，新配置需在加密前确定
+	if result.Error != nil {
+		aiConfig.ID = uuid.New().String()
+	}
 
 	// 加密 API Key
 	encryptedKey := ""
 	if !strings.Contains(input.APIKey, "****") && input.APIKey != "" {
-		encrypted, err := crypto.Encrypt(input.APIKey, h.cfg.EncryptionKey)
+		key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+		if !ok {
+			return
+		}
+		encrypted, err := key.Encrypt(input.APIKey, aiKeyAAD(aiConfig.ID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
@@ -93,12 +110,13 @@ func (h *AIHandler) SaveAIConfig(c *gin.Context) {
 
 	if result.Error != nil {
 		aiConfig = models.AIConfig{
+			ID:      aiConfig.ID,
 			VaultID: vaultID,
 			BaseURL: input.BaseURL,
 			APIKey:  encryptedKey,
 			Model:   input.Model,
 		}
-		if err := database.DB.Create(&aiConfig).Error; err != nil {
+		if err := h.db.Create(&aiConfig).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配置失败"})
 			return
 		}
@@ -110,7 +128,7 @@ func (h *AIHandler) SaveAIConfig(c *gin.Context) {
 		if encryptedKey != "" {
 			updates["api_key"] = encryptedKey
 		}
-		database.DB.Model(&aiConfig).Updates(updates)
+		h.db.Model(&aiConfig).Updates(updates)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "配置已保存"})
@@ -121,7 +139,11 @@ func (h *AIHandler) getDecryptedAPIKey(aiConfig models.AIConfig) (string, error)
 	if aiConfig.APIKey == "" {
 		return "", fmt.Errorf("API Key 未配置")
 	}
-	return crypto.Decrypt(aiConfig.APIKey, h.cfg.EncryptionKey)
+	key, err := h.keys.DataKey(h.db, aiConfig.VaultID)
+	if err != nil {
+		return "", err
+	}
+	return key.Decrypt(aiConfig.APIKey, aiKeyAAD(aiConfig.ID))
 }
 
 // GetChatHistory 获取对话历史
@@ -129,7 +151,7 @@ func (h *AIHandler) GetChatHistory(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var chats []models.AIChat
-	database.DB.Where("vault_id = ?", vaultID).Order("created_at asc").Find(&chats)
+	h.db.Where("vault_id = ?", vaultID).Order("created_at asc").Find(&chats)
 
 	if chats == nil {
 		chats = []models.AIChat{}
@@ -141,7 +163,7 @@ func (h *AIHandler) GetChatHistory(c *gin.Context) {
 // ClearChatHistory 清空对话历史
 func (h *AIHandler) ClearChatHistory(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-	database.DB.Where("vault_id = ?", vaultID).Delete(&models.AIChat{})
+	h.db.Where("vault_id = ?", vaultID).Delete(&models.AIChat{})
 	c.JSON(http.StatusOK, gin.H{"message": "对话已清空"})
 }
 
@@ -160,7 +182,7 @@ func (h *AIHandler) Chat(c *gin.Context) {
 
 	// 获取 AI 配置
 	var aiConfig models.AIConfig
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 AI 服务"})
 		return
 	}
@@ -183,11 +205,10 @@ func (h *AIHandler) Chat(c *gin.Context) {
 		Role:    "user",
 		Content: input.Message,
 	}
-	database.DB.Create(&userChat)
+	h.db.Create(&userChat)
 
 	// 获取订阅数据作为上下文
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
+	subscriptions, _ := h.store.Subscriptions.ListOwned(vaultID)
 
 	var subsContext string
 	if len(subscriptions) > 0 {
@@ -200,7 +221,7 @@ func (h *AIHandler) Chat(c *gin.Context) {
 
 	// 获取历史对话
 	var history []models.AIChat
-	database.DB.Where("vault_id = ?", vaultID).Order("created_at asc").Limit(20).Find(&history)
+	h.db.Where("vault_id = ?", vaultID).Order("created_at asc").Limit(20).Find(&history)
 
 	// 构建消息
 	messages := []openAIMessage{
@@ -229,7 +250,7 @@ func (h *AIHandler) Chat(c *gin.Context) {
 		Role:    "assistant",
 		Content: reply,
 	}
-	database.DB.Create(&assistantChat)
+	h.db.Create(&assistantChat)
 
 	c.JSON(http.StatusOK, gin.H{
 		"reply": reply,
@@ -331,7 +352,7 @@ func (h *AIHandler) streamChat(c *gin.Context, baseURL, apiKey, model string, me
 			Role:    "assistant",
 			Content: fullContent.String(),
 		}
-		database.DB.Create(&assistantChat)
+		h.db.Create(&assistantChat)
 	}
 }
 
@@ -340,7 +361,7 @@ func (h *AIHandler) GetReports(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var reports []models.AIReport
-	database.DB.Where("vault_id = ?", vaultID).Order("created_at desc").Limit(10).Find(&reports)
+	h.db.Where("vault_id = ?", vaultID).Order("created_at desc").Limit(10).Find(&reports)
 
 	if reports == nil {
 		reports = []models.AIReport{}
@@ -376,7 +397,7 @@ func (h *AIHandler) Analyze(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var aiConfig models.AIConfig
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 AI 服务"})
 		return
 	}
@@ -393,8 +414,7 @@ func (h *AIHandler) Analyze(c *gin.Context) {
 		return
 	}
 
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
+	subscriptions, _ := h.store.Subscriptions.ListOwned(vaultID)
 
 	if len(subscriptions) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "暂无订阅数据"})
@@ -443,7 +463,7 @@ func (h *AIHandler) Analyze(c *gin.Context) {
 		Categories:   string(categoriesJSON),
 		Insights:     string(insightsJSON),
 	}
-	database.DB.Create(&report)
+	h.db.Create(&report)
 
 	c.JSON(http.StatusOK, result)
 }
@@ -532,7 +552,7 @@ func (h *AIHandler) ParseSubscription(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var aiConfig models.AIConfig
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 AI 服务"})
 		return
 	}
@@ -563,7 +583,7 @@ func (h *AIHandler) ParseSubscription(c *gin.Context) {
 		return
 	}
 
-	existingTags := loadVaultTags(vaultID)
+	existingTags := loadVaultTags(h.store, vaultID)
 	tagsContext := tagsContextLine(existingTags)
 
 	prompt := fmt.Sprintf(`请从以下内容中提取订阅服务信息。请务必使用**简体中文**回复，并严格按照 JSON 格式返回。
@@ -610,7 +630,7 @@ func (h *AIHandler) ParseSubscription(c *gin.Context) {
 		return
 	}
 
-	newTags := applyCanonicalCategories(vaultID, "category", subscriptions)
+	newTags := applyCanonicalCategories(h.store, vaultID, "category", subscriptions)
 
 	result := gin.H{
 		"subscriptions": subscriptions,
@@ -841,7 +861,7 @@ func (h *AIHandler) ParseCredentials(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var aiConfig models.AIConfig
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 AI 服务"})
 		return
 	}
@@ -873,7 +893,7 @@ func (h *AIHandler) ParseCredentials(c *gin.Context) {
 		return
 	}
 
-	existingTags := loadVaultTags(vaultID)
+	existingTags := loadVaultTags(h.store, vaultID)
 	tagsContext := tagsContextLine(existingTags)
 
 	prompt := fmt.Sprintf(`请从以下内容中提取账号、密码或密钥信息。请务必使用**简体中文**回复，并严格按照 JSON 格式返回。
@@ -942,7 +962,7 @@ func (h *AIHandler) ParseCredentials(c *gin.Context) {
 		}
 	}
 
-	newTags := applyCanonicalCategories(vaultID, "category", credentials)
+	newTags := applyCanonicalCategories(h.store, vaultID, "category", credentials)
 	result := gin.H{
 		"credentials": credentials,
 		"count":       len(credentials),
@@ -967,7 +987,7 @@ func (h *AIHandler) AssignGroups(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var aiConfig models.AIConfig
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&aiConfig).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 AI 服务"})
 		return
 	}
@@ -1011,7 +1031,7 @@ func (h *AIHandler) AssignGroups(c *gin.Context) {
 		return
 	}
 
-	existingTags := loadVaultTags(vaultID)
+	existingTags := loadVaultTags(h.store, vaultID)
 	prompt := fmt.Sprintf(`请为以下已有内容重新分配分组。请务必使用简体中文，并严格按照 JSON 数组返回。
 %s
 
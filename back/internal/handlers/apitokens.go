@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"subvault/internal/apitoken"
+	"subvault/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultTokenDays 未指定有效期时的默认天数；maxTokenDays 允许的最长有效期
+const (
+	defaultTokenDays = 90
+	maxTokenDays     = 365
+)
+
+type APITokenHandler struct {
+	db *gorm.DB
+}
+
+func NewAPITokenHandler(db *gorm.DB) *APITokenHandler {
+	return &APITokenHandler{db: db}
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expiresInDays"` // 省略时 90 天，0 表示永不过期
+}
+
+type APITokenInfo struct {
+	models.APIToken
+	Scopes []string `json:"scopes"`
+}
+
+func tokenInfo(token models.APIToken) APITokenInfo {
+	return APITokenInfo{APIToken: token, Scopes: apitoken.ScopeList(token)}
+}
+
+// ListAPITokens 列出当前保险库的个人访问令牌（不含明文）
+// GET /api/v1/tokens
+func (h *APITokenHandler) ListAPITokens(c *gin.Context) {
+	tokens, err := apitoken.List(h.db, c.GetString("vaultId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取令牌失败"})
+		return
+	}
+	out := make([]APITokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		out = append(out, tokenInfo(token))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": out, "availableScopes": apitoken.AllScopes})
+}
+
+// CreateAPIToken 新建个人访问令牌，明文令牌只在本次响应中返回
+// POST /api/v1/tokens
+func (h *APITokenHandler) CreateAPIToken(c *gin.Context) {
+	var input CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的令牌数据"})
+		return
+	}
+	days := defaultTokenDays
+	if input.ExpiresInDays != nil {
+		days = *input.ExpiresInDays
+	}
+	if days < 0 || days > maxTokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "有效期需在 1-365 天之间，0 表示永不过期"})
+		return
+	}
+
+	token, plain, err := apitoken.Create(h.db, c.GetString("vaultId"), input.Name, input.Scopes, time.Duration(days)*24*time.Hour)
+	switch {
+	case errors.Is(err, apitoken.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "令牌名称不能为空且不超过 64 个字符"})
+		return
+	case errors.Is(err, apitoken.ErrInvalidScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请至少选择一项有效权限"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": plain, "info": tokenInfo(token)})
+}
+
+// RevokeAPIToken 吊销令牌，使用该令牌的脚本立即失效
+// DELETE /api/v1/tokens/:id
+func (h *APITokenHandler) RevokeAPIToken(c *gin.Context) {
+	ok, err := apitoken.RevokeForVault(h.db, c.GetString("vaultId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销令牌失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已吊销"})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"subvault/internal/apitoken"
+	"subvault/internal/keyring"
+	"subvault/internal/middleware"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTokenRouter() *gin.Engine {
+	cfg := getTestConfig()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(cfg, testDB))
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, store.NewSQL(testDB))
+	tokens := NewAPITokenHandler(testDB)
+	protected.GET("/subscriptions", vault.GetSubscriptions)
+	protected.POST("/subscriptions", vault.CreateSubscription)
+	protected.GET("/credentials", vault.GetCredentials)
+	protected.GET("/tokens", tokens.ListAPITokens)
+	return r
+}
+
+func tokenRequest(r *gin.Engine, token, method, path string) int {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAPITokenScopesEnforced(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTokenRouter()
+
+	token, plain, err := apitoken.Create(testDB, "test-vault-id", "cron", []string{"subscriptions:read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := tokenRequest(r, plain, "GET", "/api/v1/subscriptions"); code != http.StatusOK {
+		t.Fatalf("有 read 权限应能读取订阅: %d", code)
+	}
+	if code := tokenRequest(r, plain, "POST", "/api/v1/subscriptions"); code != http.StatusForbidden {
+		t.Fatalf("没有 write 权限不应能创建订阅: %d", code)
+	}
+	if code := tokenRequest(r, plain, "GET", "/api/v1/credentials"); code != http.StatusForbidden {
+		t.Fatalf("没有凭证权限不应能读取凭证: %d", code)
+	}
+	if code := tokenRequest(r, plain, "GET", "/api/v1/tokens"); code != http.StatusForbidden {
+		t.Fatalf("API 令牌不应能管理令牌: %d", code)
+	}
+
+	testDB.First(&token, "id = ?", token.ID)
+	if token.LastUsedAt == nil {
+		t.Fatal("应记录最近使用时间")
+	}
+
+	apitoken.RevokeForVault(testDB, "test-vault-id", token.ID)
+	if code := tokenRequest(r, plain, "GET", "/api/v1/subscriptions"); code != http.StatusUnauthorized {
+		t.Fatalf("吊销后应返回 401: %d", code)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"subvault/internal/audit"
+	"subvault/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// recordAudit 为保险库追加一条审计日志，带上请求的来源 IP 和 UA。
+// 已登录请求的操作者为当前保险库，解锁等未登录请求的操作者即 vaultID 本身。
+func recordAudit(c *gin.Context, db *gorm.DB, vaultID, action, outcome, targetID, detail string) {
+	if tokenID := c.GetString("apiTokenId"); tokenID != "" {
+		detail = fmt.Sprintf("%s（API 令牌 %s）", detail, tokenID)
+	}
+	audit.Record(db, models.AuditEvent{
+		VaultID:      vaultID,
+		ActorVaultID: c.GetString("vaultId"),
+		Action:       action,
+		Outcome:      outcome,
+		TargetID:     targetID,
+		Detail:       detail,
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+	})
+}
+
+// auditCredentialRead 记录一次返回明文密码的凭证读取。
+// 读到共享凭证时，同时在凭证所属的保险库留下记录，让所有者知道谁读取了它们。
+func auditCredentialRead(c *gin.Context, db *gorm.DB, vaultID string, credentials []models.Credential) {
+	shared := map[string]int{}
+	for _, cred := range credentials {
+		if cred.VaultID != vaultID {
+			shared[cred.VaultID]++
+		}
+	}
+	recordAudit(c, db, vaultID, audit.ActionCredentialsRead, audit.OutcomeSuccess, "", fmt.Sprintf("%s %d 条", c.FullPath(), len(credentials)))
+	for owner, n := range shared {
+		recordAudit(c, db, owner, audit.ActionSharedCredential, audit.OutcomeSuccess, "", fmt.Sprintf("共享凭证 %d 条", n))
+	}
+}
+
+// ListAuditEvents 分页查询审计日志
+// GET /api/v1/audit?action=auth.unlock,totp.disable&outcome=failure&since=2024-01-01&until=...&page=1&pageSize=50
+func (h *AuditHandler) ListAuditEvents(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	actions, err := audit.ParseActions(c.Query("action"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的审计动作", "actions": audit.Actions})
+		return
+	}
+	since, ok := parseAuditTime(c, "since")
+	if !ok {
+		return
+	}
+	until, ok := parseAuditTime(c, "until")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(audit.DefaultPageSize)))
+
+	filter := audit.Filter{
+		Actions:  actions,
+		Outcome:  c.Query("outcome"),
+		Since:    since,
+		Until:    until,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	events, total, err := audit.Query(h.db, vaultID, filter)
+	if err == audit.ErrInvalidFilter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结果只能为 success、failure 或 locked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	page, pageSize = audit.NormalizePage(page, pageSize)
+	c.JSON(http.StatusOK, gin.H{
+		"events":   events,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// parseAuditTime 解析 RFC 3339 时间或 YYYY-MM-DD 日期，参数缺省时返回零值
+func parseAuditTime(c *gin.Context, name string) (time.Time, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return t, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s 需为 RFC 3339 时间或 YYYY-MM-DD 日期", name)})
+	return time.Time{}, false
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/audit"
+	"subvault/internal/keyring"
+	"subvault/internal/middleware"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAuditRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.AccessTokenTTL = time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys := keyring.New(cfg)
+	auth := NewAuthHandler(cfg, keys, testDB)
+	r.POST("/api/v1/unlock", auth.Unlock)
+	r.POST("/api/v1/auth/register", auth.Register)
+
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(cfg, testDB))
+	vault := NewVaultHandler(cfg, keys, testDB, store.NewSQL(testDB))
+	protected.GET("/credentials", vault.GetCredentials)
+	protected.GET("/audit", NewAuditHandler(testDB).ListAuditEvents)
+	return r
+}
+
+type auditPage struct {
+	Events   []models.AuditEvent `json:"events"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"pageSize"`
+}
+
+func TestAuditLogRecordsUnlockAndReads(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupAuditRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+	accounts.SetRegistrationEnabled(testDB, true)
+	var bob AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "bob", "masterKey": "bob-passphrase"}).Body.Bytes(), &bob)
+
+	postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "wrong-passphrase"})
+	postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"})
+	if w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/credentials", nil); w.Code != http.StatusOK {
+		t.Fatalf("读取凭证失败: %d", w.Code)
+	}
+
+	w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/audit?action=auth.unlock&outcome=failure", nil)
+	var page auditPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || page.Total != 1 || page.Events[0].Detail != "主密钥错误" {
+		t.Fatalf("应记录一次解锁失败: %d %s", w.Code, w.Body.String())
+	}
+
+	w = authedJSON(r, alice.Token, http.MethodGet, "/api/v1/audit?pageSize=2", nil)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	// 注册、解锁失败、解锁成功、读取凭证
+	if page.Total != 4 || len(page.Events) != 2 || page.PageSize != 2 {
+		t.Fatalf("分页结果不符: %s", w.Body.String())
+	}
+	if page.Events[0].Action != audit.ActionCredentialsRead {
+		t.Fatalf("最新一条应为凭证读取: %+v", page.Events[0])
+	}
+
+	// 只能看到自己保险库的日志
+	w = authedJSON(r, bob.Token, http.MethodGet, "/api/v1/audit?outcome=failure", nil)
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Total != 0 {
+		t.Fatalf("不应看到其他保险库的日志: %s", w.Body.String())
+	}
+
+	if w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/audit?action=drop", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("未知动作应返回 400: %d", w.Code)
+	}
+	if w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/audit?since=yesterday", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效时间应返回 400: %d", w.Code)
+	}
+
+	var count int64
+	testDB.Model(&models.AuditEvent{}).Where("vault_id = ?", alice.VaultID).Count(&count)
+	if count != 4 {
+		t.Fatalf("审计日志条数不符: %d", count)
+	}
+}
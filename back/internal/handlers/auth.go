@@ -2,15 +2,21 @@ package handlers
 
 import (
 	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"time"
 
+	"subvault/internal/accounts"
+	"subvault/internal/audit"
 	"subvault/internal/config"
-	"subvault/internal/crypto"
-	"subvault/internal/database"
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
 	"subvault/internal/middleware"
 	"subvault/internal/models"
+	"subvault/internal/passkey"
 	"subvault/internal/recovery"
+	"subvault/internal/session"
+	"subvault/internal/webauthn"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -19,26 +25,46 @@ import (
 )
 
 type AuthHandler struct {
-	cfg *config.Config
+	cfg  *config.Config
+	keys *keyring.Keyring
+	db   *gorm.DB
+	rp   webauthn.RelyingParty
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
-	return &AuthHandler{cfg: cfg}
+func NewAuthHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB) *AuthHandler {
+	return &AuthHandler{cfg: cfg, keys: keys, db: db, rp: relyingParty(cfg)}
 }
 
 type UnlockRequest struct {
+	Username  string `json:"username"` // 为空时兼容只有一个用户的旧客户端
 	MasterKey string `json:"masterKey" binding:"required,min=1"`
 	TotpCode  string `json:"totpCode,omitempty"`
+	// 用通行密钥作为第二因素时，回传 403 响应中的 challengeId 和认证器的断言
+	ChallengeID string                      `json:"challengeId,omitempty"`
+	WebAuthn    *webauthn.AssertionResponse `json:"webauthn,omitempty"`
+}
+
+type RegisterRequest struct {
+	Username  string `json:"username" binding:"required"`
+	MasterKey string `json:"masterKey" binding:"required"`
+	// 第一个用户注册时需要：与 SETUP_TOKEN（未设置时为启动日志中的随机令牌）一致。
+	// 也可以不带令牌，以 ADMIN_USERNAME 和 MASTER_KEY 作为用户名和主密钥注册
+	SetupToken string `json:"setupToken,omitempty"`
 }
 
 type AuthResponse struct {
-	Token   string `json:"token"`
-	VaultID string `json:"vaultId"`
-	IsNew   bool   `json:"isNew"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // 访问令牌剩余秒数
+	VaultID      string `json:"vaultId"`
+	IsNew        bool   `json:"isNew"`
 }
 
-// Unlock 使用环境变量 MASTER_KEY 校验后解锁唯一保险库。
-// 密码错误直接拒绝，不会创建新账户。
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// Unlock 校验用户名和主密钥后解锁该用户的保险库。
 func (h *AuthHandler) Unlock(c *gin.Context) {
 	var req UnlockRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -46,94 +72,244 @@ func (h *AuthHandler) Unlock(c *gin.Context) {
 		return
 	}
 
-	if !masterKeyEquals(req.MasterKey, h.cfg.MasterKey) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "主密钥错误"})
+	// 先按用户名定位账户并检查锁定，锁定期内不校验主密钥
+	subject, vaultID := lockout.UsernameKey(req.Username, c.ClientIP()), ""
+	if found, err := accounts.Lookup(h.db, req.Username); err == nil {
+		subject, vaultID = lockout.VaultKey(found.VaultID, c.ClientIP()), found.VaultID
+	}
+	if !rejectIfLocked(c, h.db, subject, lockout.IPKey(c.ClientIP())) {
+		if vaultID != "" {
+			recordAudit(c, h.db, vaultID, audit.ActionUnlock, audit.OutcomeLocked, "", "")
+		}
 		return
 	}
 
-	vault, isNew, err := getOrCreateSoleVault(req.MasterKey)
+	user, err := accounts.Authenticate(h.db, req.Username, req.MasterKey)
+	if err == accounts.ErrInvalidCredentials {
+		recordUnlockFailure(c, h.db, subject, vaultID, audit.ActionUnlock, "主密钥错误")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或主密钥错误"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁保险库失败"})
 		return
 	}
 
 	var totpSetting models.TotpSetting
-	if err := database.DB.Where("vault_id = ?", vault.ID).First(&totpSetting).Error; err == nil {
-		if totpSetting.Enabled && totpSetting.Verified {
-			if req.TotpCode == "" {
-				c.JSON(http.StatusForbidden, gin.H{"error": "需要两步验证", "totp_required": true})
+	totpEnabled := h.db.Where("vault_id = ?", user.VaultID).First(&totpSetting).Error == nil &&
+		totpSetting.Enabled && totpSetting.Verified
+	passkeys, err := passkey.List(h.db, user.VaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁保险库失败"})
+		return
+	}
+
+	// 第二因素：TOTP 验证码、恢复码或任一已注册的通行密钥
+	method := "主密钥"
+	if totpEnabled || len(passkeys) > 0 {
+		switch {
+		case req.WebAuthn != nil && len(passkeys) > 0:
+			if !h.verifyUnlockAssertion(c, user.VaultID, req.ChallengeID, *req.WebAuthn, passkeys) {
+				recordUnlockFailure(c, h.db, subject, user.VaultID, audit.ActionUnlock, "通行密钥验证失败")
 				return
 			}
-			secret, decErr := crypto.DecryptField(totpSetting.Secret, h.cfg.EncryptionKey)
-			if decErr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+			method = "主密钥 + 通行密钥"
+		case req.TotpCode != "":
+			if !h.verifyTotpCode(c, user.VaultID, totpEnabled, totpSetting, req.TotpCode) {
+				recordUnlockFailure(c, h.db, subject, user.VaultID, audit.ActionUnlock, "验证码错误")
 				return
 			}
-			if !totp.Validate(req.TotpCode, secret) {
-				if !recovery.Consume(database.DB, vault.ID, req.TotpCode) {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+			method = "主密钥 + 验证码"
+		default:
+			resp := gin.H{"error": "需要两步验证", "totp_required": totpEnabled, "webauthn_required": len(passkeys) > 0}
+			if len(passkeys) > 0 {
+				options, err := h.unlockChallenge(user.VaultID, passkeys)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "生成验证挑战失败"})
 					return
 				}
+				resp["webauthn"] = options
 			}
+			c.JSON(http.StatusForbidden, resp)
+			return
 		}
 	}
 
-	token, err := h.generateToken(vault.ID)
+	lockout.Reset(h.db, subject)
+	recordAudit(c, h.db, user.VaultID, audit.ActionUnlock, audit.OutcomeSuccess, "", method)
+	h.startSession(c, user.VaultID, false)
+}
+
+// verifyTotpCode 校验 TOTP 验证码，不匹配时尝试恢复码；失败时已写入响应
+func (h *AuthHandler) verifyTotpCode(c *gin.Context, vaultID string, totpEnabled bool, setting models.TotpSetting, code string) bool {
+	if totpEnabled {
+		key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+		if !ok {
+			return false
+		}
+		secret, err := key.DecryptField(setting.Secret, totpSecretAAD(setting.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+			return false
+		}
+		if totp.Validate(code, secret) {
+			return true
+		}
+	}
+	if !recovery.Consume(h.db, vaultID, code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		return false
+	}
+	return true
+}
+
+// Register 注册新用户并创建其保险库，成功后直接登录
+// 第一个用户成为管理员；之后需要管理员开启注册
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供用户名和主密钥"})
+		return
+	}
+
+	user, err := accounts.Register(h.db, req.Username, req.MasterKey, h.setupAuthorized(req))
+	switch err {
+	case nil:
+	case accounts.ErrRegistrationClosed:
+		c.JSON(http.StatusForbidden, gin.H{"error": "注册已关闭"})
+		return
+	case accounts.ErrSetupRequired:
+		c.JSON(http.StatusForbidden, gin.H{"error": "初始化令牌错误", "setup_required": true})
+		return
+	case accounts.ErrUsernameTaken:
+		c.JSON(http.StatusConflict, gin.H{"error": "用户名已被占用"})
+		return
+	case accounts.ErrInvalidUsername:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名需为 3-32 位小写字母、数字或 . _ -"})
+		return
+	case accounts.ErrWeakPassphrase:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("主密钥至少 %d 位", accounts.MinPassphraseLength)})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+		return
+	}
+
+	recordAudit(c, h.db, user.VaultID, audit.ActionRegister, audit.OutcomeSuccess, user.ID, user.Username)
+	h.startSession(c, user.VaultID, true)
+}
+
+// setupAuthorized 第一个用户会成为管理员，不能让部署后第一个访问的陌生人抢先注册：
+// 须出示初始化令牌，或以配置的 ADMIN_USERNAME 和 MASTER_KEY 注册
+func (h *AuthHandler) setupAuthorized(req RegisterRequest) bool {
+	if req.SetupToken != "" && subtle.ConstantTimeCompare([]byte(req.SetupToken), []byte(h.cfg.SetupToken)) == 1 {
+		return true
+	}
+	return h.cfg.MasterKey != "" &&
+		accounts.NormalizeUsername(req.Username) == accounts.NormalizeUsername(h.cfg.AdminUsername) &&
+		subtle.ConstantTimeCompare([]byte(req.MasterKey), []byte(h.cfg.MasterKey)) == 1
+}
+
+// RegistrationStatus 是否允许注册，供登录页决定是否显示注册入口；setupRequired 表示注册的是管理员，需要初始化令牌
+// GET /api/v1/auth/registration
+func (h *AuthHandler) RegistrationStatus(c *gin.Context) {
+	setup, err := accounts.NeedsSetup(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取注册状态失败"})
+		return
+	}
+	open, err := accounts.RegistrationOpen(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取注册状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": open, "setupRequired": setup})
+}
+
+// startSession 为保险库新建会话并返回访问令牌和刷新令牌
+func (h *AuthHandler) startSession(c *gin.Context, vaultID string, isNew bool) {
+	sess, refreshToken, err := session.Create(h.db, vaultID, session.Client{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}, h.cfg.RefreshTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
+	}
+
+	token, err := h.generateToken(vaultID, sess.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token:   token,
-		VaultID: vault.ID,
-		IsNew:   isNew,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.cfg.AccessTokenTTL.Seconds()),
+		VaultID:      vaultID,
+		IsNew:        isNew,
 	})
 }
 
-func masterKeyEquals(provided, expected string) bool {
-	if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1 {
-		return true
+// Refresh 用刷新令牌换取新的访问令牌，刷新令牌同时轮转
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供刷新令牌"})
+		return
 	}
-	return false
-}
 
-// getOrCreateSoleVault 始终只使用最早创建的那一个保险库。
-func getOrCreateSoleVault(masterKey string) (models.Vault, bool, error) {
-	var vault models.Vault
-	err := database.DB.Order("created_at ASC").First(&vault).Error
-	if err == nil {
-		return vault, false, nil
+	sess, refreshToken, err := session.Rotate(h.db, req.RefreshToken, h.cfg.RefreshTokenTTL)
+	if err == session.ErrInvalidRefreshToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新解锁"})
+		return
 	}
-	if err != gorm.ErrRecordNotFound {
-		return models.Vault{}, false, err
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新会话失败"})
+		return
 	}
 
-	bcryptHash, hashErr := crypto.HashPassword(masterKey)
-	if hashErr != nil {
-		return models.Vault{}, false, hashErr
+	token, err := h.generateToken(sess.VaultID, sess.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
 	}
 
-	vault = models.Vault{
-		KeyHash:   "sole-vault-v1",
-		KeyBcrypt: bcryptHash,
-	}
-	if err := database.DB.Create(&vault).Error; err != nil {
-		return models.Vault{}, false, err
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.cfg.AccessTokenTTL.Seconds()),
+		VaultID:      sess.VaultID,
+	})
+}
+
+// Logout 吊销当前会话，访问令牌和刷新令牌一并失效
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := session.Revoke(h.db, c.GetString("sessionId")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出失败"})
+		return
 	}
-	return vault, true, nil
+	recordAudit(c, h.db, c.GetString("vaultId"), audit.ActionLogout, audit.OutcomeSuccess, c.GetString("sessionId"), "")
+	c.JSON(http.StatusOK, gin.H{"message": "已退出"})
 }
 
 func (h *AuthHandler) VerifyToken(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-	c.JSON(http.StatusOK, gin.H{"vaultId": vaultID, "valid": true})
+	resp := gin.H{"vaultId": vaultID, "valid": true}
+	if user, err := accounts.ForVault(h.db, vaultID); err == nil {
+		resp["username"] = user.Username
+		resp["isAdmin"] = user.IsAdmin
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-func (h *AuthHandler) generateToken(vaultID string) (string, error) {
+func (h *AuthHandler) generateToken(vaultID, sessionID string) (string, error) {
 	claims := middleware.Claims{
-		VaultID: vaultID,
+		VaultID:   vaultID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.cfg.AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
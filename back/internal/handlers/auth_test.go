@@ -1,15 +1,148 @@
 package handlers
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
 
-func TestMasterKeyEquals(t *testing.T) {
-	if !masterKeyEquals("correct-password", "correct-password") {
-		t.Fatal("相同主密钥应通过")
+	"subvault/internal/accounts"
+	"subvault/internal/keyring"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAuthRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.AccessTokenTTL = time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewAuthHandler(cfg, keyring.New(cfg), testDB)
+	r.POST("/api/v1/unlock", h.Unlock)
+	r.POST("/api/v1/auth/register", h.Register)
+	r.GET("/api/v1/auth/registration", h.RegistrationStatus)
+	return r
+}
+
+func postJSON(r *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestFirstRegistrationRequiresSetup(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	cfg := getTestConfig()
+	cfg.MasterKey = "configured-master-key"
+	cfg.AdminUsername = "admin"
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewAuthHandler(cfg, keyring.New(cfg), testDB)
+	r.POST("/api/v1/auth/register", h.Register)
+	r.GET("/api/v1/auth/registration", h.RegistrationStatus)
+
+	req, _ := http.NewRequest("GET", "/api/v1/auth/registration", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var status struct {
+		Enabled       bool `json:"enabled"`
+		SetupRequired bool `json:"setupRequired"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if !status.Enabled || !status.SetupRequired {
+		t.Fatalf("没有用户时应开放注册并要求初始化令牌: %s", w.Body.String())
+	}
+
+	// 第一个用户会成为管理员，不能凭空注册
+	if w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "mallory", "masterKey": "mallory-passphrase"}); w.Code != http.StatusForbidden {
+		t.Fatalf("没有初始化令牌时应拒绝: %d", w.Code)
+	}
+	if w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "mallory", "masterKey": "mallory-passphrase", "setupToken": "guess"}); w.Code != http.StatusForbidden {
+		t.Fatalf("错误的初始化令牌应拒绝: %d", w.Code)
+	}
+	if w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "mallory", "masterKey": "configured-master-key"}); w.Code != http.StatusForbidden {
+		t.Fatalf("非 ADMIN_USERNAME 用户名不能凭 MASTER_KEY 注册: %d", w.Code)
+	}
+
+	// 以配置的 ADMIN_USERNAME 和 MASTER_KEY 注册无需令牌
+	w = postJSON(r, "/api/v1/auth/register", gin.H{"username": "Admin", "masterKey": "configured-master-key"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("配置的管理员应能注册: %d %s", w.Code, w.Body.String())
+	}
+	var admin AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &admin)
+	if !accounts.IsAdmin(testDB, admin.VaultID) {
+		t.Fatal("第一个用户应为管理员")
+	}
+}
+
+func TestRegisterAndUnlockPerUser(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupAuthRouter()
+
+	w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "Alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("第一个用户应能注册: %d %s", w.Code, w.Body.String())
+	}
+	var alice AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &alice)
+	if !alice.IsNew || alice.Token == "" || alice.VaultID == "" {
+		t.Fatalf("注册应直接登录并返回新保险库: %+v", alice)
+	}
+	if !accounts.IsAdmin(testDB, alice.VaultID) {
+		t.Fatal("第一个用户应为管理员")
+	}
+
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "wrong-passphrase"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("错误主密钥应拒绝: %d", w.Code)
+	}
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "nobody", "masterKey": "alice-passphrase"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("不存在的用户应拒绝: %d", w.Code)
+	}
+	// 只有一个用户时，不带用户名的旧客户端仍可解锁
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"masterKey": "alice-passphrase"}); w.Code != http.StatusOK {
+		t.Fatalf("单用户时应兼容不带用户名的解锁: %d %s", w.Code, w.Body.String())
+	}
+
+	// 注册默认关闭，管理员开启后才能注册第二个用户
+	if w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "bob", "masterKey": "bob-passphrase"}); w.Code != http.StatusForbidden {
+		t.Fatalf("注册关闭时应拒绝: %d", w.Code)
+	}
+	if err := accounts.SetRegistrationEnabled(testDB, true); err != nil {
+		t.Fatal(err)
+	}
+	w = postJSON(r, "/api/v1/auth/register", gin.H{"username": "bob", "masterKey": "bob-passphrase"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("开启注册后应能注册: %d %s", w.Code, w.Body.String())
+	}
+	var bob AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &bob)
+	if bob.VaultID == alice.VaultID || accounts.IsAdmin(testDB, bob.VaultID) {
+		t.Fatal("每个用户应有自己的保险库，且后续用户不是管理员")
+	}
+	if w := postJSON(r, "/api/v1/auth/register", gin.H{"username": "BOB", "masterKey": "another-passphrase"}); w.Code != http.StatusConflict {
+		t.Fatalf("重复用户名应拒绝: %d", w.Code)
+	}
+
+	w = postJSON(r, "/api/v1/unlock", gin.H{"username": "bob", "masterKey": "bob-passphrase"})
+	var unlocked AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &unlocked)
+	if w.Code != http.StatusOK || unlocked.VaultID != bob.VaultID {
+		t.Fatalf("应解锁 bob 自己的保险库: %d %s", w.Code, w.Body.String())
 	}
-	if masterKeyEquals("wrong-password", "correct-password") {
-		t.Fatal("错误主密钥应拒绝")
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "bob", "masterKey": "alice-passphrase"}); w.Code != http.StatusUnauthorized {
+		t.Fatal("不能用别人的主密钥解锁")
 	}
-	if masterKeyEquals("", "correct-password") {
-		t.Fatal("空主密钥应拒绝")
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"masterKey": "alice-passphrase"}); w.Code != http.StatusUnauthorized {
+		t.Fatal("多用户时必须提供用户名")
 	}
 }
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"subvault/internal/audit"
+	"subvault/internal/backup"
+	"subvault/internal/crypto"
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BackupHandler 整库备份：导出为用口令加密的文件，换一台服务器或换一个 ENCRYPTION_KEY 也能导入
+type BackupHandler struct {
+	keys  *keyring.Keyring
+	db    *gorm.DB
+	store *store.Store
+}
+
+func NewBackupHandler(keys *keyring.Keyring, db *gorm.DB, st *store.Store) *BackupHandler {
+	return &BackupHandler{keys: keys, db: db, store: st}
+}
+
+// ExportBackup 导出保险库自己的订阅、凭证、备忘录、分组、通知设置、调价和续费记录，
+// 不含共享给自己的记录和回收站。备份中是全部明文，与凭证导出一样需再次确认身份
+// POST /api/v1/backup/export {"passphrase": "...", "masterKey": "...", "totpCode": "123456"}
+func (h *BackupHandler) ExportBackup(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var input struct {
+		reauthRequest
+		Passphrase string `json:"passphrase"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || len([]rune(input.Passphrase)) < backup.MinPassphraseLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("备份口令至少 %d 位", backup.MinPassphraseLength)})
+		return
+	}
+	if !confirmIdentity(c, h.db, h.keys, vaultID, audit.ActionBackupExport, input.reauthRequest) {
+		return
+	}
+
+	key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+	snap, err := h.store.Backups.Export(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+
+	for i := range snap.Credentials {
+		snap.Credentials[i].Password, snap.Credentials[i].Notes, err = credentialSecrets(key, snap.Credentials[i])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解密凭证失败"})
+			return
+		}
+	}
+	for i := range snap.Memos {
+		if snap.Memos[i].Content, err = key.DecryptField(snap.Memos[i].Content, memoAAD(snap.Memos[i].ID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解密备忘录失败"})
+			return
+		}
+	}
+	// 日历订阅地址相当于密码，不随备份带走
+	if snap.Settings != nil {
+		snap.Settings.ID, snap.Settings.CalendarToken = "", ""
+	}
+
+	file, err := backup.Seal(backup.Bundle{
+		VaultID:       vaultID,
+		ExportedAt:    time.Now(),
+		Subscriptions: snap.Subscriptions,
+		Credentials:   snap.Credentials,
+		Memos:         snap.Memos,
+		Tags:          snap.Tags,
+		Settings:      snap.Settings,
+		PriceHistory:  snap.PriceHistory,
+		RenewalEvents: snap.RenewalEvents,
+	}, input.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密备份失败"})
+		return
+	}
+
+	recordAudit(c, h.db, vaultID, audit.ActionBackupExport, audit.OutcomeSuccess, "",
+		fmt.Sprintf("订阅 %d 条、凭证 %d 条、备忘录 %d 条", len(snap.Subscriptions), len(snap.Credentials), len(snap.Memos)))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="subvault-backup-%s.json"`, time.Now().Format("20060102")))
+	c.JSON(http.StatusOK, file)
+}
+
+// importResult 导入的统计，skipped 为合并时因已存在而跳过的记录数
+type importResult struct {
+	Mode          string `json:"mode"`
+	Subscriptions int    `json:"subscriptions"`
+	Credentials   int    `json:"credentials"`
+	Memos         int    `json:"memos"`
+	Tags          int    `json:"tags"`
+	Skipped       int    `json:"skipped"`
+}
+
+// ImportBackup 导入备份文件，全部记录在一个事务内写入。
+// merge 保留现有数据，跳过已存在的记录；replace 先彻底删除保险库自己的数据（含回收站），再写入备份内容。
+// replace 可以清空整个保险库，两种方式都需再次确认身份
+// POST /api/v1/backup/import {"passphrase": "...", "mode": "merge", "file": {...}, "masterKey": "...", "totpCode": "123456"}
+func (h *BackupHandler) ImportBackup(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var input struct {
+		reauthRequest
+		Passphrase string      `json:"passphrase"`
+		Mode       string      `json:"mode"`
+		File       backup.File `json:"file"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的导入数据"})
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = "merge"
+	}
+	if input.Mode != "merge" && input.Mode != "replace" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导入方式只能是 merge 或 replace"})
+		return
+	}
+	if !confirmIdentity(c, h.db, h.keys, vaultID, audit.ActionBackupImport, input.reauthRequest) {
+		return
+	}
+
+	bundle, err := backup.Open(input.File, input.Passphrase)
+	if err != nil {
+		if errors.Is(err, backup.ErrWrongPassphrase) {
+			recordAudit(c, h.db, vaultID, audit.ActionBackupImport, audit.OutcomeFailure, "", "口令错误")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "口令错误或备份文件已损坏"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不是有效的备份文件"})
+		}
+		return
+	}
+
+	key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+	existing, err := h.store.Backups.Export(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+		return
+	}
+	plan := importPlan{vaultID: vaultID, bundle: bundle, replace: input.Mode == "replace", existing: existing}
+	if !plan.replace {
+		if plan.trashed, err = h.trashedIDs(vaultID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取数据失败"})
+			return
+		}
+	}
+	snap, result, err := plan.build(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return
+	}
+	result.Mode = input.Mode
+
+	if err := h.store.Backups.Import(vaultID, snap, plan.replace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入失败，数据未做任何修改"})
+		return
+	}
+	EnsureDefaultGroup(h.store, vaultID)
+
+	recordAudit(c, h.db, vaultID, audit.ActionBackupImport, audit.OutcomeSuccess, "",
+		fmt.Sprintf("%s：订阅 %d 条、凭证 %d 条、备忘录 %d 条，跳过 %d 条", input.Mode, result.Subscriptions, result.Credentials, result.Memos, result.Skipped))
+	c.JSON(http.StatusOK, result)
+}
+
+// trashedIDs 返回回收站中记录的 ID，合并时这些 ID 同样视为已存在
+func (h *BackupHandler) trashedIDs(vaultID string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	subs, err := h.store.Subscriptions.ListDeleted(vaultID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		ids[s.ID] = true
+	}
+	creds, err := h.store.Credentials.ListDeleted(vaultID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cred := range creds {
+		ids[cred.ID] = true
+	}
+	memos, err := h.store.Memos.ListDeleted(vaultID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range memos {
+		ids[m.ID] = true
+	}
+	tags, err := h.store.Tags.ListDeleted(vaultID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		ids[t.ID] = true
+	}
+	return ids, nil
+}
+
+// importPlan 把备份内容转换成待写入的记录。
+// 导入到导出时的保险库沿用原 ID，导入到其他保险库时按两边的保险库 ID 派生新 ID，
+// 这样同一份备份重复合并时能认出已导入过的记录，也不会和其他保险库的记录冲突。
+type importPlan struct {
+	vaultID  string
+	bundle   backup.Bundle
+	replace  bool
+	existing store.Snapshot
+	trashed  map[string]bool
+}
+
+func (p importPlan) id(original string) string {
+	if p.bundle.VaultID == p.vaultID && original != "" {
+		return original
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(p.vaultID+"/"+p.bundle.VaultID+"/"+original)).String()
+}
+
+func (p importPlan) build(key *crypto.Cipher) (store.Snapshot, importResult, error) {
+	var snap store.Snapshot
+	var result importResult
+	// 导入的记录以导入时间为修改时间：沿用备份中的时间会早于客户端的同步游标，增量同步拿不到这些记录
+	now := time.Now()
+
+	// 合并时已存在的记录：当前数据加回收站
+	taken := map[string]bool{}
+	credByKey := map[string]string{}
+	var liveTags []models.Tag
+	if !p.replace {
+		for id := range p.trashed {
+			taken[id] = true
+		}
+		for _, s := range p.existing.Subscriptions {
+			taken[s.ID] = true
+		}
+		for _, cred := range p.existing.Credentials {
+			taken[cred.ID] = true
+			credByKey[credentialDupKey(cred.Label, cred.Username, cred.Website)] = cred.ID
+		}
+		for _, m := range p.existing.Memos {
+			taken[m.ID] = true
+		}
+		for _, t := range p.existing.Tags {
+			taken[t.ID] = true
+		}
+		liveTags = p.existing.Tags
+	}
+
+	for _, tag := range p.bundle.Tags {
+		id := p.id(tag.ID)
+		if taken[id] || findTagByName(liveTags, tag.Name) != nil {
+			result.Skipped++
+			continue
+		}
+		tag.ID, tag.VaultID, tag.DeletedAt = id, p.vaultID, gorm.DeletedAt{}
+		snap.Tags = append(snap.Tags, tag)
+		liveTags = append(liveTags, tag)
+		result.Tags++
+	}
+
+	// 订阅按备份中的凭证 ID 找到导入后的凭证；合并时跳过的凭证指向已有的那一条
+	credIDs := map[string]string{}
+	for _, cred := range p.bundle.Credentials {
+		id := p.id(cred.ID)
+		dupKey := credentialDupKey(cred.Label, cred.Username, cred.Website)
+		if taken[id] {
+			credIDs[cred.ID] = id
+			result.Skipped++
+			continue
+		}
+		if existingID, ok := credByKey[dupKey]; ok {
+			credIDs[cred.ID] = existingID
+			result.Skipped++
+			continue
+		}
+		credIDs[cred.ID] = id
+
+		var err error
+		cred.ID, cred.VaultID, cred.CollectionID, cred.DeletedAt, cred.UpdatedAt = id, p.vaultID, nil, gorm.DeletedAt{}, now
+		if cred.Password, err = key.EncryptField(cred.Password, credentialAAD(id, "password")); err != nil {
+			return store.Snapshot{}, importResult{}, err
+		}
+		if cred.Notes, err = key.EncryptField(cred.Notes, credentialAAD(id, "notes")); err != nil {
+			return store.Snapshot{}, importResult{}, err
+		}
+		snap.Credentials = append(snap.Credentials, cred)
+		result.Credentials++
+	}
+
+	subIDs := map[string]string{}
+	for _, sub := range p.bundle.Subscriptions {
+		id := p.id(sub.ID)
+		if taken[id] {
+			result.Skipped++
+			continue
+		}
+		subIDs[sub.ID] = id
+		if sub.CredentialID != nil {
+			if credID, ok := credIDs[*sub.CredentialID]; ok {
+				sub.CredentialID = &credID
+			} else {
+				sub.CredentialID = nil
+			}
+		}
+		sub.ID, sub.VaultID, sub.CollectionID, sub.DeletedAt, sub.Tags = id, p.vaultID, nil, gorm.DeletedAt{}, nil
+		sub.UpdatedAt = now
+		snap.Subscriptions = append(snap.Subscriptions, sub)
+		result.Subscriptions++
+	}
+
+	for _, memo := range p.bundle.Memos {
+		id := p.id(memo.ID)
+		if taken[id] {
+			result.Skipped++
+			continue
+		}
+		var err error
+		memo.ID, memo.VaultID, memo.CollectionID, memo.DeletedAt, memo.UpdatedAt = id, p.vaultID, nil, gorm.DeletedAt{}, now
+		if memo.Content, err = key.EncryptField(memo.Content, memoAAD(id)); err != nil {
+			return store.Snapshot{}, importResult{}, err
+		}
+		snap.Memos = append(snap.Memos, memo)
+		result.Memos++
+	}
+
+	// 调价和续费记录只随新导入的订阅写入，不被引用，总是用新 ID
+	for _, change := range p.bundle.PriceHistory {
+		if subID, ok := subIDs[change.SubscriptionID]; ok {
+			change.ID, change.VaultID, change.SubscriptionID = uuid.New().String(), p.vaultID, subID
+			snap.PriceHistory = append(snap.PriceHistory, change)
+		}
+	}
+	for _, ev := range p.bundle.RenewalEvents {
+		if subID, ok := subIDs[ev.SubscriptionID]; ok {
+			ev.ID, ev.VaultID, ev.SubscriptionID = uuid.New().String(), p.vaultID, subID
+			snap.RenewalEvents = append(snap.RenewalEvents, ev)
+		}
+	}
+
+	// 通知设置：替换时覆盖，合并时只在还没有设置时导入；沿用现有的日历订阅地址
+	if settings := p.bundle.Settings; settings != nil && (p.replace || p.existing.Settings == nil) {
+		imported := *settings
+		imported.ID, imported.VaultID, imported.CalendarToken = uuid.New().String(), p.vaultID, newCalendarToken()
+		if current := p.existing.Settings; current != nil {
+			imported.ID, imported.CalendarToken, imported.CreatedAt = current.ID, current.CalendarToken, current.CreatedAt
+		}
+		snap.Settings = &imported
+	}
+
+	return snap, result, nil
+}
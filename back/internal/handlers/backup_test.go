@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"subvault/internal/backup"
+	"subvault/internal/crypto"
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupBackupRouter() *gin.Engine {
+	cfg := getTestConfig()
+	st := store.NewSQL(testDB)
+	keys := keyring.New(cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	vault := NewVaultHandler(cfg, keys, testDB, st)
+	backups := NewBackupHandler(keys, testDB, st)
+	r.GET("/subscriptions", vault.GetSubscriptions)
+	r.POST("/subscriptions", vault.CreateSubscription)
+	r.GET("/credentials", vault.GetCredentials)
+	r.POST("/credentials", vault.CreateCredential)
+	r.DELETE("/credentials/:id", vault.DeleteCredential)
+	r.POST("/backup/export", backups.ExportBackup)
+	r.POST("/backup/import", backups.ImportBackup)
+	r.GET("/vault/changes", vault.GetVaultChanges)
+	return r
+}
+
+// setVaultMasterKey 给测试保险库设置主密钥，导出和导入时需再次确认身份
+func setVaultMasterKey(t *testing.T, vaultID string) {
+	hash, err := crypto.HashPassword("vault-master-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDB.Model(&models.Vault{}).Where("id = ?", vaultID).Update("key_bcrypt", hash)
+}
+
+func exportBackup(t *testing.T, r *gin.Engine, vaultID string) backup.File {
+	w := sharingRequest(r, vaultID, http.MethodPost, "/backup/export", map[string]string{"passphrase": "correct horse", "masterKey": "vault-master-key"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("导出失败: %d %s", w.Code, w.Body.String())
+	}
+	var file backup.File
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func importBackup(t *testing.T, r *gin.Engine, vaultID, mode string, file backup.File) importResult {
+	w := sharingRequest(r, vaultID, http.MethodPost, "/backup/import", gin.H{"passphrase": "correct horse", "mode": mode, "file": file, "masterKey": "vault-master-key"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("导入失败: %d %s", w.Code, w.Body.String())
+	}
+	var result importResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	return result
+}
+
+func listCredentials(r *gin.Engine, vaultID string) []models.Credential {
+	var creds []models.Credential
+	json.Unmarshal(sharingRequest(r, vaultID, http.MethodGet, "/credentials", nil).Body.Bytes(), &creds)
+	return creds
+}
+
+func listSubscriptions(r *gin.Engine, vaultID string) []models.Subscription {
+	var subs []models.Subscription
+	json.Unmarshal(sharingRequest(r, vaultID, http.MethodGet, "/subscriptions", nil).Body.Bytes(), &subs)
+	return subs
+}
+
+func TestBackupReplaceRestoresVault(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBackupRouter()
+	setVaultMasterKey(t, "test-vault-id")
+
+	var cred models.Credential
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "Netflix", "username": "me", "password": "hunter2"})
+	json.Unmarshal(w.Body.Bytes(), &cred)
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/subscriptions", gin.H{
+		"name": "Netflix", "cost": 15, "status": "paused", "credentialId": cred.ID, "renewalDate": "2030-01-01",
+	})
+	// 带默认值的零值字段（active 默认为 true）导入后也要保持原样
+	testDB.Model(&models.Subscription{}).Where("vault_id = ?", "test-vault-id").Update("active", false)
+
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/backup/export", map[string]string{"passphrase": "short", "masterKey": "vault-master-key"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("过短的口令应被拒绝，实际 %d", w.Code)
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/backup/export", map[string]string{"passphrase": "correct horse"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("缺少主密钥时不应导出，实际 %d", w.Code)
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/backup/export", map[string]string{"passphrase": "correct horse", "masterKey": "wrong-master-key"}); w.Code != http.StatusForbidden {
+		t.Fatalf("主密钥错误时不应导出，实际 %d", w.Code)
+	}
+	file := exportBackup(t, r, "test-vault-id")
+
+	// 导出后删除凭证、新增一条凭证，替换导入后应回到导出时的状态
+	sharingRequest(r, "test-vault-id", http.MethodDelete, "/credentials/"+cred.ID, nil)
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "GitHub", "username": "me", "password": "x"})
+
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/backup/import", gin.H{"passphrase": "correct horse", "mode": "replace", "file": file, "masterKey": "wrong-master-key"})
+	if w.Code != http.StatusForbidden || len(listCredentials(r, "test-vault-id")) != 1 {
+		t.Fatalf("主密钥错误时不应替换导入，实际 %d", w.Code)
+	}
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/backup/import", gin.H{"passphrase": "wrong horse", "mode": "replace", "file": file, "masterKey": "vault-master-key"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("口令错误应返回 400，实际 %d", w.Code)
+	}
+	result := importBackup(t, r, "test-vault-id", "replace", file)
+	if result.Credentials != 1 || result.Subscriptions != 1 {
+		t.Fatalf("导入统计不正确: %+v", result)
+	}
+
+	creds := listCredentials(r, "test-vault-id")
+	if len(creds) != 1 || creds[0].ID != cred.ID || creds[0].Password != "hunter2" {
+		t.Fatalf("替换导入后凭证应与导出时一致: %+v", creds)
+	}
+	subs := listSubscriptions(r, "test-vault-id")
+	if len(subs) != 1 || subs[0].Active || subs[0].Status != "paused" || subs[0].CredentialID == nil || *subs[0].CredentialID != cred.ID {
+		t.Fatalf("替换导入后订阅应与导出时一致: %+v", subs)
+	}
+	var trashed int64
+	testDB.Unscoped().Model(&models.Credential{}).Where("vault_id = ? AND deleted_at IS NOT NULL", "test-vault-id").Count(&trashed)
+	if trashed != 0 {
+		t.Fatalf("替换导入应清空回收站，实际还有 %d 条", trashed)
+	}
+}
+
+func TestBackupMergeIntoOtherVaultIsIdempotent(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBackupRouter()
+	if err := testDB.Create(&models.Vault{ID: "other-vault", KeyHash: "other-vault"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	setVaultMasterKey(t, "test-vault-id")
+	setVaultMasterKey(t, "other-vault")
+
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "Netflix", "username": "me", "password": "hunter2"})
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "GitHub", "username": "me", "password": "octocat"})
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/subscriptions", gin.H{"name": "Netflix", "cost": 15, "renewalDate": "2030-01-01"})
+	file := exportBackup(t, r, "test-vault-id")
+
+	// 目标保险库已有同名同账号的凭证，合并时跳过
+	sharingRequest(r, "other-vault", http.MethodPost, "/credentials", map[string]string{"label": "github", "username": "ME", "password": "mine"})
+
+	first := importBackup(t, r, "other-vault", "merge", file)
+	if first.Credentials != 1 || first.Subscriptions != 1 || first.Skipped == 0 {
+		t.Fatalf("首次合并统计不正确: %+v", first)
+	}
+	second := importBackup(t, r, "other-vault", "merge", file)
+	if second.Credentials != 0 || second.Subscriptions != 0 {
+		t.Fatalf("重复合并不应产生新记录: %+v", second)
+	}
+
+	creds := listCredentials(r, "other-vault")
+	if len(creds) != 2 {
+		t.Fatalf("合并后应有 2 条凭证: %+v", creds)
+	}
+	for _, cred := range creds {
+		if cred.Label == "Netflix" && cred.Password != "hunter2" {
+			t.Fatalf("导入的凭证应用目标保险库的密钥重新加密: %+v", cred)
+		}
+		if cred.Label == "github" && cred.Password != "mine" {
+			t.Fatalf("合并不应覆盖已有的凭证: %+v", cred)
+		}
+	}
+	if subs := listSubscriptions(r, "test-vault-id"); len(subs) != 1 {
+		t.Fatalf("导入其他保险库不应影响源保险库: %+v", subs)
+	}
+}
+
+func TestBackupReplaceReportsChangesToDeltaSync(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBackupRouter()
+	setVaultMasterKey(t, "test-vault-id")
+
+	create := func(label string) string {
+		var cred models.Credential
+		json.Unmarshal(sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": label, "password": "secret"}).Body.Bytes(), &cred)
+		return cred.ID
+	}
+	kept := create("GitHub")
+	file := exportBackup(t, r, "test-vault-id")
+	wiped := create("Wi-Fi")
+
+	// 已有记录推到游标之前，客户端已同步过它们
+	testDB.Model(&models.Credential{}).Where("vault_id = ?", "test-vault-id").UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+	cursor := encodeSyncCursor(time.Now().Add(-30 * time.Minute))
+
+	importBackup(t, r, "test-vault-id", "replace", file)
+
+	changed, deleted := fetchChanges(t, r, "test-vault-id", cursor)
+	if !deleted[wiped] {
+		t.Fatalf("替换导入清除的凭证应作为删除返回: %v", deleted)
+	}
+	if !changed[kept] || deleted[kept] {
+		t.Fatalf("重新导入的凭证应以导入时间作为修改返回: %v %v", changed, deleted)
+	}
+}
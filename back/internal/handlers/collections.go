@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/sharing"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CollectionHandler struct {
+	db *gorm.DB
+}
+
+func NewCollectionHandler(db *gorm.DB) *CollectionHandler {
+	return &CollectionHandler{db: db}
+}
+
+type collectionRequest struct {
+	Name string `json:"name"`
+}
+
+type collectionMemberRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type assignCollectionRequest struct {
+	CollectionID *string `json:"collectionId"`
+}
+
+// writeSharingError 把 sharing 包的错误映射为 HTTP 响应
+func writeSharingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sharing.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "集合不存在"})
+	case errors.Is(err, sharing.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限执行此操作"})
+	case errors.Is(err, sharing.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色只能是 viewer 或 editor"})
+	case errors.Is(err, sharing.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "集合名称不能为空且不超过 64 个字符"})
+	case errors.Is(err, sharing.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	case errors.Is(err, sharing.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": "该用户已在集合中"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+	}
+}
+
+// ListCollections 列出创建或加入的共享集合
+// GET /api/v1/collections
+func (h *CollectionHandler) ListCollections(c *gin.Context) {
+	collections, err := sharing.List(h.db, c.GetString("vaultId"))
+	if err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, collections)
+}
+
+// CreateCollection 新建共享集合
+// POST /api/v1/collections
+func (h *CollectionHandler) CreateCollection(c *gin.Context) {
+	var input collectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的集合数据"})
+		return
+	}
+	collection, err := sharing.Create(h.db, c.GetString("vaultId"), input.Name)
+	if err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, collection)
+}
+
+// RenameCollection 重命名集合（仅所有者）
+// PUT /api/v1/collections/:id
+func (h *CollectionHandler) RenameCollection(c *gin.Context) {
+	var input collectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的集合数据"})
+		return
+	}
+	collection, err := sharing.Rename(h.db, c.Param("id"), c.GetString("vaultId"), input.Name)
+	if err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, collection)
+}
+
+// DeleteCollection 删除集合（仅所有者），其中的记录退回各自创建者
+// DELETE /api/v1/collections/:id
+func (h *CollectionHandler) DeleteCollection(c *gin.Context) {
+	if err := sharing.Delete(h.db, c.Param("id"), c.GetString("vaultId")); err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// AddCollectionMember 按用户名添加成员（仅所有者）
+// POST /api/v1/collections/:id/members
+func (h *CollectionHandler) AddCollectionMember(c *gin.Context) {
+	var input collectionMemberRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员数据"})
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.CollectionRoleViewer
+	}
+	member, err := sharing.AddMember(h.db, c.Param("id"), c.GetString("vaultId"), input.Username, input.Role)
+	if err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateCollectionMember 调整成员角色（仅所有者）
+// PUT /api/v1/collections/:id/members/:memberId
+func (h *CollectionHandler) UpdateCollectionMember(c *gin.Context) {
+	var input collectionMemberRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的成员数据"})
+		return
+	}
+	if err := sharing.UpdateMember(h.db, c.Param("id"), c.GetString("vaultId"), c.Param("memberId"), input.Role); err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "更新成功"})
+}
+
+// RemoveCollectionMember 移除成员；成员也可以移除自己以退出集合
+// DELETE /api/v1/collections/:id/members/:memberId
+func (h *CollectionHandler) RemoveCollectionMember(c *gin.Context) {
+	if err := sharing.RemoveMember(h.db, c.Param("id"), c.GetString("vaultId"), c.Param("memberId")); err != nil {
+		writeSharingError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "移除成功"})
+}
+
+func (h *VaultHandler) AssignSubscriptionCollection(c *gin.Context) {
+	assignCollection(c, h.db, h.store.Subscriptions, "订阅不存在")
+}
+
+func (h *VaultHandler) AssignCredentialCollection(c *gin.Context) {
+	assignCollection(c, h.db, h.store.Credentials, "凭证不存在")
+}
+
+func (h *MemoHandler) AssignMemoCollection(c *gin.Context) {
+	assignCollection(c, h.db, h.store.Memos, "备忘录不存在")
+}
+
+// assignCollection 把自己的记录放入共享集合，或移回个人保险库（collectionId 为 null）。
+// 只有记录的创建者能移动记录；集合所有者可以把别人放进来的记录移出集合。
+// 放入的目标集合需要有 owner 或 editor 角色。
+func assignCollection(c *gin.Context, db *gorm.DB, records store.Records, notFound string) {
+	vaultID := c.GetString("vaultId")
+	id := c.Param("id")
+
+	var input assignCollectionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的集合数据"})
+		return
+	}
+	if input.CollectionID != nil && *input.CollectionID == "" {
+		input.CollectionID = nil
+	}
+
+	record, err := records.Locate(vaultID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+
+	allowed := record.VaultID == vaultID
+	if !allowed && input.CollectionID == nil && record.CollectionID != nil {
+		role, _ := sharing.RoleOf(db, *record.CollectionID, vaultID)
+		allowed = role == models.CollectionRoleOwner
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能移动自己创建的记录"})
+		return
+	}
+	if !requireCollectionEditor(c, db, vaultID, input.CollectionID) {
+		return
+	}
+
+	if err := records.SetCollection(id, input.CollectionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "collectionId": input.CollectionID})
+}
+
+// requireCollectionEditor 新建或移入共享集合前检查目标集合的角色，失败时直接写入响应。
+// collectionID 为空表示个人数据，无需检查。
+func requireCollectionEditor(c *gin.Context, db *gorm.DB, vaultID string, collectionID *string) bool {
+	if collectionID == nil {
+		return true
+	}
+	role, err := sharing.RoleOf(db, *collectionID, vaultID)
+	if err != nil {
+		writeSharingError(c, err)
+		return false
+	}
+	if !sharing.CanEdit(role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只读共享，无权修改"})
+		return false
+	}
+	return true
+}
+
+// requireEditable 修改、删除记录前检查权限：自己的记录或以 editor 身份共享的记录
+func requireEditable(c *gin.Context, db *gorm.DB, vaultID, recordVaultID string, collectionID *string) bool {
+	if !sharing.CanEdit(sharing.Access(db, vaultID, recordVaultID, collectionID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只读共享，无权修改"})
+		return false
+	}
+	return true
+}
+
+// decryptCredentials 解密凭证列表。共享凭证由创建者的数据密钥加密，按记录所属保险库取密钥。
+func decryptCredentials(db *gorm.DB, keys *keyring.Keyring, credentials []models.Credential) {
+	for i := range credentials {
+		key, err := keys.DataKey(db, credentials[i].VaultID)
+		if err != nil {
+			credentials[i].Password, credentials[i].Notes = "", ""
+			continue
+		}
+		credentials[i].Password, _ = key.DecryptField(credentials[i].Password, credentialAAD(credentials[i].ID, "password"))
+		credentials[i].Notes, _ = key.DecryptField(credentials[i].Notes, credentialAAD(credentials[i].ID, "notes"))
+	}
+}
+
+// decryptMemos 解密备忘录列表，解密失败时返回空内容，不中断整个请求
+func decryptMemos(db *gorm.DB, keys *keyring.Keyring, memos []models.Memo) {
+	for i := range memos {
+		if memos[i].Content == "" {
+			continue
+		}
+		key, err := keys.DataKey(db, memos[i].VaultID)
+		if err != nil {
+			memos[i].Content = ""
+			continue
+		}
+		decrypted, err := key.DecryptField(memos[i].Content, memoAAD(memos[i].ID))
+		if err != nil {
+			memos[i].Content = ""
+		} else {
+			memos[i].Content = decrypted
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"subvault/internal/accounts"
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupSharingRouter 测试路由，当前保险库由 X-Vault-ID 头指定
+func setupSharingRouter() *gin.Engine {
+	cfg := getTestConfig()
+	keys := keyring.New(cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	vault := NewVaultHandler(cfg, keys, testDB, store.NewSQL(testDB))
+	collections := NewCollectionHandler(testDB)
+	r.GET("/subscriptions", vault.GetSubscriptions)
+	r.POST("/subscriptions", vault.CreateSubscription)
+	r.PUT("/subscriptions/:id", vault.UpdateSubscription)
+	r.PUT("/subscriptions/:id/collection", vault.AssignSubscriptionCollection)
+	r.GET("/credentials", vault.GetCredentials)
+	r.POST("/credentials", vault.CreateCredential)
+	r.PUT("/credentials/:id", vault.UpdateCredential)
+	r.DELETE("/credentials/:id", vault.DeleteCredential)
+	r.POST("/collections", collections.CreateCollection)
+	r.POST("/collections/:id/members", collections.AddCollectionMember)
+	r.PUT("/collections/:id/members/:memberId", collections.UpdateCollectionMember)
+	return r
+}
+
+func sharingRequest(r *gin.Engine, vaultID, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-ID", vaultID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSharedCollectionRoles(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupSharingRouter()
+
+	alice, err := accounts.Register(testDB, "alice", "alice-passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.SetRegistrationEnabled(testDB, true)
+	bob, err := accounts.Register(testDB, "bob", "bob-passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := sharingRequest(r, alice.VaultID, "POST", "/collections", gin.H{"name": "家庭"})
+	var home models.Collection
+	json.Unmarshal(w.Body.Bytes(), &home)
+	if w.Code != http.StatusCreated || home.ID == "" {
+		t.Fatalf("创建集合失败: %d %s", w.Code, w.Body.String())
+	}
+	w = sharingRequest(r, alice.VaultID, "POST", "/collections/"+home.ID+"/members", gin.H{"username": "bob", "role": "viewer"})
+	var member struct{ ID string }
+	json.Unmarshal(w.Body.Bytes(), &member)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("添加成员失败: %d %s", w.Code, w.Body.String())
+	}
+
+	// alice：一个个人凭证、一个共享凭证、一个共享订阅
+	sharingRequest(r, alice.VaultID, "POST", "/credentials", gin.H{"label": "bank", "username": "alice", "password": "personal-secret"})
+	w = sharingRequest(r, alice.VaultID, "POST", "/credentials", gin.H{"label": "netflix", "username": "family", "password": "shared-secret", "collectionId": home.ID})
+	var sharedCred models.Credential
+	json.Unmarshal(w.Body.Bytes(), &sharedCred)
+	w = sharingRequest(r, alice.VaultID, "POST", "/subscriptions", gin.H{"name": "Netflix", "cost": 30, "collectionId": home.ID})
+	var sharedSub models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &sharedSub)
+
+	var creds []models.Credential
+	w = sharingRequest(r, bob.VaultID, "GET", "/credentials", nil)
+	json.Unmarshal(w.Body.Bytes(), &creds)
+	if len(creds) != 1 || creds[0].ID != sharedCred.ID {
+		t.Fatalf("bob 应只看到共享凭证: %s", w.Body.String())
+	}
+	if creds[0].Password != "shared-secret" {
+		t.Fatalf("共享凭证应用创建者的数据密钥解密: %q", creds[0].Password)
+	}
+
+	var subs []models.Subscription
+	w = sharingRequest(r, bob.VaultID, "GET", "/subscriptions", nil)
+	json.Unmarshal(w.Body.Bytes(), &subs)
+	if len(subs) != 1 || subs[0].ID != sharedSub.ID {
+		t.Fatalf("bob 应看到共享订阅: %s", w.Body.String())
+	}
+
+	// viewer 只读
+	update := gin.H{"name": "Netflix 4K", "cost": 40, "currency": "CNY"}
+	if w := ifMatchRequest(r, bob.VaultID, "PUT", "/subscriptions/"+sharedSub.ID, currentETag(&models.Subscription{}, sharedSub.ID), update); w.Code != http.StatusForbidden {
+		t.Fatalf("viewer 修改共享订阅应返回 403: %d", w.Code)
+	}
+	if w := sharingRequest(r, bob.VaultID, "DELETE", "/credentials/"+sharedCred.ID, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("viewer 删除共享凭证应返回 403: %d", w.Code)
+	}
+	if w := sharingRequest(r, bob.VaultID, "POST", "/credentials", gin.H{"label": "x", "username": "x", "collectionId": home.ID}); w.Code != http.StatusForbidden {
+		t.Fatalf("viewer 不应能向集合新增凭证: %d", w.Code)
+	}
+
+	// 升级为 editor 后可以修改，密文仍用 alice 的数据密钥
+	sharingRequest(r, alice.VaultID, "PUT", "/collections/"+home.ID+"/members/"+member.ID, gin.H{"role": "editor"})
+	if w := ifMatchRequest(r, bob.VaultID, "PUT", "/subscriptions/"+sharedSub.ID, currentETag(&models.Subscription{}, sharedSub.ID), update); w.Code != http.StatusOK {
+		t.Fatalf("editor 应能修改共享订阅: %d %s", w.Code, w.Body.String())
+	}
+	if w := ifMatchRequest(r, bob.VaultID, "PUT", "/credentials/"+sharedCred.ID, currentETag(&models.Credential{}, sharedCred.ID), gin.H{"label": "netflix", "username": "family", "password": "rotated"}); w.Code != http.StatusOK {
+		t.Fatalf("editor 应能修改共享凭证: %d", w.Code)
+	}
+	w = sharingRequest(r, alice.VaultID, "GET", "/credentials", nil)
+	json.Unmarshal(w.Body.Bytes(), &creds)
+	for _, cred := range creds {
+		if cred.ID == sharedCred.ID && cred.Password != "rotated" {
+			t.Fatalf("所有者应能解密 editor 写入的密码: %q", cred.Password)
+		}
+	}
+
+	// editor 也不能把别人的记录移出集合
+	if w := sharingRequest(r, bob.VaultID, "PUT", "/subscriptions/"+sharedSub.ID+"/collection", gin.H{"collectionId": nil}); w.Code != http.StatusForbidden {
+		t.Fatalf("成员不应能移动他人的记录: %d", w.Code)
+	}
+	if w := sharingRequest(r, alice.VaultID, "PUT", "/subscriptions/"+sharedSub.ID+"/collection", gin.H{"collectionId": nil}); w.Code != http.StatusOK {
+		t.Fatalf("创建者应能把记录移回个人保险库: %d", w.Code)
+	}
+	w = sharingRequest(r, bob.VaultID, "GET", "/subscriptions", nil)
+	json.Unmarshal(w.Body.Bytes(), &subs)
+	if len(subs) != 0 {
+		t.Fatalf("移回个人后 bob 不应再看到: %s", w.Body.String())
+	}
+}
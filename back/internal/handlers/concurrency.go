@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 订阅、凭证、备忘录的乐观并发控制：记录的版本号以 ETag 返回，客户端更新时必须在 If-Match 中带上读取时的 ETag，
+// 记录已在其他设备上修改过时返回 409 和当前内容，不覆盖
+
+// ifMatchVersion 解析 If-Match 中的版本号，接受 "3" 和 W/"3"。
+// 没有该请求头或为 * 时返回 428，格式错误时返回 400；失败时已写入响应，ok 为 false
+func ifMatchVersion(c *gin.Context) (version int64, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "请在 If-Match 中带上读取时的 ETag"})
+		return 0, false
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 If-Match"})
+		return 0, false
+	}
+	return version, true
+}
+
+// setETag 把记录的版本号作为 ETag 返回
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// respondConflict 返回 409 和记录的当前内容（凭证和备忘录已解密），ETag 为当前版本
+func respondConflict(c *gin.Context, current interface{}, version int64) {
+	setETag(c, version)
+	c.JSON(http.StatusConflict, gin.H{"error": "记录已在其他地方修改，请确认最新内容后重试", "current": current})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupConcurrencyRouter() *gin.Engine {
+	cfg := getTestConfig()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	st := store.NewSQL(testDB)
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, st)
+	memos := NewMemoHandler(cfg, keyring.New(cfg), testDB, st)
+	r.POST("/credentials", vault.CreateCredential)
+	r.GET("/credentials/:id", vault.GetCredential)
+	r.PUT("/credentials/:id", vault.UpdateCredential)
+	r.PUT("/credentials/groups", vault.UpdateCredentialGroups)
+	r.POST("/memos", memos.CreateMemo)
+	r.PUT("/memos/:id", memos.UpdateMemo)
+	return r
+}
+
+// ifMatchRequest 与 sharingRequest 相同，另外带上 If-Match
+func ifMatchRequest(r *gin.Engine, vaultID, method, path, etag string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-ID", vaultID)
+	req.Header.Set("If-Match", etag)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// currentETag 读取数据库中记录的当前版本，用作 If-Match
+func currentETag(model interface{}, id string) string {
+	var version int64
+	testDB.Model(model).Select("version").Where("id = ?", id).Scan(&version)
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func TestUpdateCredentialIfMatch(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupConcurrencyRouter()
+
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", gin.H{"label": "GitHub", "username": "me", "password": "octocat"})
+	var cred models.Credential
+	json.Unmarshal(w.Body.Bytes(), &cred)
+	if w.Header().Get("ETag") != `"1"` || cred.Version != 1 {
+		t.Fatalf("创建后应返回版本 1 的 ETag: %q %d", w.Header().Get("ETag"), cred.Version)
+	}
+	w = sharingRequest(r, "test-vault-id", http.MethodGet, "/credentials/"+cred.ID, nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("读取单个凭证应返回 ETag: %d %q", w.Code, etag)
+	}
+
+	// 两台设备基于同一版本修改：先提交的成功，后提交的得到 409 和当前内容
+	w = ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, etag, gin.H{"label": "GitHub", "username": "me", "password": "laptop"})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("版本一致时应保存并返回新的 ETag: %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	w = ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, etag, gin.H{"label": "GitHub", "username": "me", "password": "phone"})
+	var conflict struct {
+		Current models.Credential `json:"current"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if w.Code != http.StatusConflict || conflict.Current.Password != "laptop" || conflict.Current.Version != 2 || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("版本过期时应返回 409 和解密后的当前内容: %d %s", w.Code, w.Body.String())
+	}
+
+	// 批量调整分组同样会使旧版本失效
+	sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/groups", gin.H{"assignments": []gin.H{{"id": cred.ID, "category": "工作"}}})
+	if w := ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, `"2"`, gin.H{"label": "GitHub", "username": "me"}); w.Code != http.StatusConflict {
+		t.Fatalf("分组调整后旧版本应冲突: %d", w.Code)
+	}
+	if w := ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, `W/"3"`, gin.H{"label": "GitHub", "username": "me", "category": "工作"}); w.Code != http.StatusOK {
+		t.Fatalf("弱 ETag 也应接受: %d %s", w.Code, w.Body.String())
+	}
+	if w := ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, "abc", gin.H{"label": "GitHub"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效的 If-Match 应返回 400: %d", w.Code)
+	}
+
+	var stored models.Credential
+	testDB.First(&stored, "id = ?", cred.ID)
+	if stored.Version != 4 {
+		t.Fatalf("数据库中的版本号应为 4: %d", stored.Version)
+	}
+}
+
+func TestUpdateMemoIfMatch(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupConcurrencyRouter()
+
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/memos", gin.H{"title": "Wi-Fi", "content": "密码 12345678"})
+	var memo models.Memo
+	json.Unmarshal(w.Body.Bytes(), &memo)
+
+	if w := ifMatchRequest(r, "test-vault-id", http.MethodPut, "/memos/"+memo.ID, `"1"`, gin.H{"title": "Wi-Fi", "content": "密码 87654321"}); w.Code != http.StatusOK {
+		t.Fatalf("版本一致时应保存: %d %s", w.Code, w.Body.String())
+	}
+	w = ifMatchRequest(r, "test-vault-id", http.MethodPut, "/memos/"+memo.ID, `"1"`, gin.H{"title": "Wi-Fi", "content": "旧设备的修改"})
+	var conflict struct {
+		Current models.Memo `json:"current"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if w.Code != http.StatusConflict || conflict.Current.Content != "密码 87654321" {
+		t.Fatalf("版本过期时应返回 409 和解密后的当前内容: %d %s", w.Code, w.Body.String())
+	}
+
+	// 不带 If-Match 或为 * 时无法判断客户端的数据是否过期，要求带上版本
+	if w := sharingRequest(r, "test-vault-id", http.MethodPut, "/memos/"+memo.ID, gin.H{"title": "Wi-Fi", "content": "脚本修改"}); w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("不带 If-Match 时应返回 428: %d", w.Code)
+	}
+	if w := ifMatchRequest(r, "test-vault-id", http.MethodPut, "/memos/"+memo.ID, "*", gin.H{"title": "Wi-Fi", "content": "脚本修改"}); w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("If-Match 为 * 时应返回 428: %d", w.Code)
+	}
+	var stored models.Memo
+	testDB.First(&stored, "id = ?", memo.ID)
+	if stored.Version != 2 {
+		t.Fatalf("缺少 If-Match 的修改不应保存: 版本 %d", stored.Version)
+	}
+}
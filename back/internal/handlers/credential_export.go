@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/audit"
+	"subvault/internal/exporter"
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
+	"subvault/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// reauthRequest 敏感操作前再次输入主密钥，开启了两步验证时还需验证器上的验证码
+type reauthRequest struct {
+	MasterKey string `json:"masterKey"`
+	TotpCode  string `json:"totpCode"`
+}
+
+// confirmIdentity 已登录时再次确认身份。失败与解锁共用锁定计数，锁定期内直接拒绝。
+// 只接受验证器上的验证码，不接受恢复码，避免用泄露的恢复码导出全部明文。
+// 校验失败返回 403 而不是 401，以免客户端当作会话过期去刷新令牌后重试。失败时已写入响应
+func confirmIdentity(c *gin.Context, db *gorm.DB, keys *keyring.Keyring, vaultID, action string, req reauthRequest) bool {
+	subject := lockout.VaultKey(vaultID, c.ClientIP())
+	if !rejectIfLocked(c, db, subject, lockout.IPKey(c.ClientIP())) {
+		recordAudit(c, db, vaultID, action, audit.OutcomeLocked, "", "")
+		return false
+	}
+
+	if req.MasterKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入主密钥"})
+		return false
+	}
+	switch err := accounts.VerifyPassphrase(db, vaultID, req.MasterKey); err {
+	case nil:
+	case accounts.ErrInvalidCredentials:
+		recordUnlockFailure(c, db, subject, vaultID, action, "主密钥错误")
+		c.JSON(http.StatusForbidden, gin.H{"error": "主密钥错误"})
+		return false
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证身份失败"})
+		return false
+	}
+
+	var setting models.TotpSetting
+	if db.Where("vault_id = ?", vaultID).First(&setting).Error == nil && setting.Enabled && setting.Verified {
+		if req.TotpCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要两步验证", "totp_required": true})
+			return false
+		}
+		key, ok := vaultDataKey(c, db, keys, vaultID)
+		if !ok {
+			return false
+		}
+		secret, err := key.DecryptField(setting.Secret, totpSecretAAD(setting.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+			return false
+		}
+		if !totp.Validate(req.TotpCode, secret) {
+			recordUnlockFailure(c, db, subject, vaultID, action, "验证码错误")
+			c.JSON(http.StatusForbidden, gin.H{"error": "验证码错误"})
+			return false
+		}
+	}
+
+	lockout.Reset(db, subject)
+	return true
+}
+
+type exportCredentialsRequest struct {
+	reauthRequest
+	Format string `json:"format"` // bitwarden-json、keepass-xml 或 csv
+}
+
+// ExportCredentials 确认身份后把自己的凭证导出为其他密码管理器可导入的明文文件，不含共享给自己的凭证
+// POST /api/v1/export/credentials
+func (h *VaultHandler) ExportCredentials(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var req exportCredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的导出请求"})
+		return
+	}
+	format, err := exporter.ParseFormat(req.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式"})
+		return
+	}
+	if !confirmIdentity(c, h.db, h.keys, vaultID, audit.ActionCredentialExport, req.reauthRequest) {
+		return
+	}
+
+	key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+	creds, err := h.store.Credentials.ListOwned(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取凭证失败"})
+		return
+	}
+	items := make([]exporter.Item, 0, len(creds))
+	for _, cred := range creds {
+		password, notes, err := credentialSecrets(key, cred)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解密凭证失败"})
+			return
+		}
+		folder := cred.Category
+		if folder == DefaultGroupName {
+			folder = ""
+		}
+		items = append(items, exporter.Item{
+			ID:        cred.ID,
+			Label:     cred.Label,
+			Username:  cred.Username,
+			Password:  password,
+			Website:   cred.Website,
+			Notes:     notes,
+			Folder:    folder,
+			CreatedAt: cred.CreatedAt,
+			UpdatedAt: cred.UpdatedAt,
+		})
+	}
+
+	file, err := exporter.Write(format, items, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成导出文件失败"})
+		return
+	}
+	recordAudit(c, h.db, vaultID, audit.ActionCredentialExport, audit.OutcomeSuccess, "", fmt.Sprintf("%s，%d 条", format, len(items)))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"subvault/internal/importer"
+	"subvault/internal/keyring"
+	"subvault/internal/middleware"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+func setupCredentialExportRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.AccessTokenTTL = time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys := keyring.New(cfg)
+	r.POST("/api/v1/auth/register", NewAuthHandler(cfg, keys, testDB).Register)
+
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(cfg, testDB))
+	vault := NewVaultHandler(cfg, keys, testDB, store.NewSQL(testDB))
+	protected.POST("/credentials", vault.CreateCredential)
+	protected.POST("/export/credentials", vault.ExportCredentials)
+	return r
+}
+
+func TestExportCredentialsRequiresMasterKeyAndTotp(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupCredentialExportRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+	authedJSON(r, alice.Token, http.MethodPost, "/api/v1/credentials", gin.H{"label": "GitHub", "username": "me", "password": "octocat", "website": "https://github.com", "category": "工作"})
+
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "lastpass", "masterKey": "alice-passphrase"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("不支持的格式应返回 400: %d", w.Code)
+	}
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "csv", "masterKey": "wrong-passphrase"}); w.Code != http.StatusForbidden {
+		t.Fatalf("主密钥错误应返回 403: %d", w.Code)
+	}
+
+	w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "bitwarden-json", "masterKey": "alice-passphrase"})
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".json") {
+		t.Fatalf("导出失败: %d %s", w.Code, w.Body.String())
+	}
+	result, err := importer.Parse(importer.FormatBitwardenJSON, w.Body.Bytes())
+	if err != nil || len(result.Items) != 1 || result.Items[0].Password != "octocat" || result.Items[0].Folder != "工作" {
+		t.Fatalf("导出内容应为解密后的明文: %+v %v", result, err)
+	}
+
+	// 开启两步验证后还需要验证码
+	key, err := keyring.New(getTestConfig()).DataKey(testDB, alice.VaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+	encrypted, _ := key.EncryptField(secret, totpSecretAAD("totp-1"))
+	testDB.Create(&models.TotpSetting{ID: "totp-1", VaultID: alice.VaultID, Secret: encrypted, Enabled: true, Verified: true})
+
+	w = authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "csv", "masterKey": "alice-passphrase"})
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusForbidden || resp["totp_required"] != true {
+		t.Fatalf("缺少验证码时应要求两步验证: %d %s", w.Code, w.Body.String())
+	}
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "csv", "masterKey": "alice-passphrase", "totpCode": "000000"}); w.Code != http.StatusForbidden {
+		t.Fatalf("验证码错误应返回 403: %d", w.Code)
+	}
+	code, _ := totp.GenerateCode(secret, time.Now())
+	w = authedJSON(r, alice.Token, http.MethodPost, "/api/v1/export/credentials", gin.H{"format": "keepass-xml", "masterKey": "alice-passphrase", "totpCode": code})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "octocat") {
+		t.Fatalf("主密钥和验证码正确时应导出: %d %s", w.Code, w.Body.String())
+	}
+
+	var failures int64
+	testDB.Model(&models.AuditEvent{}).Where("vault_id = ? AND action = ? AND outcome = ?", alice.VaultID, "credentials.export", "failure").Count(&failures)
+	if failures != 2 {
+		t.Fatalf("主密钥和验证码错误应记入审计日志，实际 %d 条", failures)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"subvault/internal/crypto"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultPasswordHistoryLimit 未设置时每个凭证保留的历史版本数
+	DefaultPasswordHistoryLimit = 10
+	maxPasswordHistoryLimit     = 100
+)
+
+// passwordHistoryLimit 返回保险库设置的历史版本上限，未设置时取默认值
+func passwordHistoryLimit(st *store.Store, vaultID string) int {
+	settings, err := st.Settings.Get(vaultID)
+	if err != nil || settings.PasswordHistoryLimit <= 0 {
+		return DefaultPasswordHistoryLimit
+	}
+	return settings.PasswordHistoryLimit
+}
+
+// credentialSecrets 解密凭证当前的密码和备注
+func credentialSecrets(key *crypto.Cipher, cred models.Credential) (password, notes string, err error) {
+	if password, err = key.DecryptField(cred.Password, credentialAAD(cred.ID, "password")); err != nil {
+		return "", "", err
+	}
+	if notes, err = key.DecryptField(cred.Notes, credentialAAD(cred.ID, "notes")); err != nil {
+		return "", "", err
+	}
+	return password, notes, nil
+}
+
+// newCredentialHistory 用明文密码和备注生成一条加密的历史版本
+func newCredentialHistory(key *crypto.Cipher, cred models.Credential, password, notes string) (*models.CredentialHistory, error) {
+	entry := &models.CredentialHistory{
+		ID:           uuid.New().String(),
+		VaultID:      cred.VaultID,
+		CredentialID: cred.ID,
+	}
+	var err error
+	if entry.Password, err = key.EncryptField(password, credentialHistoryAAD(entry.ID, "password")); err != nil {
+		return nil, err
+	}
+	if entry.Notes, err = key.EncryptField(notes, credentialHistoryAAD(entry.ID, "notes")); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetCredentialHistory 按时间倒序列出凭证被替换前的密码和备注
+// GET /api/v1/credentials/:id/history
+func (h *VaultHandler) GetCredentialHistory(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	cred, err := h.store.Credentials.GetReadable(vaultID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
+		return
+	}
+	key, ok := vaultDataKey(c, h.db, h.keys, cred.VaultID)
+	if !ok {
+		return
+	}
+
+	entries, err := h.store.Credentials.History(cred.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取历史版本失败"})
+		return
+	}
+	for i := range entries {
+		entries[i].Password, _ = key.DecryptField(entries[i].Password, credentialHistoryAAD(entries[i].ID, "password"))
+		entries[i].Notes, _ = key.DecryptField(entries[i].Notes, credentialHistoryAAD(entries[i].ID, "notes"))
+	}
+	auditCredentialRead(c, h.db, vaultID, []models.Credential{cred})
+
+	if entries == nil {
+		entries = []models.CredentialHistory{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// RestoreCredentialHistory 用历史版本的密码和备注替换当前值，被替换的当前值同样进入历史
+// POST /api/v1/credentials/:id/history/:historyId/restore
+func (h *VaultHandler) RestoreCredentialHistory(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	cred, err := h.store.Credentials.GetReadable(vaultID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
+		return
+	}
+	if !requireEditable(c, h.db, vaultID, cred.VaultID, cred.CollectionID) {
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if expected != cred.Version {
+		h.respondCredentialConflict(c, cred)
+		return
+	}
+	entry, err := h.store.Credentials.GetHistory(cred.ID, c.Param("historyId"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "历史版本不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取历史版本失败"})
+		}
+		return
+	}
+
+	key, ok := vaultDataKey(c, h.db, h.keys, cred.VaultID)
+	if !ok {
+		return
+	}
+	password, err := key.DecryptField(entry.Password, credentialHistoryAAD(entry.ID, "password"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密历史版本失败"})
+		return
+	}
+	notes, err := key.DecryptField(entry.Notes, credentialHistoryAAD(entry.ID, "notes"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密历史版本失败"})
+		return
+	}
+	oldPassword, oldNotes, err := credentialSecrets(key, cred)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密凭证失败"})
+		return
+	}
+	previous, err := newCredentialHistory(key, cred, oldPassword, oldNotes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return
+	}
+
+	if cred.Password, err = key.EncryptField(password, credentialAAD(cred.ID, "password")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return
+	}
+	if cred.Notes, err = key.EncryptField(notes, credentialAAD(cred.ID, "notes")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return
+	}
+	if err := h.store.Credentials.SaveWithHistory(&cred, previous, passwordHistoryLimit(h.store, cred.VaultID)); errors.Is(err, store.ErrConflict) {
+		h.credentialConflict(c, vaultID, cred.ID)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复历史版本失败"})
+		return
+	}
+
+	cred.Password, cred.Notes = password, notes
+	setETag(c, cred.Version)
+	c.JSON(http.StatusOK, cred)
+}
+
+// GetPasswordHistoryLimit 返回每个凭证保留的历史版本数
+// GET /api/v1/credentials/history-limit
+func (h *VaultHandler) GetPasswordHistoryLimit(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"limit": passwordHistoryLimit(h.store, c.GetString("vaultId"))})
+}
+
+// SavePasswordHistoryLimit 修改每个凭证保留的历史版本数，超出部分在凭证下次修改时删除
+// PUT /api/v1/credentials/history-limit
+func (h *VaultHandler) SavePasswordHistoryLimit(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var input struct {
+		Limit int `json:"limit"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Limit < 1 || input.Limit > maxPasswordHistoryLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "历史版本数需在 1 到 100 之间"})
+		return
+	}
+
+	settings, err := h.store.Settings.Get(vaultID)
+	if err != nil {
+		settings = models.NotificationSetting{
+			VaultID:              vaultID,
+			Enabled:              true,
+			DaysBeforeList:       "1,3,7",
+			WebhookPlatform:      "auto",
+			WebhookDaysBefore:    "1,2,3",
+			CalendarToken:        newCalendarToken(),
+			BaseCurrency:         "CNY",
+			PasswordHistoryLimit: input.Limit,
+		}
+		err = h.store.Settings.Create(&settings)
+	} else {
+		settings.PasswordHistoryLimit = input.Limit
+		err = h.store.Settings.Save(&settings)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"limit": input.Limit})
+}
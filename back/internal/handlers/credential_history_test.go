@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupCredentialHistoryRouter() *gin.Engine {
+	cfg := getTestConfig()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, store.NewSQL(testDB))
+	r.POST("/credentials", vault.CreateCredential)
+	r.GET("/credentials/history-limit", vault.GetPasswordHistoryLimit)
+	r.PUT("/credentials/history-limit", vault.SavePasswordHistoryLimit)
+	r.PUT("/credentials/:id", vault.UpdateCredential)
+	r.GET("/credentials/:id/history", vault.GetCredentialHistory)
+	r.POST("/credentials/:id/history/:historyId/restore", vault.RestoreCredentialHistory)
+	return r
+}
+
+func getCredentialHistory(t *testing.T, r *gin.Engine, vaultID, credID string) []models.CredentialHistory {
+	w := sharingRequest(r, vaultID, http.MethodGet, "/credentials/"+credID+"/history", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("读取历史版本失败: %d %s", w.Code, w.Body.String())
+	}
+	var entries []models.CredentialHistory
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestUpdateCredentialKeepsHistoryAndRestores(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupCredentialHistoryRouter()
+
+	var cred models.Credential
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "GitHub", "password": "first", "notes": "旧备注"})
+	json.Unmarshal(w.Body.Bytes(), &cred)
+
+	// 只改用户名不产生历史
+	ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, currentETag(&models.Credential{}, cred.ID), map[string]string{"label": "GitHub", "username": "me"})
+	if entries := getCredentialHistory(t, r, "test-vault-id", cred.ID); len(entries) != 0 {
+		t.Fatalf("密码和备注未变化时不应记录历史: %+v", entries)
+	}
+
+	ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, currentETag(&models.Credential{}, cred.ID), map[string]string{"label": "GitHub", "password": "second"})
+	entries := getCredentialHistory(t, r, "test-vault-id", cred.ID)
+	if len(entries) != 1 || entries[0].Password != "first" || entries[0].Notes != "旧备注" {
+		t.Fatalf("修改密码后应记录解密后的旧值: %+v", entries)
+	}
+	var stored models.CredentialHistory
+	testDB.First(&stored, "id = ?", entries[0].ID)
+	if stored.Password == "first" || stored.Password == "" {
+		t.Fatal("历史版本应加密存储")
+	}
+
+	w = ifMatchRequest(r, "test-vault-id", http.MethodPost, "/credentials/"+cred.ID+"/history/"+entries[0].ID+"/restore", currentETag(&models.Credential{}, cred.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("恢复历史版本失败: %d %s", w.Code, w.Body.String())
+	}
+	var restored models.Credential
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	if restored.Password != "first" {
+		t.Fatalf("恢复后密码应为旧值，实际 %q", restored.Password)
+	}
+	entries = getCredentialHistory(t, r, "test-vault-id", cred.ID)
+	if len(entries) != 2 || entries[0].Password != "second" {
+		t.Fatalf("恢复前的当前值应进入历史: %+v", entries)
+	}
+
+	if w := sharingRequest(r, "other-vault", http.MethodGet, "/credentials/"+cred.ID+"/history", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("其他保险库不应能读取历史，实际 %d", w.Code)
+	}
+}
+
+func TestPasswordHistoryLimit(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupCredentialHistoryRouter()
+
+	w := sharingRequest(r, "test-vault-id", http.MethodGet, "/credentials/history-limit", nil)
+	if w.Body.String() != `{"limit":10}` {
+		t.Fatalf("未设置时应返回默认值: %s", w.Body.String())
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/history-limit", map[string]int{"limit": 0}); w.Code != http.StatusBadRequest {
+		t.Fatalf("上限为 0 应被拒绝，实际 %d", w.Code)
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/history-limit", map[string]int{"limit": 2}); w.Code != http.StatusOK {
+		t.Fatalf("保存上限失败: %d %s", w.Code, w.Body.String())
+	}
+
+	var cred models.Credential
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "GitHub", "password": "p0"})
+	json.Unmarshal(w.Body.Bytes(), &cred)
+	for _, password := range []string{"p1", "p2", "p3"} {
+		ifMatchRequest(r, "test-vault-id", http.MethodPut, "/credentials/"+cred.ID, currentETag(&models.Credential{}, cred.ID), map[string]string{"label": "GitHub", "password": password})
+	}
+	entries := getCredentialHistory(t, r, "test-vault-id", cred.ID)
+	if len(entries) != 2 || entries[0].Password != "p2" || entries[1].Password != "p1" {
+		t.Fatalf("应只保留最近 2 条历史: %+v", entries)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"subvault/internal/importer"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxImportFileSize 导入文件的大小上限
+	maxImportFileSize = 20 << 20
+	// maxImportItems 一次导入的条目上限
+	maxImportItems = 5000
+)
+
+type credentialImportRequest struct {
+	Format   string `json:"format"` // 为空时按文件内容识别
+	FileName string `json:"fileName"`
+	Content  []byte `json:"content"` // 文件原始内容，base64 编码
+	Atomic   bool   `json:"atomic"`  // 为 true 时任何一条失败都整批不写入
+}
+
+// credentialImportItem 预览中的一条，exists 表示已有相同名称、账号和网址的凭证，导入时会跳过
+type credentialImportItem struct {
+	batchCredentialItem
+	Exists bool `json:"exists"`
+}
+
+// parseCredentialImport 解析请求中的导出文件，同时返回是否整批导入，失败时已写入响应
+func parseCredentialImport(c *gin.Context) (importer.Result, bool, bool) {
+	var input credentialImportRequest
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.Content) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传导出文件"})
+		return importer.Result{}, false, false
+	}
+	if len(input.Content) > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件过大，最大 20MB"})
+		return importer.Result{}, false, false
+	}
+	format, err := importer.ParseFormat(input.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导入格式"})
+		return importer.Result{}, false, false
+	}
+
+	result, err := importer.Parse(format, input.Content)
+	switch {
+	case errors.Is(err, importer.ErrUnknownFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法识别文件格式，支持 Bitwarden、1Password、KeePass 和浏览器导出的文件"})
+		return importer.Result{}, false, false
+	case errors.Is(err, importer.ErrEncrypted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持加密的导出文件，请导出为未加密的格式"})
+		return importer.Result{}, false, false
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件内容与格式不符"})
+		return importer.Result{}, false, false
+	}
+	if len(result.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件中没有可导入的凭证"})
+		return importer.Result{}, false, false
+	}
+	if len(result.Items) > maxImportItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多导入 5000 条"})
+		return importer.Result{}, false, false
+	}
+	return result, input.Atomic, true
+}
+
+func importItems(items []importer.Item) []batchCredentialItem {
+	out := make([]batchCredentialItem, 0, len(items))
+	for _, item := range items {
+		out = append(out, batchCredentialItem{
+			Label:    item.Label,
+			Username: item.Username,
+			Password: item.Password,
+			Notes:    item.Notes,
+			Website:  item.Website,
+			Category: item.Folder,
+		})
+	}
+	return out
+}
+
+// PreviewCredentialImport 解析导出文件但不写入，返回条目供用户挑选后经 /credentials/batch 导入
+func (h *VaultHandler) PreviewCredentialImport(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	result, _, ok := parseCredentialImport(c)
+	if !ok {
+		return
+	}
+
+	existing, _ := h.store.Credentials.ListOwned(vaultID)
+	seen := make(map[string]struct{}, len(existing))
+	for _, cred := range existing {
+		seen[credentialDupKey(cred.Label, cred.Username, cred.Website)] = struct{}{}
+	}
+	items := make([]credentialImportItem, 0, len(result.Items))
+	for _, item := range importItems(result.Items) {
+		_, exists := seen[credentialDupKey(item.Label, item.Username, item.Website)]
+		items = append(items, credentialImportItem{batchCredentialItem: item, Exists: exists})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"format":      result.Format,
+		"items":       items,
+		"unsupported": result.Skipped,
+	})
+}
+
+// ImportCredentials 解析导出文件并直接导入全部条目，文件夹映射为分组
+func (h *VaultHandler) ImportCredentials(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	result, atomic, ok := parseCredentialImport(c)
+	if !ok {
+		return
+	}
+	created, skipped, failed, ok := h.createCredentials(c, vaultID, importItems(result.Items), atomic)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"format":       result.Format,
+		"created":      created,
+		"skipped":      skipped,
+		"failed":       failed,
+		"createdCount": len(created),
+		"skippedCount": len(skipped),
+		"failedCount":  len(failed),
+		"unsupported":  result.Skipped,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupCredentialImportRouter() *gin.Engine {
+	cfg := getTestConfig()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, store.NewSQL(testDB))
+	r.GET("/credentials", vault.GetCredentials)
+	r.POST("/credentials", vault.CreateCredential)
+	r.POST("/credentials/import", vault.ImportCredentials)
+	r.POST("/credentials/import/preview", vault.PreviewCredentialImport)
+	return r
+}
+
+const bitwardenExportSample = `{
+  "encrypted": false,
+  "folders": [{"id": "f1", "name": "work"}, {"id": "f2", "name": "社交"}],
+  "items": [
+    {"type": 1, "name": "GitHub", "folderId": "f1", "login": {"username": "me", "password": "octocat", "uris": [{"uri": "https://github.com"}]}},
+    {"type": 1, "name": "Twitter", "folderId": "f1", "login": {"username": "me", "password": "tweet"}},
+    {"type": 1, "name": "Twitter", "folderId": "f1", "login": {"username": "me", "password": "tweet"}},
+    {"type": 1, "name": "Weibo", "folderId": "f2", "login": {"username": "me", "password": "weibo"}},
+    {"type": 4, "name": "身份证", "identity": {}}
+  ]
+}`
+
+func TestImportCredentialsFromBitwarden(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupCredentialImportRouter()
+
+	// 已有的凭证和分组：GitHub 重复，文件夹 work 归入已有的 Work 分组
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", map[string]string{"label": "github", "username": "ME", "website": "github.com", "password": "mine"})
+	testDB.Create(&models.Tag{VaultID: "test-vault-id", Name: "Work", Color: "#3B82F6"})
+
+	body := gin.H{"fileName": "bitwarden.json", "content": []byte(bitwardenExportSample)}
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/import/preview", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("预览失败: %d %s", w.Code, w.Body.String())
+	}
+	var preview struct {
+		Format      string                 `json:"format"`
+		Items       []credentialImportItem `json:"items"`
+		Unsupported int                    `json:"unsupported"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Format != "bitwarden-json" || len(preview.Items) != 4 || preview.Unsupported != 1 {
+		t.Fatalf("预览结果不正确: %+v", preview)
+	}
+	if !preview.Items[0].Exists || preview.Items[1].Exists {
+		t.Fatalf("预览应标出已存在的凭证: %+v", preview.Items)
+	}
+	if creds := listCredentials(r, "test-vault-id"); len(creds) != 1 {
+		t.Fatalf("预览不应写入: %+v", creds)
+	}
+
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/import", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("导入失败: %d %s", w.Code, w.Body.String())
+	}
+	var result struct {
+		CreatedCount int `json:"createdCount"`
+		SkippedCount int `json:"skippedCount"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.CreatedCount != 2 || result.SkippedCount != 2 {
+		t.Fatalf("应导入 Twitter 和 Weibo 两条: %+v", result)
+	}
+
+	creds := listCredentials(r, "test-vault-id")
+	for _, cred := range creds {
+		if cred.Label == "Twitter" && (cred.Password != "tweet" || cred.Category != "Work") {
+			t.Fatalf("文件夹应归入大小写不同的已有分组: %+v", cred)
+		}
+		if cred.Label == "Weibo" && cred.Category != "社交" {
+			t.Fatalf("导入的凭证不正确: %+v", cred)
+		}
+	}
+	var tags []models.Tag
+	testDB.Where("vault_id = ? AND name = ?", "test-vault-id", "社交").Find(&tags)
+	if len(tags) != 1 {
+		t.Fatal("文件夹应自动创建为分组")
+	}
+
+	// 同一文件再次导入全部跳过
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/import", body)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.CreatedCount != 0 {
+		t.Fatalf("重复导入不应产生新凭证: %+v", result)
+	}
+}
+
+func TestImportCredentialsRejectsUnknownFiles(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupCredentialImportRouter()
+
+	for _, body := range []gin.H{
+		{"content": []byte("a,b,c\n1,2,3\n")},
+		{"content": []byte(`{"encrypted": true, "items": []}`)},
+		{"format": "lastpass", "content": []byte("url,username,password\n")},
+		{"format": "keepass-xml", "content": []byte("not xml")},
+	} {
+		if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/import", body); w.Code != http.StatusBadRequest {
+			t.Fatalf("%v 应返回 400，实际 %d", body["format"], w.Code)
+		}
+	}
+}
@@ -1,14 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
-	"subvault/internal/crypto"
-	"subvault/internal/database"
 	"subvault/internal/models"
+	"subvault/internal/store"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type GroupAssignment struct {
@@ -18,6 +19,7 @@ type GroupAssignment struct {
 
 type updateGroupsRequest struct {
 	Assignments []GroupAssignment `json:"assignments"`
+	Atomic      bool              `json:"atomic"` // 为 true 时任何一条无法调整都整批不修改
 }
 
 type batchCredentialItem struct {
@@ -30,7 +32,8 @@ type batchCredentialItem struct {
 }
 
 type batchCreateCredentialsRequest struct {
-	Items []batchCredentialItem `json:"items"`
+	Items  []batchCredentialItem `json:"items"`
+	Atomic bool                  `json:"atomic"` // 为 true 时任何一条失败都整批不写入
 }
 
 type batchResultItem struct {
@@ -38,6 +41,9 @@ type batchResultItem struct {
 	Reason string `json:"reason"`
 }
 
+// errBatchRejected 整批模式下有条目失败，用于回滚事务
+var errBatchRejected = errors.New("batch rejected")
+
 func (h *VaultHandler) BatchCreateCredentials(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
@@ -55,111 +61,163 @@ func (h *VaultHandler) BatchCreateCredentials(c *gin.Context) {
 		return
 	}
 
-	var existing []models.Credential
-	database.DB.Select("label", "username", "website").Where("vault_id = ?", vaultID).Find(&existing)
-	seen := make(map[string]struct{}, len(existing)+len(input.Items))
-	for _, cred := range existing {
-		seen[credentialDupKey(cred.Label, cred.Username, cred.Website)] = struct{}{}
+	created, skipped, failed, ok := h.createCredentials(c, vaultID, input.Items, input.Atomic)
+	if !ok {
+		return
 	}
 
-	names := make([]string, 0, len(input.Items))
-	for _, item := range input.Items {
-		names = append(names, item.Category)
+	c.JSON(http.StatusOK, gin.H{
+		"created":      created,
+		"skipped":      skipped,
+		"failed":       failed,
+		"createdCount": len(created),
+		"skippedCount": len(skipped),
+		"failedCount":  len(failed),
+	})
+}
+
+// createCredentials 逐条加密写入，与已有凭证或本批前面的条目 credentialDupKey 相同时跳过。
+// 分组按名称不区分大小写匹配已有分组，没有的自动创建。
+// atomic 为 true 时分组和凭证在一个事务中写入，遇到第一条失败即整批回滚；跳过的重复条目不算失败。
+// 取数据密钥失败、整批回滚或数据库出错时已写入响应，ok 为 false
+func (h *VaultHandler) createCredentials(c *gin.Context, vaultID string, items []batchCredentialItem, atomic bool) (created []models.Credential, skipped, failed []batchResultItem, ok bool) {
+	dataKey, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return nil, nil, nil, false
 	}
-	ensureTagsForNames(vaultID, names)
 
-	created := make([]models.Credential, 0)
-	skipped := make([]batchResultItem, 0)
-	failed := make([]batchResultItem, 0)
+	existing, _ := h.store.Credentials.ListOwned(vaultID)
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Category)
+	}
 
-	for _, item := range input.Items {
-		label := strings.TrimSpace(item.Label)
-		if label == "" {
-			failed = append(failed, batchResultItem{Label: item.Label, Reason: "缺少名称"})
-			continue
+	write := func(st *store.Store) error {
+		created = make([]models.Credential, 0)
+		skipped = make([]batchResultItem, 0)
+		failed = make([]batchResultItem, 0)
+		reject := func(label, reason string) error {
+			failed = append(failed, batchResultItem{Label: label, Reason: reason})
+			if atomic {
+				return errBatchRejected
+			}
+			return nil
 		}
 
-		username := strings.TrimSpace(item.Username)
-		password := item.Password
-		notes := item.Notes
-		website := strings.TrimSpace(item.Website)
-		if username == "" && strings.TrimSpace(password) == "" && strings.TrimSpace(notes) == "" && website == "" {
-			failed = append(failed, batchResultItem{Label: label, Reason: "缺少账号、密码或备注"})
-			continue
+		seen := make(map[string]struct{}, len(existing)+len(items))
+		for _, cred := range existing {
+			seen[credentialDupKey(cred.Label, cred.Username, cred.Website)] = struct{}{}
 		}
-
-		key := credentialDupKey(label, username, website)
-		if _, ok := seen[key]; ok {
-			skipped = append(skipped, batchResultItem{Label: label, Reason: "已存在，已跳过"})
-			continue
+		canonical, _, err := ensureTagsForNames(st, vaultID, names)
+		if err != nil && atomic {
+			return err
 		}
 
-		cred := models.Credential{
-			VaultID:  vaultID,
-			Label:    label,
-			Username: username,
-			Password: password,
-			Notes:    notes,
-			Website:  website,
-			Category: ResolveGroupName(item.Category),
-		}
+		for _, item := range items {
+			label := strings.TrimSpace(item.Label)
+			if label == "" {
+				if err := reject(item.Label, "缺少名称"); err != nil {
+					return err
+				}
+				continue
+			}
 
-		if cred.Password != "" {
-			encrypted, err := crypto.EncryptField(cred.Password, h.cfg.EncryptionKey)
-			if err != nil {
-				failed = append(failed, batchResultItem{Label: label, Reason: "加密失败"})
+			username := strings.TrimSpace(item.Username)
+			password := item.Password
+			notes := item.Notes
+			website := strings.TrimSpace(item.Website)
+			if username == "" && strings.TrimSpace(password) == "" && strings.TrimSpace(notes) == "" && website == "" {
+				if err := reject(label, "缺少账号、密码或备注"); err != nil {
+					return err
+				}
 				continue
 			}
-			cred.Password = encrypted
-		}
-		if cred.Notes != "" {
-			encrypted, err := crypto.EncryptField(cred.Notes, h.cfg.EncryptionKey)
-			if err != nil {
-				failed = append(failed, batchResultItem{Label: label, Reason: "加密失败"})
+
+			key := credentialDupKey(label, username, website)
+			if _, ok := seen[key]; ok {
+				skipped = append(skipped, batchResultItem{Label: label, Reason: "已存在，已跳过"})
 				continue
 			}
-			cred.Notes = encrypted
-		}
 
-		if err := database.DB.Create(&cred).Error; err != nil {
-			failed = append(failed, batchResultItem{Label: label, Reason: "写入失败"})
-			continue
-		}
+			cred := models.Credential{
+				ID:       uuid.New().String(),
+				VaultID:  vaultID,
+				Label:    label,
+				Username: username,
+				Password: password,
+				Notes:    notes,
+				Website:  website,
+				Category: ResolveGroupName(item.Category),
+			}
+			if name, ok := canonical[item.Category]; ok {
+				cred.Category = name
+			}
 
-		if cred.Password != "" {
-			cred.Password, _ = crypto.DecryptField(cred.Password, h.cfg.EncryptionKey)
-		}
-		if cred.Notes != "" {
-			cred.Notes, _ = crypto.DecryptField(cred.Notes, h.cfg.EncryptionKey)
-		}
+			if cred.Password != "" {
+				encrypted, err := dataKey.EncryptField(cred.Password, credentialAAD(cred.ID, "password"))
+				if err != nil {
+					if err := reject(label, "加密失败"); err != nil {
+						return err
+					}
+					continue
+				}
+				cred.Password = encrypted
+			}
+			if cred.Notes != "" {
+				encrypted, err := dataKey.EncryptField(cred.Notes, credentialAAD(cred.ID, "notes"))
+				if err != nil {
+					if err := reject(label, "加密失败"); err != nil {
+						return err
+					}
+					continue
+				}
+				cred.Notes = encrypted
+			}
 
-		seen[key] = struct{}{}
-		created = append(created, cred)
+			if err := st.Credentials.Create(&cred); err != nil {
+				if atomic {
+					return err
+				}
+				failed = append(failed, batchResultItem{Label: label, Reason: "写入失败"})
+				continue
+			}
+
+			cred.Password, cred.Notes = password, notes
+			seen[key] = struct{}{}
+			created = append(created, cred)
+		}
+		return nil
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"created":      created,
-		"skipped":      skipped,
-		"failed":       failed,
-		"createdCount": len(created),
-		"skippedCount": len(skipped),
-		"failedCount":  len(failed),
-	})
+	if !atomic {
+		write(h.store)
+		return created, skipped, failed, true
+	}
+	switch err := h.store.Transaction(write); {
+	case errors.Is(err, errBatchRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "有凭证无法导入，整批未写入", "failed": failed})
+		return nil, nil, nil, false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入凭证失败，整批未写入"})
+		return nil, nil, nil, false
+	}
+	return created, skipped, failed, true
 }
 
 func (h *VaultHandler) UpdateCredentialGroups(c *gin.Context) {
-	updateRecordGroups(c, &models.Credential{})
+	updateRecordGroups(c, h.store, func(st *store.Store) store.Records { return st.Credentials })
 }
 
 func (h *VaultHandler) UpdateSubscriptionGroups(c *gin.Context) {
-	updateRecordGroups(c, &models.Subscription{})
+	updateRecordGroups(c, h.store, func(st *store.Store) store.Records { return st.Subscriptions })
 }
 
 func (h *MemoHandler) UpdateMemoGroups(c *gin.Context) {
-	updateRecordGroups(c, &models.Memo{})
+	updateRecordGroups(c, h.store, func(st *store.Store) store.Records { return st.Memos })
 }
 
-func updateRecordGroups(c *gin.Context, model interface{}) {
+// updateRecordGroups 批量修改分组。records 从传入的 Store 中取出要修改的记录类型，整批模式下传入的是事务中的 Store
+func updateRecordGroups(c *gin.Context, st *store.Store, records func(*store.Store) store.Records) {
 	vaultID := c.GetString("vaultId")
 
 	var input updateGroupsRequest
@@ -176,23 +234,53 @@ func updateRecordGroups(c *gin.Context, model interface{}) {
 	for _, item := range input.Assignments {
 		names = append(names, item.Category)
 	}
-	canonical, _ := ensureTagsForNames(vaultID, names)
 
 	updated := 0
-	for _, item := range input.Assignments {
-		id := strings.TrimSpace(item.ID)
-		if id == "" {
-			continue
+	var failed []string
+	write := func(st *store.Store) error {
+		updated, failed = 0, []string{}
+		canonical, _, err := ensureTagsForNames(st, vaultID, names)
+		if err != nil && input.Atomic {
+			return err
 		}
-		name := ResolveGroupName(item.Category)
-		if next, ok := canonical[item.Category]; ok {
-			name = next
+		for _, item := range input.Assignments {
+			id := strings.TrimSpace(item.ID)
+			name := ResolveGroupName(item.Category)
+			if next, ok := canonical[item.Category]; ok {
+				name = next
+			}
+			// 不存在或只读共享的记录不计入 updated
+			ok := false
+			if id != "" {
+				var err error
+				if ok, err = records(st).SetCategory(vaultID, id, name); err != nil && input.Atomic {
+					return err
+				}
+			}
+			if ok {
+				updated++
+			} else if input.Atomic {
+				failed = append(failed, item.ID)
+			}
 		}
-		result := database.DB.Model(model).Where("id = ? AND vault_id = ?", id, vaultID).Update("category", name)
-		if result.Error == nil {
-			updated += int(result.RowsAffected)
+		if len(failed) > 0 {
+			return errBatchRejected
 		}
+		return nil
 	}
 
+	if !input.Atomic {
+		write(st)
+		c.JSON(http.StatusOK, gin.H{"updated": updated})
+		return
+	}
+	switch err := st.Transaction(write); {
+	case errors.Is(err, errBatchRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分记录不存在或无权修改，整批未修改", "failed": failed})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "调整分组失败，整批未修改"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"updated": updated})
 }
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"subvault/internal/keyring"
+	"subvault/internal/middleware"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupBatchRouter() *gin.Engine {
+	cfg := getTestConfig()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	idempotent := middleware.Idempotent(testDB, keyring.New(cfg))
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, store.NewSQL(testDB))
+	r.POST("/credentials", vault.CreateCredential)
+	r.POST("/credentials/batch", idempotent, vault.BatchCreateCredentials)
+	r.PUT("/credentials/groups", idempotent, vault.UpdateCredentialGroups)
+	return r
+}
+
+// idempotentRequest 与 sharingRequest 相同，另外带上 Idempotency-Key
+func idempotentRequest(r *gin.Engine, vaultID, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-ID", vaultID)
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func countCredentials(vaultID string) int64 {
+	var n int64
+	testDB.Model(&models.Credential{}).Where("vault_id = ? AND deleted_at IS NULL", vaultID).Count(&n)
+	return n
+}
+
+func TestBatchCreateCredentialsAtomic(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBatchRouter()
+
+	items := []gin.H{
+		{"label": "GitHub", "username": "me", "password": "octocat", "category": "开发"},
+		{"label": "", "password": "no-label"},
+	}
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", gin.H{"items": items, "atomic": true})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("整批模式下有条目失败应返回 400: %d %s", w.Code, w.Body.String())
+	}
+	var tags int64
+	testDB.Model(&models.Tag{}).Where("vault_id = ? AND name = ?", "test-vault-id", "开发").Count(&tags)
+	if n := countCredentials("test-vault-id"); n != 0 || tags != 0 {
+		t.Fatalf("整批模式失败后不应写入任何凭证或分组: %d 条凭证，%d 个分组", n, tags)
+	}
+
+	// 默认模式逐条写入，失败的条目单独列出
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", gin.H{"items": items})
+	var resp struct {
+		CreatedCount int `json:"createdCount"`
+		FailedCount  int `json:"failedCount"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.CreatedCount != 1 || resp.FailedCount != 1 {
+		t.Fatalf("默认模式应写入可导入的条目: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchCreateCredentialsIdempotencyKey(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBatchRouter()
+
+	body := gin.H{"items": []gin.H{{"label": "GitHub", "username": "me", "password": "octocat"}, {"label": "Wi-Fi", "password": "12345678"}}}
+	first := idempotentRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", "import-1", body)
+	if first.Code != http.StatusOK {
+		t.Fatalf("导入失败: %d %s", first.Code, first.Body.String())
+	}
+
+	// 同一个键重试：返回第一次的响应，不重复写入，也不会因为已存在被记为跳过
+	retry := idempotentRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", "import-1", body)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("重试应原样返回第一次的响应: %d %s", retry.Code, retry.Body.String())
+	}
+	if n := countCredentials("test-vault-id"); n != 2 {
+		t.Fatalf("重试不应重复写入，实际 %d 条", n)
+	}
+	// 响应中的明文密码不能落库
+	var saved models.IdempotencyKey
+	testDB.Where("vault_id = ? AND key = ?", "test-vault-id", "import-1").First(&saved)
+	if saved.Response == "" || bytes.Contains([]byte(saved.Response), []byte("octocat")) {
+		t.Fatalf("保存的响应应加密: %q", saved.Response)
+	}
+
+	other := gin.H{"items": []gin.H{{"label": "Email", "password": "secret"}}}
+	if w := idempotentRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", "import-1", other); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("同一个键用于不同请求应返回 422: %d", w.Code)
+	}
+	// 键按保险库隔离
+	testDB.Create(&models.Vault{ID: "other-vault", KeyHash: "other-vault"})
+	if w := idempotentRequest(r, "other-vault", http.MethodPost, "/credentials/batch", "import-1", body); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("其他保险库使用相同的键应正常处理: %d", w.Code)
+	}
+}
+
+func TestUpdateGroupsAtomic(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBatchRouter()
+
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", gin.H{"label": "GitHub", "password": "octocat", "category": "工作"})
+	var cred models.Credential
+	json.Unmarshal(w.Body.Bytes(), &cred)
+
+	assignments := []gin.H{{"id": cred.ID, "category": "开发"}, {"id": "missing", "category": "开发"}}
+	w = sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/groups", gin.H{"assignments": assignments, "atomic": true})
+	var resp struct {
+		Failed []string `json:"failed"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusBadRequest || len(resp.Failed) != 1 || resp.Failed[0] != "missing" {
+		t.Fatalf("整批模式下有记录无法调整应返回 400 并列出: %d %s", w.Code, w.Body.String())
+	}
+	var stored models.Credential
+	testDB.First(&stored, "id = ?", cred.ID)
+	if stored.Category != "工作" {
+		t.Fatalf("整批模式失败后不应修改任何记录: %s", stored.Category)
+	}
+
+	w = sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/groups", gin.H{"assignments": assignments})
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"updated":1`)) {
+		t.Fatalf("默认模式应修改可调整的记录: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAtomicBatchRollsBackWhenGroupCreationFails(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupBatchRouter()
+
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials", gin.H{"label": "GitHub", "password": "octocat", "category": "工作"})
+	var cred models.Credential
+	json.Unmarshal(w.Body.Bytes(), &cred)
+
+	if err := testDB.Exec("CREATE TRIGGER reject_tags BEFORE INSERT ON tags BEGIN SELECT RAISE(ABORT, 'tags unavailable'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.Exec("DROP TRIGGER reject_tags")
+
+	// 新分组写不进去时整批回滚，不会把记录挪到默认分组
+	w = sharingRequest(r, "test-vault-id", http.MethodPut, "/credentials/groups", gin.H{"assignments": []gin.H{{"id": cred.ID, "category": "开发"}}, "atomic": true})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("分组创建失败时整批模式应返回 500: %d %s", w.Code, w.Body.String())
+	}
+	var stored models.Credential
+	testDB.First(&stored, "id = ?", cred.ID)
+	if stored.Category != "工作" {
+		t.Fatalf("整批模式失败后不应修改任何记录: %s", stored.Category)
+	}
+
+	items := []gin.H{{"label": "Wi-Fi", "password": "12345678", "category": "家庭"}}
+	w = sharingRequest(r, "test-vault-id", http.MethodPost, "/credentials/batch", gin.H{"items": items, "atomic": true})
+	if w.Code != http.StatusInternalServerError || countCredentials("test-vault-id") != 1 {
+		t.Fatalf("分组创建失败时整批导入应回滚: %d %s", w.Code, w.Body.String())
+	}
+}
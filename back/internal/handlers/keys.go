@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"subvault/internal/crypto"
+	"subvault/internal/keyring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// vaultDataKey 取出保险库数据密钥对应的 Cipher，失败时直接写入 500 响应
+func vaultDataKey(c *gin.Context, db *gorm.DB, keys *keyring.Keyring, vaultID string) (*crypto.Cipher, bool) {
+	key, err := keys.DataKey(db, vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加载保险库密钥失败"})
+		return nil, false
+	}
+	return key, true
+}
+
+// 以下附加数据的表名、列名需与 rotation.EncryptedColumns 保持一致
+
+func credentialAAD(id, field string) crypto.AAD {
+	return crypto.AAD{Table: "credentials", RowID: id, Field: field}
+}
+
+func credentialHistoryAAD(id, field string) crypto.AAD {
+	return crypto.AAD{Table: "credential_histories", RowID: id, Field: field}
+}
+
+func memoAAD(id string) crypto.AAD {
+	return crypto.AAD{Table: "memos", RowID: id, Field: "content"}
+}
+
+func totpSecretAAD(id string) crypto.AAD {
+	return crypto.AAD{Table: "totp_settings", RowID: id, Field: "secret"}
+}
+
+func aiKeyAAD(id string) crypto.AAD {
+	return crypto.AAD{Table: "ai_configs", RowID: id, Field: "api_key"}
+}
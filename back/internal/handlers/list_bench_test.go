@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 列表接口的耗时应随行数线性增长：每行只做一次 AES-GCM 解密，密钥派生只在构造 Cipher 时发生。
+// 对比不同行数下的 ns/row 指标，数值应基本持平。
+var benchRowCounts = []int{10, 100, 1000}
+
+// seedListRows 写入 n 条凭证和 n 条备忘录，密文使用保险库的数据密钥
+func seedListRows(b *testing.B, keys *keyring.Keyring, n int) {
+	key, err := keys.DataKey(testDB, "test-vault-id")
+	if err != nil {
+		b.Fatal(err)
+	}
+	creds := make([]models.Credential, n)
+	memos := make([]models.Memo, n)
+	for i := 0; i < n; i++ {
+		creds[i] = models.Credential{ID: fmt.Sprintf("cred-%d", i), VaultID: "test-vault-id", Label: "site", Username: "user"}
+		if creds[i].Password, err = key.EncryptField("password", credentialAAD(creds[i].ID, "password")); err != nil {
+			b.Fatal(err)
+		}
+		if creds[i].Notes, err = key.EncryptField("notes", credentialAAD(creds[i].ID, "notes")); err != nil {
+			b.Fatal(err)
+		}
+		memos[i] = models.Memo{ID: fmt.Sprintf("memo-%d", i), VaultID: "test-vault-id", Title: "memo"}
+		if memos[i].Content, err = key.EncryptField("content", memoAAD(memos[i].ID)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := testDB.CreateInBatches(creds, 200).Error; err != nil {
+		b.Fatal(err)
+	}
+	if err := testDB.CreateInBatches(memos, 200).Error; err != nil {
+		b.Fatal(err)
+	}
+}
+
+func benchmarkList(b *testing.B, path string, register func(r *gin.Engine, keys *keyring.Keyring)) {
+	for _, n := range benchRowCounts {
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			cleanup := setupTestDB(b)
+			defer cleanup()
+
+			cfg := getTestConfig()
+			keys := keyring.New(cfg)
+			seedListRows(b, keys, n)
+
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("vaultId", "test-vault-id")
+				c.Next()
+			})
+			register(r, keys)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", path, nil)
+				r.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(n), "ns/row")
+		})
+	}
+}
+
+func BenchmarkGetVault(b *testing.B) {
+	benchmarkList(b, "/api/v1/vault", func(r *gin.Engine, keys *keyring.Keyring) {
+		r.GET("/api/v1/vault", NewVaultHandler(getTestConfig(), keys, testDB, store.NewSQL(testDB)).GetVault)
+	})
+}
+
+func BenchmarkGetCredentials(b *testing.B) {
+	benchmarkList(b, "/api/v1/credentials", func(r *gin.Engine, keys *keyring.Keyring) {
+		r.GET("/api/v1/credentials", NewVaultHandler(getTestConfig(), keys, testDB, store.NewSQL(testDB)).GetCredentials)
+	})
+}
+
+func BenchmarkGetMemos(b *testing.B) {
+	benchmarkList(b, "/api/v1/memos", func(r *gin.Engine, keys *keyring.Keyring) {
+		r.GET("/api/v1/memos", NewMemoHandler(getTestConfig(), keys, testDB, store.NewSQL(testDB)).GetMemos)
+	})
+}
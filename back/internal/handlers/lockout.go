@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/audit"
+	"subvault/internal/lockout"
+	"subvault/internal/models"
+	"subvault/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// rejectIfLocked 保险库或来源 IP 处于锁定期时返回 429，已写入响应时返回 false
+func rejectIfLocked(c *gin.Context, db *gorm.DB, subjects ...string) bool {
+	remaining, err := lockout.Locked(db, subjects...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解锁保险库失败"})
+		return false
+	}
+	if remaining <= 0 {
+		return true
+	}
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      fmt.Sprintf("解锁失败次数过多，请 %s后再试", webhook.FormatDuration(remaining)),
+		"retryAfter": seconds,
+	})
+	return false
+}
+
+// recordUnlockFailure 主密钥、验证码或通行密钥校验失败时为账户（按来源 IP 区分）和来源 IP 各记一次失败。
+// subject 为空时只计 IP；vaultID 已知时写入审计日志，触发锁定时通过该保险库配置的 Webhook 提醒。
+func recordUnlockFailure(c *gin.Context, db *gorm.DB, subject, vaultID, action, reason string) {
+	ip := c.ClientIP()
+	if vaultID != "" {
+		recordAudit(c, db, vaultID, action, audit.OutcomeFailure, "", reason)
+	}
+	var lockedFor time.Duration
+	if subject != "" {
+		d, err := lockout.RecordFailure(db, subject, lockout.AccountPolicy)
+		if err != nil {
+			log.Printf("记录解锁失败次数失败: %v", err)
+		}
+		lockedFor = d
+	}
+	d, err := lockout.RecordFailure(db, lockout.IPKey(ip), lockout.IPPolicy)
+	if err != nil {
+		log.Printf("记录解锁失败次数失败: %v", err)
+	}
+	if d > lockedFor {
+		lockedFor = d
+	}
+	if lockedFor > 0 && vaultID != "" {
+		go notifyLockout(db, vaultID, ip, lockedFor)
+	}
+}
+
+// notifyLockout 保险库开启了 Webhook 时发送锁定提醒
+func notifyLockout(db *gorm.DB, vaultID, ip string, lockedFor time.Duration) {
+	var setting models.NotificationSetting
+	if err := db.Where("vault_id = ? AND webhook_enabled = ?", vaultID, true).First(&setting).Error; err != nil || setting.WebhookURL == "" {
+		return
+	}
+	username := vaultID
+	if user, err := accounts.ForVault(db, vaultID); err == nil {
+		username = user.Username
+	}
+	text := webhook.BuildLockoutText(username, ip, lockedFor)
+	if err := webhook.Send(setting.WebhookURL, setting.WebhookPlatform, text, setting.WebhookSecret); err != nil {
+		log.Printf("发送锁定提醒失败: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
+	"subvault/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestUnlockLockoutAfterRepeatedFailures(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupAuthRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+
+	notified := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		notified <- string(body)
+	}))
+	defer server.Close()
+	testDB.Create(&models.NotificationSetting{ID: "ns-1", VaultID: alice.VaultID, WebhookEnabled: true, WebhookURL: server.URL, WebhookPlatform: "generic"})
+
+	for i := 0; i < lockout.AccountPolicy.Threshold; i++ {
+		if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "wrong-passphrase"}); w.Code != http.StatusUnauthorized {
+			t.Fatalf("第 %d 次错误主密钥应返回 401: %d", i+1, w.Code)
+		}
+	}
+
+	// 锁定期内即使主密钥正确也拒绝
+	w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("锁定期内应返回 429 和 Retry-After: %d %v", w.Code, w.Header())
+	}
+
+	select {
+	case body := <-notified:
+		if !strings.Contains(body, "alice") {
+			t.Fatalf("锁定提醒应包含用户名: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("锁定时应发送 Webhook 提醒")
+	}
+
+	// 不存在的用户名同样会被锁定，不能借此探测用户名
+	for i := 0; i < lockout.AccountPolicy.Threshold; i++ {
+		postJSON(r, "/api/v1/unlock", gin.H{"username": "nobody", "masterKey": "wrong-passphrase"})
+	}
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "nobody", "masterKey": "wrong-passphrase"}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("不存在的用户名也应锁定: %d", w.Code)
+	}
+
+	// 锁定到期后可以正常解锁，成功后清除账户的失败记录
+	testDB.Model(&models.LoginFailure{}).Where("subject = ?", lockout.VaultKey(alice.VaultID, "")).Update("locked_until", time.Now().Add(-time.Second))
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}); w.Code != http.StatusOK {
+		t.Fatalf("锁定到期后应能解锁: %d %s", w.Code, w.Body.String())
+	}
+	var count int64
+	testDB.Model(&models.LoginFailure{}).Where("subject = ?", lockout.VaultKey(alice.VaultID, "")).Count(&count)
+	if count != 0 {
+		t.Fatal("解锁成功后应清除账户失败记录")
+	}
+}
+
+func TestUnlockLockoutCountsTotpFailures(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupAuthRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+
+	cfg := getTestConfig()
+	key, err := keyring.New(cfg).DataKey(testDB, alice.VaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+	encrypted, _ := key.EncryptField(secret, totpSecretAAD("totp-1"))
+	testDB.Create(&models.TotpSetting{ID: "totp-1", VaultID: alice.VaultID, Secret: encrypted, Enabled: true, Verified: true})
+
+	for i := 0; i < lockout.AccountPolicy.Threshold; i++ {
+		if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "totpCode": "000000"}); w.Code != http.StatusUnauthorized {
+			t.Fatalf("错误验证码应返回 401: %d", w.Code)
+		}
+	}
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "totpCode": code}); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("验证码连续错误也应触发锁定: %d", w.Code)
+	}
+}
+
+// 账户的锁定按来源 IP 区分：别人猜错主密钥不应把账户主人锁在外面
+func TestUnlockLockoutIsPerSourceIP(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupAuthRouter()
+	postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"})
+
+	unlockFrom := func(ip, masterKey string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/unlock", strings.NewReader(`{"username":"alice","masterKey":"`+masterKey+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < lockout.AccountPolicy.Threshold; i++ {
+		unlockFrom("198.51.100.7", "wrong-passphrase")
+	}
+	if code := unlockFrom("198.51.100.7", "alice-passphrase"); code != http.StatusTooManyRequests {
+		t.Fatalf("失败的来源 IP 应被锁定: %d", code)
+	}
+	if code := unlockFrom("203.0.113.9", "alice-passphrase"); code != http.StatusOK {
+		t.Fatalf("其他 IP 上的账户主人不应受影响: %d", code)
+	}
+}
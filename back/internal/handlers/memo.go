@@ -1,23 +1,29 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"subvault/internal/config"
-	"subvault/internal/crypto"
-	"subvault/internal/database"
+	"subvault/internal/keyring"
 	"subvault/internal/models"
+	"subvault/internal/store"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type MemoHandler struct {
-	cfg *config.Config
+	cfg   *config.Config
+	keys  *keyring.Keyring
+	db    *gorm.DB
+	store *store.Store
 }
 
-func NewMemoHandler(cfg *config.Config) *MemoHandler {
-	return &MemoHandler{cfg: cfg}
+func NewMemoHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB, st *store.Store) *MemoHandler {
+	return &MemoHandler{cfg: cfg, keys: keys, db: db, store: st}
 }
 
 // GetMemos 获取用户所有备忘录，解密内容
@@ -25,25 +31,19 @@ func NewMemoHandler(cfg *config.Config) *MemoHandler {
 // Requirements: 1.2, 7.1
 func (h *MemoHandler) GetMemos(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
+	if _, ok := vaultDataKey(c, h.db, h.keys, vaultID); !ok {
+		return
+	}
 
-	var memos []models.Memo
-	if err := database.DB.Where("vault_id = ?", vaultID).Find(&memos).Error; err != nil {
+	// 自己的备忘录加上所在共享集合中的备忘录
+	memos, err := h.store.Memos.ListReadable(vaultID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
 		return
 	}
 
 	// 解密每个备忘录的内容
-	for i := range memos {
-		if memos[i].Content != "" {
-			decrypted, err := crypto.DecryptField(memos[i].Content, h.cfg.EncryptionKey)
-			if err != nil {
-				// 解密失败时返回空内容，不中断整个请求
-				memos[i].Content = ""
-			} else {
-				memos[i].Content = decrypted
-			}
-		}
-	}
+	decryptMemos(h.db, h.keys, memos)
 
 	// 确保返回空数组而不是 null
 	if memos == nil {
@@ -53,6 +53,21 @@ func (h *MemoHandler) GetMemos(c *gin.Context) {
 	c.JSON(http.StatusOK, memos)
 }
 
+// GetMemo 获取单个备忘录（已解密），ETag 为版本号
+// GET /api/v1/memos/:id
+func (h *MemoHandler) GetMemo(c *gin.Context) {
+	memo, err := h.store.Memos.GetReadable(c.GetString("vaultId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "备忘录不存在"})
+		return
+	}
+	list := []models.Memo{memo}
+	decryptMemos(h.db, h.keys, list)
+
+	setETag(c, memo.Version)
+	c.JSON(http.StatusOK, list[0])
+}
+
 // CreateMemo 创建新备忘录
 // POST /api/v1/memos
 // Requirements: 1.2, 1.3, 1.4, 7.1
@@ -71,13 +86,27 @@ func (h *MemoHandler) CreateMemo(c *gin.Context) {
 		return
 	}
 
+	if !requireCollectionEditor(c, h.db, vaultID, memo.CollectionID) {
+		return
+	}
+
 	// 设置 VaultID
 	memo.VaultID = vaultID
 	memo.Category = ResolveGroupName(memo.Category)
 
+	key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+
+	// 密文绑定行 ID，需在加密前确定
+	if memo.ID == "" {
+		memo.ID = uuid.New().String()
+	}
+
 	// 加密内容
 	if memo.Content != "" {
-		encrypted, err := crypto.EncryptField(memo.Content, h.cfg.EncryptionKey)
+		encrypted, err := key.EncryptField(memo.Content, memoAAD(memo.ID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
@@ -86,17 +115,18 @@ func (h *MemoHandler) CreateMemo(c *gin.Context) {
 	}
 
 	// 保存到数据库
-	if err := database.DB.Create(&memo).Error; err != nil {
+	if err := h.store.Memos.Create(&memo); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
 		return
 	}
 
 	// 返回时解密内容
 	if memo.Content != "" {
-		decrypted, _ := crypto.DecryptField(memo.Content, h.cfg.EncryptionKey)
+		decrypted, _ := key.DecryptField(memo.Content, memoAAD(memo.ID))
 		memo.Content = decrypted
 	}
 
+	setETag(c, memo.Version)
 	c.JSON(http.StatusCreated, memo)
 }
 
@@ -107,12 +137,23 @@ func (h *MemoHandler) UpdateMemo(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	memoID := c.Param("id")
 
-	// 验证备忘录存在且属于当前用户
-	var memo models.Memo
-	if err := database.DB.Where("id = ? AND vault_id = ?", memoID, vaultID).First(&memo).Error; err != nil {
+	// 验证备忘录存在且当前用户可编辑（自己的或以 editor 身份共享的）
+	memo, err := h.store.Memos.GetReadable(vaultID, memoID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "备忘录不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, memo.VaultID, memo.CollectionID) {
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if expected != memo.Version {
+		h.respondMemoConflict(c, memo)
+		return
+	}
 
 	var updateData models.Memo
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -126,27 +167,38 @@ func (h *MemoHandler) UpdateMemo(c *gin.Context) {
 		return
 	}
 
-	// 准备更新数据
-	updates := map[string]interface{}{
-		"title":     updateData.Title,
-		"category":  ResolveGroupName(updateData.Category),
-		"is_pinned": updateData.IsPinned,
+	// 共享备忘录始终用创建者的数据密钥加密
+	key, ok := vaultDataKey(c, h.db, h.keys, memo.VaultID)
+	if !ok {
+		return
 	}
 
+	// 准备更新数据
+	memo.Title = updateData.Title
+	memo.Category = ResolveGroupName(updateData.Category)
+	memo.IsPinned = updateData.IsPinned
+
 	// 加密内容
+	memo.Content = ""
 	if updateData.Content != "" {
-		encrypted, err := crypto.EncryptField(updateData.Content, h.cfg.EncryptionKey)
+		encrypted, err := key.EncryptField(updateData.Content, memoAAD(memo.ID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
 		}
-		updates["content"] = encrypted
-	} else {
-		updates["content"] = ""
+		memo.Content = encrypted
 	}
 
 	// 更新数据库
-	if err := database.DB.Model(&memo).Updates(updates).Error; err != nil {
+	if err := h.store.Memos.Save(&memo); errors.Is(err, store.ErrConflict) {
+		current, err := h.store.Memos.GetReadable(vaultID, memoID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "备忘录不存在"})
+			return
+		}
+		h.respondMemoConflict(c, current)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
 		return
 	}
@@ -157,9 +209,17 @@ func (h *MemoHandler) UpdateMemo(c *gin.Context) {
 	memo.Category = updateData.Category
 	memo.IsPinned = updateData.IsPinned
 
+	setETag(c, memo.Version)
 	c.JSON(http.StatusOK, memo)
 }
 
+// respondMemoConflict 解密后返回备忘录的当前内容
+func (h *MemoHandler) respondMemoConflict(c *gin.Context, current models.Memo) {
+	list := []models.Memo{current}
+	decryptMemos(h.db, h.keys, list)
+	respondConflict(c, list[0], current.Version)
+}
+
 // DeleteMemo 删除备忘录
 // DELETE /api/v1/memos/:id
 // Requirements: 3.2
@@ -167,12 +227,20 @@ func (h *MemoHandler) DeleteMemo(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	memoID := c.Param("id")
 
-	// 删除备忘录（同时验证权限）
-	result := database.DB.Where("id = ? AND vault_id = ?", memoID, vaultID).Delete(&models.Memo{})
-	if result.RowsAffected == 0 {
+	// 验证权限后删除备忘录
+	memo, err := h.store.Memos.GetReadable(vaultID, memoID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "备忘录不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, memo.VaultID, memo.CollectionID) {
+		return
+	}
+
+	if err := h.store.Memos.Delete(memoID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
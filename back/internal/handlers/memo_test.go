@@ -5,37 +5,44 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 
 	"subvault/internal/config"
+	"subvault/internal/crypto"
 	"subvault/internal/database"
+	"subvault/internal/database/dbtest"
+	"subvault/internal/keyring"
 	"subvault/internal/models"
+	"subvault/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/leanovate/gopter"
 	"github.com/leanovate/gopter/gen"
 	"github.com/leanovate/gopter/prop"
+	"gorm.io/gorm"
 )
 
+// testDB 当前测试使用的数据库连接，由 setupTestDB 设置
+var testDB *gorm.DB
+
 // setupTestDB initializes a test database
-func setupTestDB(t *testing.T) func() {
-	// Use a temporary database file
-	tmpFile, err := os.CreateTemp("", "test_memo_*.db")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
-	}
-	tmpFile.Close()
+func setupTestDB(t testing.TB) func() {
+	// 临时 SQLite 文件；设置 TEST_DATABASE_URL 时为 PostgreSQL 中的独立 schema
+	target, cleanup := dbtest.Target(t)
 
-	err = database.Init(tmpFile.Name())
+	db, err := database.Init(target)
 	if err != nil {
 		t.Fatalf("Failed to initialize database: %v", err)
 	}
+	testDB = db
 
-	// Return cleanup function
-	return func() {
-		os.Remove(tmpFile.Name())
+	// 数据密钥挂在保险库上，测试用的保险库需要真实存在
+	if err := testDB.Create(&models.Vault{ID: "test-vault-id", KeyHash: "test-vault-id"}).Error; err != nil {
+		t.Fatalf("Failed to create test vault: %v", err)
 	}
+
+	// Return cleanup function
+	return cleanup
 }
 
 // setupTestRouter creates a test router with the memo handler
@@ -43,7 +50,7 @@ func setupTestRouter(cfg *config.Config) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 
-	handler := NewMemoHandler(cfg)
+	handler := NewMemoHandler(cfg, keyring.New(cfg), testDB, store.NewSQL(testDB))
 
 	// Add a middleware to set vaultId for testing
 	router.Use(func(c *gin.Context) {
@@ -66,6 +73,11 @@ func getTestConfig() *config.Config {
 		EncryptionKey: "test-encryption-key-32-bytes-ok",
 		DatabasePath:  "",
 		Environment:   "test",
+		// 低开销的 Argon2id 参数，避免每个测试都分配 64 MiB
+		KDF: crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 1, MemoryKiB: 1024, Threads: 1},
+		WebAuthnRPID:    "localhost",
+		WebAuthnOrigins: []string{"http://localhost:5173"},
+		SetupToken:      "test-setup-token",
 	}
 }
 
@@ -340,6 +352,7 @@ func updateMemo(router *gin.Engine, id, title, content, category string, isPinne
 
 	req, _ := http.NewRequest("PUT", "/api/v1/memos/"+id, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", currentETag(&models.Memo{}, id))
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -678,7 +691,7 @@ func TestProperty9_MemoIsCorrectlyAssociatedWithVault(t *testing.T) {
 
 			// Step 2: Query the database directly to verify the vaultId field
 			var dbMemo models.Memo
-			if err := database.DB.Where("id = ?", createdMemo.ID).First(&dbMemo).Error; err != nil {
+			if err := testDB.Where("id = ?", createdMemo.ID).First(&dbMemo).Error; err != nil {
 				t.Logf("Error querying memo from database: %v", err)
 				return false
 			}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"subvault/internal/session"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SessionHandler struct {
+	db *gorm.DB
+}
+
+func NewSessionHandler(db *gorm.DB) *SessionHandler {
+	return &SessionHandler{db: db}
+}
+
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions 列出当前保险库所有有效会话（已解锁的设备）
+// GET /api/v1/sessions
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	currentID := c.GetString("sessionId")
+
+	sessions, err := session.List(h.db, vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
+		return
+	}
+
+	out := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, SessionInfo{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// RevokeSession 远程登出指定设备，该设备的访问令牌立即失效
+// DELETE /api/v1/sessions/:id
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	sessionID := c.Param("id")
+
+	ok, err := session.RevokeForVault(h.db, vaultID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出设备失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已登出该设备"})
+}
@@ -8,28 +8,30 @@ import (
 	"strings"
 	"time"
 
-	"subvault/internal/database"
 	"subvault/internal/fx"
 	"subvault/internal/ical"
 	"subvault/internal/models"
 	"subvault/internal/renewal"
+	"subvault/internal/store"
 	"subvault/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
-type SettingsHandler struct{}
+type SettingsHandler struct {
+	store *store.Store
+}
 
-func NewSettingsHandler() *SettingsHandler {
-	return &SettingsHandler{}
+func NewSettingsHandler(st *store.Store) *SettingsHandler {
+	return &SettingsHandler{store: st}
 }
 
 // === 标签管理 ===
 
 func (h *SettingsHandler) GetTags(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-	EnsureDefaultGroup(vaultID)
-	tags := loadVaultTags(vaultID)
+	EnsureDefaultGroup(h.store, vaultID)
+	tags := loadVaultTags(h.store, vaultID)
 	c.JSON(http.StatusOK, tags)
 }
 
@@ -46,10 +48,12 @@ func (h *SettingsHandler) CreateTag(c *gin.Context) {
 	}
 	input.Name = strings.TrimSpace(input.Name)
 
-	var existing models.Tag
-	if err := database.DB.Where("vault_id = ? AND name = ?", vaultID, input.Name).First(&existing).Error; err == nil {
-		c.JSON(http.StatusOK, existing)
-		return
+	existing, _ := h.store.Tags.List(vaultID)
+	for _, t := range existing {
+		if t.Name == input.Name {
+			c.JSON(http.StatusOK, t)
+			return
+		}
 	}
 
 	tag := models.Tag{
@@ -61,7 +65,7 @@ func (h *SettingsHandler) CreateTag(c *gin.Context) {
 		tag.Color = "#3B82F6"
 	}
 
-	if err := database.DB.Create(&tag).Error; err != nil {
+	if err := h.store.Tags.Create(&tag); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建标签失败"})
 		return
 	}
@@ -73,8 +77,8 @@ func (h *SettingsHandler) UpdateTag(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	tagID := c.Param("id")
 
-	var tag models.Tag
-	if err := database.DB.Where("id = ? AND vault_id = ?", tagID, vaultID).First(&tag).Error; err != nil {
+	tag, err := h.store.Tags.Get(vaultID, tagID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "标签不存在"})
 		return
 	}
@@ -88,15 +92,17 @@ func (h *SettingsHandler) UpdateTag(c *gin.Context) {
 		return
 	}
 
-	updates := map[string]interface{}{}
 	if input.Name != "" && tag.Name != DefaultGroupName {
-		updates["name"] = strings.TrimSpace(input.Name)
+		tag.Name = strings.TrimSpace(input.Name)
 	}
 	if input.Color != "" {
-		updates["color"] = input.Color
+		tag.Color = input.Color
 	}
 
-	database.DB.Model(&tag).Updates(updates)
+	if err := h.store.Tags.Save(&tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新标签失败"})
+		return
+	}
 	c.JSON(http.StatusOK, tag)
 }
 
@@ -104,8 +110,8 @@ func (h *SettingsHandler) DeleteTag(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	tagID := c.Param("id")
 
-	var tag models.Tag
-	if err := database.DB.Where("id = ? AND vault_id = ?", tagID, vaultID).First(&tag).Error; err != nil {
+	tag, err := h.store.Tags.Get(vaultID, tagID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "分组不存在"})
 		return
 	}
@@ -114,8 +120,7 @@ func (h *SettingsHandler) DeleteTag(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Where("id = ? AND vault_id = ?", tagID, vaultID).Delete(&models.Tag{})
-	if result.RowsAffected == 0 {
+	if ok, _ := h.store.Tags.Delete(vaultID, tagID); !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "标签不存在"})
 		return
 	}
@@ -128,10 +133,9 @@ func (h *SettingsHandler) DeleteTag(c *gin.Context) {
 func (h *SettingsHandler) GetNotificationSettings(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
-	var settings models.NotificationSetting
-	result := database.DB.Where("vault_id = ?", vaultID).First(&settings)
+	settings, err := h.store.Settings.Get(vaultID)
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"enabled":           true,
 			"daysBeforeList":    "1,3,7",
@@ -147,7 +151,7 @@ func (h *SettingsHandler) GetNotificationSettings(c *gin.Context) {
 	}
 	if settings.CalendarToken == "" {
 		settings.CalendarToken = newCalendarToken()
-		database.DB.Model(&settings).Update("calendar_token", settings.CalendarToken)
+		h.store.Settings.Save(&settings)
 	}
 	if settings.BaseCurrency == "" {
 		settings.BaseCurrency = "CNY"
@@ -194,10 +198,9 @@ func (h *SettingsHandler) SaveNotificationSettings(c *gin.Context) {
 		input.BaseCurrency = "CNY"
 	}
 
-	var settings models.NotificationSetting
-	result := database.DB.Where("vault_id = ?", vaultID).First(&settings)
+	settings, err := h.store.Settings.Get(vaultID)
 
-	if result.Error != nil {
+	if err != nil {
 		settings = models.NotificationSetting{
 			VaultID:           vaultID,
 			Enabled:           input.Enabled,
@@ -210,22 +213,24 @@ func (h *SettingsHandler) SaveNotificationSettings(c *gin.Context) {
 			CalendarToken:     newCalendarToken(),
 			BaseCurrency:      input.BaseCurrency,
 		}
-		database.DB.Create(&settings)
+		err = h.store.Settings.Create(&settings)
 	} else {
-		updates := map[string]interface{}{
-			"enabled":             input.Enabled,
-			"days_before_list":    input.DaysBeforeList,
-			"webhook_enabled":     input.WebhookEnabled,
-			"webhook_url":         input.WebhookURL,
-			"webhook_platform":    input.WebhookPlatform,
-			"webhook_days_before": input.WebhookDaysBefore,
-			"webhook_secret":      input.WebhookSecret,
-			"base_currency":       input.BaseCurrency,
-		}
+		settings.Enabled = input.Enabled
+		settings.DaysBeforeList = input.DaysBeforeList
+		settings.WebhookEnabled = input.WebhookEnabled
+		settings.WebhookURL = input.WebhookURL
+		settings.WebhookPlatform = input.WebhookPlatform
+		settings.WebhookDaysBefore = input.WebhookDaysBefore
+		settings.WebhookSecret = input.WebhookSecret
+		settings.BaseCurrency = input.BaseCurrency
 		if settings.CalendarToken == "" {
-			updates["calendar_token"] = newCalendarToken()
+			settings.CalendarToken = newCalendarToken()
 		}
-		database.DB.Model(&settings).Updates(updates)
+		err = h.store.Settings.Save(&settings)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "设置已保存"})
@@ -267,15 +272,14 @@ type UpcomingRenewal struct {
 func (h *SettingsHandler) GetUpcomingRenewals(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ? AND active = ?", vaultID, true).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
+	subscriptions, _ := h.store.Subscriptions.ListReadable(vaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
 
 	var upcoming []UpcomingRenewal
 	today := renewal.Today()
 
 	for _, sub := range subscriptions {
-		if sub.FrequencyUnit == "PERMANENT" {
+		if !sub.Active || sub.FrequencyUnit == "PERMANENT" {
 			continue
 		}
 
@@ -345,13 +349,11 @@ type CurrencySpend struct {
 func (h *SettingsHandler) GetAnalytics(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
+	subscriptions, _ := h.store.Subscriptions.ListOwned(vaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
 
 	base := "CNY"
-	var setting models.NotificationSetting
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&setting).Error; err == nil && setting.BaseCurrency != "" {
+	if setting, err := h.store.Settings.Get(vaultID); err == nil && setting.BaseCurrency != "" {
 		base = setting.BaseCurrency
 	}
 	rates, _ := fx.RatesTo(base)
@@ -408,8 +410,7 @@ func (h *SettingsHandler) GetAnalytics(c *gin.Context) {
 	}
 
 	monthTotals := map[string]float64{}
-	var events []models.RenewalEvent
-	database.DB.Where("vault_id = ?", vaultID).Find(&events)
+	events, _ := h.store.Subscriptions.RenewalEvents(vaultID)
 	for _, ev := range events {
 		if len(ev.OccurredOn) < 7 {
 			continue
@@ -480,14 +481,13 @@ func (h *SettingsHandler) PublicCalendar(c *gin.Context) {
 		c.String(http.StatusNotFound, "not found")
 		return
 	}
-	var setting models.NotificationSetting
-	if err := database.DB.Where("calendar_token = ?", token).First(&setting).Error; err != nil {
+	setting, err := h.store.Settings.FindByCalendarToken(token)
+	if err != nil {
 		c.String(http.StatusNotFound, "not found")
 		return
 	}
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", setting.VaultID).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
+	subscriptions, _ := h.store.Subscriptions.ListReadable(setting.VaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
 	c.Header("Content-Type", "text/calendar; charset=utf-8")
 	c.Header("Content-Disposition", "inline; filename=subvault.ics")
 	c.String(http.StatusOK, ical.Build(subscriptions))
@@ -495,9 +495,8 @@ func (h *SettingsHandler) PublicCalendar(c *gin.Context) {
 
 func (h *SettingsHandler) GetInsights(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
+	subscriptions, _ := h.store.Subscriptions.ListOwned(vaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
 
 	today := renewal.Today()
 	type Insight struct {
@@ -552,8 +551,7 @@ func (h *SettingsHandler) GetInsights(c *gin.Context) {
 		insights = append(insights, Insight{Kind: "spend", Title: top.Name + " 占月支出过高", Detail: "超过四成月度订阅支出", SubID: top.ID, SubName: top.Name})
 	}
 
-	var hikes []models.PriceHistory
-	database.DB.Where("vault_id = ?", vaultID).Order("created_at desc").Limit(8).Find(&hikes)
+	hikes, _ := h.store.Subscriptions.RecentPriceChanges(vaultID, 8)
 	for _, hike := range hikes {
 		if hike.NewCost <= hike.OldCost {
 			continue
@@ -578,12 +576,17 @@ func websiteHost(raw string) string {
 func (h *SettingsHandler) RotateCalendarToken(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	token := newCalendarToken()
-	var settings models.NotificationSetting
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&settings).Error; err != nil {
+	settings, err := h.store.Settings.Get(vaultID)
+	if err != nil {
 		settings = models.NotificationSetting{VaultID: vaultID, CalendarToken: token, BaseCurrency: "CNY"}
-		database.DB.Create(&settings)
+		err = h.store.Settings.Create(&settings)
 	} else {
-		database.DB.Model(&settings).Update("calendar_token", token)
+		settings.CalendarToken = token
+		err = h.store.Settings.Save(&settings)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新日历订阅地址失败"})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"calendarToken": token})
 }
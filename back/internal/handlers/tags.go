@@ -3,8 +3,8 @@ package handlers
 import (
 	"strings"
 
-	"subvault/internal/database"
 	"subvault/internal/models"
+	"subvault/internal/store"
 )
 
 const DefaultGroupName = "默认"
@@ -22,10 +22,10 @@ func ResolveGroupName(name string) string {
 	return name
 }
 
-func EnsureDefaultGroup(vaultID string) models.Tag {
-	existing := loadVaultTags(vaultID)
+func EnsureDefaultGroup(st *store.Store, vaultID string) models.Tag {
+	existing := loadVaultTags(st, vaultID)
 	if t := findTagByName(existing, DefaultGroupName); t != nil {
-		fillEmptyCategories(vaultID)
+		fillEmptyCategories(st, vaultID)
 		return *t
 	}
 
@@ -34,17 +34,17 @@ func EnsureDefaultGroup(vaultID string) models.Tag {
 		Name:    DefaultGroupName,
 		Color:   tagPalette[0],
 	}
-	database.DB.Create(&tag)
-	database.DB.Model(&models.Credential{}).Where("vault_id = ?", vaultID).Update("category", DefaultGroupName)
-	database.DB.Model(&models.Memo{}).Where("vault_id = ?", vaultID).Update("category", DefaultGroupName)
-	database.DB.Model(&models.Subscription{}).Where("vault_id = ? AND (category = '' OR category IS NULL)", vaultID).Update("category", DefaultGroupName)
+	st.Tags.Create(&tag)
+	st.Credentials.SetAllCategories(vaultID, DefaultGroupName)
+	st.Memos.SetAllCategories(vaultID, DefaultGroupName)
+	st.Subscriptions.FillEmptyCategory(vaultID, DefaultGroupName)
 	return tag
 }
 
-func fillEmptyCategories(vaultID string) {
-	database.DB.Model(&models.Credential{}).Where("vault_id = ? AND (category = '' OR category IS NULL)", vaultID).Update("category", DefaultGroupName)
-	database.DB.Model(&models.Memo{}).Where("vault_id = ? AND (category = '' OR category IS NULL)", vaultID).Update("category", DefaultGroupName)
-	database.DB.Model(&models.Subscription{}).Where("vault_id = ? AND (category = '' OR category IS NULL)", vaultID).Update("category", DefaultGroupName)
+func fillEmptyCategories(st *store.Store, vaultID string) {
+	st.Credentials.FillEmptyCategory(vaultID, DefaultGroupName)
+	st.Memos.FillEmptyCategory(vaultID, DefaultGroupName)
+	st.Subscriptions.FillEmptyCategory(vaultID, DefaultGroupName)
 }
 
 func normalizeTagName(name string) string {
@@ -64,9 +64,8 @@ func findTagByName(tags []models.Tag, name string) *models.Tag {
 	return nil
 }
 
-func loadVaultTags(vaultID string) []models.Tag {
-	var tags []models.Tag
-	database.DB.Where("vault_id = ?", vaultID).Order("created_at asc").Find(&tags)
+func loadVaultTags(st *store.Store, vaultID string) []models.Tag {
+	tags, _ := st.Tags.List(vaultID)
 	if tags == nil {
 		tags = []models.Tag{}
 	}
@@ -85,10 +84,13 @@ func tagsContextLine(tags []models.Tag) string {
 		"\n请优先使用以上已有分组名称（保持文字完全一致）。只有确实没有合适分组时，才新建一个简短中文分组名。"
 }
 
-func ensureTagsForNames(vaultID string, names []string) (map[string]string, []models.Tag) {
-	existing := loadVaultTags(vaultID)
+// ensureTagsForNames 按名称匹配已有分组，没有的自动创建。创建失败的名称不出现在返回的映射中，
+// 继续处理其余名称，并返回遇到的第一个错误，由事务中的调用方决定是否整批回滚
+func ensureTagsForNames(st *store.Store, vaultID string, names []string) (map[string]string, []models.Tag, error) {
+	existing := loadVaultTags(st, vaultID)
 	canonical := map[string]string{}
 	var created []models.Tag
+	var firstErr error
 	colorIndex := len(existing)
 
 	for _, raw := range names {
@@ -106,7 +108,10 @@ func ensureTagsForNames(vaultID string, names []string) (map[string]string, []mo
 			Name:    name,
 			Color:   tagPalette[colorIndex%len(tagPalette)],
 		}
-		if err := database.DB.Create(&tag).Error; err != nil {
+		if err := st.Tags.Create(&tag); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
 			continue
 		}
 		created = append(created, tag)
@@ -114,17 +119,17 @@ func ensureTagsForNames(vaultID string, names []string) (map[string]string, []mo
 		canonical[raw] = tag.Name
 		colorIndex++
 	}
-	return canonical, created
+	return canonical, created, firstErr
 }
 
-func applyCanonicalCategories(vaultID, key string, items []map[string]interface{}) []models.Tag {
+func applyCanonicalCategories(st *store.Store, vaultID, key string, items []map[string]interface{}) []models.Tag {
 	names := make([]string, 0, len(items))
 	for _, item := range items {
 		if s, ok := item[key].(string); ok {
 			names = append(names, s)
 		}
 	}
-	canonical, created := ensureTagsForNames(vaultID, names)
+	canonical, created, _ := ensureTagsForNames(st, vaultID, names)
 	for i := range items {
 		s, _ := items[i][key].(string)
 		if next, ok := canonical[s]; ok {
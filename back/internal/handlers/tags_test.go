@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"subvault/internal/models"
+	"subvault/internal/store/storetest"
+
+	"github.com/gin-gonic/gin"
 )
 
 func TestFindTagByNameIgnoresCaseAndSpace(t *testing.T) {
@@ -33,3 +39,41 @@ func TestResolveGroupNameDefaults(t *testing.T) {
 		t.Fatalf("已选分组应保留，实际 %q", got)
 	}
 }
+
+// 分组处理器只依赖 store，用内存实现即可测试，无需数据库
+func TestDefaultGroupCreatedAndProtected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mem := storetest.New()
+	st := mem.Store()
+	if err := st.Subscriptions.Create(&models.Subscription{VaultID: "v1", Name: "Netflix", Category: "娱乐", Status: "active"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewSettingsHandler(st)
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("vaultId", "v1") })
+	router.GET("/tags", h.GetTags)
+	router.DELETE("/tags/:id", h.DeleteTag)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags", nil))
+	var tags []models.Tag
+	if err := json.Unmarshal(w.Body.Bytes(), &tags); err != nil {
+		t.Fatal(err)
+	}
+	var def *models.Tag
+	for i := range tags {
+		if tags[i].Name == DefaultGroupName {
+			def = &tags[i]
+		}
+	}
+	if def == nil {
+		t.Fatalf("首次读取分组时应创建默认分组: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/tags/"+def.ID, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("默认分组不能删除，实际 %d", w.Code)
+	}
+}
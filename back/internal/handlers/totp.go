@@ -3,22 +3,27 @@ package handlers
 import (
 	"net/http"
 
+	"subvault/internal/audit"
 	"subvault/internal/config"
-	"subvault/internal/crypto"
-	"subvault/internal/database"
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
 	"subvault/internal/models"
 	"subvault/internal/recovery"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
 )
 
 type TotpHandler struct {
-	cfg *config.Config
+	cfg  *config.Config
+	keys *keyring.Keyring
+	db   *gorm.DB
 }
 
-func NewTotpHandler(cfg *config.Config) *TotpHandler {
-	return &TotpHandler{cfg: cfg}
+func NewTotpHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB) *TotpHandler {
+	return &TotpHandler{cfg: cfg, keys: keys, db: db}
 }
 
 type SetupTOTPResponse struct {
@@ -36,7 +41,7 @@ func (h *TotpHandler) SetupTOTP(c *gin.Context) {
 
 	// 检查是否已存在
 	var existing models.TotpSetting
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&existing).Error; err == nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&existing).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "两步验证已设置，请先禁用再重新设置"})
 		return
 	}
@@ -52,23 +57,30 @@ func (h *TotpHandler) SetupTOTP(c *gin.Context) {
 	}
 
 	// 加密密钥后存储
-	encryptedSecret, err := crypto.EncryptField(key.Secret(), h.cfg.EncryptionKey)
+	dataKey, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+	settingID := uuid.New().String()
+	encryptedSecret, err := dataKey.EncryptField(key.Secret(), totpSecretAAD(settingID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密密钥失败"})
 		return
 	}
 
 	setting := models.TotpSetting{
+		ID:       settingID,
 		VaultID:  vaultID,
 		Secret:   encryptedSecret,
 		Enabled:  true,
 		Verified: false,
 	}
 
-	if err := database.DB.Create(&setting).Error; err != nil {
+	if err := h.db.Create(&setting).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存验证设置失败"})
 		return
 	}
+	recordAudit(c, h.db, vaultID, audit.ActionTotpSetup, audit.OutcomeSuccess, setting.ID, "")
 
 	c.JSON(http.StatusOK, SetupTOTPResponse{
 		URI:    key.URL(),
@@ -87,27 +99,20 @@ func (h *TotpHandler) VerifyTOTP(c *gin.Context) {
 	}
 
 	var setting models.TotpSetting
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&setting).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&setting).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "未找到两步验证设置"})
 		return
 	}
 
-	// 解密密钥
-	secret, err := crypto.DecryptField(setting.Secret, h.cfg.EncryptionKey)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密密钥失败"})
-		return
-	}
-
 	// 验证码校验
-	if !totp.Validate(req.Code, secret) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+	if !h.validateCode(c, setting, audit.ActionTotpEnable, req.Code) {
 		return
 	}
 
 	// 标记为已验证
-	database.DB.Model(&setting).Update("verified", true)
-	codes, err := recovery.Generate(database.DB, vaultID, 8)
+	h.db.Model(&setting).Update("verified", true)
+	recordAudit(c, h.db, vaultID, audit.ActionTotpEnable, audit.OutcomeSuccess, setting.ID, "")
+	codes, err := recovery.Generate(h.db, vaultID, recovery.DefaultCount)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"message": "两步验证已启用"})
 		return
@@ -119,12 +124,13 @@ func (h *TotpHandler) VerifyTOTP(c *gin.Context) {
 func (h *TotpHandler) DisableTOTP(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
-	result := database.DB.Where("vault_id = ?", vaultID).Delete(&models.TotpSetting{})
+	result := h.db.Where("vault_id = ?", vaultID).Delete(&models.TotpSetting{})
 	if result.RowsAffected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "未找到两步验证设置"})
 		return
 	}
-	database.DB.Where("vault_id = ?", vaultID).Delete(&models.TotpRecoveryCode{})
+	h.db.Where("vault_id = ?", vaultID).Delete(&models.TotpRecoveryCode{})
+	recordAudit(c, h.db, vaultID, audit.ActionTotpDisable, audit.OutcomeSuccess, "", "")
 	c.JSON(http.StatusOK, gin.H{"message": "两步验证已禁用"})
 }
 
@@ -133,10 +139,111 @@ func (h *TotpHandler) GetTOTPStatus(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
 	var setting models.TotpSetting
-	if err := database.DB.Where("vault_id = ?", vaultID).First(&setting).Error; err != nil {
+	if err := h.db.Where("vault_id = ?", vaultID).First(&setting).Error; err != nil {
 		c.JSON(http.StatusOK, gin.H{"enabled": false, "verified": false})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"enabled": setting.Enabled, "verified": setting.Verified})
+	resp := gin.H{"enabled": setting.Enabled, "verified": setting.Verified}
+	if setting.Verified {
+		if remaining, err := recovery.Remaining(h.db, vaultID); err == nil {
+			resp["recoveryCodesRemaining"] = remaining
+			resp["recoveryCodesLow"] = remaining <= recovery.LowThreshold
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetRecoveryCodeStatus 查询未使用的恢复码数量
+// GET /api/v1/totp/recovery-codes
+func (h *TotpHandler) GetRecoveryCodeStatus(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	if _, ok := h.verifiedTotpSetting(c, vaultID); !ok {
+		return
+	}
+	remaining, err := recovery.Remaining(h.db, vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取恢复码状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"remaining": remaining,
+		"total":     recovery.DefaultCount,
+		"low":       remaining <= recovery.LowThreshold,
+	})
+}
+
+// RegenerateRecoveryCodes 校验当前验证码后生成一组新的恢复码，旧恢复码全部作废。
+// 只接受验证器上的验证码，不接受恢复码，避免用泄露的恢复码换取一整组新码。
+// POST /api/v1/totp/recovery-codes
+func (h *TotpHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var req VerifyTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供验证码"})
+		return
+	}
+
+	setting, ok := h.verifiedTotpSetting(c, vaultID)
+	if !ok {
+		return
+	}
+	if !h.validateCode(c, setting, audit.ActionRecoveryRenew, req.Code) {
+		return
+	}
+
+	codes, err := recovery.Generate(h.db, vaultID, recovery.DefaultCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+	recordAudit(c, h.db, vaultID, audit.ActionRecoveryRenew, audit.OutcomeSuccess, setting.ID, "")
+	c.JSON(http.StatusOK, gin.H{"message": "恢复码已重新生成，旧恢复码已失效", "recoveryCodes": codes})
+}
+
+// verifiedTotpSetting 读取已验证的两步验证设置，未启用时已写入响应
+func (h *TotpHandler) verifiedTotpSetting(c *gin.Context, vaultID string) (models.TotpSetting, bool) {
+	var setting models.TotpSetting
+	if err := h.db.Where("vault_id = ?", vaultID).First(&setting).Error; err != nil || !setting.Verified {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用两步验证"})
+		return models.TotpSetting{}, false
+	}
+	return setting, true
+}
+
+// validateCode 校验验证器上的验证码，与主密钥共用失败计数和锁定，避免借这里无限次猜测；
+// 已锁定或校验失败时已写入响应
+func (h *TotpHandler) validateCode(c *gin.Context, setting models.TotpSetting, action, code string) bool {
+	subject := lockout.VaultKey(setting.VaultID, c.ClientIP())
+	if !rejectIfLocked(c, h.db, subject, lockout.IPKey(c.ClientIP())) {
+		recordAudit(c, h.db, setting.VaultID, action, audit.OutcomeLocked, setting.ID, "")
+		return false
+	}
+	secret, ok := h.decryptSecret(c, setting)
+	if !ok {
+		return false
+	}
+	if !totp.Validate(code, secret) {
+		recordUnlockFailure(c, h.db, subject, setting.VaultID, action, "验证码错误")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		return false
+	}
+	lockout.Reset(h.db, subject)
+	return true
+}
+
+// decryptSecret 解密 TOTP 密钥，失败时已写入响应
+func (h *TotpHandler) decryptSecret(c *gin.Context, setting models.TotpSetting) (string, bool) {
+	dataKey, ok := vaultDataKey(c, h.db, h.keys, setting.VaultID)
+	if !ok {
+		return "", false
+	}
+	secret, err := dataKey.DecryptField(setting.Secret, totpSecretAAD(setting.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密密钥失败"})
+		return "", false
+	}
+	return secret, true
 }
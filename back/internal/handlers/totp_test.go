@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
+	"subvault/internal/middleware"
+	"subvault/internal/models"
+	"subvault/internal/recovery"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+func setupTotpRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.AccessTokenTTL = time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys := keyring.New(cfg)
+	r.POST("/api/v1/auth/register", NewAuthHandler(cfg, keys, testDB).Register)
+
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(cfg, testDB))
+	h := NewTotpHandler(cfg, keys, testDB)
+	protected.GET("/totp/status", h.GetTOTPStatus)
+	protected.POST("/totp/verify", h.VerifyTOTP)
+	protected.GET("/totp/recovery-codes", h.GetRecoveryCodeStatus)
+	protected.POST("/totp/recovery-codes", h.RegenerateRecoveryCodes)
+	return r
+}
+
+func TestRecoveryCodeRegeneration(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTotpRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+
+	if w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/totp/recovery-codes", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("未启用两步验证时应返回 404: %d", w.Code)
+	}
+
+	key, err := keyring.New(getTestConfig()).DataKey(testDB, alice.VaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+	encrypted, _ := key.EncryptField(secret, totpSecretAAD("totp-1"))
+	testDB.Create(&models.TotpSetting{ID: "totp-1", VaultID: alice.VaultID, Secret: encrypted, Enabled: true, Verified: true})
+	codes, err := recovery.Generate(testDB, alice.VaultID, recovery.DefaultCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes[:recovery.DefaultCount-recovery.LowThreshold] {
+		recovery.Consume(testDB, alice.VaultID, code)
+	}
+
+	var status struct {
+		Remaining int64 `json:"remaining"`
+		Low       bool  `json:"low"`
+	}
+	w := authedJSON(r, alice.Token, http.MethodGet, "/api/v1/totp/recovery-codes", nil)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.Remaining != recovery.LowThreshold || !status.Low {
+		t.Fatalf("恢复码不足时应提示: %s", w.Body.String())
+	}
+	var totpStatus map[string]interface{}
+	json.Unmarshal(authedJSON(r, alice.Token, http.MethodGet, "/api/v1/totp/status", nil).Body.Bytes(), &totpStatus)
+	if totpStatus["recoveryCodesLow"] != true {
+		t.Fatalf("两步验证状态应提示恢复码不足: %v", totpStatus)
+	}
+
+	// 错误验证码和恢复码都不能用来重新生成
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/totp/recovery-codes", gin.H{"code": "000000"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("错误验证码应返回 401: %d", w.Code)
+	}
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/totp/recovery-codes", gin.H{"code": codes[len(codes)-1]}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("恢复码不能用于重新生成: %d", w.Code)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	w = authedJSON(r, alice.Token, http.MethodPost, "/api/v1/totp/recovery-codes", gin.H{"code": code})
+	var regenerated struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &regenerated)
+	if w.Code != http.StatusOK || len(regenerated.RecoveryCodes) != recovery.DefaultCount {
+		t.Fatalf("重新生成失败: %d %s", w.Code, w.Body.String())
+	}
+	if recovery.Consume(testDB, alice.VaultID, codes[len(codes)-1]) {
+		t.Fatal("旧恢复码应失效")
+	}
+	w = authedJSON(r, alice.Token, http.MethodGet, "/api/v1/totp/recovery-codes", nil)
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.Remaining != recovery.DefaultCount || status.Low {
+		t.Fatalf("重新生成后状态不符: %s", w.Body.String())
+	}
+}
+
+func TestTotpCodeFailuresLockOut(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTotpRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+	key, err := keyring.New(getTestConfig()).DataKey(testDB, alice.VaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+	encrypted, _ := key.EncryptField(secret, totpSecretAAD("totp-1"))
+	testDB.Create(&models.TotpSetting{ID: "totp-1", VaultID: alice.VaultID, Secret: encrypted, Enabled: true, Verified: true})
+
+	// 两个入口共用保险库的失败计数
+	for i := 1; i < lockout.AccountPolicy.Threshold; i++ {
+		if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/totp/recovery-codes", gin.H{"code": "000000"}); w.Code != http.StatusUnauthorized {
+			t.Fatalf("错误验证码应返回 401: %d", w.Code)
+		}
+	}
+	if w := authedJSON(r, alice.Token, http.MethodPost, "/api/v1/totp/verify", gin.H{"code": "000000"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("错误验证码应返回 401: %d", w.Code)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	for _, path := range []string{"/api/v1/totp/recovery-codes", "/api/v1/totp/verify"} {
+		w := authedJSON(r, alice.Token, http.MethodPost, path, gin.H{"code": code})
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s 锁定期间即使验证码正确也应返回 429: %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"subvault/internal/config"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrashHandler 回收站：删除的订阅、凭证、备忘录和分组先移入回收站，可恢复或彻底删除，
+// 超过保留期由后台任务自动清除
+type TrashHandler struct {
+	cfg   *config.Config
+	store *store.Store
+}
+
+func NewTrashHandler(cfg *config.Config, st *store.Store) *TrashHandler {
+	return &TrashHandler{cfg: cfg, store: st}
+}
+
+// trashRecords 按 URL 中的类型取对应的存取接口，分组单独处理
+func (h *TrashHandler) trashRecords(kind string) store.Records {
+	switch kind {
+	case "subscriptions":
+		return h.store.Subscriptions
+	case "credentials":
+		return h.store.Credentials
+	case "memos":
+		return h.store.Memos
+	}
+	return nil
+}
+
+// GetTrash 列出回收站中自己的记录和可编辑的共享记录。
+// 凭证和备忘录不返回密文，恢复后再按正常流程读取。
+// GET /api/v1/trash
+func (h *TrashHandler) GetTrash(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	subs, err := h.store.Subscriptions.ListDeleted(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取回收站失败"})
+		return
+	}
+	creds, err := h.store.Credentials.ListDeleted(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取回收站失败"})
+		return
+	}
+	memos, err := h.store.Memos.ListDeleted(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取回收站失败"})
+		return
+	}
+	tags, err := h.store.Tags.ListDeleted(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取回收站失败"})
+		return
+	}
+
+	for i := range creds {
+		creds[i].Password, creds[i].Notes = "", ""
+	}
+	for i := range memos {
+		memos[i].Content = ""
+	}
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+	if creds == nil {
+		creds = []models.Credential{}
+	}
+	if memos == nil {
+		memos = []models.Memo{}
+	}
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscriptions": subs,
+		"credentials":   creds,
+		"memos":         memos,
+		"tags":          tags,
+		"retentionDays": int(h.cfg.TrashRetention / (24 * time.Hour)),
+	})
+}
+
+// RestoreTrashItem 把记录移出回收站
+// POST /api/v1/trash/:kind/:id/restore
+func (h *TrashHandler) RestoreTrashItem(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	kind, id := c.Param("kind"), c.Param("id")
+
+	if kind == "tags" {
+		h.restoreTag(c, vaultID, id)
+		return
+	}
+	records := h.trashRecords(kind)
+	if records == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未知的记录类型"})
+		return
+	}
+	if _, err := records.LocateDeleted(vaultID, id); err != nil {
+		writeTrashLookupError(c, err)
+		return
+	}
+	if err := records.Restore(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复"})
+}
+
+// restoreTag 恢复分组；回收站外已有同名分组时拒绝，避免出现两个同名分组
+func (h *TrashHandler) restoreTag(c *gin.Context, vaultID, id string) {
+	tag, err := h.store.Tags.GetDeleted(vaultID, id)
+	if err != nil {
+		writeTrashLookupError(c, err)
+		return
+	}
+	tags, err := h.store.Tags.List(vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	if findTagByName(tags, tag.Name) != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "已有同名分组，请先重命名或删除后再恢复"})
+		return
+	}
+	if err := h.store.Tags.Restore(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复"})
+}
+
+// PurgeTrashItem 彻底删除回收站中的一条记录，不可恢复
+// DELETE /api/v1/trash/:kind/:id
+func (h *TrashHandler) PurgeTrashItem(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	kind, id := c.Param("kind"), c.Param("id")
+
+	var err error
+	if kind == "tags" {
+		_, err = h.store.Tags.GetDeleted(vaultID, id)
+	} else if records := h.trashRecords(kind); records != nil {
+		_, err = records.LocateDeleted(vaultID, id)
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未知的记录类型"})
+		return
+	}
+	if err != nil {
+		writeTrashLookupError(c, err)
+		return
+	}
+
+	if kind == "tags" {
+		err = h.store.Tags.Purge(id)
+	} else {
+		err = h.trashRecords(kind).Purge(id)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已彻底删除"})
+}
+
+// EmptyTrash 彻底删除回收站中的全部记录
+// DELETE /api/v1/trash
+func (h *TrashHandler) EmptyTrash(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	purged := 0
+	fail := func() {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败", "purged": purged})
+	}
+
+	subs, err := h.store.Subscriptions.ListDeleted(vaultID)
+	if err != nil {
+		fail()
+		return
+	}
+	for _, sub := range subs {
+		if err := h.store.Subscriptions.Purge(sub.ID); err != nil {
+			fail()
+			return
+		}
+		purged++
+	}
+	creds, err := h.store.Credentials.ListDeleted(vaultID)
+	if err != nil {
+		fail()
+		return
+	}
+	for _, cred := range creds {
+		if err := h.store.Credentials.Purge(cred.ID); err != nil {
+			fail()
+			return
+		}
+		purged++
+	}
+	memos, err := h.store.Memos.ListDeleted(vaultID)
+	if err != nil {
+		fail()
+		return
+	}
+	for _, memo := range memos {
+		if err := h.store.Memos.Purge(memo.ID); err != nil {
+			fail()
+			return
+		}
+		purged++
+	}
+	tags, err := h.store.Tags.ListDeleted(vaultID)
+	if err != nil {
+		fail()
+		return
+	}
+	for _, tag := range tags {
+		if err := h.store.Tags.Purge(tag.ID); err != nil {
+			fail()
+			return
+		}
+		purged++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+func writeTrashLookupError(c *gin.Context, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有这条记录"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTrashRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.TrashRetention = 30 * 24 * time.Hour
+	st := store.NewSQL(testDB)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, st)
+	settings := NewSettingsHandler(st)
+	trash := NewTrashHandler(cfg, st)
+	r.GET("/subscriptions", vault.GetSubscriptions)
+	r.DELETE("/subscriptions/:id", vault.DeleteSubscription)
+	r.DELETE("/credentials/:id", vault.DeleteCredential)
+	r.POST("/tags", settings.CreateTag)
+	r.DELETE("/tags/:id", settings.DeleteTag)
+	r.GET("/trash", trash.GetTrash)
+	r.DELETE("/trash", trash.EmptyTrash)
+	r.POST("/trash/:kind/:id/restore", trash.RestoreTrashItem)
+	r.DELETE("/trash/:kind/:id", trash.PurgeTrashItem)
+	return r
+}
+
+type trashResponse struct {
+	Subscriptions []models.Subscription `json:"subscriptions"`
+	Credentials   []models.Credential   `json:"credentials"`
+	Tags          []models.Tag          `json:"tags"`
+	RetentionDays int                   `json:"retentionDays"`
+}
+
+func getTrash(t *testing.T, r *gin.Engine) trashResponse {
+	w := sharingRequest(r, "test-vault-id", http.MethodGet, "/trash", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("读取回收站失败: %d %s", w.Code, w.Body.String())
+	}
+	var out trashResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDeleteMovesToTrashAndRestores(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTrashRouter()
+
+	tag := models.Tag{VaultID: "test-vault-id", Name: "娱乐"}
+	sub := models.Subscription{VaultID: "test-vault-id", Name: "Netflix", Cost: 15, Tags: []models.Tag{tag}}
+	if err := testDB.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if w := sharingRequest(r, "test-vault-id", http.MethodDelete, "/subscriptions/"+sub.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除订阅失败: %d %s", w.Code, w.Body.String())
+	}
+	trash := getTrash(t, r)
+	if len(trash.Subscriptions) != 1 || !trash.Subscriptions[0].DeletedAt.Valid || trash.RetentionDays != 30 {
+		t.Fatalf("删除的订阅应出现在回收站中: %+v", trash)
+	}
+
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/trash/subscriptions/"+sub.ID+"/restore", nil); w.Code != http.StatusOK {
+		t.Fatalf("恢复失败: %d %s", w.Code, w.Body.String())
+	}
+	w := sharingRequest(r, "test-vault-id", http.MethodGet, "/subscriptions", nil)
+	var subs []models.Subscription
+	json.Unmarshal(w.Body.Bytes(), &subs)
+	if len(subs) != 1 || subs[0].ID != sub.ID {
+		t.Fatalf("恢复后订阅应重新出现: %s", w.Body.String())
+	}
+
+	// 再次删除后彻底删除，标签关联一并清除
+	sharingRequest(r, "test-vault-id", http.MethodDelete, "/subscriptions/"+sub.ID, nil)
+	if w := sharingRequest(r, "test-vault-id", http.MethodDelete, "/trash/subscriptions/"+sub.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("彻底删除失败: %d %s", w.Code, w.Body.String())
+	}
+	var links int64
+	testDB.Table("subscription_tags").Where("subscription_id = ?", sub.ID).Count(&links)
+	if links != 0 {
+		t.Fatalf("彻底删除后不应留下标签关联，实际 %d 条", links)
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/trash/subscriptions/"+sub.ID+"/restore", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("彻底删除后不能再恢复，实际 %d", w.Code)
+	}
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/trash/vaults/"+sub.ID+"/restore", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("未知类型应返回 404，实际 %d", w.Code)
+	}
+}
+
+func TestTrashHidesSecretsAndIsPerVault(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTrashRouter()
+
+	cred := models.Credential{VaultID: "test-vault-id", Label: "GitHub", Username: "me", Password: "ciphertext", Notes: "ciphertext"}
+	if err := testDB.Create(&cred).Error; err != nil {
+		t.Fatal(err)
+	}
+	sharingRequest(r, "test-vault-id", http.MethodDelete, "/credentials/"+cred.ID, nil)
+
+	trash := getTrash(t, r)
+	if len(trash.Credentials) != 1 || trash.Credentials[0].Password != "" || trash.Credentials[0].Notes != "" {
+		t.Fatalf("回收站不应返回密文: %+v", trash.Credentials)
+	}
+	if w := sharingRequest(r, "other-vault", http.MethodDelete, "/trash/credentials/"+cred.ID, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("其他保险库不应能彻底删除，实际 %d", w.Code)
+	}
+
+	w := sharingRequest(r, "test-vault-id", http.MethodDelete, "/trash", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"purged":1}` {
+		t.Fatalf("清空回收站失败: %d %s", w.Code, w.Body.String())
+	}
+	if trash := getTrash(t, r); len(trash.Credentials) != 0 {
+		t.Fatal("清空后回收站应为空")
+	}
+}
+
+func TestRestoreTagRejectsDuplicateName(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupTrashRouter()
+
+	var tag models.Tag
+	w := sharingRequest(r, "test-vault-id", http.MethodPost, "/tags", map[string]string{"name": "工作"})
+	json.Unmarshal(w.Body.Bytes(), &tag)
+	sharingRequest(r, "test-vault-id", http.MethodDelete, "/tags/"+tag.ID, nil)
+	sharingRequest(r, "test-vault-id", http.MethodPost, "/tags", map[string]string{"name": "工作"})
+
+	if w := sharingRequest(r, "test-vault-id", http.MethodPost, "/trash/tags/"+tag.ID+"/restore", nil); w.Code != http.StatusConflict {
+		t.Fatalf("已有同名分组时恢复应返回 409，实际 %d", w.Code)
+	}
+	if trash := getTrash(t, r); len(trash.Tags) != 1 {
+		t.Fatalf("恢复失败的分组应留在回收站中: %+v", trash.Tags)
+	}
+}
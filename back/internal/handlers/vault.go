@@ -1,55 +1,51 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"subvault/internal/config"
-	"subvault/internal/crypto"
-	"subvault/internal/database"
+	"subvault/internal/keyring"
 	"subvault/internal/models"
 	"subvault/internal/renewal"
+	"subvault/internal/store"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type VaultHandler struct {
-	cfg *config.Config
+	cfg   *config.Config
+	keys  *keyring.Keyring
+	db    *gorm.DB
+	store *store.Store
 }
 
-func NewVaultHandler(cfg *config.Config) *VaultHandler {
-	return &VaultHandler{cfg: cfg}
+func NewVaultHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB, st *store.Store) *VaultHandler {
+	return &VaultHandler{cfg: cfg, keys: keys, db: db, store: st}
 }
 
 // GetVault 获取完整 Vault 数据
 func (h *VaultHandler) GetVault(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-	EnsureDefaultGroup(vaultID)
-
-	var credentials []models.Credential
-	var subscriptions []models.Subscription
-	var memos []models.Memo
-
-	database.DB.Where("vault_id = ?", vaultID).Find(&credentials)
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
-	database.DB.Where("vault_id = ?", vaultID).Find(&memos)
-
-	for i := range credentials {
-		credentials[i].Password, _ = crypto.DecryptField(credentials[i].Password, h.cfg.EncryptionKey)
-		credentials[i].Notes, _ = crypto.DecryptField(credentials[i].Notes, h.cfg.EncryptionKey)
-	}
-
-	for i := range memos {
-		if memos[i].Content != "" {
-			decrypted, err := crypto.DecryptField(memos[i].Content, h.cfg.EncryptionKey)
-			if err != nil {
-				memos[i].Content = ""
-			} else {
-				memos[i].Content = decrypted
-			}
-		}
+	if _, ok := vaultDataKey(c, h.db, h.keys, vaultID); !ok {
+		return
 	}
+	EnsureDefaultGroup(h.store, vaultID)
+	// 游标取读取之前的时间，读取期间的修改会在下一次增量同步中返回
+	cursor := encodeSyncCursor(time.Now())
+
+	// 自己的数据加上所在共享集合中的数据
+	credentials, _ := h.store.Credentials.ListReadable(vaultID)
+	subscriptions, _ := h.store.Subscriptions.ListReadable(vaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
+	memos, _ := h.store.Memos.ListReadable(vaultID)
+
+	decryptCredentials(h.db, h.keys, credentials)
+	decryptMemos(h.db, h.keys, memos)
+	auditCredentialRead(c, h.db, vaultID, credentials)
 
 	if credentials == nil {
 		credentials = []models.Credential{}
@@ -66,6 +62,7 @@ func (h *VaultHandler) GetVault(c *gin.Context) {
 		Subscriptions: subscriptions,
 		Memos:         memos,
 		LastUpdated:   time.Now().UnixMilli(),
+		Cursor:        cursor,
 	})
 }
 
@@ -74,9 +71,8 @@ func (h *VaultHandler) GetVault(c *gin.Context) {
 func (h *VaultHandler) GetSubscriptions(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
-	var subscriptions []models.Subscription
-	database.DB.Where("vault_id = ?", vaultID).Find(&subscriptions)
-	subscriptions = renewal.RotateAndSave(database.DB, subscriptions, renewal.Today())
+	subscriptions, _ := h.store.Subscriptions.ListReadable(vaultID)
+	subscriptions = renewal.RotateAndSave(h.store.Subscriptions, subscriptions, renewal.Today())
 
 	if subscriptions == nil {
 		subscriptions = []models.Subscription{}
@@ -85,6 +81,18 @@ func (h *VaultHandler) GetSubscriptions(c *gin.Context) {
 	c.JSON(http.StatusOK, subscriptions)
 }
 
+// GetSubscription 获取单个订阅，ETag 为版本号
+// GET /api/v1/subscriptions/:id
+func (h *VaultHandler) GetSubscription(c *gin.Context) {
+	sub, err := h.store.Subscriptions.GetReadable(c.GetString("vaultId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return
+	}
+	setETag(c, sub.Version)
+	c.JSON(http.StatusOK, sub)
+}
+
 func (h *VaultHandler) CreateSubscription(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
@@ -94,15 +102,20 @@ func (h *VaultHandler) CreateSubscription(c *gin.Context) {
 		return
 	}
 
+	if !requireCollectionEditor(c, h.db, vaultID, sub.CollectionID) {
+		return
+	}
+
 	sub.VaultID = vaultID
 	sub.Category = ResolveGroupName(sub.Category)
 	sub.NormalizeStatus()
 
-	if err := database.DB.Create(&sub).Error; err != nil {
+	if err := h.store.Subscriptions.Create(&sub); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建订阅失败"})
 		return
 	}
 
+	setETag(c, sub.Version)
 	c.JSON(http.StatusCreated, sub)
 }
 
@@ -110,11 +123,22 @@ func (h *VaultHandler) UpdateSubscription(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	subID := c.Param("id")
 
-	var sub models.Subscription
-	if err := database.DB.Where("id = ? AND vault_id = ?", subID, vaultID).First(&sub).Error; err != nil {
+	sub, err := h.store.Subscriptions.GetReadable(vaultID, subID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, sub.VaultID, sub.CollectionID) {
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if expected != sub.Version {
+		respondConflict(c, sub, sub.Version)
+		return
+	}
 
 	var updateData models.Subscription
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -126,35 +150,38 @@ func (h *VaultHandler) UpdateSubscription(c *gin.Context) {
 	oldCurrency := sub.Currency
 	updateData.NormalizeStatus()
 
-	if err := database.DB.Model(&sub).Updates(map[string]interface{}{
-		"name":              updateData.Name,
-		"cost":              updateData.Cost,
-		"currency":          updateData.Currency,
-		"frequency_amount":  updateData.FrequencyAmount,
-		"frequency_unit":    updateData.FrequencyUnit,
-		"renewal_date":      updateData.RenewalDate,
-		"start_date":        updateData.StartDate,
-		"category":          ResolveGroupName(updateData.Category),
-		"credential_id":     updateData.CredentialID,
-		"website":           updateData.Website,
-		"active":            updateData.Active,
-		"auto_rotate":       updateData.AutoRotate,
-		"status":            updateData.Status,
-		"payment_method":    updateData.PaymentMethod,
-		"card_last4":        updateData.CardLast4,
-		"cancel_url":        updateData.CancelURL,
-		"trial_ends_on":     updateData.TrialEndsOn,
-		"promo_ends_on":     updateData.PromoEndsOn,
-		"reminder_days":     updateData.ReminderDays,
-		"notes":             updateData.Notes,
-	}).Error; err != nil {
+	sub.Name = updateData.Name
+	sub.Cost = updateData.Cost
+	sub.Currency = updateData.Currency
+	sub.FrequencyAmount = updateData.FrequencyAmount
+	sub.FrequencyUnit = updateData.FrequencyUnit
+	sub.RenewalDate = updateData.RenewalDate
+	sub.StartDate = updateData.StartDate
+	sub.Category = ResolveGroupName(updateData.Category)
+	sub.CredentialID = updateData.CredentialID
+	sub.Website = updateData.Website
+	sub.Active = updateData.Active
+	sub.AutoRotate = updateData.AutoRotate
+	sub.Status = updateData.Status
+	sub.PaymentMethod = updateData.PaymentMethod
+	sub.CardLast4 = updateData.CardLast4
+	sub.CancelURL = updateData.CancelURL
+	sub.TrialEndsOn = updateData.TrialEndsOn
+	sub.PromoEndsOn = updateData.PromoEndsOn
+	sub.ReminderDays = updateData.ReminderDays
+	sub.Notes = updateData.Notes
+
+	if err := h.store.Subscriptions.Save(&sub); errors.Is(err, store.ErrConflict) {
+		h.subscriptionConflict(c, vaultID, subID)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新订阅失败"})
 		return
 	}
 
 	if updateData.Cost != oldCost || updateData.Currency != oldCurrency {
-		database.DB.Create(&models.PriceHistory{
-			VaultID:        vaultID,
+		h.store.Subscriptions.RecordPriceChange(&models.PriceHistory{
+			VaultID:        sub.VaultID,
 			SubscriptionID: subID,
 			OldCost:        oldCost,
 			NewCost:        updateData.Cost,
@@ -162,19 +189,37 @@ func (h *VaultHandler) UpdateSubscription(c *gin.Context) {
 		})
 	}
 
-	database.DB.Where("id = ? AND vault_id = ?", subID, vaultID).First(&sub)
+	setETag(c, sub.Version)
 	c.JSON(http.StatusOK, sub)
 }
 
+// subscriptionConflict 保存时发现订阅已被修改，重新读取后返回 409
+func (h *VaultHandler) subscriptionConflict(c *gin.Context, vaultID, id string) {
+	current, err := h.store.Subscriptions.GetReadable(vaultID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return
+	}
+	respondConflict(c, current, current.Version)
+}
+
 func (h *VaultHandler) DeleteSubscription(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	subID := c.Param("id")
 
-	result := database.DB.Where("id = ? AND vault_id = ?", subID, vaultID).Delete(&models.Subscription{})
-	if result.RowsAffected == 0 {
+	sub, err := h.store.Subscriptions.GetReadable(vaultID, subID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, sub.VaultID, sub.CollectionID) {
+		return
+	}
+
+	if err := h.store.Subscriptions.Delete(subID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除订阅失败"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
@@ -183,15 +228,14 @@ func (h *VaultHandler) DeleteSubscription(c *gin.Context) {
 
 func (h *VaultHandler) GetCredentials(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
-
-	var credentials []models.Credential
-	database.DB.Where("vault_id = ?", vaultID).Find(&credentials)
-
-	for i := range credentials {
-		credentials[i].Password, _ = crypto.DecryptField(credentials[i].Password, h.cfg.EncryptionKey)
-		credentials[i].Notes, _ = crypto.DecryptField(credentials[i].Notes, h.cfg.EncryptionKey)
+	if _, ok := vaultDataKey(c, h.db, h.keys, vaultID); !ok {
+		return
 	}
 
+	credentials, _ := h.store.Credentials.ListReadable(vaultID)
+	decryptCredentials(h.db, h.keys, credentials)
+	auditCredentialRead(c, h.db, vaultID, credentials)
+
 	if credentials == nil {
 		credentials = []models.Credential{}
 	}
@@ -199,6 +243,23 @@ func (h *VaultHandler) GetCredentials(c *gin.Context) {
 	c.JSON(http.StatusOK, credentials)
 }
 
+// GetCredential 获取单个凭证（已解密），ETag 为版本号
+// GET /api/v1/credentials/:id
+func (h *VaultHandler) GetCredential(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+	cred, err := h.store.Credentials.GetReadable(vaultID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
+		return
+	}
+	list := []models.Credential{cred}
+	decryptCredentials(h.db, h.keys, list)
+	auditCredentialRead(c, h.db, vaultID, list)
+
+	setETag(c, cred.Version)
+	c.JSON(http.StatusOK, list[0])
+}
+
 func (h *VaultHandler) CreateCredential(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 
@@ -208,12 +269,26 @@ func (h *VaultHandler) CreateCredential(c *gin.Context) {
 		return
 	}
 
+	if !requireCollectionEditor(c, h.db, vaultID, cred.CollectionID) {
+		return
+	}
+
 	cred.VaultID = vaultID
 	cred.Category = ResolveGroupName(cred.Category)
 
+	key, ok := vaultDataKey(c, h.db, h.keys, vaultID)
+	if !ok {
+		return
+	}
+
+	// 密文绑定行 ID，需在加密前确定
+	if cred.ID == "" {
+		cred.ID = uuid.New().String()
+	}
+
 	if cred.Password != "" {
 		var err error
-		cred.Password, err = crypto.EncryptField(cred.Password, h.cfg.EncryptionKey)
+		cred.Password, err = key.EncryptField(cred.Password, credentialAAD(cred.ID, "password"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
@@ -221,28 +296,29 @@ func (h *VaultHandler) CreateCredential(c *gin.Context) {
 	}
 	if cred.Notes != "" {
 		var err error
-		cred.Notes, err = crypto.EncryptField(cred.Notes, h.cfg.EncryptionKey)
+		cred.Notes, err = key.EncryptField(cred.Notes, credentialAAD(cred.ID, "notes"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
 		}
 	}
 
-	if err := database.DB.Create(&cred).Error; err != nil {
+	if err := h.store.Credentials.Create(&cred); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建凭证失败"})
 		return
 	}
 
 	// 返回时解密
 	if cred.Password != "" {
-		decrypted, _ := crypto.Decrypt(cred.Password, h.cfg.EncryptionKey)
+		decrypted, _ := key.Decrypt(cred.Password, credentialAAD(cred.ID, "password"))
 		cred.Password = decrypted
 	}
 	if cred.Notes != "" {
-		decrypted, _ := crypto.Decrypt(cred.Notes, h.cfg.EncryptionKey)
+		decrypted, _ := key.Decrypt(cred.Notes, credentialAAD(cred.ID, "notes"))
 		cred.Notes = decrypted
 	}
 
+	setETag(c, cred.Version)
 	c.JSON(http.StatusCreated, cred)
 }
 
@@ -250,11 +326,22 @@ func (h *VaultHandler) UpdateCredential(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	credID := c.Param("id")
 
-	var cred models.Credential
-	if err := database.DB.Where("id = ? AND vault_id = ?", credID, vaultID).First(&cred).Error; err != nil {
+	cred, err := h.store.Credentials.GetReadable(vaultID, credID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, cred.VaultID, cred.CollectionID) {
+		return
+	}
+	expected, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+	if expected != cred.Version {
+		h.respondCredentialConflict(c, cred)
+		return
+	}
 
 	var updateData models.Credential
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -262,32 +349,58 @@ func (h *VaultHandler) UpdateCredential(c *gin.Context) {
 		return
 	}
 
-	updates := map[string]interface{}{
-		"username": updateData.Username,
-		"label":    updateData.Label,
-		"website":  updateData.Website,
-		"category": ResolveGroupName(updateData.Category),
+	// 共享凭证始终用创建者的数据密钥加密
+	key, ok := vaultDataKey(c, h.db, h.keys, cred.VaultID)
+	if !ok {
+		return
+	}
+
+	// 修改前的密码和备注存入历史版本；旧值无法解密时（如密钥已损坏）不记录历史
+	var previous *models.CredentialHistory
+	if oldPassword, oldNotes, err := credentialSecrets(key, cred); err == nil && (oldPassword != "" || oldNotes != "") &&
+		((updateData.Password != "" && updateData.Password != oldPassword) || (updateData.Notes != "" && updateData.Notes != oldNotes)) {
+		if previous, err = newCredentialHistory(key, cred, oldPassword, oldNotes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+			return
+		}
 	}
 
+	cred.Username = updateData.Username
+	cred.Label = updateData.Label
+	cred.Website = updateData.Website
+	cred.Category = ResolveGroupName(updateData.Category)
+
+	// 密码和备注留空表示不修改
 	if updateData.Password != "" {
-		encrypted, err := crypto.EncryptField(updateData.Password, h.cfg.EncryptionKey)
+		encrypted, err := key.EncryptField(updateData.Password, credentialAAD(cred.ID, "password"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
 		}
-		updates["password"] = encrypted
+		cred.Password = encrypted
 	}
 
 	if updateData.Notes != "" {
-		encrypted, err := crypto.EncryptField(updateData.Notes, h.cfg.EncryptionKey)
+		encrypted, err := key.EncryptField(updateData.Notes, credentialAAD(cred.ID, "notes"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
 			return
 		}
-		updates["notes"] = encrypted
+		cred.Notes = encrypted
 	}
 
-	database.DB.Model(&cred).Updates(updates)
+	if previous != nil {
+		err = h.store.Credentials.SaveWithHistory(&cred, previous, passwordHistoryLimit(h.store, cred.VaultID))
+	} else {
+		err = h.store.Credentials.Save(&cred)
+	}
+	if errors.Is(err, store.ErrConflict) {
+		h.credentialConflict(c, vaultID, credID)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新凭证失败"})
+		return
+	}
 
 	// 返回解密后的数据
 	cred.Username = updateData.Username
@@ -297,23 +410,46 @@ func (h *VaultHandler) UpdateCredential(c *gin.Context) {
 	cred.Website = updateData.Website
 	cred.Category = updateData.Category
 
+	setETag(c, cred.Version)
 	c.JSON(http.StatusOK, cred)
 }
 
+// credentialConflict 保存时发现凭证已被修改，重新读取后返回 409
+func (h *VaultHandler) credentialConflict(c *gin.Context, vaultID, id string) {
+	current, err := h.store.Credentials.GetReadable(vaultID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
+		return
+	}
+	h.respondCredentialConflict(c, current)
+}
+
+// respondCredentialConflict 解密后返回凭证的当前内容
+func (h *VaultHandler) respondCredentialConflict(c *gin.Context, current models.Credential) {
+	list := []models.Credential{current}
+	decryptCredentials(h.db, h.keys, list)
+	auditCredentialRead(c, h.db, c.GetString("vaultId"), list)
+	respondConflict(c, list[0], current.Version)
+}
+
 func (h *VaultHandler) DeleteCredential(c *gin.Context) {
 	vaultID := c.GetString("vaultId")
 	credID := c.Param("id")
 
-	// 先解除订阅关联
-	database.DB.Model(&models.Subscription{}).
-		Where("vault_id = ? AND credential_id = ?", vaultID, credID).
-		Update("credential_id", nil)
-
-	result := database.DB.Where("id = ? AND vault_id = ?", credID, vaultID).Delete(&models.Credential{})
-	if result.RowsAffected == 0 {
+	cred, err := h.store.Credentials.GetReadable(vaultID, credID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
 		return
 	}
+	if !requireEditable(c, h.db, vaultID, cred.VaultID, cred.CollectionID) {
+		return
+	}
+
+	// 移入回收站，订阅关联保留到彻底删除时再解除，以便恢复
+	if err := h.store.Credentials.Delete(credID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除凭证失败"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
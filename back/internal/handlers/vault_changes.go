@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncOverlap 按游标查询时往前多查的时间。游标生成时仍在进行的写入，其修改时间可能早于游标，
+// 多查一段避免漏掉；重叠部分的记录会重复返回，客户端按 ID 覆盖即可
+const syncOverlap = 5 * time.Second
+
+// encodeSyncCursor 游标对客户端不透明，内容是服务器时间（毫秒）
+func encodeSyncCursor(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixMilli(), 10)))
+}
+
+func decodeSyncCursor(cursor string) (time.Time, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// syncTombstone 增量同步中需要客户端移除的记录：移入回收站，或不再可见（移出共享集合、退出集合、彻底删除等）。
+// Kind 与回收站接口的类型一致
+type syncTombstone struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+type vaultChangesResponse struct {
+	Credentials   []models.Credential   `json:"credentials"`
+	Subscriptions []models.Subscription `json:"subscriptions"`
+	Memos         []models.Memo         `json:"memos"`
+	Deleted       []syncTombstone       `json:"deleted"`
+	Cursor        string                `json:"cursor"`
+}
+
+// GetVaultChanges 返回游标之后新建、修改和删除的记录，游标来自 GetVault 或上一次调用的响应。
+// deleted 包含移入回收站的记录，以及不再可见的记录：移出共享集合、被移出或退出集合、集合被删除、彻底删除。
+// 游标早于回收站保留期时，删除的记录和移除记录可能已被清理，返回 410，客户端应重新加载完整数据。
+// 到期订阅由后台任务轮转，轮转后的订阅作为修改返回。
+// GET /api/v1/vault/changes?since=<cursor>
+func (h *VaultHandler) GetVaultChanges(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	now := time.Now()
+	since, ok := decodeSyncCursor(c.Query("since"))
+	if !ok || since.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的同步游标"})
+		return
+	}
+	if h.cfg.TrashRetention > 0 && since.Before(now.Add(-h.cfg.TrashRetention)) {
+		c.JSON(http.StatusGone, gin.H{"error": "同步游标已过期，请重新加载完整数据"})
+		return
+	}
+	if _, ok := vaultDataKey(c, h.db, h.keys, vaultID); !ok {
+		return
+	}
+	from := since.Add(-syncOverlap)
+
+	resp := vaultChangesResponse{Cursor: encodeSyncCursor(now), Deleted: []syncTombstone{}}
+	var err error
+	if resp.Credentials, err = h.store.Credentials.ListChangedSince(vaultID, from); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+		return
+	}
+	if resp.Subscriptions, err = h.store.Subscriptions.ListChangedSince(vaultID, from); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+		return
+	}
+	if resp.Memos, err = h.store.Memos.ListChangedSince(vaultID, from); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+		return
+	}
+
+	// 先移除后又重新可见的记录（移回集合、重新加入）会出现在修改列表中，以修改为准，不再返回移除
+	seen := map[string]bool{}
+	for _, cred := range resp.Credentials {
+		seen[cred.ID] = true
+	}
+	for _, sub := range resp.Subscriptions {
+		seen[sub.ID] = true
+	}
+	for _, memo := range resp.Memos {
+		seen[memo.ID] = true
+	}
+
+	kinds := []struct {
+		kind    string
+		records store.Records
+	}{
+		{"subscriptions", h.store.Subscriptions},
+		{"credentials", h.store.Credentials},
+		{"memos", h.store.Memos},
+	}
+	for _, k := range kinds {
+		deleted, err := k.records.ListDeletedSince(vaultID, from)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+			return
+		}
+		removed, err := k.records.ListRemovedSince(vaultID, from)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取变更失败"})
+			return
+		}
+		for _, t := range append(deleted, removed...) {
+			if seen[t.ID] {
+				continue
+			}
+			// 同一条记录可能先删除再彻底删除，只返回一次
+			seen[t.ID] = true
+			resp.Deleted = append(resp.Deleted, syncTombstone{Kind: k.kind, ID: t.ID, DeletedAt: t.DeletedAt})
+		}
+	}
+
+	decryptCredentials(h.db, h.keys, resp.Credentials)
+	decryptMemos(h.db, h.keys, resp.Memos)
+	// 没有变化的轮询不返回明文，不记审计
+	if len(resp.Credentials) > 0 {
+		auditCredentialRead(c, h.db, vaultID, resp.Credentials)
+	}
+
+	if resp.Credentials == nil {
+		resp.Credentials = []models.Credential{}
+	}
+	if resp.Subscriptions == nil {
+		resp.Subscriptions = []models.Subscription{}
+	}
+	if resp.Memos == nil {
+		resp.Memos = []models.Memo{}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/keyring"
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupVaultChangesRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.TrashRetention = 24 * time.Hour
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("vaultId", c.GetHeader("X-Vault-ID"))
+		c.Next()
+	})
+	st := store.NewSQL(testDB)
+	vault := NewVaultHandler(cfg, keyring.New(cfg), testDB, st)
+	memos := NewMemoHandler(cfg, keyring.New(cfg), testDB, st)
+	trash := NewTrashHandler(cfg, st)
+	collections := NewCollectionHandler(testDB)
+	r.GET("/vault", vault.GetVault)
+	r.GET("/vault/changes", vault.GetVaultChanges)
+	r.POST("/subscriptions", vault.CreateSubscription)
+	r.POST("/credentials", vault.CreateCredential)
+	r.PUT("/credentials/:id", vault.UpdateCredential)
+	r.DELETE("/credentials/:id", vault.DeleteCredential)
+	r.PUT("/credentials/:id/collection", vault.AssignCredentialCollection)
+	r.POST("/memos", memos.CreateMemo)
+	r.DELETE("/memos/:id", memos.DeleteMemo)
+	r.DELETE("/trash/:kind/:id", trash.PurgeTrashItem)
+	r.POST("/collections", collections.CreateCollection)
+	r.DELETE("/collections/:id", collections.DeleteCollection)
+	r.POST("/collections/:id/members", collections.AddCollectionMember)
+	r.DELETE("/collections/:id/members/:memberId", collections.RemoveCollectionMember)
+	return r
+}
+
+func TestGetVaultChanges(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupVaultChangesRouter()
+	const vaultID = "test-vault-id"
+
+	var cred models.Credential
+	json.Unmarshal(sharingRequest(r, vaultID, http.MethodPost, "/credentials", gin.H{"label": "GitHub", "username": "me", "password": "octocat"}).Body.Bytes(), &cred)
+	var memo models.Memo
+	json.Unmarshal(sharingRequest(r, vaultID, http.MethodPost, "/memos", gin.H{"title": "Wi-Fi", "content": "12345678"}).Body.Bytes(), &memo)
+	sharingRequest(r, vaultID, http.MethodPost, "/subscriptions", gin.H{"name": "Netflix", "cost": 15, "renewalDate": "2099-01-01"})
+
+	w := sharingRequest(r, vaultID, http.MethodGet, "/vault", nil)
+	var full models.VaultData
+	json.Unmarshal(w.Body.Bytes(), &full)
+	if _, ok := decodeSyncCursor(full.Cursor); !ok {
+		t.Fatalf("完整加载应返回同步游标: %s", w.Body.String())
+	}
+
+	// 把已有记录的修改时间推到游标之前
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, model := range []interface{}{&models.Credential{}, &models.Memo{}, &models.Subscription{}} {
+		testDB.Model(model).Where("vault_id = ?", vaultID).UpdateColumn("updated_at", hourAgo)
+	}
+	cursor := encodeSyncCursor(time.Now().Add(-30 * time.Minute))
+
+	ifMatchRequest(r, vaultID, http.MethodPut, "/credentials/"+cred.ID, currentETag(&models.Credential{}, cred.ID), gin.H{"label": "GitHub", "username": "me", "password": "new-octocat"})
+	sharingRequest(r, vaultID, http.MethodDelete, "/memos/"+memo.ID, nil)
+
+	w = sharingRequest(r, vaultID, http.MethodGet, "/vault/changes?since="+cursor, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("增量同步失败: %d %s", w.Code, w.Body.String())
+	}
+	var changes vaultChangesResponse
+	json.Unmarshal(w.Body.Bytes(), &changes)
+	if len(changes.Credentials) != 1 || changes.Credentials[0].Password != "new-octocat" {
+		t.Fatalf("应只返回修改过的凭证且为明文: %+v", changes.Credentials)
+	}
+	if len(changes.Subscriptions) != 0 || len(changes.Memos) != 0 {
+		t.Fatalf("未修改的记录不应返回: %s", w.Body.String())
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0].Kind != "memos" || changes.Deleted[0].ID != memo.ID {
+		t.Fatalf("应返回删除的备忘录: %+v", changes.Deleted)
+	}
+	if next, ok := decodeSyncCursor(changes.Cursor); !ok || next.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("应返回新的游标: %q", changes.Cursor)
+	}
+
+	if w := sharingRequest(r, vaultID, http.MethodGet, "/vault/changes?since=not-a-cursor", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效游标应返回 400: %d", w.Code)
+	}
+	expired := encodeSyncCursor(time.Now().Add(-48 * time.Hour))
+	if w := sharingRequest(r, vaultID, http.MethodGet, "/vault/changes?since="+expired, nil); w.Code != http.StatusGone {
+		t.Fatalf("早于回收站保留期的游标应返回 410: %d", w.Code)
+	}
+}
+
+// fetchChanges 读取增量同步，返回修改过的凭证 ID 和需要移除的凭证 ID
+func fetchChanges(t *testing.T, r *gin.Engine, vaultID, cursor string) (changed, deleted map[string]bool) {
+	t.Helper()
+	w := sharingRequest(r, vaultID, http.MethodGet, "/vault/changes?since="+cursor, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("增量同步失败: %d %s", w.Code, w.Body.String())
+	}
+	var changes vaultChangesResponse
+	json.Unmarshal(w.Body.Bytes(), &changes)
+	changed, deleted = map[string]bool{}, map[string]bool{}
+	for _, cred := range changes.Credentials {
+		changed[cred.ID] = true
+	}
+	for _, d := range changes.Deleted {
+		if d.Kind == "credentials" {
+			deleted[d.ID] = true
+		}
+	}
+	return changed, deleted
+}
+
+func TestGetVaultChangesReportsLostAccess(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupVaultChangesRouter()
+
+	alice, err := accounts.Register(testDB, "alice", "alice-passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.SetRegistrationEnabled(testDB, true)
+	bob, err := accounts.Register(testDB, "bob", "bob-passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var home models.Collection
+	json.Unmarshal(sharingRequest(r, alice.VaultID, http.MethodPost, "/collections", gin.H{"name": "家庭"}).Body.Bytes(), &home)
+	var member struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(sharingRequest(r, alice.VaultID, http.MethodPost, "/collections/"+home.ID+"/members", gin.H{"username": "bob"}).Body.Bytes(), &member)
+
+	create := func(label string) string {
+		var cred models.Credential
+		json.Unmarshal(sharingRequest(r, alice.VaultID, http.MethodPost, "/credentials", gin.H{"label": label, "password": "secret"}).Body.Bytes(), &cred)
+		return cred.ID
+	}
+	moved, trashed, joined := create("路由器"), create("电表"), create("水表")
+	for _, id := range []string{moved, trashed} {
+		sharingRequest(r, alice.VaultID, http.MethodPut, "/credentials/"+id+"/collection", gin.H{"collectionId": home.ID})
+	}
+
+	// 把已有记录和成员关系推到游标之前
+	hourAgo := time.Now().Add(-time.Hour)
+	testDB.Model(&models.Credential{}).Where("vault_id = ?", alice.VaultID).UpdateColumn("updated_at", hourAgo)
+	testDB.Model(&models.CollectionMember{}).Where("id = ?", member.ID).UpdateColumn("created_at", hourAgo)
+	cursor := encodeSyncCursor(time.Now().Add(-30 * time.Minute))
+
+	// 一条移出集合、一条移入集合：条数不变，仍应分别返回
+	sharingRequest(r, alice.VaultID, http.MethodPut, "/credentials/"+moved+"/collection", gin.H{"collectionId": nil})
+	sharingRequest(r, alice.VaultID, http.MethodPut, "/credentials/"+joined+"/collection", gin.H{"collectionId": home.ID})
+	// 删除后立即彻底删除，回收站中不留记录
+	sharingRequest(r, alice.VaultID, http.MethodDelete, "/credentials/"+trashed, nil)
+	if w := sharingRequest(r, alice.VaultID, http.MethodDelete, "/trash/credentials/"+trashed, nil); w.Code != http.StatusOK {
+		t.Fatalf("彻底删除失败: %d %s", w.Code, w.Body.String())
+	}
+
+	changed, deleted := fetchChanges(t, r, bob.VaultID, cursor)
+	if !changed[joined] || changed[moved] {
+		t.Fatalf("应返回移入集合的凭证: %v", changed)
+	}
+	if !deleted[moved] || !deleted[trashed] || deleted[joined] {
+		t.Fatalf("移出集合和彻底删除的凭证应作为删除返回: %v", deleted)
+	}
+	if _, deleted := fetchChanges(t, r, alice.VaultID, cursor); deleted[moved] || !deleted[trashed] {
+		t.Fatalf("创建者仍能看到移出集合的凭证，只应收到彻底删除: %v", deleted)
+	}
+
+	// 被移出集合后看不到集合中的凭证
+	if w := sharingRequest(r, alice.VaultID, http.MethodDelete, "/collections/"+home.ID+"/members/"+member.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("移除成员失败: %d %s", w.Code, w.Body.String())
+	}
+	if _, deleted := fetchChanges(t, r, bob.VaultID, cursor); !deleted[joined] {
+		t.Fatalf("被移出集合后应返回集合中凭证的删除: %v", deleted)
+	}
+
+	// 重新加入后，加入前的凭证作为新增返回，不再返回删除
+	json.Unmarshal(sharingRequest(r, alice.VaultID, http.MethodPost, "/collections/"+home.ID+"/members", gin.H{"username": "bob"}).Body.Bytes(), &member)
+	testDB.Model(&models.Credential{}).Where("id = ?", joined).UpdateColumn("updated_at", hourAgo)
+	if changed, deleted := fetchChanges(t, r, bob.VaultID, cursor); !changed[joined] || deleted[joined] {
+		t.Fatalf("重新加入后应返回集合中的凭证: changed=%v deleted=%v", changed, deleted)
+	}
+
+	// 集合删除后记录退回创建者，成员不再可见
+	if w := sharingRequest(r, alice.VaultID, http.MethodDelete, "/collections/"+home.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("删除集合失败: %d %s", w.Code, w.Body.String())
+	}
+	if changed, deleted := fetchChanges(t, r, bob.VaultID, cursor); changed[joined] || !deleted[joined] {
+		t.Fatalf("集合删除后应返回其中凭证的删除: changed=%v deleted=%v", changed, deleted)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"subvault/internal/accounts"
+	"subvault/internal/audit"
+	"subvault/internal/config"
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
+	"subvault/internal/models"
+	"subvault/internal/passkey"
+	"subvault/internal/webauthn"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type WebAuthnHandler struct {
+	keys *keyring.Keyring
+	db   *gorm.DB
+	rp   webauthn.RelyingParty
+}
+
+func NewWebAuthnHandler(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB) *WebAuthnHandler {
+	return &WebAuthnHandler{keys: keys, db: db, rp: relyingParty(cfg)}
+}
+
+// relyingParty 从配置构造 WebAuthn 依赖方
+func relyingParty(cfg *config.Config) webauthn.RelyingParty {
+	return webauthn.RelyingParty{ID: cfg.WebAuthnRPID, Name: "SubVault", Origins: cfg.WebAuthnOrigins}
+}
+
+type BeginWebAuthnRegistrationRequest struct {
+	reauthRequest
+	Passwordless bool `json:"passwordless"`
+}
+
+type FinishWebAuthnRegistrationRequest struct {
+	ChallengeID  string                        `json:"challengeId" binding:"required"`
+	Name         string                        `json:"name" binding:"required"`
+	Passwordless bool                          `json:"passwordless"`
+	Credential   webauthn.RegistrationResponse `json:"credential"`
+}
+
+// BeginRegistration 下发注册选项，前端传给 navigator.credentials.create。
+// 通行密钥（尤其是免密码凭证）之后可以直接解锁，只凭会话不能注册：需再次输入主密钥，开启两步验证时还需验证码。
+// 挑战只能由本保险库在有效期内使用一次，完成注册时凭挑战即可
+// POST /api/v1/webauthn/register/begin
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var req BeginWebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if !confirmIdentity(c, h.db, h.keys, vaultID, audit.ActionPasskeyRegister, req.reauthRequest) {
+		return
+	}
+
+	username := vaultID
+	if user, err := accounts.ForVault(h.db, vaultID); err == nil {
+		username = user.Username
+	}
+	existing, err := passkey.List(h.db, vaultID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通行密钥失败"})
+		return
+	}
+	challengeID, challenge, err := passkey.IssueChallenge(h.db, vaultID, passkey.PurposeRegister)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成注册挑战失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challengeId": challengeID,
+		"publicKey":   h.rp.CreationOptions(challenge, vaultID, username, passkey.Descriptors(existing), req.Passwordless),
+	})
+}
+
+// FinishRegistration 校验认证器的注册响应并保存凭证。
+// 免密码凭证要求用户验证，并返回只出现一次的设备密钥。
+// POST /api/v1/webauthn/register/finish
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	vaultID := c.GetString("vaultId")
+
+	var req FinishWebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供名称和认证器响应"})
+		return
+	}
+
+	challenge, err := passkey.ConsumeChallenge(h.db, req.ChallengeID, vaultID, passkey.PurposeRegister)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "注册已过期，请重试"})
+		return
+	}
+	cred, err := h.rp.VerifyRegistration(challenge, req.Credential, req.Passwordless)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "认证器校验失败"})
+		return
+	}
+
+	row, deviceSecret, err := passkey.Save(h.db, vaultID, req.Name, cred, req.Passwordless)
+	switch {
+	case err == nil:
+	case errors.Is(err, passkey.ErrInvalidName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名称不能为空且不超过 64 个字符"})
+		return
+	case errors.Is(err, passkey.ErrDuplicateCredential):
+		c.JSON(http.StatusConflict, gin.H{"error": "该认证器已注册"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存通行密钥失败"})
+		return
+	}
+
+	recordAudit(c, h.db, vaultID, audit.ActionPasskeyRegister, audit.OutcomeSuccess, row.ID, row.Name)
+	resp := gin.H{"credential": row}
+	if deviceSecret != "" {
+		resp["deviceSecret"] = deviceSecret
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListCredentials 列出已注册的通行密钥
+// GET /api/v1/webauthn/credentials
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	creds, err := passkey.List(h.db, c.GetString("vaultId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取通行密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, creds)
+}
+
+// DeleteCredential 删除通行密钥
+// DELETE /api/v1/webauthn/credentials/:id
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	ok, err := passkey.DeleteForVault(h.db, c.GetString("vaultId"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除通行密钥失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通行密钥不存在"})
+		return
+	}
+	recordAudit(c, h.db, c.GetString("vaultId"), audit.ActionPasskeyDelete, audit.OutcomeSuccess, c.Param("id"), "")
+	c.JSON(http.StatusOK, gin.H{"message": "通行密钥已删除"})
+}
+
+// unlockChallenge 主密钥校验通过后下发第二因素的断言选项，只列出该保险库的凭证
+func (h *AuthHandler) unlockChallenge(vaultID string, creds []models.WebAuthnCredential) (gin.H, error) {
+	challengeID, challenge, err := passkey.IssueChallenge(h.db, vaultID, passkey.PurposeUnlock)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"challengeId": challengeID,
+		"publicKey":   h.rp.RequestOptions(challenge, passkey.Descriptors(creds), "preferred"),
+	}, nil
+}
+
+// verifyUnlockAssertion 校验作为第二因素的断言，失败时已写入响应
+func (h *AuthHandler) verifyUnlockAssertion(c *gin.Context, vaultID, challengeID string, resp webauthn.AssertionResponse, creds []models.WebAuthnCredential) bool {
+	challenge, err := passkey.ConsumeChallenge(h.db, challengeID, vaultID, passkey.PurposeUnlock)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证已过期，请重试"})
+		return false
+	}
+	id := strings.TrimRight(resp.ID, "=")
+	for _, cred := range creds {
+		if cred.CredentialID == id {
+			return h.checkAssertion(c, challenge, resp, cred, false)
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证失败"})
+	return false
+}
+
+// checkAssertion 校验签名并更新签名计数，失败时已写入响应
+func (h *AuthHandler) checkAssertion(c *gin.Context, challenge string, resp webauthn.AssertionResponse, cred models.WebAuthnCredential, requireUV bool) bool {
+	result, err := h.rp.VerifyAssertion(challenge, resp, cred.PublicKey, cred.SignCount, requireUV)
+	if errors.Is(err, webauthn.ErrSignCount) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥签名计数异常，认证器可能已被复制"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证失败"})
+		return false
+	}
+	if err := passkey.RecordUse(h.db, cred.ID, result.SignCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+		return false
+	}
+	return true
+}
+
+type PasskeyUnlockRequest struct {
+	ChallengeID  string                     `json:"challengeId" binding:"required"`
+	Credential   webauthn.AssertionResponse `json:"credential"`
+	DeviceSecret string                     `json:"deviceSecret" binding:"required"`
+}
+
+// BeginPasskeyUnlock 下发免密码解锁的断言选项，由浏览器列出可发现凭证
+// POST /api/v1/auth/webauthn/begin
+func (h *AuthHandler) BeginPasskeyUnlock(c *gin.Context) {
+	challengeID, challenge, err := passkey.IssueChallenge(h.db, "", passkey.PurposePasswordless)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成验证挑战失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"challengeId": challengeID,
+		"publicKey":   h.rp.RequestOptions(challenge, nil, "required"),
+	})
+}
+
+// PasskeyUnlock 用免密码通行密钥解锁：需要认证器完成用户验证，并出示注册时下发给本设备的设备密钥
+// POST /api/v1/auth/webauthn/unlock
+func (h *AuthHandler) PasskeyUnlock(c *gin.Context) {
+	var req PasskeyUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供通行密钥和设备密钥"})
+		return
+	}
+
+	ipKey := lockout.IPKey(c.ClientIP())
+	if !rejectIfLocked(c, h.db, ipKey) {
+		return
+	}
+	challenge, err := passkey.ConsumeChallenge(h.db, req.ChallengeID, "", passkey.PurposePasswordless)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证已过期，请重试"})
+		return
+	}
+	cred, err := passkey.FindByCredentialID(h.db, req.Credential.ID)
+	if err != nil {
+		recordUnlockFailure(c, h.db, "", "", audit.ActionPasskeyUnlock, "")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证失败"})
+		return
+	}
+	subject := lockout.VaultKey(cred.VaultID, c.ClientIP())
+	if !rejectIfLocked(c, h.db, subject) {
+		recordAudit(c, h.db, cred.VaultID, audit.ActionPasskeyUnlock, audit.OutcomeLocked, cred.ID, cred.Name)
+		return
+	}
+	if !passkey.CheckDeviceSecret(cred, req.DeviceSecret) {
+		recordUnlockFailure(c, h.db, subject, cred.VaultID, audit.ActionPasskeyUnlock, cred.Name+"：设备密钥错误")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "通行密钥验证失败"})
+		return
+	}
+	if !h.checkAssertion(c, challenge, req.Credential, cred, true) {
+		recordUnlockFailure(c, h.db, subject, cred.VaultID, audit.ActionPasskeyUnlock, cred.Name+"：签名校验失败")
+		return
+	}
+
+	lockout.Reset(h.db, subject)
+	recordAudit(c, h.db, cred.VaultID, audit.ActionPasskeyUnlock, audit.OutcomeSuccess, cred.ID, cred.Name)
+	h.startSession(c, cred.VaultID, false)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"subvault/internal/keyring"
+	"subvault/internal/middleware"
+	"subvault/internal/webauthn"
+	"subvault/internal/webauthn/webauthntest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupWebAuthnRouter() *gin.Engine {
+	cfg := getTestConfig()
+	cfg.AccessTokenTTL = time.Minute
+	cfg.RefreshTokenTTL = time.Hour
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	auth := NewAuthHandler(cfg, keyring.New(cfg), testDB)
+	r.POST("/api/v1/unlock", auth.Unlock)
+	r.POST("/api/v1/auth/register", auth.Register)
+	r.POST("/api/v1/auth/webauthn/begin", auth.BeginPasskeyUnlock)
+	r.POST("/api/v1/auth/webauthn/unlock", auth.PasskeyUnlock)
+
+	protected := r.Group("/api/v1")
+	protected.Use(middleware.AuthMiddleware(cfg, testDB))
+	h := NewWebAuthnHandler(cfg, keyring.New(cfg), testDB)
+	protected.POST("/webauthn/register/begin", h.BeginRegistration)
+	protected.POST("/webauthn/register/finish", h.FinishRegistration)
+	protected.GET("/webauthn/credentials", h.ListCredentials)
+	return r
+}
+
+func authedJSON(r *gin.Engine, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type webauthnChallenge struct {
+	ChallengeID string `json:"challengeId"`
+	PublicKey   struct {
+		Challenge        string                          `json:"challenge"`
+		AllowCredentials []webauthn.CredentialDescriptor `json:"allowCredentials"`
+	} `json:"publicKey"`
+}
+
+// registerPasskey 以 alice 的主密钥走完注册流程，返回设备密钥（仅免密码凭证有）
+func registerPasskey(t *testing.T, r *gin.Engine, token string, auth *webauthntest.Authenticator, passwordless bool) string {
+	t.Helper()
+	w := authedJSON(r, token, "POST", "/api/v1/webauthn/register/begin", gin.H{"passwordless": passwordless, "masterKey": "alice-passphrase"})
+	var begin webauthnChallenge
+	json.Unmarshal(w.Body.Bytes(), &begin)
+	if w.Code != http.StatusOK || begin.ChallengeID == "" {
+		t.Fatalf("开始注册失败: %d %s", w.Code, w.Body.String())
+	}
+	w = authedJSON(r, token, "POST", "/api/v1/webauthn/register/finish", gin.H{
+		"challengeId":  begin.ChallengeID,
+		"name":         "test key",
+		"passwordless": passwordless,
+		"credential":   auth.Register(begin.PublicKey.Challenge),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("完成注册失败: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		DeviceSecret string `json:"deviceSecret"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.DeviceSecret
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupWebAuthnRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+	// 只有会话不能注册通行密钥
+	if w := authedJSON(r, alice.Token, "POST", "/api/v1/webauthn/register/begin", gin.H{"passwordless": true}); w.Code != http.StatusBadRequest {
+		t.Fatalf("缺少主密钥时不应下发注册挑战: %d", w.Code)
+	}
+	if w := authedJSON(r, alice.Token, "POST", "/api/v1/webauthn/register/begin", gin.H{"passwordless": true, "masterKey": "wrong-passphrase"}); w.Code != http.StatusForbidden {
+		t.Fatalf("主密钥错误时不应下发注册挑战: %d", w.Code)
+	}
+
+	key := webauthntest.New("localhost", "http://localhost:5173")
+	if secret := registerPasskey(t, r, alice.Token, key, false); secret != "" {
+		t.Fatal("普通凭证不应下发设备密钥")
+	}
+
+	// 注册了通行密钥后，只有主密钥不能解锁
+	w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"})
+	var prompt struct {
+		TotpRequired     bool              `json:"totp_required"`
+		WebAuthnRequired bool              `json:"webauthn_required"`
+		WebAuthn         webauthnChallenge `json:"webauthn"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &prompt)
+	if w.Code != http.StatusForbidden || !prompt.WebAuthnRequired || prompt.TotpRequired {
+		t.Fatalf("应要求通行密钥验证: %d %s", w.Code, w.Body.String())
+	}
+	if len(prompt.WebAuthn.PublicKey.AllowCredentials) != 1 || prompt.WebAuthn.PublicKey.AllowCredentials[0].ID != key.CredentialID() {
+		t.Fatalf("应只列出该用户的凭证: %+v", prompt.WebAuthn.PublicKey.AllowCredentials)
+	}
+
+	// 主密钥错误时不下发挑战
+	if w := postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "wrong-passphrase"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("错误主密钥应拒绝: %d", w.Code)
+	}
+
+	assertion := key.Assert(prompt.WebAuthn.PublicKey.Challenge)
+	unlock := gin.H{"username": "alice", "masterKey": "alice-passphrase", "challengeId": prompt.WebAuthn.ChallengeID, "webauthn": assertion}
+	if w := postJSON(r, "/api/v1/unlock", unlock); w.Code != http.StatusOK {
+		t.Fatalf("主密钥加通行密钥应能解锁: %d %s", w.Code, w.Body.String())
+	}
+	if w := postJSON(r, "/api/v1/unlock", unlock); w.Code != http.StatusUnauthorized {
+		t.Fatalf("挑战不能重放: %d", w.Code)
+	}
+
+	// 其他认证器的断言不被接受
+	json.Unmarshal(postJSON(r, "/api/v1/unlock", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &prompt)
+	other := webauthntest.New("localhost", "http://localhost:5173")
+	unlock = gin.H{"username": "alice", "masterKey": "alice-passphrase", "challengeId": prompt.WebAuthn.ChallengeID, "webauthn": other.Assert(prompt.WebAuthn.PublicKey.Challenge)}
+	if w := postJSON(r, "/api/v1/unlock", unlock); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未注册的认证器应拒绝: %d", w.Code)
+	}
+}
+
+func TestWebAuthnPasswordlessUnlock(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	r := setupWebAuthnRouter()
+
+	var alice AuthResponse
+	json.Unmarshal(postJSON(r, "/api/v1/auth/register", gin.H{"username": "alice", "masterKey": "alice-passphrase", "setupToken": "test-setup-token"}).Body.Bytes(), &alice)
+	secondFactor := webauthntest.New("localhost", "http://localhost:5173")
+	registerPasskey(t, r, alice.Token, secondFactor, false)
+	phone := webauthntest.New("localhost", "http://localhost:5173")
+	deviceSecret := registerPasskey(t, r, alice.Token, phone, true)
+	if deviceSecret == "" {
+		t.Fatal("免密码凭证应下发设备密钥")
+	}
+
+	begin := func() webauthnChallenge {
+		var ch webauthnChallenge
+		json.Unmarshal(postJSON(r, "/api/v1/auth/webauthn/begin", gin.H{}).Body.Bytes(), &ch)
+		if len(ch.PublicKey.AllowCredentials) != 0 {
+			t.Fatal("免密码解锁不应在验证前暴露凭证列表")
+		}
+		return ch
+	}
+
+	ch := begin()
+	if w := postJSON(r, "/api/v1/auth/webauthn/unlock", gin.H{"challengeId": ch.ChallengeID, "credential": phone.Assert(ch.PublicKey.Challenge), "deviceSecret": "wrong"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("设备密钥错误应拒绝: %d", w.Code)
+	}
+	ch = begin()
+	if w := postJSON(r, "/api/v1/auth/webauthn/unlock", gin.H{"challengeId": ch.ChallengeID, "credential": secondFactor.Assert(ch.PublicKey.Challenge), "deviceSecret": deviceSecret}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("非免密码凭证不能免密码解锁: %d", w.Code)
+	}
+
+	phone.UserVerified = false
+	ch = begin()
+	if w := postJSON(r, "/api/v1/auth/webauthn/unlock", gin.H{"challengeId": ch.ChallengeID, "credential": phone.Assert(ch.PublicKey.Challenge), "deviceSecret": deviceSecret}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("免密码解锁必须完成用户验证: %d", w.Code)
+	}
+
+	phone.UserVerified = true
+	ch = begin()
+	w := postJSON(r, "/api/v1/auth/webauthn/unlock", gin.H{"challengeId": ch.ChallengeID, "credential": phone.Assert(ch.PublicKey.Challenge), "deviceSecret": deviceSecret})
+	var unlocked AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &unlocked)
+	if w.Code != http.StatusOK || unlocked.VaultID != alice.VaultID || unlocked.Token == "" {
+		t.Fatalf("通行密钥加设备密钥应能解锁: %d %s", w.Code, w.Body.String())
+	}
+
+	w = authedJSON(r, unlocked.Token, "GET", "/api/v1/webauthn/credentials", nil)
+	var creds []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &creds)
+	if len(creds) != 2 || creds[1]["lastUsedAt"] == nil {
+		t.Fatalf("应列出两个凭证并记录使用时间: %s", w.Body.String())
+	}
+	if _, leaked := creds[1]["deviceSecretHash"]; leaked {
+		t.Fatal("不应返回设备密钥哈希")
+	}
+}
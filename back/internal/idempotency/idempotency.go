@@ -0,0 +1,105 @@
+// Package idempotency 持久化保存带 Idempotency-Key 的写请求的响应。
+// 客户端超时后用同一个键重试时直接返回第一次的响应，不会重复写入。
+// 响应中可能有解密后的密码和备注，用保险库的数据密钥加密后保存。
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"subvault/internal/crypto"
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// TTL 键的保留时间，过期后同一个键视为新请求
+	TTL = 24 * time.Hour
+	// PendingTimeout 处理中的记录超过这段时间仍未完成，视为进程中途退出，允许重试
+	PendingTimeout = 5 * time.Minute
+)
+
+var (
+	// ErrInProgress 同一个键的请求还在处理中
+	ErrInProgress = errors.New("idempotent request in progress")
+	// ErrMismatch 同一个键被用于不同的请求
+	ErrMismatch = errors.New("idempotency key reused for a different request")
+)
+
+// Fingerprint 请求的指纹：方法、路径和请求体的 SHA-256
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin 占用保险库中的一个键。返回的记录 StatusCode 为 0 时由本次请求处理，处理完后调用 Complete 或 Abandon；
+// 非 0 时是已完成的同一请求，直接返回其中保存的响应
+func Begin(db *gorm.DB, vaultID, key, fingerprint string) (*models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var row models.IdempotencyKey
+		err := db.Where("vault_id = ? AND key = ?", vaultID, key).First(&row).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			row = models.IdempotencyKey{VaultID: vaultID, Key: key, Fingerprint: fingerprint}
+			if err := db.Create(&row).Error; err == nil {
+				return &row, nil
+			}
+			// 唯一索引冲突：另一个请求同时占用了这个键，重新读取
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		expired := time.Since(row.CreatedAt) > TTL || (row.StatusCode == 0 && time.Since(row.CreatedAt) > PendingTimeout)
+		if expired {
+			if err := db.Where("id = ? AND status_code = ?", row.ID, row.StatusCode).Delete(&models.IdempotencyKey{}).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if row.Fingerprint != fingerprint {
+			return nil, ErrMismatch
+		}
+		if row.StatusCode == 0 {
+			return nil, ErrInProgress
+		}
+		return &row, nil
+	}
+	return nil, ErrInProgress
+}
+
+// ResponseAAD 保存的响应密文绑定到所在的行，表名、列名与 rotation.EncryptedColumns 一致
+func ResponseAAD(id string) crypto.AAD {
+	return crypto.AAD{Table: "idempotency_keys", RowID: id, Field: "response"}
+}
+
+// Complete 用保险库数据密钥 key 加密并保存响应，之后同一个键的请求直接返回它
+func Complete(db *gorm.DB, key *crypto.Cipher, id string, statusCode int, response []byte) error {
+	encrypted, err := key.EncryptField(string(response), ResponseAAD(id))
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.IdempotencyKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status_code": statusCode, "response": encrypted}).Error
+}
+
+// Response 解密 Begin 返回的已完成记录中保存的响应
+func Response(key *crypto.Cipher, row *models.IdempotencyKey) ([]byte, error) {
+	plain, err := key.DecryptField(row.Response, ResponseAAD(row.ID))
+	return []byte(plain), err
+}
+
+// Abandon 释放键，用于服务端出错等允许客户端原样重试的情况
+func Abandon(db *gorm.DB, id string) error {
+	return db.Where("id = ?", id).Delete(&models.IdempotencyKey{}).Error
+}
+
+// PurgeExpired 删除超过保留时间的键
+func PurgeExpired(db *gorm.DB) error {
+	return db.Where("created_at < ?", time.Now().Add(-TTL)).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,87 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+
+	"subvault/internal/crypto"
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testKey 测试用的保险库数据密钥
+var testKey = crypto.NewCipher(crypto.LegacyKDF, "test-data-key")
+
+func TestBeginReplaysCompletedRequest(t *testing.T) {
+	db := openTestDB(t)
+	fp := Fingerprint("POST", "/api/v1/credentials/batch", []byte(`{"items":[]}`))
+
+	row, err := Begin(db, "vault-1", "k1", fp)
+	if err != nil || row.StatusCode != 0 {
+		t.Fatalf("第一次应由本请求处理: %+v %v", row, err)
+	}
+	if _, err := Begin(db, "vault-1", "k1", fp); err != ErrInProgress {
+		t.Fatalf("处理中时应返回 ErrInProgress: %v", err)
+	}
+	if err := Complete(db, testKey, row.ID, 200, []byte(`{"createdCount":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := Begin(db, "vault-1", "k1", fp)
+	if err != nil || replay.StatusCode != 200 || replay.Response == `{"createdCount":1}` {
+		t.Fatalf("完成后应返回加密保存的响应: %+v %v", replay, err)
+	}
+	if body, err := Response(testKey, replay); err != nil || string(body) != `{"createdCount":1}` {
+		t.Fatalf("保存的响应应能解密: %s %v", body, err)
+	}
+	if _, err := Begin(db, "vault-1", "k1", Fingerprint("POST", "/api/v1/credentials/batch", []byte(`{}`))); err != ErrMismatch {
+		t.Fatalf("同一个键用于不同请求应返回 ErrMismatch: %v", err)
+	}
+	if other, err := Begin(db, "vault-2", "k1", fp); err != nil || other.StatusCode != 0 {
+		t.Fatalf("键按保险库隔离: %+v %v", other, err)
+	}
+}
+
+func TestBeginExpiresStaleKeys(t *testing.T) {
+	db := openTestDB(t)
+	fp := Fingerprint("PUT", "/api/v1/memos/groups", nil)
+
+	// 进程中途退出留下的处理中记录，超时后可以重试
+	row, _ := Begin(db, "vault-1", "pending", fp)
+	db.Model(row).Update("created_at", time.Now().Add(-PendingTimeout-time.Minute))
+	if again, err := Begin(db, "vault-1", "pending", fp); err != nil || again.StatusCode != 0 || again.ID == row.ID {
+		t.Fatalf("超时的处理中记录应被替换: %+v %v", again, err)
+	}
+
+	row, _ = Begin(db, "vault-1", "done", fp)
+	Complete(db, testKey, row.ID, 200, []byte(`{}`))
+	db.Model(row).Update("created_at", time.Now().Add(-TTL-time.Hour))
+	if err := PurgeExpired(db); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	db.Model(&models.IdempotencyKey{}).Where("key = ?", "done").Count(&n)
+	if n != 0 {
+		t.Fatal("过期的键应被清理")
+	}
+
+	row, _ = Begin(db, "vault-1", "failed", fp)
+	Abandon(db, row.ID)
+	if again, err := Begin(db, "vault-1", "failed", fp); err != nil || again.StatusCode != 0 {
+		t.Fatalf("释放后可以重新处理: %+v %v", again, err)
+	}
+}
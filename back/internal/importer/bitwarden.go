@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Bitwarden 条目类型，银行卡（3）和身份（4）不导入
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+)
+
+type bitwardenExport struct {
+	Encrypted         bool `json:"encrypted"`
+	PasswordProtected bool `json:"passwordProtected"`
+	Folders           []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Collections []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"collections"`
+	Items []struct {
+		Type          int      `json:"type"`
+		Name          string   `json:"name"`
+		Notes         string   `json:"notes"`
+		FolderID      string   `json:"folderId"`
+		CollectionIDs []string `json:"collectionIds"`
+		Login         struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+			Type  int    `json:"type"`
+		} `json:"fields"`
+	} `json:"items"`
+}
+
+// parseBitwardenJSON 解析个人或组织导出的未加密 JSON；组织导出没有文件夹，用第一个集合作为分组
+func parseBitwardenJSON(data []byte) (Result, error) {
+	var export bitwardenExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return Result{}, ErrInvalidFile
+	}
+	if export.Encrypted || export.PasswordProtected {
+		return Result{}, ErrEncrypted
+	}
+
+	folders := map[string]string{}
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+	for _, col := range export.Collections {
+		folders[col.ID] = col.Name
+	}
+
+	var result Result
+	for _, it := range export.Items {
+		if it.Type != bitwardenLogin && it.Type != bitwardenSecureNote {
+			result.Skipped++
+			continue
+		}
+		folder := folders[it.FolderID]
+		if folder == "" && len(it.CollectionIDs) > 0 {
+			folder = folders[it.CollectionIDs[0]]
+		}
+		extras := [][2]string{{"TOTP", it.Login.TOTP}}
+		for _, field := range it.Fields {
+			// 类型 3 为关联字段，值只是另一个字段的编号
+			if field.Type != 3 {
+				extras = append(extras, [2]string{field.Name, field.Value})
+			}
+		}
+		item := Item{
+			Label:    it.Name,
+			Username: it.Login.Username,
+			Password: it.Login.Password,
+			Notes:    joinNotes(it.Notes, extras...),
+			Folder:   folder,
+		}
+		if len(it.Login.URIs) > 0 {
+			item.Website = it.Login.URIs[0].URI
+		}
+		result.add(item)
+	}
+	return result, nil
+}
+
+// parseBitwardenCSV 解析 Bitwarden 的 CSV 导出，fields 列为多行的 “名称: 值”，原样并入备注
+func parseBitwardenCSV(data []byte) (Result, error) {
+	header, rows, err := readCSV(data)
+	if err != nil {
+		return Result{}, err
+	}
+	if !header.has("login_password") {
+		return Result{}, ErrInvalidFile
+	}
+
+	var result Result
+	for _, row := range rows {
+		kind := strings.ToLower(strings.TrimSpace(header.get(row, "type")))
+		if kind != "" && kind != "login" && kind != "note" {
+			result.Skipped++
+			continue
+		}
+		folder := header.get(row, "folder")
+		if folder == "" {
+			// 组织导出用 collections 列，多个集合以逗号分隔
+			folder, _, _ = strings.Cut(header.get(row, "collections"), ",")
+		}
+		result.add(Item{
+			Label:    header.get(row, "name"),
+			Username: header.get(row, "login_username"),
+			Password: header.get(row, "login_password"),
+			Website:  firstLine(header.get(row, "login_uri")),
+			Notes:    joinNotes(header.get(row, "notes"), [2]string{"", header.get(row, "fields")}, [2]string{"TOTP", header.get(row, "login_totp")}),
+			Folder:   folder,
+		})
+	}
+	return result, nil
+}
+
+// firstLine 多个网址以换行或逗号分隔时取第一个
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "\n,"); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+package importer
+
+// parseChromeCSV 解析 Chrome、Edge 等 Chromium 浏览器导出的密码 CSV（name,url,username,password[,note]），
+// 本项目导出的通用 CSV 多一列 folder
+func parseChromeCSV(data []byte) (Result, error) {
+	header, rows, err := readCSV(data)
+	if err != nil {
+		return Result{}, err
+	}
+	if !header.has("url") || !header.has("password") {
+		return Result{}, ErrInvalidFile
+	}
+
+	var result Result
+	for _, row := range rows {
+		result.add(Item{
+			Label:    header.get(row, "name"),
+			Username: header.get(row, "username"),
+			Password: header.get(row, "password"),
+			Website:  header.get(row, "url"),
+			Notes:    header.get(row, "note", "notes"),
+			Folder:   header.get(row, "folder"),
+		})
+	}
+	return result, nil
+}
+
+// parseFirefoxCSV 解析 Firefox 导出的登录信息 CSV，没有名称列，用网址的主机名作为名称
+func parseFirefoxCSV(data []byte) (Result, error) {
+	header, rows, err := readCSV(data)
+	if err != nil {
+		return Result{}, err
+	}
+	if !header.has("url") || !header.has("password") {
+		return Result{}, ErrInvalidFile
+	}
+
+	var result Result
+	for _, row := range rows {
+		result.add(Item{
+			Username: header.get(row, "username"),
+			Password: header.get(row, "password"),
+			Website:  header.get(row, "url"),
+		})
+	}
+	return result, nil
+}
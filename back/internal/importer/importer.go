@@ -0,0 +1,231 @@
+// Package importer 解析其他密码管理器和浏览器导出的文件，统一转换成凭证条目。
+// 只负责解析，不做去重和写入；文件夹、分组等统一放在 Item.Folder 中，由调用方映射为分组。
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Format 导出文件的格式
+type Format string
+
+const (
+	FormatBitwardenJSON Format = "bitwarden-json"
+	FormatBitwardenCSV  Format = "bitwarden-csv"
+	Format1PasswordPUX  Format = "1password-1pux"
+	Format1PasswordCSV  Format = "1password-csv"
+	FormatKeePassXML    Format = "keepass-xml"
+	FormatChromeCSV     Format = "chrome-csv"
+	FormatFirefoxCSV    Format = "firefox-csv"
+)
+
+// Formats 支持的全部格式
+var Formats = []Format{
+	FormatBitwardenJSON, FormatBitwardenCSV,
+	Format1PasswordPUX, Format1PasswordCSV,
+	FormatKeePassXML,
+	FormatChromeCSV, FormatFirefoxCSV,
+}
+
+var (
+	// ErrUnknownFormat 无法识别文件格式，或指定了不支持的格式
+	ErrUnknownFormat = errors.New("unknown import format")
+	// ErrEncrypted 导出文件本身是加密的（如 Bitwarden 的加密 JSON），需要重新导出为明文
+	ErrEncrypted = errors.New("encrypted export is not supported")
+	// ErrInvalidFile 文件内容与格式不符
+	ErrInvalidFile = errors.New("invalid import file")
+)
+
+// Item 一条待导入的凭证，字段均为明文
+type Item struct {
+	Label    string `json:"label"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Website  string `json:"website"`
+	Notes    string `json:"notes"`
+	Folder   string `json:"folder"` // 原来所在的文件夹或分组，多级时用 / 连接
+}
+
+// Result 解析结果。Skipped 为无法转换成凭证的条目数（如银行卡、身份信息、空条目）
+type Result struct {
+	Format  Format `json:"format"`
+	Items   []Item `json:"items"`
+	Skipped int    `json:"skipped"`
+}
+
+// add 补全名称后加入结果，没有任何可保存内容的条目计入 Skipped
+func (r *Result) add(item Item) {
+	item.Label = strings.TrimSpace(item.Label)
+	item.Username = strings.TrimSpace(item.Username)
+	item.Website = strings.TrimSpace(item.Website)
+	item.Notes = strings.TrimSpace(item.Notes)
+	item.Folder = strings.Trim(strings.TrimSpace(item.Folder), "/")
+	if item.Username == "" && strings.TrimSpace(item.Password) == "" && item.Notes == "" && item.Website == "" {
+		r.Skipped++
+		return
+	}
+	if item.Label == "" {
+		item.Label = hostOf(item.Website)
+	}
+	if item.Label == "" {
+		item.Label = item.Username
+	}
+	r.Items = append(r.Items, item)
+}
+
+// ParseFormat 校验请求中的格式名，空字符串表示自动识别
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "auto" {
+		return "", nil
+	}
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", ErrUnknownFormat
+}
+
+// Parse 按指定格式解析文件，format 为空时先用 Detect 识别
+func Parse(format Format, data []byte) (Result, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "" {
+		format = Detect(data)
+	}
+	var (
+		result Result
+		err    error
+	)
+	switch format {
+	case FormatBitwardenJSON:
+		result, err = parseBitwardenJSON(data)
+	case FormatBitwardenCSV:
+		result, err = parseBitwardenCSV(data)
+	case Format1PasswordPUX:
+		result, err = parse1PUX(data)
+	case Format1PasswordCSV:
+		result, err = parse1PasswordCSV(data)
+	case FormatKeePassXML:
+		result, err = parseKeePassXML(data)
+	case FormatChromeCSV:
+		result, err = parseChromeCSV(data)
+	case FormatFirefoxCSV:
+		result, err = parseFirefoxCSV(data)
+	default:
+		return Result{}, ErrUnknownFormat
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	result.Format = format
+	return result, nil
+}
+
+// Detect 根据文件内容识别格式，识别不出时返回空字符串
+func Detect(data []byte) Format {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return Format1PasswordPUX
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return FormatKeePassXML
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatBitwardenJSON
+	}
+
+	header, _, err := readCSV(data)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case header.has("login_password"):
+		return FormatBitwardenCSV
+	case header.has("httprealm") || header.has("formactionorigin"):
+		return FormatFirefoxCSV
+	case header.has("title") && header.has("password"):
+		return Format1PasswordCSV
+	case header.has("name") && header.has("url") && header.has("password"):
+		return FormatChromeCSV
+	}
+	return ""
+}
+
+// csvHeader 小写的列名到列序号
+type csvHeader map[string]int
+
+func (h csvHeader) has(name string) bool {
+	_, ok := h[name]
+	return ok
+}
+
+// get 按候选列名取第一个存在的列
+func (h csvHeader) get(row []string, names ...string) string {
+	for _, name := range names {
+		if i, ok := h[name]; ok && i < len(row) {
+			return row[i]
+		}
+	}
+	return ""
+}
+
+// readCSV 读取带表头的 CSV，容忍引号不规范和每行列数不一致
+func readCSV(data []byte) (csvHeader, [][]string, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, nil, ErrInvalidFile
+	}
+	header := csvHeader{}
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := header[name]; !ok {
+			header[name] = i
+		}
+	}
+	return header, records[1:], nil
+}
+
+// hostOf 取网址的主机名作为缺省名称
+func hostOf(website string) string {
+	website = strings.TrimSpace(website)
+	if website == "" {
+		return ""
+	}
+	if !strings.Contains(website, "://") {
+		website = "https://" + website
+	}
+	u, err := url.Parse(website)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// joinNotes 把附加字段以 “名称: 值” 追加到备注后面，值为空的跳过
+func joinNotes(notes string, extras ...[2]string) string {
+	lines := []string{}
+	if s := strings.TrimSpace(notes); s != "" {
+		lines = append(lines, s)
+	}
+	for _, kv := range extras {
+		value := strings.TrimSpace(kv[1])
+		if value == "" {
+			continue
+		}
+		if kv[0] == "" {
+			lines = append(lines, value)
+		} else {
+			lines = append(lines, kv[0]+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, format Format, data string) Result {
+	t.Helper()
+	result, err := Parse(format, []byte(data))
+	if err != nil {
+		t.Fatalf("解析 %s 失败: %v", format, err)
+	}
+	return result
+}
+
+func TestParseBitwardenJSON(t *testing.T) {
+	data := `{
+	  "encrypted": false,
+	  "folders": [{"id": "f1", "name": "工作"}],
+	  "items": [
+	    {"type": 1, "name": "GitHub", "notes": "主账号", "folderId": "f1",
+	     "login": {"username": "me", "password": "hunter2", "totp": "otpauth://totp/x", "uris": [{"uri": "https://github.com"}]},
+	     "fields": [{"name": "PIN", "value": "1234", "type": 1}]},
+	    {"type": 2, "name": "Wi-Fi", "notes": "密码 12345678", "folderId": null, "login": null},
+	    {"type": 3, "name": "Visa", "card": {"number": "4111"}}
+	  ]
+	}`
+	result := parse(t, "", data)
+	if result.Format != FormatBitwardenJSON || len(result.Items) != 2 || result.Skipped != 1 {
+		t.Fatalf("解析结果不正确: %+v", result)
+	}
+	got := result.Items[0]
+	if got.Label != "GitHub" || got.Username != "me" || got.Password != "hunter2" || got.Website != "https://github.com" || got.Folder != "工作" {
+		t.Fatalf("登录条目不正确: %+v", got)
+	}
+	if got.Notes != "主账号\nTOTP: otpauth://totp/x\nPIN: 1234" {
+		t.Fatalf("附加字段应并入备注: %q", got.Notes)
+	}
+	if result.Items[1].Folder != "" || result.Items[1].Notes != "密码 12345678" {
+		t.Fatalf("安全笔记不正确: %+v", result.Items[1])
+	}
+
+	if _, err := Parse(FormatBitwardenJSON, []byte(`{"encrypted": true, "items": []}`)); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("加密导出应返回 ErrEncrypted，实际 %v", err)
+	}
+}
+
+func TestParseCSVFormats(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		format Format
+		want   Item
+	}{
+		{
+			name:   "bitwarden",
+			data:   "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n社交,,login,Twitter,,\"PIN: 1\",0,https://x.com,me,pw,\n",
+			format: FormatBitwardenCSV,
+			want:   Item{Label: "Twitter", Username: "me", Password: "pw", Website: "https://x.com", Notes: "PIN: 1", Folder: "社交"},
+		},
+		{
+			name:   "1password",
+			data:   "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\nGitHub,https://github.com,me,pw,,false,false,\"开发,工作\",备注\n",
+			format: Format1PasswordCSV,
+			want:   Item{Label: "GitHub", Username: "me", Password: "pw", Website: "https://github.com", Notes: "备注", Folder: "开发"},
+		},
+		{
+			name:   "chrome",
+			data:   "\xef\xbb\xbfname,url,username,password,note\nexample.com,https://example.com/login,me,pw,\n",
+			format: FormatChromeCSV,
+			want:   Item{Label: "example.com", Username: "me", Password: "pw", Website: "https://example.com/login"},
+		},
+		{
+			name:   "firefox",
+			data:   "\"url\",\"username\",\"password\",\"httpRealm\",\"formActionOrigin\",\"guid\",\"timeCreated\",\"timeLastUsed\",\"timePasswordChanged\"\n\"https://www.mozilla.org\",\"me\",\"pw\",,\"https://www.mozilla.org\",\"{1}\",\"1\",\"1\",\"1\"\n",
+			format: FormatFirefoxCSV,
+			want:   Item{Label: "mozilla.org", Username: "me", Password: "pw", Website: "https://www.mozilla.org"},
+		},
+	}
+	for _, c := range cases {
+		if got := Detect([]byte(c.data)); got != c.format {
+			t.Fatalf("%s: 识别为 %q", c.name, got)
+		}
+		result := parse(t, c.format, c.data)
+		if len(result.Items) != 1 || result.Items[0] != c.want {
+			t.Fatalf("%s: 解析结果不正确: %+v", c.name, result.Items)
+		}
+	}
+
+	if Detect([]byte("a,b,c\n1,2,3\n")) != "" {
+		t.Fatal("无法识别的 CSV 应返回空格式")
+	}
+	if _, err := Parse("", []byte("a,b,c\n1,2,3\n")); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("无法识别时应返回 ErrUnknownFormat，实际 %v", err)
+	}
+}
+
+func TestParseKeePassXML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+  <Meta><RecycleBinUUID>BIN</RecycleBinUUID></Meta>
+  <Root>
+    <Group>
+      <UUID>ROOT</UUID><Name>Database</Name>
+      <Entry>
+        <String><Key>Title</Key><Value>Router</Value></String>
+        <String><Key>UserName</Key><Value>admin</Value></String>
+        <String><Key>Password</Key><Value ProtectInMemory="True">secret</Value></String>
+      </Entry>
+      <Group>
+        <UUID>G1</UUID><Name>Internet</Name>
+        <Group>
+          <UUID>G2</UUID><Name>Email</Name>
+          <Entry>
+            <String><Key>Title</Key><Value>Gmail</Value></String>
+            <String><Key>UserName</Key><Value>me@gmail.com</Value></String>
+            <String><Key>Password</Key><Value>new</Value></String>
+            <String><Key>URL</Key><Value>https://mail.google.com</Value></String>
+            <String><Key>Recovery</Key><Value>code-1</Value></String>
+            <History>
+              <Entry><String><Key>Password</Key><Value>old</Value></String></Entry>
+            </History>
+          </Entry>
+        </Group>
+      </Group>
+      <Group>
+        <UUID>BIN</UUID><Name>Recycle Bin</Name>
+        <Entry><String><Key>Title</Key><Value>Deleted</Value></String><String><Key>Password</Key><Value>x</Value></String></Entry>
+      </Group>
+    </Group>
+  </Root>
+</KeePassFile>`
+	result := parse(t, "", data)
+	if result.Format != FormatKeePassXML || len(result.Items) != 2 {
+		t.Fatalf("解析结果不正确: %+v", result)
+	}
+	if got := result.Items[0]; got.Label != "Router" || got.Password != "secret" || got.Folder != "" {
+		t.Fatalf("顶层分组的条目不应带分组: %+v", got)
+	}
+	got := result.Items[1]
+	if got.Folder != "Internet/Email" || got.Password != "new" || got.Notes != "Recovery: code-1" {
+		t.Fatalf("嵌套分组的条目不正确: %+v", got)
+	}
+}
+
+func TestParse1PUX(t *testing.T) {
+	data := `{"accounts": [{"vaults": [
+	  {"attrs": {"name": "Private"}, "items": [
+	    {"state": "active", "categoryUuid": "001",
+	     "overview": {"title": "GitHub", "url": "https://github.com", "tags": ["开发"]},
+	     "details": {"loginFields": [{"designation": "username", "value": "me"}, {"designation": "password", "value": "pw"}],
+	                 "notesPlain": "备注", "sections": [{"fields": [{"title": "one-time password", "value": {"totp": "otpauth://totp/x"}}]}]}},
+	    {"state": "archived", "overview": {"title": "Old"}, "details": {"password": "x"}}
+	  ]},
+	  {"attrs": {"name": "Shared"}, "items": [
+	    {"state": "active", "categoryUuid": "005", "overview": {"title": "Wi-Fi"}, "details": {"password": "12345678"}}
+	  ]}
+	]}]}`
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("export.data")
+	w.Write([]byte(data))
+	zw.Close()
+
+	result, err := Parse("", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != Format1PasswordPUX || len(result.Items) != 2 || result.Skipped != 1 {
+		t.Fatalf("解析结果不正确: %+v", result)
+	}
+	got := result.Items[0]
+	if got.Username != "me" || got.Password != "pw" || got.Folder != "开发" || !strings.Contains(got.Notes, "one-time password: otpauth://totp/x") {
+		t.Fatalf("登录条目不正确: %+v", got)
+	}
+	if result.Items[1].Folder != "Shared" || result.Items[1].Password != "12345678" {
+		t.Fatalf("没有标签时应按保险库分组: %+v", result.Items[1])
+	}
+}
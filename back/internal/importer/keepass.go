@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type keePassFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    struct {
+		RecycleBinUUID string `xml:"RecycleBinUUID"`
+	} `xml:"Meta"`
+	Root struct {
+		Groups []keePassGroup `xml:"Group"`
+	} `xml:"Root"`
+}
+
+type keePassGroup struct {
+	UUID    string         `xml:"UUID"`
+	Name    string         `xml:"Name"`
+	Entries []keePassEntry `xml:"Entry"`
+	Groups  []keePassGroup `xml:"Group"`
+}
+
+// keePassEntry 只读取当前值，History 中的旧版本不导入
+type keePassEntry struct {
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"String"`
+}
+
+// parseKeePassXML 解析 KeePass 2.x 导出的 XML。顶层分组是数据库本身，其下的分组按路径作为分组，回收站不导入
+func parseKeePassXML(data []byte) (Result, error) {
+	var file keePassFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return Result{}, ErrInvalidFile
+	}
+
+	var result Result
+	var walk func(group keePassGroup, path string)
+	walk = func(group keePassGroup, path string) {
+		if file.Meta.RecycleBinUUID != "" && group.UUID == file.Meta.RecycleBinUUID {
+			return
+		}
+		for _, entry := range group.Entries {
+			result.add(entry.toItem(path))
+		}
+		for _, child := range group.Groups {
+			childPath := strings.TrimSpace(child.Name)
+			if path != "" {
+				childPath = path + "/" + childPath
+			}
+			walk(child, childPath)
+		}
+	}
+	for _, root := range file.Root.Groups {
+		walk(root, "")
+	}
+	return result, nil
+}
+
+func (e keePassEntry) toItem(folder string) Item {
+	item := Item{Folder: folder}
+	var extras [][2]string
+	for _, s := range e.Strings {
+		switch s.Key {
+		case "Title":
+			item.Label = s.Value
+		case "UserName":
+			item.Username = s.Value
+		case "Password":
+			item.Password = s.Value
+		case "URL":
+			item.Website = s.Value
+		case "Notes":
+			item.Notes = s.Value
+		default:
+			// 自定义字段并入备注
+			extras = append(extras, [2]string{s.Key, s.Value})
+		}
+	}
+	item.Notes = joinNotes(item.Notes, extras...)
+	return item
+}
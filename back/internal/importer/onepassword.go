@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// max1PUXDataSize export.data 解压后的大小上限，附件在单独的文件中，不会读取
+const max1PUXDataSize = 64 << 20
+
+type onePUXExport struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePUXItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePUXItem struct {
+	State    string `json:"state"`
+	Overview struct {
+		Title string   `json:"title"`
+		URL   string   `json:"url"`
+		Tags  []string `json:"tags"`
+	} `json:"overview"`
+	Details struct {
+		LoginFields []struct {
+			Designation string `json:"designation"`
+			Value       string `json:"value"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Fields []struct {
+				Title string                     `json:"title"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+}
+
+// parse1PUX 解析 1Password 8 的 .1pux 导出（zip 包中的 export.data）。
+// 标签作为分组；没有标签且导出了多个保险库时用保险库名称。已归档的条目不导入
+func parse1PUX(data []byte) (Result, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Result{}, ErrInvalidFile
+	}
+	var raw []byte
+	for _, f := range zr.File {
+		if f.Name != "export.data" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return Result{}, ErrInvalidFile
+		}
+		raw, err = io.ReadAll(io.LimitReader(rc, max1PUXDataSize+1))
+		rc.Close()
+		if err != nil || len(raw) > max1PUXDataSize {
+			return Result{}, ErrInvalidFile
+		}
+	}
+	var export onePUXExport
+	if raw == nil || json.Unmarshal(raw, &export) != nil {
+		return Result{}, ErrInvalidFile
+	}
+
+	vaults := 0
+	for _, account := range export.Accounts {
+		vaults += len(account.Vaults)
+	}
+	var result Result
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, it := range vault.Items {
+				if it.State == "archived" {
+					result.Skipped++
+					continue
+				}
+				item := it.toItem()
+				if item.Folder == "" && vaults > 1 {
+					item.Folder = vault.Attrs.Name
+				}
+				result.add(item)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (it onePUXItem) toItem() Item {
+	item := Item{Label: it.Overview.Title, Website: it.Overview.URL, Password: it.Details.Password}
+	if len(it.Overview.Tags) > 0 {
+		item.Folder = it.Overview.Tags[0]
+	}
+	for _, field := range it.Details.LoginFields {
+		switch field.Designation {
+		case "username":
+			item.Username = field.Value
+		case "password":
+			item.Password = field.Value
+		}
+	}
+	// 分区中的字段（一次性密码、API 密钥、服务器地址等）并入备注，值是以类型为键的单个字符串
+	var extras [][2]string
+	for _, section := range it.Details.Sections {
+		for _, field := range section.Fields {
+			for _, raw := range field.Value {
+				var value string
+				if json.Unmarshal(raw, &value) == nil {
+					extras = append(extras, [2]string{field.Title, value})
+				}
+			}
+		}
+	}
+	item.Notes = joinNotes(it.Details.NotesPlain, extras...)
+	return item
+}
+
+// parse1PasswordCSV 解析 1Password 的 CSV 导出，列名在各版本间略有不同；Tags 列取第一个标签作为分组
+func parse1PasswordCSV(data []byte) (Result, error) {
+	header, rows, err := readCSV(data)
+	if err != nil {
+		return Result{}, err
+	}
+	if !header.has("title") || !header.has("password") {
+		return Result{}, ErrInvalidFile
+	}
+
+	var result Result
+	for _, row := range rows {
+		if strings.EqualFold(strings.TrimSpace(header.get(row, "archived")), "true") {
+			result.Skipped++
+			continue
+		}
+		folder, _, _ := strings.Cut(header.get(row, "tags"), ",")
+		result.add(Item{
+			Label:    header.get(row, "title"),
+			Username: header.get(row, "username"),
+			Password: header.get(row, "password"),
+			Website:  firstLine(header.get(row, "url", "website")),
+			Notes:    joinNotes(header.get(row, "notes", "notesplain"), [2]string{"OTP", header.get(row, "otpauth")}),
+			Folder:   folder,
+		})
+	}
+	return result, nil
+}
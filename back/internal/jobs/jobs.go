@@ -6,30 +6,117 @@ import (
 	"strings"
 	"time"
 
-	"subvault/internal/database"
+	"subvault/internal/idempotency"
+	"subvault/internal/keyring"
+	"subvault/internal/lockout"
 	"subvault/internal/models"
+	"subvault/internal/passkey"
 	"subvault/internal/renewal"
+	"subvault/internal/rotation"
+	"subvault/internal/session"
+	"subvault/internal/sharing"
+	"subvault/internal/store"
 	"subvault/internal/webhook"
+
+	"gorm.io/gorm"
 )
 
-func Start() {
+// Start 启动后台任务，trashRetention 为回收站中记录的保留期
+func Start(db *gorm.DB, st *store.Store, keys *keyring.Keyring, trashRetention time.Duration) {
 	go func() {
-		runOnce()
+		runOnce(db, st, trashRetention)
+		upgradeCiphertexts(db, keys)
 		ticker := time.NewTicker(time.Hour)
 		defer ticker.Stop()
 		for range ticker.C {
-			runOnce()
+			runOnce(db, st, trashRetention)
 		}
 	}()
 }
 
-func runOnce() {
-	if err := renewal.RotateAllOverdue(database.DB); err != nil {
+func runOnce(db *gorm.DB, st *store.Store, trashRetention time.Duration) {
+	if err := renewal.RotateAllOverdue(st.Subscriptions); err != nil {
 		log.Printf("自动轮转订阅失败: %v", err)
 	}
-	if err := SendDueReminders(); err != nil {
+	if err := SendDueReminders(db, st); err != nil {
 		log.Printf("发送续费提醒失败: %v", err)
 	}
+	if err := session.PurgeExpired(db); err != nil {
+		log.Printf("清理过期会话失败: %v", err)
+	}
+	if err := passkey.PurgeExpired(db); err != nil {
+		log.Printf("清理过期通行密钥挑战失败: %v", err)
+	}
+	if err := lockout.PurgeStale(db); err != nil {
+		log.Printf("清理解锁失败记录失败: %v", err)
+	}
+	if err := idempotency.PurgeExpired(db); err != nil {
+		log.Printf("清理过期幂等键失败: %v", err)
+	}
+	if err := PurgeTrash(st, time.Now().Add(-trashRetention)); err != nil {
+		log.Printf("清理回收站失败: %v", err)
+	}
+	// 早于回收站保留期的同步游标会被拒绝，之前的移除记录不再需要
+	if err := sharing.PurgeRemovalsBefore(db, time.Now().Add(-trashRetention)); err != nil {
+		log.Printf("清理同步移除记录失败: %v", err)
+	}
+}
+
+// PurgeTrash 彻底删除所有保险库中在 cutoff 之前移入回收站的记录
+func PurgeTrash(st *store.Store, cutoff time.Time) error {
+	purges := []struct {
+		name  string
+		purge func(time.Time) (int64, error)
+	}{
+		{"订阅", st.Subscriptions.PurgeDeletedBefore},
+		{"凭证", st.Credentials.PurgeDeletedBefore},
+		{"备忘录", st.Memos.PurgeDeletedBefore},
+		{"分组", st.Tags.PurgeDeletedBefore},
+	}
+	for _, p := range purges {
+		n, err := p.purge(cutoff)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("回收站中 %d 条%s已超过保留期，已彻底删除", n, p.name)
+		}
+	}
+	return nil
+}
+
+// upgradeBatchSize 后台升级密文时每个事务改写的行数
+const upgradeBatchSize = 200
+
+// upgradeCiphertexts 把所有保险库中旧格式的密文分批改写为 v2 格式，启动时执行一次
+func upgradeCiphertexts(db *gorm.DB, keys *keyring.Keyring) {
+	var vaultIDs []string
+	if err := db.Model(&models.Vault{}).Pluck("id", &vaultIDs).Error; err != nil {
+		log.Printf("升级密文格式失败: %v", err)
+		return
+	}
+	for _, vaultID := range vaultIDs {
+		dek, err := keys.DataKey(db, vaultID)
+		if err != nil {
+			log.Printf("升级密文格式失败，保险库 %s 的数据密钥不可用: %v", vaultID, err)
+			continue
+		}
+		total := 0
+		for {
+			n, err := rotation.UpgradeVault(db, vaultID, dek, upgradeBatchSize)
+			if err != nil {
+				log.Printf("升级保险库 %s 的密文格式失败: %v", vaultID, err)
+				break
+			}
+			total += n
+			if n < upgradeBatchSize {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("保险库 %s 已升级 %d 行旧格式密文", vaultID, total)
+		}
+	}
 }
 
 func parseDays(list string, fallback []int) map[int]struct{} {
@@ -49,9 +136,9 @@ func parseDays(list string, fallback []int) map[int]struct{} {
 	return out
 }
 
-func SendDueReminders() error {
-	var settings []models.NotificationSetting
-	if err := database.DB.Where("webhook_enabled = ? AND webhook_url <> ?", true, "").Find(&settings).Error; err != nil {
+func SendDueReminders(db *gorm.DB, st *store.Store) error {
+	settings, err := st.Settings.ListWebhookEnabled()
+	if err != nil {
 		return err
 	}
 
@@ -60,8 +147,8 @@ func SendDueReminders() error {
 
 	for _, setting := range settings {
 		globalDays := parseDays(setting.WebhookDaysBefore, []int{1, 2, 3})
-		var subscriptions []models.Subscription
-		if err := database.DB.Where("vault_id = ?", setting.VaultID).Find(&subscriptions).Error; err != nil {
+		subscriptions, err := st.Subscriptions.ListReadable(setting.VaultID)
+		if err != nil {
 			return err
 		}
 
@@ -77,19 +164,19 @@ func SendDueReminders() error {
 			if sub.FrequencyUnit != "PERMANENT" {
 				daysLeft, ok := renewal.DaysUntil(sub.RenewalDate, today)
 				if ok {
-					maybeSend(setting, sub, daysLeft, days, todayStr, "renewal")
+					maybeSend(db, setting, sub, daysLeft, days, todayStr, "renewal")
 				}
 			}
 			if sub.TrialEndsOn != "" {
 				daysLeft, ok := renewal.DaysUntil(sub.TrialEndsOn, today)
 				if ok {
-					maybeSend(setting, sub, daysLeft, days, todayStr, "trial")
+					maybeSend(db, setting, sub, daysLeft, days, todayStr, "trial")
 				}
 			}
 			if sub.PromoEndsOn != "" {
 				daysLeft, ok := renewal.DaysUntil(sub.PromoEndsOn, today)
 				if ok {
-					maybeSend(setting, sub, daysLeft, days, todayStr, "promo")
+					maybeSend(db, setting, sub, daysLeft, days, todayStr, "promo")
 				}
 			}
 		}
@@ -97,12 +184,12 @@ func SendDueReminders() error {
 	return nil
 }
 
-func maybeSend(setting models.NotificationSetting, sub models.Subscription, daysLeft int, wanted map[int]struct{}, todayStr, kind string) {
+func maybeSend(db *gorm.DB, setting models.NotificationSetting, sub models.Subscription, daysLeft int, wanted map[int]struct{}, todayStr, kind string) {
 	if _, ok := wanted[daysLeft]; !ok {
 		return
 	}
 	var existing models.WebhookDelivery
-	err := database.DB.Where(
+	err := db.Where(
 		"vault_id = ? AND subscription_id = ? AND days_left = ? AND sent_date = ? AND kind = ?",
 		setting.VaultID, sub.ID, daysLeft, todayStr, kind,
 	).First(&existing).Error
@@ -128,7 +215,7 @@ func maybeSend(setting models.NotificationSetting, sub models.Subscription, days
 		SentDate:       todayStr,
 		Kind:           kind,
 	}
-	if createErr := database.DB.Create(&delivery).Error; createErr != nil {
+	if createErr := db.Create(&delivery).Error; createErr != nil {
 		log.Printf("记录提醒发送失败: %v", createErr)
 	}
 }
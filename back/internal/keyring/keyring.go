@@ -0,0 +1,130 @@
+package keyring
+
+import (
+	"sync"
+
+	"subvault/internal/config"
+	"subvault/internal/crypto"
+	"subvault/internal/database"
+	"subvault/internal/models"
+	"subvault/internal/rotation"
+
+	"gorm.io/gorm"
+)
+
+// Keyring 信封加密：每个保险库一个随机数据密钥（DEK），
+// DEK 由主密钥（ENCRYPTION_KEY，即 KEK）包裹后存放在 Vault.DataKey，字段加密时直接作为 AES 密钥。
+// 轮换主密钥只需重新包裹 DEK；单个 DEK 泄露只影响对应保险库。
+//
+// 主密钥和每个 DEK 的 Cipher 都只构造一次并缓存，处理器之间共享。
+type Keyring struct {
+	current  string
+	previous []string
+	params   crypto.KDFParams
+
+	mu    sync.Mutex                // 只保护下面几个字段，不在派生密钥或访问数据库期间持有
+	kek   *rotation.KEK             // 首次使用时读取本安装盐值后构造
+	keys  map[string]*crypto.Cipher // vaultID -> DEK 的 Cipher
+	locks map[string]*sync.Mutex    // vaultID -> 加载该库 DEK 时持有，同一保险库只加载一次，不同保险库互不阻塞
+}
+
+func New(cfg *config.Config) *Keyring {
+	params := cfg.KDF
+	if params.Algorithm == "" {
+		params = crypto.DefaultKDFParams
+	}
+	return &Keyring{
+		current:  cfg.EncryptionKey,
+		previous: cfg.PreviousEncryptionKeys,
+		params:   params,
+		keys:     make(map[string]*crypto.Cipher),
+		locks:    make(map[string]*sync.Mutex),
+	}
+}
+
+// DataKey 返回保险库数据密钥的 Cipher。
+// 尚未启用数据密钥的旧保险库在首次访问时生成 DEK，并把已有密文从主密钥迁移过去；
+// 派生参数与配置不一致（旧版 PBKDF2 或调整过 Argon2id 参数）的保险库在首次访问时用新参数重新包裹 DEK，
+// 旧版按参数从 DEK 派生密钥加密的保险库同时改写为直接用 DEK 加密。
+func (k *Keyring) DataKey(db *gorm.DB, vaultID string) (*crypto.Cipher, error) {
+	k.mu.Lock()
+	if dek, ok := k.keys[vaultID]; ok {
+		k.mu.Unlock()
+		return dek, nil
+	}
+	lock, ok := k.locks[vaultID]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.locks[vaultID] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	// 等锁期间可能已由另一个请求加载完成
+	k.mu.Lock()
+	dek, ok := k.keys[vaultID]
+	k.mu.Unlock()
+	if ok {
+		return dek, nil
+	}
+
+	kek, err := k.loadKEK(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var vault models.Vault
+		if err := tx.Where("id = ?", vaultID).First(&vault).Error; err != nil {
+			return err
+		}
+		var err error
+		switch {
+		case vault.DataKey == "":
+			dek, _, err = rotation.MigrateVault(tx, &vault, kek, k.params)
+		case vault.KDF != k.params.String() || !vault.RawDataKey:
+			dek, _, err = rotation.UpgradeKDF(tx, &vault, kek, k.params)
+		default:
+			var plain string
+			if plain, err = kek.Cipher(k.params).Decrypt(vault.DataKey, rotation.DataKeyAAD(vault.ID)); err != nil {
+				return err
+			}
+			dek, err = crypto.NewDataKeyCipher(plain)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.keys[vaultID] = dek
+	delete(k.locks, vaultID)
+	k.mu.Unlock()
+	return dek, nil
+}
+
+// loadKEK 首次使用时读取本安装盐值并构造主密钥；主密钥的 Argon2 派生在 KEK.Cipher 中按参数只做一次。
+// 读盐值访问数据库，在 k.mu 之外进行，并发的首次调用可能各读一次，只保留先发布的那个
+func (k *Keyring) loadKEK(db *gorm.DB) (*rotation.KEK, error) {
+	k.mu.Lock()
+	kek := k.kek
+	k.mu.Unlock()
+	if kek != nil {
+		return kek, nil
+	}
+
+	salt, err := database.InstallSalt(db)
+	if err != nil {
+		return nil, err
+	}
+	kek = rotation.NewKEK(salt, k.current, k.previous...)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.kek == nil {
+		k.kek = kek
+	}
+	return k.kek, nil
+}
@@ -0,0 +1,210 @@
+package keyring
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"subvault/internal/config"
+	"subvault/internal/crypto"
+	"subvault/internal/database"
+	"subvault/internal/models"
+	"subvault/internal/rotation"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testParams 测试用的低开销 Argon2id 参数
+var testParams = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 1, MemoryKiB: 1024, Threads: 1}
+
+func TestDataKeyMigratesLegacyVault(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Vault{}, &models.Credential{}, &models.CredentialHistory{}, &models.Memo{}, &models.TotpSetting{}, &models.AIConfig{}, &models.IdempotencyKey{}, &models.Installation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const oldKEK, kek = "old-master-key", "master-key"
+	vault := models.Vault{KeyHash: "legacy"}
+	db.Create(&vault)
+	// 旧格式密文：无版本前缀、无附加数据
+	sealed, _ := crypto.NewCipher(crypto.LegacyKDF, oldKEK).Encrypt("hunter2", crypto.AAD{})
+	legacy := strings.TrimPrefix(sealed, crypto.VersionV2+":")
+	cred := models.Credential{VaultID: vault.ID, Label: "GitHub", Username: "me", Password: legacy}
+	db.Create(&cred)
+
+	// 轮换期间旧主密钥放在 previous 里，旧数据仍可迁移
+	keys := New(&config.Config{EncryptionKey: kek, PreviousEncryptionKeys: []string{oldKEK}, KDF: testParams})
+	dek, err := keys.DataKey(db, vault.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt, err := database.InstallSalt(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kdf := crypto.KDF{Params: testParams, Salt: salt}
+	db.First(&vault, "id = ?", vault.ID)
+	if vault.KDF != testParams.String() || !vault.RawDataKey {
+		t.Fatalf("应记录派生参数，并直接用 DEK 加密: %q %v", vault.KDF, vault.RawDataKey)
+	}
+	plain, err := crypto.NewCipher(kdf, kek).Decrypt(vault.DataKey, rotation.DataKeyAAD(vault.ID))
+	if err != nil {
+		t.Fatal("数据密钥应由当前主密钥包裹后保存")
+	}
+	db.First(&cred, "id = ?", cred.ID)
+	raw, err := crypto.NewDataKeyCipher(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := raw.Decrypt(cred.Password, crypto.AAD{Table: "credentials", RowID: cred.ID, Field: "password"}); err != nil || got != "hunter2" {
+		t.Fatalf("旧密文应迁移到数据密钥: %q %v", got, err)
+	}
+
+	if got, err := dek.Decrypt(cred.Password, crypto.AAD{Table: "credentials", RowID: cred.ID, Field: "password"}); err != nil || got != "hunter2" {
+		t.Fatalf("返回的 Cipher 应能解密迁移后的密文: %q %v", got, err)
+	}
+
+	again, err := New(&config.Config{EncryptionKey: kek, KDF: testParams}).DataKey(db, vault.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := again.Decrypt(cred.Password, crypto.AAD{Table: "credentials", RowID: cred.ID, Field: "password"}); err != nil || got != "hunter2" {
+		t.Fatal("重新加载应得到同一个数据密钥")
+	}
+	if cached, _ := keys.DataKey(db, vault.ID); cached != dek {
+		t.Fatal("同一保险库应复用缓存的 Cipher")
+	}
+
+	// 调整 Argon2id 参数后，下次加载时按新参数重新包裹 DEK，密文直接用 DEK 加密，不需要改写
+	tuned := testParams
+	tuned.Time = 2
+	before := cred.Password
+	upgraded, err := New(&config.Config{EncryptionKey: kek, KDF: tuned}).DataKey(db, vault.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.First(&vault, "id = ?", vault.ID)
+	db.First(&cred, "id = ?", cred.ID)
+	if vault.KDF != tuned.String() || cred.Password != before {
+		t.Fatalf("应迁移到新的派生参数且不改写密文: %q", vault.KDF)
+	}
+	if got, err := upgraded.Decrypt(cred.Password, crypto.AAD{Table: "credentials", RowID: cred.ID, Field: "password"}); err != nil || got != "hunter2" {
+		t.Fatalf("调整参数后密文应仍可读: %q %v", got, err)
+	}
+}
+
+func TestDataKeyLoadsEachVaultOnce(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite 不支持并发写事务，单连接让数据库访问排队；并发只发生在 Keyring 内
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Vault{}, &models.Credential{}, &models.CredentialHistory{}, &models.Memo{}, &models.TotpSetting{}, &models.AIConfig{}, &models.IdempotencyKey{}, &models.Installation{}); err != nil {
+		t.Fatal(err)
+	}
+	vaults := []models.Vault{{KeyHash: "a"}, {KeyHash: "b"}}
+	for i := range vaults {
+		db.Create(&vaults[i])
+	}
+
+	// 同一保险库的并发请求只生成一次 DEK，拿到同一个 Cipher；不同保险库各自加载
+	keys := New(&config.Config{EncryptionKey: "master-key", KDF: testParams})
+	results := make([]*crypto.Cipher, 8)
+	errs := make([]error, len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = keys.DataKey(db, vaults[i%2].ID)
+		}(i)
+	}
+	wg.Wait()
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if results[i] != results[i%2] {
+			t.Fatal("同一保险库应只加载一次并共享 Cipher")
+		}
+	}
+	if results[0] == results[1] {
+		t.Fatal("不同保险库应有各自的数据密钥")
+	}
+	for i, vault := range vaults {
+		var stored models.Vault
+		db.First(&stored, "id = ?", vault.ID)
+		plain, err := keys.kek.Cipher(testParams).Decrypt(stored.DataKey, rotation.DataKeyAAD(vault.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved, err := crypto.NewDataKeyCipher(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, _ := results[i].Encrypt("hunter2", crypto.AAD{})
+		if got, err := saved.Decrypt(sealed, crypto.AAD{}); err != nil || got != "hunter2" {
+			t.Fatal("保存的数据密钥应与返回的 Cipher 一致")
+		}
+	}
+}
+
+func TestCachedDataKeyNotBlockedByKEKLoad(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Vault{}, &models.Installation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := New(&config.Config{EncryptionKey: "master-key", KDF: testParams})
+	cached, err := crypto.NewDataKeyCipher(strings.Repeat("ab", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.keys["cached-vault"] = cached
+
+	// 占住唯一的连接，读取盐值会一直等待
+	tx := db.Begin()
+	loading := make(chan error, 1)
+	go func() {
+		_, err := keys.DataKey(db, "other-vault")
+		loading <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 主密钥还在等数据库时，已缓存的数据密钥应立即返回
+	done := make(chan *crypto.Cipher, 1)
+	go func() {
+		dek, _ := keys.DataKey(db, "cached-vault")
+		done <- dek
+	}()
+	select {
+	case dek := <-done:
+		if dek != cached {
+			t.Fatal("应返回已缓存的数据密钥")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("读取盐值期间不应阻塞其他保险库")
+	}
+	tx.Rollback()
+	<-loading
+}
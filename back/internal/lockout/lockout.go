@@ -0,0 +1,118 @@
+// Package lockout 持久化记录解锁失败次数，连续失败达到阈值后按指数退避锁定。
+package lockout
+
+import (
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Policy 锁定策略：Threshold 次失败后锁定 Base，之后每次锁定时长翻倍，最长 Max
+type Policy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+var (
+	// AccountPolicy 针对单个保险库在单个来源 IP 上的失败：5 次失败锁 1 分钟，随后 2、4、8 分钟……最长 24 小时。
+	// 按来源 IP 区分，别人猜错主密钥不会把保险库的主人锁在外面
+	AccountPolicy = Policy{Threshold: 5, Base: time.Minute, Max: 24 * time.Hour}
+	// IPPolicy 针对单个来源 IP，阈值更高以容忍同一出口下的多个用户，防止对多个用户名轮流猜测
+	IPPolicy = Policy{Threshold: 20, Base: 5 * time.Minute, Max: 24 * time.Hour}
+)
+
+// ResetAfter 超过这段时间没有新的失败，失败次数和锁定级别清零
+const ResetAfter = 24 * time.Hour
+
+// VaultKey 保险库在来源 IP 上的计数键
+func VaultKey(vaultID, ip string) string { return "vault:" + vaultID + "|ip:" + ip }
+
+// UsernameKey 不存在的用户名在来源 IP 上的计数键，与存在的用户表现一致，避免借锁定探测用户名
+func UsernameKey(username, ip string) string {
+	return "user:" + accounts.NormalizeUsername(username) + "|ip:" + ip
+}
+
+// IPKey 来源 IP 的计数键
+func IPKey(ip string) string { return "ip:" + ip }
+
+// Locked 返回给定键中最长的剩余锁定时间，未锁定时为 0
+func Locked(db *gorm.DB, keys ...string) (time.Duration, error) {
+	var rows []models.LoginFailure
+	if err := db.Where("subject IN ? AND locked_until > ?", keys, time.Now()).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+	var longest time.Duration
+	for _, row := range rows {
+		if remaining := time.Until(*row.LockedUntil); remaining > longest {
+			longest = remaining
+		}
+	}
+	return longest, nil
+}
+
+// RecordFailure 记一次失败；达到阈值时开始锁定并返回锁定时长，否则返回 0。
+// 计数用一条 upsert 在数据库里自增，并发的失败不会互相覆盖，首次插入也不会撞上唯一索引
+func RecordFailure(db *gorm.DB, key string, policy Policy) (time.Duration, error) {
+	var lockedFor time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// 超过 ResetAfter 没有失败时从 1 重新计数，锁定级别清零
+		stale := "login_failures.last_failure_at < ?"
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "subject"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":        gorm.Expr("CASE WHEN "+stale+" THEN 1 ELSE login_failures.failures + 1 END", now.Add(-ResetAfter)),
+				"lockouts":        gorm.Expr("CASE WHEN "+stale+" THEN 0 ELSE login_failures.lockouts END", now.Add(-ResetAfter)),
+				"last_failure_at": now,
+				"updated_at":      now,
+			}),
+		}).Create(&models.LoginFailure{Subject: key, Failures: 1, LastFailureAt: now}).Error
+		if err != nil {
+			return err
+		}
+
+		// upsert 已持有这一行的写锁，读取和锁定在同一事务内不会与其他失败交错
+		var row models.LoginFailure
+		if err := tx.Where("subject = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+		if row.Failures < policy.Threshold {
+			return nil
+		}
+		lockedFor = policy.duration(row.Lockouts)
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"failures":     0,
+			"lockouts":     row.Lockouts + 1,
+			"locked_until": now.Add(lockedFor),
+		}).Error
+	})
+	return lockedFor, err
+}
+
+// Reset 解锁成功后清除保险库在该 IP 上的失败记录（IP 本身的记录不清除，避免攻击者用自己的账户重置计数）
+func Reset(db *gorm.DB, key string) error {
+	return db.Where("subject = ?", key).Delete(&models.LoginFailure{}).Error
+}
+
+// PurgeStale 清理长时间没有失败且已解除锁定的记录
+func PurgeStale(db *gorm.DB) error {
+	now := time.Now()
+	return db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-ResetAfter), now).
+		Delete(&models.LoginFailure{}).Error
+}
+
+func (p Policy) duration(lockouts int) time.Duration {
+	d := p.Base
+	for i := 0; i < lockouts && d < p.Max; i++ {
+		d *= 2
+	}
+	if d > p.Max {
+		d = p.Max
+	}
+	return d
+}
@@ -0,0 +1,157 @@
+package lockout
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.LoginFailure{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLockoutEscalates(t *testing.T) {
+	db := openTestDB(t)
+	policy := Policy{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute}
+	key := VaultKey("vault-1", "192.0.2.1")
+
+	var lockedFor time.Duration
+	for i := 0; i < 3; i++ {
+		d, err := RecordFailure(db, key, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 && d != 0 {
+			t.Fatalf("第 %d 次失败不应锁定", i+1)
+		}
+		lockedFor = d
+	}
+	if lockedFor != time.Minute {
+		t.Fatalf("首次锁定应为 1 分钟，实际 %v", lockedFor)
+	}
+	if remaining, _ := Locked(db, key, IPKey("203.0.113.1")); remaining <= 0 || remaining > time.Minute {
+		t.Fatalf("应处于锁定期: %v", remaining)
+	}
+
+	// 之后每次锁定时长翻倍，不超过上限
+	want := []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+	for _, w := range want {
+		for i := 0; i < 3; i++ {
+			lockedFor, _ = RecordFailure(db, key, policy)
+		}
+		if lockedFor != w {
+			t.Fatalf("锁定时长应为 %v，实际 %v", w, lockedFor)
+		}
+	}
+
+	if err := Reset(db, key); err != nil {
+		t.Fatal(err)
+	}
+	if remaining, _ := Locked(db, key); remaining != 0 {
+		t.Fatal("重置后应解除锁定")
+	}
+}
+
+func TestLockoutResetsAfterQuietPeriod(t *testing.T) {
+	db := openTestDB(t)
+	policy := Policy{Threshold: 2, Base: time.Minute, Max: time.Hour}
+	key := IPKey("203.0.113.1")
+
+	RecordFailure(db, key, policy)
+	RecordFailure(db, key, policy)
+	db.Model(&models.LoginFailure{}).Where("subject = ?", key).Updates(map[string]interface{}{
+		"last_failure_at": time.Now().Add(-ResetAfter - time.Minute),
+		"locked_until":    time.Now().Add(-time.Minute),
+	})
+
+	// 长时间没有失败后重新计数，锁定级别也清零
+	if d, _ := RecordFailure(db, key, policy); d != 0 {
+		t.Fatal("计数应已清零")
+	}
+	if d, _ := RecordFailure(db, key, policy); d != time.Minute {
+		t.Fatalf("锁定级别应已清零，实际 %v", d)
+	}
+
+	other := UsernameKey("Nobody", "192.0.2.1")
+	RecordFailure(db, other, policy)
+	db.Model(&models.LoginFailure{}).Where("subject = ?", other).Update("last_failure_at", time.Now().Add(-ResetAfter-time.Minute))
+	if err := PurgeStale(db); err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	db.Model(&models.LoginFailure{}).Pluck("subject", &subjects)
+	if len(subjects) != 1 || subjects[0] != key {
+		t.Fatalf("只应清理过期且未锁定的记录: %v", subjects)
+	}
+}
+
+func TestRecordFailureConcurrent(t *testing.T) {
+	// 用文件数据库让多个连接真正并发写入，busy_timeout 让写锁排队而不是直接失败
+	dsn := filepath.Join(t.TempDir(), "lockout.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.LoginFailure{}); err != nil {
+		t.Fatal(err)
+	}
+	// 每次查询后稍作停顿，让各个事务互相穿插，CPU 核数少时也能暴露读-改-写的竞争
+	db.Callback().Query().After("gorm:query").Register("test:interleave", func(*gorm.DB) {
+		time.Sleep(time.Millisecond)
+	})
+	policy := Policy{Threshold: 5, Base: time.Minute, Max: time.Hour}
+	key := VaultKey("vault-1", "192.0.2.1")
+
+	const attempts = 22
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var lockouts int
+	errs := make(chan error, attempts)
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			d, err := RecordFailure(db, key, policy)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if d > 0 {
+				mu.Lock()
+				lockouts++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("并发记录失败不应出错: %v", err)
+	}
+
+	// 每一次失败都应计入：22 次失败触发 4 次锁定，余下 2 次
+	var row models.LoginFailure
+	if err := db.Where("subject = ?", key).First(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if lockouts != 4 || row.Lockouts != 4 || row.Failures != 2 {
+		t.Fatalf("并发失败有丢失: 锁定 %d 次，记录 %+v", lockouts, row)
+	}
+}
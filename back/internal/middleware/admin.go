@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"subvault/internal/accounts"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminMiddleware 只允许管理员访问，需放在 AuthMiddleware 之后
+func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !accounts.IsAdmin(db, c.GetString("vaultId")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
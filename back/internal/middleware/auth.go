@@ -4,18 +4,22 @@ import (
 	"net/http"
 	"strings"
 
+	"subvault/internal/apitoken"
 	"subvault/internal/config"
+	"subvault/internal/session"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type Claims struct {
-	VaultID string `json:"vaultId"`
+	VaultID   string `json:"vaultId"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+func AuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -33,11 +37,18 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+
+		// 个人访问令牌：按权限和接口白名单放行
+		if strings.HasPrefix(tokenString, apitoken.Prefix) {
+			authenticateAPIToken(c, db, tokenString)
+			return
+		}
+
 		claims := &Claims{}
 
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			return []byte(cfg.JWTSecret), nil
-		})
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效或过期的令牌"})
@@ -45,8 +56,78 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// 已登出或被吊销的会话，即使令牌未过期也拒绝
+		if !session.IsActive(db, claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新解锁"})
+			c.Abort()
+			return
+		}
+
+		session.Touch(db, claims.SessionID, c.ClientIP())
+
 		// 将 VaultID 存入上下文
 		c.Set("vaultId", claims.VaultID)
+		c.Set("sessionId", claims.SessionID)
 		c.Next()
 	}
 }
+
+func authenticateAPIToken(c *gin.Context, db *gorm.DB, plain string) {
+	token, err := apitoken.Authenticate(db, plain)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效、过期或已吊销的 API 令牌"})
+		c.Abort()
+		return
+	}
+
+	scopes := apitoken.ScopeList(token)
+	if !apiTokenAllowed(scopes, c.Request.Method, c.FullPath()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API 令牌无权访问此接口"})
+		c.Abort()
+		return
+	}
+
+	apitoken.Touch(db, token.ID, c.ClientIP())
+
+	c.Set("vaultId", token.VaultID)
+	c.Set("apiTokenId", token.ID)
+	c.Next()
+}
+
+// apiTokenRoutes API 令牌可访问的接口及所需资源权限；不在表中的接口（会话、两步验证、令牌管理、AI 等）一律拒绝。
+// GET 需要 read 权限，其余方法需要 write 权限；/vault 和 /vault/changes 返回全部类型的数据，需要三类资源的 read 权限。
+var apiTokenRoutes = []struct {
+	prefix    string
+	resources []string
+}{
+	{"/api/v1/subscriptions", []string{apitoken.ResourceSubscriptions}},
+	{"/api/v1/credentials", []string{apitoken.ResourceCredentials}},
+	{"/api/v1/memos", []string{apitoken.ResourceMemos}},
+	{"/api/v1/tags", []string{apitoken.ResourceTags}},
+	{"/api/v1/vault", []string{apitoken.ResourceSubscriptions, apitoken.ResourceCredentials, apitoken.ResourceMemos}},
+	{"/api/v1/analytics", []string{apitoken.ResourceAnalytics}},
+	{"/api/v1/insights", []string{apitoken.ResourceAnalytics}},
+	{"/api/v1/notifications/upcoming", []string{apitoken.ResourceAnalytics}},
+}
+
+func apiTokenAllowed(scopes []string, method, path string) bool {
+	if path == "/api/v1/verify" {
+		return true
+	}
+	action := apitoken.ActionWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		action = apitoken.ActionRead
+	}
+	for _, route := range apiTokenRoutes {
+		if path != route.prefix && !strings.HasPrefix(path, route.prefix+"/") {
+			continue
+		}
+		for _, resource := range route.resources {
+			if !apitoken.Allows(scopes, resource, action) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
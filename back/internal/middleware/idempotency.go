@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"subvault/internal/idempotency"
+	"subvault/internal/keyring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKeyHeader 客户端为每个逻辑请求生成的唯一键，重试时原样带上
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// responseRecorder 在写给客户端的同时保存响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent 让带 Idempotency-Key 请求头的写请求可以安全重试：第一次的响应保存 24 小时，
+// 之后同一保险库、同一个键的相同请求直接返回保存的响应并带上 Idempotent-Replayed 头。
+// 同一个键用于不同请求返回 422，上一次还在处理中返回 409；服务端出错（5xx）不保存，允许重试。
+// 响应用保险库的数据密钥加密后保存。没有该请求头时不做处理。需放在 AuthMiddleware 之后
+func Idempotent(db *gorm.DB, keys *keyring.Keyring) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key 过长"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		vaultID := c.GetString("vaultId")
+		dek, err := keys.DataKey(db, vaultID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "加载保险库密钥失败"})
+			return
+		}
+
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.Request.URL.Path, body)
+		row, err := idempotency.Begin(db, vaultID, key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key 已用于其他请求"})
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "相同的请求正在处理中，请稍后重试"})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "处理请求失败"})
+			return
+		}
+		if row.StatusCode != 0 {
+			response, err := idempotency.Response(dek, row)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "读取保存的响应失败"})
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(row.StatusCode, "application/json; charset=utf-8", response)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			err = idempotency.Abandon(db, row.ID)
+		} else {
+			err = idempotency.Complete(db, dek, row.ID, status, recorder.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("保存幂等键 %s 的响应失败: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIToken 个人访问令牌，供脚本和自动化调用 API
+// 明文令牌只在创建时返回一次，库里只保存 SHA-256 哈希；Scopes 为逗号分隔的权限列表
+type APIToken struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	VaultID    string     `json:"vaultId" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix"` // 明文令牌开头几位，便于在列表中辨认
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // 为空表示永不过期
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new token
+func (t *APIToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	return nil
+}
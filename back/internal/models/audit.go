@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrAuditAppendOnly 审计日志只能追加，不能修改或删除。
+// 模型钩子在应用层提前拒绝，数据库中另有触发器（迁移 0010）拒绝直接执行的 UPDATE/DELETE
+var ErrAuditAppendOnly = errors.New("audit log is append-only")
+
+// AuditEvent 安全审计日志：解锁、两步验证变更、凭证读取等。
+// VaultID 为日志归属的保险库；ActorVaultID 为执行操作的保险库，读取共享凭证时两者不同。
+type AuditEvent struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	VaultID      string    `json:"vaultId" gorm:"index:idx_audit_vault_time,priority:1;not null"`
+	ActorVaultID string    `json:"actorVaultId"`
+	Action       string    `json:"action" gorm:"index;not null"`
+	Outcome      string    `json:"outcome" gorm:"not null"` // success, failure, locked
+	TargetID     string    `json:"targetId"`
+	Detail       string    `json:"detail"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"userAgent"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"index:idx_audit_vault_time,priority:2"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return nil
+}
+
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 共享集合中的角色；集合的创建者始终为 owner，不单独存成员记录
+const (
+	CollectionRoleOwner  = "owner"
+	CollectionRoleEditor = "editor"
+	CollectionRoleViewer = "viewer"
+)
+
+// Collection 共享集合，例如家庭共用的流媒体、水电订阅
+// 订阅、凭证、备忘录通过 CollectionID 放入集合，数据仍属于创建者的保险库、用其数据密钥加密
+type Collection struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	OwnerVaultID string    `json:"ownerVaultId" gorm:"index;not null"`
+	Name         string    `json:"name" gorm:"not null"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new collection
+func (c *Collection) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// CollectionMember 集合成员，Role 为 viewer（只读）或 editor（可编辑）
+type CollectionMember struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	CollectionID string    `json:"collectionId" gorm:"uniqueIndex:idx_collection_member;not null"`
+	VaultID      string    `json:"vaultId" gorm:"uniqueIndex:idx_collection_member;index;not null"`
+	Role         string    `json:"role" gorm:"not null;default:viewer"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new member
+func (m *CollectionMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// SyncRemoval 记录从某个保险库的视野中消失：移出共享集合、保险库被移出集合、集合被删除，或记录被彻底删除。
+// 这些情况在回收站中不留记录，增量同步据此通知客户端移除。Kind 为记录所在的表名，与回收站接口的类型一致
+type SyncRemoval struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	VaultID   string    `json:"vaultId" gorm:"index;not null"`
+	Kind      string    `json:"kind" gorm:"not null"`
+	RecordID  string    `json:"recordId" gorm:"not null"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new removal
+func (r *SyncRemoval) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey 带 Idempotency-Key 请求头的写请求及其响应，同一保险库内同一个键的重试直接返回保存的响应。
+// StatusCode 为 0 表示请求还在处理中
+type IdempotencyKey struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	VaultID     string    `json:"vaultId" gorm:"uniqueIndex:idx_idempotency_key;not null"`
+	Key         string    `json:"key" gorm:"uniqueIndex:idx_idempotency_key;not null"`
+	Fingerprint string    `json:"-" gorm:"not null"` // 方法、路径和请求体的 SHA-256，同一个键只能用于同一个请求
+	StatusCode  int       `json:"statusCode"`
+	Response    string    `json:"-"` // 保险库数据密钥加密的响应体
+	CreatedAt   time.Time `json:"createdAt" gorm:"index"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Installation 安装级设置，整个数据库只有一行（ID = 1）
+type Installation struct {
+	ID                  uint   `gorm:"primaryKey"`
+	KDFSalt             string `gorm:"not null"`      // 十六进制随机盐值，首次启动时生成，之后不再变化
+	RegistrationEnabled bool   `gorm:"default:false"` // 是否允许新用户注册，由管理员开关
+	CreatedAt           time.Time
+}
+
+// SchemaVersion 已执行的数据库迁移，每个版本一行
+type SchemaVersion struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
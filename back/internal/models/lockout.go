@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginFailure 解锁失败计数，按保险库（或未知用户名）和来源 IP 各一条。
+// 达到阈值后锁定，每次锁定的时长翻倍；长时间没有失败后重新计数。
+type LoginFailure struct {
+	ID            string     `json:"id" gorm:"primaryKey"`
+	Subject       string     `json:"subject" gorm:"uniqueIndex;not null"` // vault:<id>、user:<用户名>、ip:<地址>
+	Failures      int        `json:"failures"`                            // 当前锁定周期内的连续失败次数
+	Lockouts      int        `json:"lockouts"`                            // 已触发的锁定次数，决定下一次锁定时长
+	LockedUntil   *time.Time `json:"lockedUntil"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (f *LoginFailure) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	return nil
+}
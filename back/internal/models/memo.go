@@ -10,14 +10,17 @@ import (
 // Memo 备忘录
 // Content 字段存储 AES-256-GCM 加密后的密文
 type Memo struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	VaultID   string    `json:"vaultId" gorm:"index;not null"`
-	Title     string    `json:"title" gorm:"not null"`
-	Content   string    `json:"content"`                       // 存储 AES-256-GCM 加密后的密文
-	Category  string    `json:"category" gorm:"default:其他"`
-	IsPinned  bool      `json:"isPinned" gorm:"default:false"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID           string         `json:"id" gorm:"primaryKey"`
+	VaultID      string         `json:"vaultId" gorm:"index;not null"`
+	Title        string         `json:"title" gorm:"not null"`
+	Content      string         `json:"content"` // 存储 AES-256-GCM 加密后的密文
+	Category     string         `json:"category" gorm:"default:其他"`
+	IsPinned     bool           `json:"isPinned" gorm:"default:false"`
+	CollectionID *string        `json:"collectionId,omitempty" gorm:"index"` // 所在共享集合，空表示个人数据
+	Version      int64          `json:"version" gorm:"not null;default:1"`   // 同 Credential.Version
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	DeletedAt    gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"` // 软删除，非空表示在回收站中
 }
 
 // BeforeCreate GORM hook to generate UUID before creating a new memo
@@ -25,5 +28,8 @@ func (m *Memo) BeforeCreate(tx *gorm.DB) error {
 	if m.ID == "" {
 		m.ID = uuid.New().String()
 	}
+	if m.Version < 1 {
+		m.Version = 1
+	}
 	return nil
 }
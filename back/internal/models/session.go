@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session 登录会话（每台解锁过的设备一条）
+// 访问令牌携带会话 ID，刷新令牌只保存 SHA-256 哈希
+type Session struct {
+	ID           string     `json:"id" gorm:"primaryKey"`
+	VaultID      string     `json:"vaultId" gorm:"index;not null"`
+	RefreshHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	PreviousHash string     `json:"-" gorm:"index"` // 上一次轮转前的刷新令牌，用于发现重放
+	UserAgent    string     `json:"userAgent"`
+	IP           string     `json:"ip"`
+	LastSeenAt   time.Time  `json:"lastSeenAt"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new session
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
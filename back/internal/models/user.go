@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// User 用户账户，每个用户对应一个保险库
+// 主密钥的 bcrypt 哈希保存在所属保险库的 Vault.KeyBcrypt
+type User struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"uniqueIndex;not null"`
+	VaultID   string    `json:"vaultId" gorm:"uniqueIndex;not null"`
+	IsAdmin   bool      `json:"isAdmin" gorm:"default:false"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BeforeCreate GORM hook to generate UUID before creating a new user
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	return nil
+}
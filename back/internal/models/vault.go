@@ -10,73 +10,108 @@ import (
 
 // Vault 保险库
 type Vault struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	KeyHash   string    `json:"-" gorm:"uniqueIndex;not null"`
-	KeyBcrypt string    `json:"-"` // bcrypt hash for password verification
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID         string    `json:"id" gorm:"primaryKey"`
+	KeyHash    string    `json:"-" gorm:"uniqueIndex;not null"`
+	KeyBcrypt  string    `json:"-"`                               // bcrypt hash for password verification
+	DataKey    string    `json:"-"`                               // 由 ENCRYPTION_KEY 包裹的数据密钥（DEK），本库所有密文用它加密
+	KDF        string    `json:"-" gorm:"column:kdf"`             // 包裹 DEK 的主密钥派生参数（crypto.KDFParams），空表示旧版 PBKDF2
+	RawDataKey bool      `json:"-" gorm:"not null;default:false"` // 密文直接用 DEK 作为 AES 密钥；false 为旧版按 KDF 从 DEK 派生，首次访问时改写
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
 func (v *Vault) BeforeCreate(tx *gorm.DB) error {
-	v.ID = uuid.New().String()
+	if v.ID == "" {
+		v.ID = uuid.New().String()
+	}
 	return nil
 }
 
 // Credential 凭证
 // Password 字段存储加密后的密文
 type Credential struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	VaultID   string    `json:"vaultId" gorm:"index;not null"`
-	Username  string    `json:"username" gorm:"not null"`
-	Password  string    `json:"password,omitempty"` // 存储 AES-256-GCM 加密后的密文
-	Label     string    `json:"label" gorm:"not null"`
-	Notes     string    `json:"notes,omitempty"` // 存储 AES-256-GCM 加密后的密文
-	Website   string    `json:"website,omitempty"`
-	Category  string    `json:"category" gorm:"default:其他"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID           string         `json:"id" gorm:"primaryKey"`
+	VaultID      string         `json:"vaultId" gorm:"index;not null"`
+	Username     string         `json:"username" gorm:"not null"`
+	Password     string         `json:"password,omitempty"` // 存储 AES-256-GCM 加密后的密文
+	Label        string         `json:"label" gorm:"not null"`
+	Notes        string         `json:"notes,omitempty"` // 存储 AES-256-GCM 加密后的密文
+	Website      string         `json:"website,omitempty"`
+	Category     string         `json:"category" gorm:"default:其他"`
+	CollectionID *string        `json:"collectionId,omitempty" gorm:"index"` // 所在共享集合，空表示个人数据
+	Version      int64          `json:"version" gorm:"not null;default:1"`   // 每次修改加一，更新时用 If-Match 带上，检测并发修改
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	DeletedAt    gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"` // 软删除，非空表示在回收站中
 }
 
 func (c *Credential) BeforeCreate(tx *gorm.DB) error {
 	if c.ID == "" {
 		c.ID = uuid.New().String()
 	}
+	if c.Version < 1 {
+		c.Version = 1
+	}
+	return nil
+}
+
+// CredentialHistory 凭证被修改前的密码和备注，CreatedAt 为被替换的时间。
+// 与凭证一样用所属保险库的数据密钥加密，附加数据绑定到历史记录自己的 ID
+type CredentialHistory struct {
+	ID           string    `json:"id" gorm:"primaryKey"`
+	VaultID      string    `json:"vaultId" gorm:"index;not null"`
+	CredentialID string    `json:"credentialId" gorm:"index;not null"`
+	Password     string    `json:"password,omitempty"` // 存储 AES-256-GCM 加密后的密文
+	Notes        string    `json:"notes,omitempty"`    // 存储 AES-256-GCM 加密后的密文
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (h *CredentialHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.New().String()
+	}
 	return nil
 }
 
 // Subscription 订阅
 type Subscription struct {
-	ID              string    `json:"id" gorm:"primaryKey"`
-	VaultID         string    `json:"vaultId" gorm:"index;not null"`
-	Name            string    `json:"name" gorm:"not null"`
-	Cost            float64   `json:"cost" gorm:"not null"`
-	Currency        string    `json:"currency" gorm:"default:CNY"`
-	FrequencyAmount int       `json:"frequencyAmount" gorm:"default:1"`
-	FrequencyUnit   string    `json:"frequencyUnit" gorm:"default:MONTHS"`
-	RenewalDate     string    `json:"renewalDate"`
-	StartDate       string    `json:"startDate"`
-	Category        string    `json:"category" gorm:"default:生活"`
-	CredentialID    *string   `json:"credentialId,omitempty"`
-	Website         string    `json:"website,omitempty"`
-	Active          bool      `json:"active" gorm:"default:true"`
-	AutoRotate      bool      `json:"autoRotate" gorm:"default:false"`
-	Status          string    `json:"status" gorm:"default:active"` // active, trial, paused, canceled
-	PaymentMethod   string    `json:"paymentMethod"`
-	CardLast4       string    `json:"cardLast4"`
-	CancelURL       string    `json:"cancelUrl"`
-	TrialEndsOn     string    `json:"trialEndsOn"`
-	PromoEndsOn     string    `json:"promoEndsOn"`
-	ReminderDays    string    `json:"reminderDays"` // 覆盖全局 Webhook 天数，空则用全局
-	Notes           string    `json:"notes"`
-	CreatedAt       time.Time `json:"createdAt"`
-	UpdatedAt       time.Time `json:"updatedAt"`
-	Tags            []Tag     `json:"tags,omitempty" gorm:"many2many:subscription_tags;"`
+	ID              string         `json:"id" gorm:"primaryKey"`
+	VaultID         string         `json:"vaultId" gorm:"index;not null"`
+	Name            string         `json:"name" gorm:"not null"`
+	Cost            float64        `json:"cost" gorm:"not null"`
+	Currency        string         `json:"currency" gorm:"default:CNY"`
+	FrequencyAmount int            `json:"frequencyAmount" gorm:"default:1"`
+	FrequencyUnit   string         `json:"frequencyUnit" gorm:"default:MONTHS"`
+	RenewalDate     string         `json:"renewalDate"`
+	StartDate       string         `json:"startDate"`
+	Category        string         `json:"category" gorm:"default:生活"`
+	CredentialID    *string        `json:"credentialId,omitempty"`
+	Website         string         `json:"website,omitempty"`
+	Active          bool           `json:"active" gorm:"default:true"`
+	AutoRotate      bool           `json:"autoRotate" gorm:"default:false"`
+	Status          string         `json:"status" gorm:"default:active"` // active, trial, paused, canceled
+	PaymentMethod   string         `json:"paymentMethod"`
+	CardLast4       string         `json:"cardLast4"`
+	CancelURL       string         `json:"cancelUrl"`
+	TrialEndsOn     string         `json:"trialEndsOn"`
+	PromoEndsOn     string         `json:"promoEndsOn"`
+	ReminderDays    string         `json:"reminderDays"` // 覆盖全局 Webhook 天数，空则用全局
+	Notes           string         `json:"notes"`
+	CollectionID    *string        `json:"collectionId,omitempty" gorm:"index"` // 所在共享集合，空表示个人数据
+	Version         int64          `json:"version" gorm:"not null;default:1"`   // 同 Credential.Version
+	CreatedAt       time.Time      `json:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+	DeletedAt       gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"` // 软删除，非空表示在回收站中
+	Tags            []Tag          `json:"tags,omitempty" gorm:"many2many:subscription_tags;"`
 }
 
 func (s *Subscription) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == "" {
 		s.ID = uuid.New().String()
 	}
+	if s.Version < 1 {
+		s.Version = 1
+	}
 	s.NormalizeStatus()
 	return nil
 }
@@ -114,11 +149,12 @@ func (s *Subscription) IsTracked() bool {
 
 // Tag 自定义标签
 type Tag struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	VaultID   string    `json:"vaultId" gorm:"index;not null"`
-	Name      string    `json:"name" gorm:"not null"`
-	Color     string    `json:"color" gorm:"default:#3B82F6"` // 标签颜色
-	CreatedAt time.Time `json:"createdAt"`
+	ID        string         `json:"id" gorm:"primaryKey"`
+	VaultID   string         `json:"vaultId" gorm:"index;not null"`
+	Name      string         `json:"name" gorm:"not null"`
+	Color     string         `json:"color" gorm:"default:#3B82F6"` // 标签颜色
+	CreatedAt time.Time      `json:"createdAt"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"` // 软删除，非空表示在回收站中
 }
 
 func (t *Tag) BeforeCreate(tx *gorm.DB) error {
@@ -130,19 +166,21 @@ func (t *Tag) BeforeCreate(tx *gorm.DB) error {
 
 // NotificationSetting 通知设置
 type NotificationSetting struct {
-	ID                string    `json:"id" gorm:"primaryKey"`
-	VaultID           string    `json:"vaultId" gorm:"uniqueIndex;not null"`
-	Enabled           bool      `json:"enabled" gorm:"default:true"`
-	DaysBeforeList    string    `json:"daysBeforeList" gorm:"default:1,3,7"` // 应用内即将到期窗口
-	WebhookEnabled    bool      `json:"webhookEnabled" gorm:"default:false"`
-	WebhookURL        string    `json:"webhookUrl"`
-	WebhookPlatform   string    `json:"webhookPlatform" gorm:"default:auto"` // auto, feishu, wecom, dingtalk, generic
-	WebhookDaysBefore string    `json:"webhookDaysBefore" gorm:"default:1,2,3"`
-	WebhookSecret     string    `json:"webhookSecret"`
-	CalendarToken     string    `json:"calendarToken"`
-	BaseCurrency      string    `json:"baseCurrency" gorm:"default:CNY"`
-	CreatedAt         time.Time `json:"createdAt"`
-	UpdatedAt         time.Time `json:"updatedAt"`
+	ID                string `json:"id" gorm:"primaryKey"`
+	VaultID           string `json:"vaultId" gorm:"uniqueIndex;not null"`
+	Enabled           bool   `json:"enabled" gorm:"default:true"`
+	DaysBeforeList    string `json:"daysBeforeList" gorm:"default:1,3,7"` // 应用内即将到期窗口
+	WebhookEnabled    bool   `json:"webhookEnabled" gorm:"default:false"`
+	WebhookURL        string `json:"webhookUrl"`
+	WebhookPlatform   string `json:"webhookPlatform" gorm:"default:auto"` // auto, feishu, wecom, dingtalk, generic
+	WebhookDaysBefore string `json:"webhookDaysBefore" gorm:"default:1,2,3"`
+	WebhookSecret     string `json:"webhookSecret"`
+	CalendarToken     string `json:"calendarToken"`
+	BaseCurrency      string `json:"baseCurrency" gorm:"default:CNY"`
+	// 每条凭证最多保留的历史版本数，0 表示使用默认值；与基础货币一样是保险库级别的偏好
+	PasswordHistoryLimit int       `json:"passwordHistoryLimit"`
+	CreatedAt            time.Time `json:"createdAt"`
+	UpdatedAt            time.Time `json:"updatedAt"`
 }
 
 type PriceHistory struct {
@@ -238,12 +276,55 @@ func (t *TotpSetting) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// WebAuthnCredential 通行密钥 / 安全密钥，可作为第二因素；
+// Passwordless 为 true 的凭证配合设备密钥（DeviceSecretHash）可免主密钥解锁
+type WebAuthnCredential struct {
+	ID               string     `json:"id" gorm:"primaryKey"`
+	VaultID          string     `json:"vaultId" gorm:"index;not null"`
+	Name             string     `json:"name" gorm:"not null"`
+	CredentialID     string     `json:"-" gorm:"uniqueIndex;not null"` // base64url
+	PublicKey        []byte     `json:"-" gorm:"not null"`             // COSE_Key 编码
+	SignCount        uint32     `json:"-"`
+	AAGUID           string     `json:"aaguid"`
+	Transports       string     `json:"-"` // 逗号分隔
+	Passwordless     bool       `json:"passwordless" gorm:"default:false"`
+	DeviceSecretHash string     `json:"-"` // 免密码解锁时设备还需出示的随机密钥（SHA-256）
+	LastUsedAt       *time.Time `json:"lastUsedAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+func (w *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// WebAuthnChallenge 注册或验证时下发的一次性挑战，五分钟内有效
+// 免密码解锁开始时还不知道是哪个保险库，VaultID 为空
+type WebAuthnChallenge struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	VaultID   string    `json:"vaultId" gorm:"index"`
+	Challenge string    `json:"challenge" gorm:"not null"`
+	Purpose   string    `json:"purpose" gorm:"not null"` // register, unlock, passwordless
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (w *WebAuthnChallenge) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	return nil
+}
+
 // VaultData 用于 API 响应
 type VaultData struct {
 	Credentials   []Credential   `json:"credentials"`
 	Subscriptions []Subscription `json:"subscriptions"`
 	Memos         []Memo         `json:"memos"`
 	LastUpdated   int64          `json:"lastUpdated"`
+	Cursor        string         `json:"cursor"` // 传给 /vault/changes 的增量同步游标
 }
 
 // AIConfig AI 配置（每个 Vault 独立配置）
@@ -0,0 +1,195 @@
+// Package passkey 保存 WebAuthn 凭证和一次性挑战；协议校验见 webauthn 包。
+package passkey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/webauthn"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrChallengeInvalid 挑战不存在、已使用、已过期或用途不符
+	ErrChallengeInvalid = errors.New("webauthn challenge invalid")
+	// ErrCredentialNotFound 凭证不存在
+	ErrCredentialNotFound = errors.New("webauthn credential not found")
+	// ErrDuplicateCredential 同一个认证器已注册过
+	ErrDuplicateCredential = errors.New("webauthn credential already registered")
+	// ErrInvalidName 凭证名称为空或过长
+	ErrInvalidName = errors.New("invalid webauthn credential name")
+)
+
+// 挑战用途，注册和不同的验证场景互不通用
+const (
+	PurposeRegister     = "register"
+	PurposeUnlock       = "unlock"       // 主密钥之后的第二因素
+	PurposePasswordless = "passwordless" // 免主密钥解锁
+)
+
+// ChallengeTTL 挑战有效期，与浏览器端超时一致
+const ChallengeTTL = webauthn.ChallengeTimeoutMillis * time.Millisecond
+
+const maxNameLength = 64
+
+// IssueChallenge 新建一次性挑战，返回挑战记录 ID 和挑战值
+func IssueChallenge(db *gorm.DB, vaultID, purpose string) (string, string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", "", err
+	}
+	row := models.WebAuthnChallenge{
+		VaultID:   vaultID,
+		Challenge: challenge,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ChallengeTTL),
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return "", "", err
+	}
+	return row.ID, challenge, nil
+}
+
+// ConsumeChallenge 取出并删除挑战，每个挑战只能用一次。
+// 免密码解锁的挑战不绑定保险库，vaultID 传空字符串。
+func ConsumeChallenge(db *gorm.DB, id, vaultID, purpose string) (string, error) {
+	if id == "" {
+		return "", ErrChallengeInvalid
+	}
+	var row models.WebAuthnChallenge
+	if err := db.Where("id = ? AND vault_id = ? AND purpose = ?", id, vaultID, purpose).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrChallengeInvalid
+		}
+		return "", err
+	}
+	// 并发请求只有一个能删除成功
+	result := db.Where("id = ?", row.ID).Delete(&models.WebAuthnChallenge{})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected != 1 || time.Now().After(row.ExpiresAt) {
+		return "", ErrChallengeInvalid
+	}
+	return row.Challenge, nil
+}
+
+// PurgeExpired 清理过期未使用的挑战
+func PurgeExpired(db *gorm.DB) error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnChallenge{}).Error
+}
+
+// List 返回保险库注册的全部凭证，最早注册的在前
+func List(db *gorm.DB, vaultID string) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := db.Where("vault_id = ?", vaultID).Order("created_at asc").Find(&creds).Error
+	return creds, err
+}
+
+// Descriptors 把凭证转为 allowCredentials / excludeCredentials 列表
+func Descriptors(creds []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	out := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		d := webauthn.CredentialDescriptor{Type: "public-key", ID: cred.CredentialID}
+		if cred.Transports != "" {
+			d.Transports = strings.Split(cred.Transports, ",")
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// Save 保存校验通过的新凭证。passwordless 为 true 时生成设备密钥，
+// 明文只在返回值中出现这一次，之后免密码解锁时必须一并出示。
+func Save(db *gorm.DB, vaultID, name string, cred webauthn.Credential, passwordless bool) (models.WebAuthnCredential, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxNameLength {
+		return models.WebAuthnCredential{}, "", ErrInvalidName
+	}
+	var count int64
+	if err := db.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", cred.ID).Count(&count).Error; err != nil {
+		return models.WebAuthnCredential{}, "", err
+	}
+	if count > 0 {
+		return models.WebAuthnCredential{}, "", ErrDuplicateCredential
+	}
+
+	row := models.WebAuthnCredential{
+		VaultID:      vaultID,
+		Name:         name,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		AAGUID:       hex.EncodeToString(cred.AAGUID),
+		Transports:   strings.Join(cred.Transports, ","),
+		Passwordless: passwordless,
+	}
+	var deviceSecret string
+	if passwordless {
+		secret, err := randomSecret()
+		if err != nil {
+			return models.WebAuthnCredential{}, "", err
+		}
+		deviceSecret = secret
+		row.DeviceSecretHash = hashSecret(secret)
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return models.WebAuthnCredential{}, "", err
+	}
+	return row, deviceSecret, nil
+}
+
+// FindByCredentialID 按认证器返回的凭证 ID 查找
+func FindByCredentialID(db *gorm.DB, credentialID string) (models.WebAuthnCredential, error) {
+	var cred models.WebAuthnCredential
+	if err := db.Where("credential_id = ?", strings.TrimRight(credentialID, "=")).First(&cred).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.WebAuthnCredential{}, ErrCredentialNotFound
+		}
+		return models.WebAuthnCredential{}, err
+	}
+	return cred, nil
+}
+
+// CheckDeviceSecret 校验免密码解锁时出示的设备密钥
+func CheckDeviceSecret(cred models.WebAuthnCredential, secret string) bool {
+	if !cred.Passwordless || cred.DeviceSecretHash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(cred.DeviceSecretHash)) == 1
+}
+
+// RecordUse 验证成功后保存新的签名计数和使用时间
+func RecordUse(db *gorm.DB, id string, signCount uint32) error {
+	return db.Model(&models.WebAuthnCredential{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": time.Now(),
+	}).Error
+}
+
+// DeleteForVault 删除指定保险库下的凭证，凭证不属于该保险库时返回 false
+func DeleteForVault(db *gorm.DB, vaultID, id string) (bool, error) {
+	result := db.Where("id = ? AND vault_id = ?", id, vaultID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
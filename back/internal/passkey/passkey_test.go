@@ -0,0 +1,103 @@
+package passkey
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/webauthn"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.WebAuthnCredential{}, &models.WebAuthnChallenge{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestChallengeSingleUse(t *testing.T) {
+	db := openTestDB(t)
+	id, challenge, err := IssueChallenge(db, "vault-1", PurposeUnlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConsumeChallenge(db, id, "vault-2", PurposeUnlock); !errors.Is(err, ErrChallengeInvalid) {
+		t.Fatalf("其他保险库不能使用该挑战: %v", err)
+	}
+	if _, err := ConsumeChallenge(db, id, "vault-1", PurposeRegister); !errors.Is(err, ErrChallengeInvalid) {
+		t.Fatalf("用途不符应拒绝: %v", err)
+	}
+	got, err := ConsumeChallenge(db, id, "vault-1", PurposeUnlock)
+	if err != nil || got != challenge {
+		t.Fatalf("应取回挑战: %v", err)
+	}
+	if _, err := ConsumeChallenge(db, id, "vault-1", PurposeUnlock); !errors.Is(err, ErrChallengeInvalid) {
+		t.Fatalf("挑战只能使用一次: %v", err)
+	}
+
+	expired, _, _ := IssueChallenge(db, "vault-1", PurposeUnlock)
+	db.Model(&models.WebAuthnChallenge{}).Where("id = ?", expired).Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := ConsumeChallenge(db, expired, "vault-1", PurposeUnlock); !errors.Is(err, ErrChallengeInvalid) {
+		t.Fatalf("过期挑战应拒绝: %v", err)
+	}
+	IssueChallenge(db, "vault-1", PurposeUnlock)
+	db.Model(&models.WebAuthnChallenge{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Second))
+	if err := PurgeExpired(db); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.WebAuthnChallenge{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("过期挑战应被清理，剩余 %d", count)
+	}
+}
+
+func TestSaveAndDeviceSecret(t *testing.T) {
+	db := openTestDB(t)
+	cred := webauthn.Credential{ID: "cred-1", PublicKey: []byte{1}, AAGUID: make([]byte, 16), Transports: []string{"usb", "nfc"}}
+
+	plain, secret, err := Save(db, "vault-1", "YubiKey", cred, false)
+	if err != nil || secret != "" || plain.Passwordless {
+		t.Fatalf("普通凭证不应生成设备密钥: %v %q", err, secret)
+	}
+	if _, _, err := Save(db, "vault-2", "again", cred, false); !errors.Is(err, ErrDuplicateCredential) {
+		t.Fatalf("同一认证器不能重复注册: %v", err)
+	}
+	if _, _, err := Save(db, "vault-1", "  ", webauthn.Credential{ID: "cred-2"}, false); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("名称不能为空: %v", err)
+	}
+
+	row, secret, err := Save(db, "vault-1", "Phone", webauthn.Credential{ID: "cred-3", PublicKey: []byte{1}}, true)
+	if err != nil || secret == "" {
+		t.Fatalf("免密码凭证应返回设备密钥: %v", err)
+	}
+	found, err := FindByCredentialID(db, "cred-3")
+	if err != nil || found.ID != row.ID {
+		t.Fatalf("应能按凭证 ID 查找: %v", err)
+	}
+	if found.DeviceSecretHash == secret || !CheckDeviceSecret(found, secret) || CheckDeviceSecret(found, secret+"x") {
+		t.Fatal("设备密钥只应以哈希保存并能校验")
+	}
+	if CheckDeviceSecret(plain, "") {
+		t.Fatal("普通凭证不能用于免密码解锁")
+	}
+
+	if ds := Descriptors([]models.WebAuthnCredential{plain}); len(ds) != 1 || len(ds[0].Transports) != 2 {
+		t.Fatalf("凭证描述不对: %+v", ds)
+	}
+	if ok, _ := DeleteForVault(db, "vault-2", row.ID); ok {
+		t.Fatal("不能删除其他保险库的凭证")
+	}
+	if ok, _ := DeleteForVault(db, "vault-1", row.ID); !ok {
+		t.Fatal("应能删除自己的凭证")
+	}
+}
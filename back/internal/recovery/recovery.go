@@ -12,14 +12,20 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	// DefaultCount 每次生成的恢复码数量
+	DefaultCount = 8
+	// LowThreshold 剩余未使用的恢复码不多于此数时提醒重新生成
+	LowThreshold = 2
+)
+
+// Generate 生成一组新的恢复码并作废旧的，整组替换在同一事务内完成
 func Generate(db *gorm.DB, vaultID string, n int) ([]string, error) {
 	if n < 1 {
-		n = 8
-	}
-	if err := db.Where("vault_id = ?", vaultID).Delete(&models.TotpRecoveryCode{}).Error; err != nil {
-		return nil, err
+		n = DefaultCount
 	}
 	plain := make([]string, 0, n)
+	hashes := make([]string, 0, n)
 	for i := 0; i < n; i++ {
 		code, err := randomCode()
 		if err != nil {
@@ -29,15 +35,33 @@ func Generate(db *gorm.DB, vaultID string, n int) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		row := models.TotpRecoveryCode{VaultID: vaultID, CodeHash: hash}
-		if err := db.Create(&row).Error; err != nil {
-			return nil, err
-		}
 		plain = append(plain, code)
+		hashes = append(hashes, hash)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("vault_id = ?", vaultID).Delete(&models.TotpRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := tx.Create(&models.TotpRecoveryCode{VaultID: vaultID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return plain, nil
 }
 
+// Remaining 返回未使用的恢复码数量
+func Remaining(db *gorm.DB, vaultID string) (int64, error) {
+	var count int64
+	err := db.Model(&models.TotpRecoveryCode{}).Where("vault_id = ? AND used_at IS NULL", vaultID).Count(&count).Error
+	return count, err
+}
+
 func Consume(db *gorm.DB, vaultID, code string) bool {
 	code = strings.ToUpper(strings.TrimSpace(code))
 	if code == "" {
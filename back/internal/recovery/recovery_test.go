@@ -35,4 +35,19 @@ func TestGenerateAndConsume(t *testing.T) {
 	if Consume(db, "vault-1", "NOPE-CODE") {
 		t.Fatal("错误恢复码应拒绝")
 	}
+	if n, err := Remaining(db, "vault-1"); err != nil || n != 7 {
+		t.Fatalf("应剩余 7 个恢复码: %d %v", n, err)
+	}
+
+	// 重新生成后旧码全部作废
+	fresh, err := Generate(db, "vault-1", 0)
+	if err != nil || len(fresh) != DefaultCount {
+		t.Fatalf("应生成 %d 个新恢复码: %d %v", DefaultCount, len(fresh), err)
+	}
+	if Consume(db, "vault-1", codes[1]) {
+		t.Fatal("重新生成后旧恢复码应失效")
+	}
+	if n, _ := Remaining(db, "vault-1"); n != int64(DefaultCount) {
+		t.Fatalf("重新生成后应剩余 %d 个: %d", DefaultCount, n)
+	}
 }
@@ -4,8 +4,7 @@ import (
 	"time"
 
 	"subvault/internal/models"
-
-	"gorm.io/gorm"
+	"subvault/internal/store"
 )
 
 func Location() *time.Location {
@@ -83,32 +82,25 @@ func RotateIfDue(sub *models.Subscription, today time.Time) bool {
 	return changed
 }
 
-func RotateAndSave(db *gorm.DB, subscriptions []models.Subscription, today time.Time) []models.Subscription {
+// RotateAndSave 把到期的订阅推进到下一周期并保存，同时记一笔续费。保存成功的订阅版本号随之加一，与数据库一致
+func RotateAndSave(subs store.SubscriptionRepository, subscriptions []models.Subscription, today time.Time) []models.Subscription {
 	for i := range subscriptions {
 		if !RotateIfDue(&subscriptions[i], today) {
 			continue
 		}
-		db.Model(&subscriptions[i]).Updates(map[string]interface{}{
-			"start_date":   subscriptions[i].StartDate,
-			"renewal_date": subscriptions[i].RenewalDate,
-		})
-		_ = db.Create(&models.RenewalEvent{
-			VaultID:        subscriptions[i].VaultID,
-			SubscriptionID: subscriptions[i].ID,
-			Amount:         subscriptions[i].Cost,
-			Currency:       subscriptions[i].Currency,
-			OccurredOn:     subscriptions[i].StartDate,
-			Source:         "rotate",
-		}).Error
+		if subs.RecordRotation(subscriptions[i]) == nil {
+			subscriptions[i].Version++
+		}
 	}
 	return subscriptions
 }
 
-func RotateAllOverdue(db *gorm.DB) error {
-	var subscriptions []models.Subscription
-	if err := db.Where("auto_rotate = ? AND active = ?", true, true).Find(&subscriptions).Error; err != nil {
+// RotateAllOverdue 轮转所有保险库中开启自动续期的订阅，由后台任务定时调用
+func RotateAllOverdue(subs store.SubscriptionRepository) error {
+	subscriptions, err := subs.ListAutoRotate()
+	if err != nil {
 		return err
 	}
-	RotateAndSave(db, subscriptions, Today())
+	RotateAndSave(subs, subscriptions, Today())
 	return nil
 }
@@ -0,0 +1,293 @@
+package rotation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"subvault/internal/crypto"
+	"subvault/internal/database"
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// EncryptedColumn 一张表里按保险库数据密钥加密的列
+type EncryptedColumn struct {
+	Table   string
+	Columns []string
+}
+
+// EncryptedColumns 所有加密存储的列，新增加密字段时需要登记在这里
+var EncryptedColumns = []EncryptedColumn{
+	{Table: "credentials", Columns: []string{"password", "notes"}},
+	{Table: "credential_histories", Columns: []string{"password", "notes"}},
+	{Table: "memos", Columns: []string{"content"}},
+	{Table: "totp_settings", Columns: []string{"secret"}},
+	{Table: "ai_configs", Columns: []string{"api_key"}},
+	{Table: "idempotency_keys", Columns: []string{"response"}},
+}
+
+// Report 轮换结果：vaults 为重新包裹的数据密钥数，其余为各表改写的行数
+type Report map[string]int
+
+// DataKeyAAD 包裹后的数据密钥绑定到所属保险库
+func DataKeyAAD(vaultID string) crypto.AAD {
+	return crypto.AAD{Table: "vaults", RowID: vaultID, Field: "data_key"}
+}
+
+// KEK 主密钥（ENCRYPTION_KEY）及轮换前的旧密钥。
+// 不同保险库可能记录着不同的派生参数，按参数分别构造 Cipher 并缓存，每组参数只派生一次。
+type KEK struct {
+	keys []string
+	salt []byte
+
+	mu      sync.Mutex
+	ciphers map[crypto.KDFParams]*crypto.Cipher
+}
+
+// NewKEK salt 为本安装的随机盐值，见 database.InstallSalt
+func NewKEK(salt []byte, current string, previous ...string) *KEK {
+	return &KEK{
+		keys:    append([]string{current}, previous...),
+		salt:    salt,
+		ciphers: make(map[crypto.KDFParams]*crypto.Cipher),
+	}
+}
+
+// KDF 按给定参数派生时使用的 KDF（带本安装盐值）
+func (k *KEK) KDF(params crypto.KDFParams) crypto.KDF {
+	return crypto.KDF{Params: params, Salt: k.salt}
+}
+
+// Cipher 返回按 params 派生的主密钥 Cipher，解密时依次回退到旧密钥
+func (k *KEK) Cipher(params crypto.KDFParams) *crypto.Cipher {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if c, ok := k.ciphers[params]; ok {
+		return c
+	}
+	c := crypto.NewCipher(k.KDF(params), k.keys[0], k.keys[1:]...)
+	k.ciphers[params] = c
+	return c
+}
+
+// Rotate 轮换主密钥（ENCRYPTION_KEY），全部在一个事务内完成：
+//   - 已有数据密钥的保险库只需用新主密钥重新包裹 DEK，密文本身不动；
+//   - 尚未启用数据密钥的旧保险库先生成 DEK，把该库密文从旧主密钥迁移到 DEK，派生参数取 params。
+//
+// 已经由新主密钥包裹的 DEK 保持不动，因此可以重复执行。
+// 任意一个值解不开都会回滚，不会留下新旧混杂的数据。
+func Rotate(db *gorm.DB, oldKeys []string, newKey string, params crypto.KDFParams) (Report, error) {
+	if newKey == "" {
+		return nil, errors.New("new key is required")
+	}
+	if len(oldKeys) == 0 {
+		return nil, errors.New("no old key provided")
+	}
+	salt, err := database.InstallSalt(db)
+	if err != nil {
+		return nil, err
+	}
+	// 解密时先试新密钥，再依次回退到旧密钥
+	kek := NewKEK(salt, newKey, oldKeys...)
+
+	report := Report{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var vaults []models.Vault
+		if err := tx.Find(&vaults).Error; err != nil {
+			return err
+		}
+		for i := range vaults {
+			vault := &vaults[i]
+			if vault.DataKey == "" {
+				_, migrated, err := MigrateVault(tx, vault, kek, params)
+				if err != nil {
+					return err
+				}
+				for table, n := range migrated {
+					report[table] += n
+				}
+				report["vaults"]++
+				continue
+			}
+			vaultParams, err := crypto.ParseKDFParams(vault.KDF)
+			if err != nil {
+				return fmt.Errorf("保险库 %s: %w", vault.ID, err)
+			}
+			aad := DataKeyAAD(vault.ID)
+			if _, err := kek.Cipher(vaultParams).Current().Decrypt(vault.DataKey, aad); err == nil && !crypto.IsLegacy(vault.DataKey) {
+				continue
+			}
+			dek, err := kek.Cipher(vaultParams).Decrypt(vault.DataKey, aad)
+			if err != nil {
+				return fmt.Errorf("保险库 %s 的数据密钥无法用旧密钥解开: %w", vault.ID, err)
+			}
+			if err := wrapDataKey(tx, vault, dek, kek, vaultParams); err != nil {
+				return err
+			}
+			report["vaults"]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// MigrateVault 为尚未启用数据密钥的保险库生成 DEK：
+// 用主密钥（旧版 PBKDF2 派生，含旧密钥回退）解密该库所有密文，再直接用新 DEK 重新加密，
+// DEK 由按 params 派生的主密钥包裹后写回保险库。
+// 需要在事务内调用，返回 DEK 的 Cipher 和各表迁移行数。
+func MigrateVault(tx *gorm.DB, vault *models.Vault, kek *KEK, params crypto.KDFParams) (*crypto.Cipher, Report, error) {
+	dek, err := crypto.GenerateDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	dekCipher, err := crypto.NewDataKeyCipher(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := reencryptVault(tx, vault.ID, kek.Cipher(crypto.LegacyKDFParams), dekCipher)
+	if err != nil {
+		return nil, nil, err
+	}
+	vault.RawDataKey = true
+	if err := wrapDataKey(tx, vault, dek, kek, params); err != nil {
+		return nil, nil, err
+	}
+	return dekCipher, report, nil
+}
+
+// UpgradeKDF 把保险库的派生参数换成 params（例如从旧版 PBKDF2 迁移到 Argon2id，或调整 Argon2id 参数）：
+// DEK 本身不变，用新参数派生的主密钥重新包裹。密文直接用 DEK 加密，与派生参数无关，不需要改写；
+// 旧版按参数从 DEK 派生 AES 密钥的保险库（RawDataKey 为 false）顺带把全部密文改写为直接用 DEK 加密。
+// 需要在事务内调用，返回 DEK 的 Cipher 和各表改写行数。
+func UpgradeKDF(tx *gorm.DB, vault *models.Vault, kek *KEK, params crypto.KDFParams) (*crypto.Cipher, Report, error) {
+	from, err := crypto.ParseKDFParams(vault.KDF)
+	if err != nil {
+		return nil, nil, fmt.Errorf("保险库 %s: %w", vault.ID, err)
+	}
+	dek, err := kek.Cipher(from).Decrypt(vault.DataKey, DataKeyAAD(vault.ID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("保险库 %s 的数据密钥无法解开: %w", vault.ID, err)
+	}
+	to, err := crypto.NewDataKeyCipher(dek)
+	if err != nil {
+		return nil, nil, fmt.Errorf("保险库 %s: %w", vault.ID, err)
+	}
+	report := Report{}
+	if !vault.RawDataKey {
+		if report, err = reencryptVault(tx, vault.ID, crypto.NewCipher(kek.KDF(from), dek), to); err != nil {
+			return nil, nil, err
+		}
+		vault.RawDataKey = true
+	}
+	if err := wrapDataKey(tx, vault, dek, kek, params); err != nil {
+		return nil, nil, err
+	}
+	return to, report, nil
+}
+
+func reencryptVault(tx *gorm.DB, vaultID string, from, to *crypto.Cipher) (Report, error) {
+	report := Report{}
+	for _, spec := range EncryptedColumns {
+		n, err := reencryptTable(tx, spec, vaultID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		report[spec.Table] = n
+	}
+	return report, nil
+}
+
+func wrapDataKey(tx *gorm.DB, vault *models.Vault, dek string, kek *KEK, params crypto.KDFParams) error {
+	wrapped, err := kek.Cipher(params).Encrypt(dek, DataKeyAAD(vault.ID))
+	if err != nil {
+		return err
+	}
+	// UpdateColumns 不改 updated_at，轮换密钥不算用户修改
+	updates := map[string]interface{}{"data_key": wrapped, "kdf": params.String(), "raw_data_key": vault.RawDataKey}
+	if err := tx.Model(vault).UpdateColumns(updates).Error; err != nil {
+		return err
+	}
+	vault.DataKey = wrapped
+	vault.KDF = params.String()
+	return nil
+}
+
+// UpgradeVault 把保险库中仍是旧格式（无版本、无附加数据）的密文改写为 v2 格式，
+// 密钥不变。每次最多处理 limit 行，返回实际改写的行数，供后台任务分批执行。
+func UpgradeVault(db *gorm.DB, vaultID string, dek *crypto.Cipher, limit int) (int, error) {
+	upgraded := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, spec := range EncryptedColumns {
+			if upgraded >= limit {
+				return nil
+			}
+			n, err := upgradeTable(tx, spec, vaultID, dek, limit-upgraded)
+			if err != nil {
+				return err
+			}
+			upgraded += n
+		}
+		return nil
+	})
+	return upgraded, err
+}
+
+func upgradeTable(tx *gorm.DB, spec EncryptedColumn, vaultID string, dek *crypto.Cipher, limit int) (int, error) {
+	legacy := tx.Table(spec.Table).Where("vault_id = ?", vaultID)
+	conds := make([]string, 0, len(spec.Columns))
+	args := make([]interface{}, 0, len(spec.Columns))
+	for _, col := range spec.Columns {
+		conds = append(conds, "("+col+" <> '' AND "+col+" NOT LIKE ?)")
+		args = append(args, crypto.VersionV2+":%")
+	}
+	legacy = legacy.Where(strings.Join(conds, " OR "), args...).Limit(limit)
+	return reencryptRows(tx, spec, legacy, dek, dek, true)
+}
+
+func reencryptTable(tx *gorm.DB, spec EncryptedColumn, vaultID string, from, to *crypto.Cipher) (int, error) {
+	return reencryptRows(tx, spec, tx.Table(spec.Table).Where("vault_id = ?", vaultID), from, to, false)
+}
+
+func reencryptRows(tx *gorm.DB, spec EncryptedColumn, query *gorm.DB, from, to *crypto.Cipher, onlyLegacy bool) (int, error) {
+	var rows []map[string]interface{}
+	fields := append([]string{"id"}, spec.Columns...)
+	if err := query.Select(fields).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, row := range rows {
+		id := fmt.Sprint(row["id"])
+		updates := map[string]interface{}{}
+		for _, col := range spec.Columns {
+			value, _ := row[col].(string)
+			if value == "" || (onlyLegacy && !crypto.IsLegacy(value)) {
+				continue
+			}
+			aad := crypto.AAD{Table: spec.Table, RowID: id, Field: col}
+			plaintext, err := from.Decrypt(value, aad)
+			if err != nil {
+				return 0, fmt.Errorf("%s.%s (id=%s) 无法用旧密钥解密: %w", spec.Table, col, id, err)
+			}
+			encrypted, err := to.Encrypt(plaintext, aad)
+			if err != nil {
+				return 0, err
+			}
+			updates[col] = encrypted
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := tx.Table(spec.Table).Where("id = ?", id).UpdateColumns(updates).Error; err != nil {
+			return 0, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
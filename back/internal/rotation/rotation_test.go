@@ -0,0 +1,280 @@
+package rotation
+
+import (
+	"strings"
+	"testing"
+
+	"subvault/internal/crypto"
+	"subvault/internal/database"
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	oldKey = "old-encryption-key"
+	newKey = "new-encryption-key"
+)
+
+// testParams 测试用的低开销 Argon2id 参数
+var testParams = crypto.KDFParams{Algorithm: crypto.KDFArgon2id, Time: 1, MemoryKiB: 1024, Threads: 1}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Vault{}, &models.Credential{}, &models.CredentialHistory{}, &models.Memo{}, &models.TotpSetting{}, &models.AIConfig{}, &models.IdempotencyKey{}, &models.Installation{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// mustEncrypt 按迁移前的 PBKDF2 派生方式加密
+func mustEncrypt(t *testing.T, plaintext, key string, aad crypto.AAD) string {
+	out, err := crypto.NewCipher(crypto.LegacyKDF, key).Encrypt(plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// legacyEncrypt 生成旧格式密文：无版本前缀、无附加数据
+func legacyEncrypt(t *testing.T, plaintext, key string) string {
+	return strings.TrimPrefix(mustEncrypt(t, plaintext, key, crypto.AAD{}), crypto.VersionV2+":")
+}
+
+func aad(table, id, field string) crypto.AAD {
+	return crypto.AAD{Table: table, RowID: id, Field: field}
+}
+
+// installKDF 本安装盐值加上 testParams
+func installKDF(t *testing.T, db *gorm.DB) crypto.KDF {
+	salt, err := database.InstallSalt(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.KDF{Params: testParams, Salt: salt}
+}
+
+func createVault(t *testing.T, db *gorm.DB, dataKey string) models.Vault {
+	vault := models.Vault{KeyHash: t.Name(), DataKey: dataKey}
+	if err := db.Create(&vault).Error; err != nil {
+		t.Fatal(err)
+	}
+	return vault
+}
+
+func TestRotateMigratesLegacyVaultToDataKey(t *testing.T) {
+	db := openTestDB(t)
+	vault := createVault(t, db, "")
+
+	cred := models.Credential{VaultID: vault.ID, Label: "GitHub", Username: "me", Password: legacyEncrypt(t, "hunter2", oldKey)}
+	memo := models.Memo{VaultID: vault.ID, Title: "wifi", Content: legacyEncrypt(t, "passw0rd", oldKey)}
+	totp := models.TotpSetting{VaultID: vault.ID, Secret: legacyEncrypt(t, "JBSWY3DP", oldKey)}
+	db.Create(&cred)
+	db.Create(&memo)
+	db.Create(&totp)
+
+	report, err := Rotate(db, []string{oldKey}, newKey, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["vaults"] != 1 || report["credentials"] != 1 || report["memos"] != 1 || report["totp_settings"] != 1 {
+		t.Fatalf("unexpected report: %v", report)
+	}
+
+	db.First(&vault, "id = ?", vault.ID)
+	if vault.KDF != testParams.String() || !vault.RawDataKey {
+		t.Fatalf("迁移后应记录派生参数，并直接用 DEK 加密: %q %v", vault.KDF, vault.RawDataKey)
+	}
+	kdf := installKDF(t, db)
+	dek, err := crypto.NewCipher(kdf, newKey).Decrypt(vault.DataKey, DataKeyAAD(vault.ID))
+	if err != nil {
+		t.Fatalf("数据密钥应由新主密钥包裹: %v", err)
+	}
+	db.First(&cred, "id = ?", cred.ID)
+	if crypto.IsLegacy(cred.Password) {
+		t.Fatal("迁移后密文应为 v2 格式")
+	}
+	dekCipher, err := crypto.NewDataKeyCipher(dek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dekCipher.Decrypt(cred.Password, aad("credentials", cred.ID, "password")); err != nil || got != "hunter2" {
+		t.Fatalf("密码应能直接用数据密钥解密: %q %v", got, err)
+	}
+	if _, err := crypto.NewCipher(crypto.LegacyKDF, oldKey).Decrypt(cred.Password, aad("credentials", cred.ID, "password")); err == nil {
+		t.Fatal("迁移后旧主密钥不应再能直接解密")
+	}
+
+	// 再执行一次不应报错，也不应重复改写
+	report, err = Rotate(db, []string{oldKey}, newKey, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["vaults"] != 0 || report["credentials"] != 0 {
+		t.Fatalf("重复轮换不应改写已轮换的数据: %v", report)
+	}
+}
+
+func TestRotateOnlyRewrapsDataKey(t *testing.T) {
+	db := openTestDB(t)
+	dek, err := crypto.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := createVault(t, db, legacyEncrypt(t, dek, oldKey))
+	cred := models.Credential{ID: "cred-1", VaultID: vault.ID, Label: "a", Username: "a", Password: mustEncrypt(t, "one", dek, aad("credentials", "cred-1", "password"))}
+	db.Create(&cred)
+	before := cred.Password
+
+	report, err := Rotate(db, []string{oldKey}, newKey, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["vaults"] != 1 || report["credentials"] != 0 {
+		t.Fatalf("只应重新包裹数据密钥: %v", report)
+	}
+
+	// 轮换主密钥不改变派生参数，旧版 PBKDF2 的保险库留给 UpgradeKDF 迁移
+	db.First(&vault, "id = ?", vault.ID)
+	if got, err := crypto.NewCipher(crypto.LegacyKDF, newKey).Decrypt(vault.DataKey, DataKeyAAD(vault.ID)); err != nil || got != dek || crypto.IsLegacy(vault.DataKey) {
+		t.Fatalf("新主密钥应解出原数据密钥: %v", err)
+	}
+	db.First(&cred, "id = ?", cred.ID)
+	if cred.Password != before {
+		t.Fatal("有数据密钥的保险库密文不应被改写")
+	}
+}
+
+func TestRotateRollsBackOnUndecryptableValue(t *testing.T) {
+	db := openTestDB(t)
+	vault := createVault(t, db, "")
+
+	good := models.Credential{VaultID: vault.ID, Label: "a", Username: "a", Password: legacyEncrypt(t, "one", oldKey)}
+	bad := models.Memo{VaultID: vault.ID, Title: "b", Content: legacyEncrypt(t, "two", "some-other-key")}
+	db.Create(&good)
+	db.Create(&bad)
+
+	if _, err := Rotate(db, []string{oldKey}, newKey, testParams); err == nil {
+		t.Fatal("存在无法解密的数据时应失败")
+	}
+
+	db.First(&vault, "id = ?", vault.ID)
+	if vault.DataKey != "" {
+		t.Fatal("失败后不应写入数据密钥")
+	}
+	db.First(&good, "id = ?", good.ID)
+	if _, err := crypto.NewCipher(crypto.LegacyKDF, oldKey).Decrypt(good.Password, crypto.AAD{}); err != nil {
+		t.Fatal("失败后应回滚，数据仍由旧密钥加密")
+	}
+}
+
+func TestUpgradeVaultRewritesLegacyRowsInBatches(t *testing.T) {
+	db := openTestDB(t)
+	dek, err := crypto.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := createVault(t, db, mustEncrypt(t, dek, newKey, DataKeyAAD("")))
+
+	current := models.Credential{ID: "cred-v2", VaultID: vault.ID, Label: "a", Username: "a", Password: mustEncrypt(t, "one", dek, aad("credentials", "cred-v2", "password"))}
+	legacy := models.Credential{ID: "cred-v1", VaultID: vault.ID, Label: "b", Username: "b", Password: legacyEncrypt(t, "two", dek), Notes: legacyEncrypt(t, "note", dek)}
+	memo := models.Memo{ID: "memo-v1", VaultID: vault.ID, Title: "c", Content: legacyEncrypt(t, "three", dek)}
+	db.Create(&current)
+	db.Create(&legacy)
+	db.Create(&memo)
+	before := current.Password
+
+	cipher := crypto.NewCipher(crypto.LegacyKDF, dek)
+	n, err := UpgradeVault(db, vault.ID, cipher, 1)
+	if err != nil || n != 1 {
+		t.Fatalf("第一批应只改写 1 行: %d %v", n, err)
+	}
+	n, err = UpgradeVault(db, vault.ID, cipher, 10)
+	if err != nil || n != 1 {
+		t.Fatalf("第二批应改写剩余 1 行: %d %v", n, err)
+	}
+	if n, _ := UpgradeVault(db, vault.ID, cipher, 10); n != 0 {
+		t.Fatalf("全部升级后不应再有改写: %d", n)
+	}
+
+	db.First(&current, "id = ?", current.ID)
+	if current.Password != before {
+		t.Fatal("已是 v2 格式的密文不应被改写")
+	}
+	db.First(&legacy, "id = ?", legacy.ID)
+	if got, err := cipher.Decrypt(legacy.Password, aad("credentials", legacy.ID, "password")); err != nil || got != "two" || crypto.IsLegacy(legacy.Password) {
+		t.Fatalf("旧格式密码应升级为 v2: %q %v", got, err)
+	}
+	if got, err := cipher.Decrypt(legacy.Notes, aad("credentials", legacy.ID, "notes")); err != nil || got != "note" {
+		t.Fatalf("旧格式备注应升级为 v2: %q %v", got, err)
+	}
+	db.First(&memo, "id = ?", memo.ID)
+	if got, err := cipher.Decrypt(memo.Content, aad("memos", memo.ID, "content")); err != nil || got != "three" {
+		t.Fatalf("旧格式备忘录应升级为 v2: %q %v", got, err)
+	}
+}
+
+func TestUpgradeKDFMigratesFromPBKDF2(t *testing.T) {
+	db := openTestDB(t)
+	dek, err := crypto.GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := createVault(t, db, "")
+	wrapped := mustEncrypt(t, dek, newKey, DataKeyAAD(vault.ID))
+	db.Model(&vault).UpdateColumn("data_key", wrapped)
+	vault.DataKey = wrapped
+	cred := models.Credential{ID: "cred-1", VaultID: vault.ID, Label: "a", Username: "a", Password: mustEncrypt(t, "one", dek, aad("credentials", "cred-1", "password"))}
+	db.Create(&cred)
+
+	kdf := installKDF(t, db)
+	kek := NewKEK(kdf.Salt, newKey)
+	var upgraded *crypto.Cipher
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		upgraded, _, err = UpgradeKDF(tx, &vault, kek, testParams)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.First(&vault, "id = ?", vault.ID)
+	if vault.KDF != testParams.String() || !vault.RawDataKey {
+		t.Fatalf("应记录新的派生参数，并改为直接用 DEK 加密: %q %v", vault.KDF, vault.RawDataKey)
+	}
+	if got, err := crypto.NewCipher(kdf, newKey).Decrypt(vault.DataKey, DataKeyAAD(vault.ID)); err != nil || got != dek {
+		t.Fatal("数据密钥应由 Argon2id 派生的主密钥重新包裹，DEK 本身不变")
+	}
+	db.First(&cred, "id = ?", cred.ID)
+	if got, err := upgraded.Decrypt(cred.Password, aad("credentials", cred.ID, "password")); err != nil || got != "one" {
+		t.Fatalf("密文应改为直接用 DEK 加密: %q %v", got, err)
+	}
+	if _, err := crypto.NewCipher(crypto.LegacyKDF, dek).Decrypt(cred.Password, aad("credentials", cred.ID, "password")); err == nil {
+		t.Fatal("迁移后 PBKDF2 派生的密钥不应再能解密")
+	}
+
+	// 之后再调整参数只重新包裹 DEK，密文不动
+	tuned := testParams
+	tuned.Time = 2
+	before := cred.Password
+	var report Report
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, report, err = UpgradeKDF(tx, &vault, kek, tuned)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.First(&vault, "id = ?", vault.ID)
+	db.First(&cred, "id = ?", cred.ID)
+	if vault.KDF != tuned.String() || cred.Password != before || report["credentials"] != 0 {
+		t.Fatalf("直接用 DEK 加密的保险库调整参数时不应改写密文: %q %v", vault.KDF, report)
+	}
+}
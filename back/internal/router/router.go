@@ -1,27 +1,37 @@
 package router
 
 import (
+	"log"
+
 	"subvault/internal/config"
 	"subvault/internal/handlers"
+	"subvault/internal/keyring"
 	"subvault/internal/middleware"
+	"subvault/internal/store"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func Setup(cfg *config.Config) *gin.Engine {
+func Setup(cfg *config.Config, keys *keyring.Keyring, db *gorm.DB, st *store.Store) *gin.Engine {
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.Default()
+	// 未配置可信代理时不信任任何 X-Forwarded-For，客户端 IP 取连接的对端地址；
+	// 否则任何人都能伪造来源 IP，绕过按 IP 的速率限制和解锁锁定
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES 无效: %v", err)
+	}
 
 	// CORS 配置
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000", "http://127.0.0.1:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key", "If-Match"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed", "ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -37,28 +47,51 @@ func Setup(cfg *config.Config) *gin.Engine {
 	v1 := r.Group("/api/v1")
 	{
 		// 解锁（无需认证，但有更严格的速率限制）
-		authHandler := handlers.NewAuthHandler(cfg)
+		authHandler := handlers.NewAuthHandler(cfg, keys, db)
 		v1.POST("/unlock", middleware.AuthRateLimitMiddleware(), authHandler.Unlock)
-		v1.GET("/calendar/:token", handlers.NewSettingsHandler().PublicCalendar)
+		v1.POST("/auth/refresh", middleware.AuthRateLimitMiddleware(), authHandler.Refresh)
+		v1.POST("/auth/register", middleware.AuthRateLimitMiddleware(), authHandler.Register)
+		v1.GET("/auth/registration", authHandler.RegistrationStatus)
+		v1.POST("/auth/webauthn/begin", middleware.AuthRateLimitMiddleware(), authHandler.BeginPasskeyUnlock)
+		v1.POST("/auth/webauthn/unlock", middleware.AuthRateLimitMiddleware(), authHandler.PasskeyUnlock)
+		v1.GET("/calendar/:token", handlers.NewSettingsHandler(st).PublicCalendar)
 
 		// 需要认证的路由
 		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware(cfg))
+		protected.Use(middleware.AuthMiddleware(cfg, db))
 		{
 			// 验证 token
 			protected.GET("/verify", authHandler.VerifyToken)
+			protected.POST("/auth/logout", authHandler.Logout)
+
+			// 已登录设备
+			sessionHandler := handlers.NewSessionHandler(db)
+			protected.GET("/sessions", sessionHandler.ListSessions)
+			protected.DELETE("/sessions/:id", sessionHandler.RevokeSession)
+
+			// 个人访问令牌（只能用解锁得到的会话管理，API 令牌无权访问）
+			tokenHandler := handlers.NewAPITokenHandler(db)
+			protected.GET("/tokens", tokenHandler.ListAPITokens)
+			protected.POST("/tokens", tokenHandler.CreateAPIToken)
+			protected.DELETE("/tokens/:id", tokenHandler.RevokeAPIToken)
+
+			// 批量写接口支持 Idempotency-Key，超时重试不会重复写入
+			idempotent := middleware.Idempotent(db, keys)
 
 			// Vault 数据
-			vaultHandler := handlers.NewVaultHandler(cfg)
+			vaultHandler := handlers.NewVaultHandler(cfg, keys, db, st)
 			protected.GET("/vault", vaultHandler.GetVault)
+			protected.GET("/vault/changes", vaultHandler.GetVaultChanges)
 
 			// 订阅
 			subs := protected.Group("/subscriptions")
 			{
 				subs.GET("", vaultHandler.GetSubscriptions)
 				subs.POST("", vaultHandler.CreateSubscription)
-				subs.PUT("/groups", vaultHandler.UpdateSubscriptionGroups)
+				subs.PUT("/groups", idempotent, vaultHandler.UpdateSubscriptionGroups)
+				subs.GET("/:id", vaultHandler.GetSubscription)
 				subs.PUT("/:id", vaultHandler.UpdateSubscription)
+				subs.PUT("/:id/collection", vaultHandler.AssignSubscriptionCollection)
 				subs.DELETE("/:id", vaultHandler.DeleteSubscription)
 			}
 
@@ -67,25 +100,66 @@ func Setup(cfg *config.Config) *gin.Engine {
 			{
 				creds.GET("", vaultHandler.GetCredentials)
 				creds.POST("", vaultHandler.CreateCredential)
-				creds.POST("/batch", vaultHandler.BatchCreateCredentials)
-				creds.PUT("/groups", vaultHandler.UpdateCredentialGroups)
+				creds.POST("/batch", idempotent, vaultHandler.BatchCreateCredentials)
+				creds.POST("/import", idempotent, vaultHandler.ImportCredentials)
+				creds.POST("/import/preview", vaultHandler.PreviewCredentialImport)
+				creds.PUT("/groups", idempotent, vaultHandler.UpdateCredentialGroups)
+				creds.GET("/history-limit", vaultHandler.GetPasswordHistoryLimit)
+				creds.PUT("/history-limit", vaultHandler.SavePasswordHistoryLimit)
+				creds.GET("/:id", vaultHandler.GetCredential)
 				creds.PUT("/:id", vaultHandler.UpdateCredential)
+				creds.PUT("/:id/collection", vaultHandler.AssignCredentialCollection)
+				creds.GET("/:id/history", vaultHandler.GetCredentialHistory)
+				creds.POST("/:id/history/:historyId/restore", vaultHandler.RestoreCredentialHistory)
 				creds.DELETE("/:id", vaultHandler.DeleteCredential)
 			}
 
 			// 备忘录
-			memoHandler := handlers.NewMemoHandler(cfg)
+			memoHandler := handlers.NewMemoHandler(cfg, keys, db, st)
 			memos := protected.Group("/memos")
 			{
 				memos.GET("", memoHandler.GetMemos)
 				memos.POST("", memoHandler.CreateMemo)
-				memos.PUT("/groups", memoHandler.UpdateMemoGroups)
+				memos.PUT("/groups", idempotent, memoHandler.UpdateMemoGroups)
+				memos.GET("/:id", memoHandler.GetMemo)
 				memos.PUT("/:id", memoHandler.UpdateMemo)
+				memos.PUT("/:id/collection", memoHandler.AssignMemoCollection)
 				memos.DELETE("/:id", memoHandler.DeleteMemo)
 			}
 
+			// 回收站（只能用解锁得到的会话访问，API 令牌无权访问）
+			trashHandler := handlers.NewTrashHandler(cfg, st)
+			trash := protected.Group("/trash")
+			{
+				trash.GET("", trashHandler.GetTrash)
+				trash.DELETE("", trashHandler.EmptyTrash)
+				trash.POST("/:kind/:id/restore", trashHandler.RestoreTrashItem)
+				trash.DELETE("/:kind/:id", trashHandler.PurgeTrashItem)
+			}
+
+			// 整库备份（只能用解锁得到的会话访问，API 令牌无权访问）
+			backupHandler := handlers.NewBackupHandler(keys, db, st)
+			protected.POST("/backup/export", backupHandler.ExportBackup)
+			protected.POST("/backup/import", backupHandler.ImportBackup)
+
+			// 凭证明文导出，需再次输入主密钥（开启两步验证时还需验证码），API 令牌无权访问
+			protected.POST("/export/credentials", vaultHandler.ExportCredentials)
+
+			// 共享集合
+			collectionHandler := handlers.NewCollectionHandler(db)
+			collections := protected.Group("/collections")
+			{
+				collections.GET("", collectionHandler.ListCollections)
+				collections.POST("", collectionHandler.CreateCollection)
+				collections.PUT("/:id", collectionHandler.RenameCollection)
+				collections.DELETE("/:id", collectionHandler.DeleteCollection)
+				collections.POST("/:id/members", collectionHandler.AddCollectionMember)
+				collections.PUT("/:id/members/:memberId", collectionHandler.UpdateCollectionMember)
+				collections.DELETE("/:id/members/:memberId", collectionHandler.RemoveCollectionMember)
+			}
+
 			// AI 分析
-			aiHandler := handlers.NewAIHandler(cfg)
+			aiHandler := handlers.NewAIHandler(cfg, keys, db, st)
 			ai := protected.Group("/ai")
 			{
 				ai.GET("/config", aiHandler.GetAIConfig)
@@ -101,7 +175,7 @@ func Setup(cfg *config.Config) *gin.Engine {
 			}
 
 			// 设置和分析
-			settingsHandler := handlers.NewSettingsHandler()
+			settingsHandler := handlers.NewSettingsHandler(st)
 
 			// 标签
 			tags := protected.Group("/tags")
@@ -124,13 +198,37 @@ func Setup(cfg *config.Config) *gin.Engine {
 			protected.GET("/analytics", settingsHandler.GetAnalytics)
 
 			// 两步验证 (TOTP)
-			totpHandler := handlers.NewTotpHandler(cfg)
+			totpHandler := handlers.NewTotpHandler(cfg, keys, db)
 			totp := protected.Group("/totp")
 			{
 				totp.POST("/setup", totpHandler.SetupTOTP)
 				totp.POST("/verify", totpHandler.VerifyTOTP)
 				totp.DELETE("", totpHandler.DisableTOTP)
 				totp.GET("/status", totpHandler.GetTOTPStatus)
+				totp.GET("/recovery-codes", totpHandler.GetRecoveryCodeStatus)
+				totp.POST("/recovery-codes", totpHandler.RegenerateRecoveryCodes)
+			}
+
+			// 通行密钥 (WebAuthn)
+			webauthnHandler := handlers.NewWebAuthnHandler(cfg, keys, db)
+			passkeys := protected.Group("/webauthn")
+			{
+				passkeys.POST("/register/begin", webauthnHandler.BeginRegistration)
+				passkeys.POST("/register/finish", webauthnHandler.FinishRegistration)
+				passkeys.GET("/credentials", webauthnHandler.ListCredentials)
+				passkeys.DELETE("/credentials/:id", webauthnHandler.DeleteCredential)
+			}
+
+			// 安全审计日志
+			protected.GET("/audit", handlers.NewAuditHandler(db).ListAuditEvents)
+
+			// 管理员
+			adminHandler := handlers.NewAdminHandler(db)
+			admin := protected.Group("/admin")
+			admin.Use(middleware.AdminMiddleware(db))
+			{
+				admin.GET("/registration", adminHandler.GetRegistration)
+				admin.PUT("/registration", adminHandler.UpdateRegistration)
 			}
 		}
 	}
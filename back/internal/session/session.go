@@ -0,0 +1,171 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidRefreshToken 刷新令牌不存在、已过期、已吊销或被重放
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// touchInterval 最近活跃时间的最小写入间隔，避免每个请求都写库
+const touchInterval = time.Minute
+
+// Client 发起解锁的设备信息
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// Create 为保险库新建会话，返回会话和明文刷新令牌（只出现这一次）
+func Create(db *gorm.DB, vaultID string, client Client, ttl time.Duration) (models.Session, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return models.Session{}, "", err
+	}
+	now := time.Now()
+	sess := models.Session{
+		VaultID:     vaultID,
+		RefreshHash: hashToken(token),
+		UserAgent:   truncate(client.UserAgent, 255),
+		IP:          client.IP,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	if err := db.Create(&sess).Error; err != nil {
+		return models.Session{}, "", err
+	}
+	return sess, token, nil
+}
+
+// Rotate 用刷新令牌换取新的刷新令牌，旧令牌立即失效。
+// 已轮转过的旧令牌再次出现说明可能被盗用，整条会话直接吊销。
+func Rotate(db *gorm.DB, refreshToken string, ttl time.Duration) (models.Session, string, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	hash := hashToken(refreshToken)
+
+	var sess models.Session
+	if err := db.Where("refresh_hash = ?", hash).First(&sess).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			var replayed models.Session
+			if db.Where("previous_hash = ? AND revoked_at IS NULL", hash).First(&replayed).Error == nil {
+				_ = Revoke(db, replayed.ID)
+			}
+			return models.Session{}, "", ErrInvalidRefreshToken
+		}
+		return models.Session{}, "", err
+	}
+	if sess.RevokedAt != nil || time.Now().After(sess.ExpiresAt) {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+
+	next, err := randomToken()
+	if err != nil {
+		return models.Session{}, "", err
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND refresh_hash = ?", sess.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_hash":  hashToken(next),
+			"previous_hash": hash,
+			"last_seen_at":  now,
+			"expires_at":    expiresAt,
+		})
+	if result.Error != nil {
+		return models.Session{}, "", result.Error
+	}
+	// 并发刷新时只有一个请求能换到新令牌
+	if result.RowsAffected == 0 {
+		return models.Session{}, "", ErrInvalidRefreshToken
+	}
+	sess.LastSeenAt = now
+	sess.ExpiresAt = expiresAt
+	return sess, next, nil
+}
+
+// List 返回保险库仍然有效的会话，最近活跃的在前
+func List(db *gorm.DB, vaultID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := db.Where("vault_id = ? AND revoked_at IS NULL AND expires_at > ?", vaultID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeForVault 吊销指定保险库下的会话，会话不属于该保险库时返回 false
+func RevokeForVault(db *gorm.DB, vaultID, id string) (bool, error) {
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND vault_id = ? AND revoked_at IS NULL", id, vaultID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// Touch 记录会话最近活跃时间和来源 IP，一分钟内重复调用不写库
+func Touch(db *gorm.DB, id, ip string) {
+	now := time.Now()
+	db.Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", id, now.Add(-touchInterval)).
+		Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"ip":           ip,
+		})
+}
+
+// Revoke 吊销会话，已吊销的会话保持原吊销时间
+func Revoke(db *gorm.DB, id string) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsActive 会话存在、未吊销且未过期
+func IsActive(db *gorm.DB, id string) bool {
+	if id == "" {
+		return false
+	}
+	var count int64
+	db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// PurgeExpired 清理已过期或吊销超过一天的会话
+func PurgeExpired(db *gorm.DB) error {
+	cutoff := time.Now().Add(-24 * time.Hour)
+	return db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{}).Error
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,127 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Session{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCreateAndRotate(t *testing.T) {
+	db := openTestDB(t)
+
+	sess, token, err := Create(db, "vault-1", Client{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsActive(db, sess.ID) {
+		t.Fatal("新会话应有效")
+	}
+
+	rotated, next, err := Rotate(db, token, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID != sess.ID || next == token {
+		t.Fatal("轮转应保留会话并换新刷新令牌")
+	}
+	if _, _, err := Rotate(db, next, time.Hour); err != nil {
+		t.Fatalf("新刷新令牌应可用: %v", err)
+	}
+}
+
+func TestRotateReplayRevokesSession(t *testing.T) {
+	db := openTestDB(t)
+
+	sess, token, err := Create(db, "vault-1", Client{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Rotate(db, token, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Rotate(db, token, time.Hour); err != ErrInvalidRefreshToken {
+		t.Fatalf("旧刷新令牌应拒绝，实际 %v", err)
+	}
+	if IsActive(db, sess.ID) {
+		t.Fatal("旧刷新令牌重放后会话应被吊销")
+	}
+}
+
+func TestRevokeAndExpiry(t *testing.T) {
+	db := openTestDB(t)
+
+	sess, token, err := Create(db, "vault-1", Client{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Revoke(db, sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if IsActive(db, sess.ID) {
+		t.Fatal("吊销后会话应失效")
+	}
+	if _, _, err := Rotate(db, token, time.Hour); err != ErrInvalidRefreshToken {
+		t.Fatal("吊销后刷新令牌应拒绝")
+	}
+
+	expired, expiredToken, err := Create(db, "vault-1", Client{}, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsActive(db, expired.ID) {
+		t.Fatal("过期会话应失效")
+	}
+	if _, _, err := Rotate(db, expiredToken, time.Hour); err != ErrInvalidRefreshToken {
+		t.Fatal("过期刷新令牌应拒绝")
+	}
+}
+
+func TestListAndRevokeForVault(t *testing.T) {
+	db := openTestDB(t)
+
+	laptop, _, err := Create(db, "vault-1", Client{UserAgent: "Firefox", IP: "10.0.0.2"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Create(db, "vault-1", Client{UserAgent: "Safari", IP: "10.0.0.3"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Create(db, "vault-2", Client{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := List(db, "vault-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("应列出 2 个会话，实际 %d", len(sessions))
+	}
+
+	if ok, _ := RevokeForVault(db, "vault-2", laptop.ID); ok {
+		t.Fatal("不能吊销其他保险库的会话")
+	}
+	if ok, err := RevokeForVault(db, "vault-1", laptop.ID); !ok || err != nil {
+		t.Fatalf("应能吊销自己的会话: %v", err)
+	}
+	sessions, _ = List(db, "vault-1")
+	if len(sessions) != 1 || sessions[0].UserAgent != "Safari" {
+		t.Fatal("吊销后只应剩下另一台设备")
+	}
+}
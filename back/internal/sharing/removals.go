@@ -0,0 +1,104 @@
+package sharing
+
+import (
+	"time"
+
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// recordTables 可以放入集合的记录所在的表，表名同时是增量同步和回收站接口中的记录类型
+var recordTables = []string{"subscriptions", "credentials", "memos"}
+
+// Audience 能看到一条记录的保险库：创建者，加上所在集合的所有者和全部成员
+func Audience(db *gorm.DB, recordVaultID string, collectionID *string) ([]string, error) {
+	vaults := []string{recordVaultID}
+	if collectionID == nil || *collectionID == "" {
+		return vaults, nil
+	}
+	members, err := collectionVaults(db, *collectionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, vaultID := range members {
+		if vaultID != recordVaultID {
+			vaults = append(vaults, vaultID)
+		}
+	}
+	return vaults, nil
+}
+
+// collectionVaults 集合所有者和全部成员的保险库
+func collectionVaults(db *gorm.DB, collectionID string) ([]string, error) {
+	var vaults []string
+	err := db.Raw("SELECT owner_vault_id FROM collections WHERE id = ? UNION SELECT vault_id FROM collection_members WHERE collection_id = ?",
+		collectionID, collectionID).Scan(&vaults).Error
+	return vaults, err
+}
+
+// RecordRemovals 记录 kind 表中的 recordID 从 vaultIDs 的视野中消失，供增量同步返回
+func RecordRemovals(db *gorm.DB, kind, recordID string, vaultIDs []string) error {
+	if len(vaultIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.SyncRemoval, 0, len(vaultIDs))
+	for _, vaultID := range vaultIDs {
+		rows = append(rows, models.SyncRemoval{VaultID: vaultID, Kind: kind, RecordID: recordID})
+	}
+	return db.Create(&rows).Error
+}
+
+// RecordMove 记录从集合 from 移到 to（nil 表示个人保险库）后，为不再能看到它的保险库记录移除
+func RecordMove(db *gorm.DB, kind, recordID, recordVaultID string, from, to *string) error {
+	before, err := Audience(db, recordVaultID, from)
+	if err != nil {
+		return err
+	}
+	after, err := Audience(db, recordVaultID, to)
+	if err != nil {
+		return err
+	}
+	still := make(map[string]bool, len(after))
+	for _, vaultID := range after {
+		still[vaultID] = true
+	}
+	var lost []string
+	for _, vaultID := range before {
+		if !still[vaultID] {
+			lost = append(lost, vaultID)
+		}
+	}
+	return RecordRemovals(db, kind, recordID, lost)
+}
+
+// recordLeave 集合中的记录不再对 vaultIDs 可见时（退出集合、集合被删除）逐条记录移除，各保险库自己创建的记录除外。
+// 回收站中的记录同样记录：离开后客户端无法再从回收站得知它们的删除
+func recordLeave(tx *gorm.DB, collectionID string, vaultIDs []string) error {
+	for _, table := range recordTables {
+		var records []struct {
+			ID      string
+			VaultID string
+		}
+		if err := tx.Table(table).Select("id", "vault_id").Where("collection_id = ?", collectionID).Scan(&records).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			var lost []string
+			for _, vaultID := range vaultIDs {
+				if vaultID != record.VaultID {
+					lost = append(lost, vaultID)
+				}
+			}
+			if err := RecordRemovals(tx, table, record.ID, lost); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeRemovalsBefore 清理 cutoff 之前的移除记录。早于回收站保留期的同步游标已经失效，不再需要它们
+func PurgeRemovalsBefore(db *gorm.DB, cutoff time.Time) error {
+	return db.Where("created_at < ?", cutoff).Delete(&models.SyncRemoval{}).Error
+}
@@ -0,0 +1,334 @@
+package sharing
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"subvault/internal/accounts"
+	"subvault/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound 集合不存在，或当前保险库不是其所有者/成员
+	ErrNotFound = errors.New("collection not found")
+	// ErrForbidden 当前角色无权执行该操作
+	ErrForbidden = errors.New("insufficient collection role")
+	// ErrInvalidRole 成员角色只能是 viewer 或 editor
+	ErrInvalidRole = errors.New("invalid collection role")
+	// ErrInvalidName 集合名称为空或过长
+	ErrInvalidName = errors.New("invalid collection name")
+	// ErrUserNotFound 要添加的用户名不存在
+	ErrUserNotFound = errors.New("user not found")
+	// ErrAlreadyMember 用户已在集合中（含所有者本人）
+	ErrAlreadyMember = errors.New("already a member")
+)
+
+const maxNameLength = 64
+
+// 可见集合：自己创建的，加上作为成员加入的；可编辑集合只算 editor 身份加入的
+const (
+	readableCollections = "SELECT id FROM collections WHERE owner_vault_id = ? UNION SELECT collection_id FROM collection_members WHERE vault_id = ?"
+	writableCollections = "SELECT id FROM collections WHERE owner_vault_id = ? UNION SELECT collection_id FROM collection_members WHERE vault_id = ? AND role = 'editor'"
+)
+
+// Readable 查询范围：自己保险库的记录，加上所在共享集合中的记录。
+// 用于订阅、凭证、备忘录等带 vault_id 和 collection_id 列的表。
+func Readable(vaultID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(vault_id = ? OR collection_id IN ("+readableCollections+"))", vaultID, vaultID, vaultID)
+	}
+}
+
+// Writable 查询范围：自己保险库的记录，加上以 owner/editor 身份可编辑的共享记录
+func Writable(vaultID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(vault_id = ? OR collection_id IN ("+writableCollections+"))", vaultID, vaultID, vaultID)
+	}
+}
+
+// ChangedSince 查询范围：since 之后修改过的记录，加上 vaultID 在 since 之后加入的集合中的全部记录。
+// 加入前就已存在的记录修改时间可能早于 since，增量同步需要把它们当作新增返回
+func ChangedSince(vaultID string, since time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(updated_at > ? OR collection_id IN (SELECT collection_id FROM collection_members WHERE vault_id = ? AND created_at > ?))", since, vaultID, since)
+	}
+}
+
+// RoleOf 返回保险库在集合中的角色，不可见时返回 ErrNotFound
+func RoleOf(db *gorm.DB, collectionID, vaultID string) (string, error) {
+	var collection models.Collection
+	err := db.Where("id = ?", collectionID).First(&collection).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if collection.OwnerVaultID == vaultID {
+		return models.CollectionRoleOwner, nil
+	}
+	var member models.CollectionMember
+	err = db.Where("collection_id = ? AND vault_id = ?", collectionID, vaultID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// CanEdit 角色是否允许新增、修改、删除集合中的记录
+func CanEdit(role string) bool {
+	return role == models.CollectionRoleOwner || role == models.CollectionRoleEditor
+}
+
+// Access 返回保险库对一条记录的权限：自己的记录为 owner，共享记录为所在集合中的角色，
+// 无权访问返回空字符串
+func Access(db *gorm.DB, vaultID, recordVaultID string, collectionID *string) string {
+	if recordVaultID == vaultID {
+		return models.CollectionRoleOwner
+	}
+	if collectionID == nil || *collectionID == "" {
+		return ""
+	}
+	role, err := RoleOf(db, *collectionID, vaultID)
+	if err != nil {
+		return ""
+	}
+	return role
+}
+
+// Member 集合成员，所有者也以 owner 角色列出（ID 为空）
+type Member struct {
+	ID       string `json:"id,omitempty"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Summary 当前保险库可见的集合及自己的角色
+type Summary struct {
+	models.Collection
+	Role    string   `json:"role"`
+	Members []Member `json:"members"`
+}
+
+// List 列出保险库创建或加入的全部集合
+func List(db *gorm.DB, vaultID string) ([]Summary, error) {
+	var collections []models.Collection
+	if err := db.Where("id IN ("+readableCollections+")", vaultID, vaultID).Order("created_at asc").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Summary, 0, len(collections))
+	for _, collection := range collections {
+		members, err := members(db, collection)
+		if err != nil {
+			return nil, err
+		}
+		role := ""
+		for _, m := range members {
+			if m.vaultID == vaultID {
+				role = m.Role
+			}
+		}
+		summary := Summary{Collection: collection, Role: role, Members: make([]Member, 0, len(members))}
+		for _, m := range members {
+			summary.Members = append(summary.Members, m.Member)
+		}
+		out = append(out, summary)
+	}
+	return out, nil
+}
+
+type memberRow struct {
+	Member
+	vaultID string
+}
+
+func members(db *gorm.DB, collection models.Collection) ([]memberRow, error) {
+	owner, err := accounts.ForVault(db, collection.OwnerVaultID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	rows := []memberRow{{Member: Member{Username: owner.Username, Role: models.CollectionRoleOwner}, vaultID: collection.OwnerVaultID}}
+
+	var records []models.CollectionMember
+	if err := db.Where("collection_id = ?", collection.ID).Order("created_at asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		user, err := accounts.ForVault(db, record.VaultID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		rows = append(rows, memberRow{Member: Member{ID: record.ID, Username: user.Username, Role: record.Role}, vaultID: record.VaultID})
+	}
+	return rows, nil
+}
+
+func normalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+func validRole(role string) bool {
+	return role == models.CollectionRoleViewer || role == models.CollectionRoleEditor
+}
+
+// Create 新建集合，创建者为所有者
+func Create(db *gorm.DB, ownerVaultID, name string) (models.Collection, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	collection := models.Collection{OwnerVaultID: ownerVaultID, Name: name}
+	if err := db.Create(&collection).Error; err != nil {
+		return models.Collection{}, err
+	}
+	return collection, nil
+}
+
+// loadOwned 读取集合并确认调用者是所有者；成员调用返回 ErrForbidden
+func loadOwned(db *gorm.DB, collectionID, vaultID string) (models.Collection, error) {
+	role, err := RoleOf(db, collectionID, vaultID)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	if role != models.CollectionRoleOwner {
+		return models.Collection{}, ErrForbidden
+	}
+	var collection models.Collection
+	err = db.Where("id = ?", collectionID).First(&collection).Error
+	return collection, err
+}
+
+// Rename 修改集合名称，仅所有者可用
+func Rename(db *gorm.DB, collectionID, vaultID, name string) (models.Collection, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	collection, err := loadOwned(db, collectionID, vaultID)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	if err := db.Model(&collection).Update("name", name).Error; err != nil {
+		return models.Collection{}, err
+	}
+	return collection, nil
+}
+
+// Delete 删除集合，仅所有者可用。
+// 集合中的记录不删除，退回各自创建者的个人保险库；回收站中的记录同样退回，恢复后不会指向已删除的集合。
+// 其他保险库从此看不到这些记录，为它们记录移除。
+func Delete(db *gorm.DB, collectionID, vaultID string) error {
+	if _, err := loadOwned(db, collectionID, vaultID); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		vaults, err := collectionVaults(tx, collectionID)
+		if err != nil {
+			return err
+		}
+		if err := recordLeave(tx, collectionID, vaults); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.Subscription{}, &models.Credential{}, &models.Memo{}} {
+			if err := tx.Unscoped().Model(model).Where("collection_id = ?", collectionID).Update("collection_id", nil).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("collection_id = ?", collectionID).Delete(&models.CollectionMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", collectionID).Delete(&models.Collection{}).Error
+	})
+}
+
+// AddMember 按用户名邀请成员，仅所有者可用
+func AddMember(db *gorm.DB, collectionID, vaultID, username, role string) (Member, error) {
+	if !validRole(role) {
+		return Member{}, ErrInvalidRole
+	}
+	collection, err := loadOwned(db, collectionID, vaultID)
+	if err != nil {
+		return Member{}, err
+	}
+	var user models.User
+	err = db.Where("username = ?", accounts.NormalizeUsername(username)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Member{}, ErrUserNotFound
+	}
+	if err != nil {
+		return Member{}, err
+	}
+	if user.VaultID == collection.OwnerVaultID {
+		return Member{}, ErrAlreadyMember
+	}
+	var count int64
+	if err := db.Model(&models.CollectionMember{}).Where("collection_id = ? AND vault_id = ?", collectionID, user.VaultID).Count(&count).Error; err != nil {
+		return Member{}, err
+	}
+	if count > 0 {
+		return Member{}, ErrAlreadyMember
+	}
+	record := models.CollectionMember{CollectionID: collectionID, VaultID: user.VaultID, Role: role}
+	if err := db.Create(&record).Error; err != nil {
+		return Member{}, err
+	}
+	return Member{ID: record.ID, Username: user.Username, Role: role}, nil
+}
+
+// UpdateMember 调整成员角色，仅所有者可用
+func UpdateMember(db *gorm.DB, collectionID, vaultID, memberID, role string) error {
+	if !validRole(role) {
+		return ErrInvalidRole
+	}
+	if _, err := loadOwned(db, collectionID, vaultID); err != nil {
+		return err
+	}
+	result := db.Model(&models.CollectionMember{}).Where("id = ? AND collection_id = ?", memberID, collectionID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveMember 所有者可移除任意成员，成员可移除自己（退出集合）。
+// 退出者在集合中创建的记录仍属于其保险库，退出后依然可见；其他人的记录为退出者记录移除。
+func RemoveMember(db *gorm.DB, collectionID, vaultID, memberID string) error {
+	role, err := RoleOf(db, collectionID, vaultID)
+	if err != nil {
+		return err
+	}
+	query := db.Where("id = ? AND collection_id = ?", memberID, collectionID)
+	if role != models.CollectionRoleOwner {
+		query = query.Where("vault_id = ?", vaultID)
+	}
+	var member models.CollectionMember
+	err = query.First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if role != models.CollectionRoleOwner {
+			return ErrForbidden
+		}
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&member).Error; err != nil {
+			return err
+		}
+		return recordLeave(tx, collectionID, []string{member.VaultID})
+	})
+}
@@ -0,0 +1,156 @@
+package sharing
+
+import (
+	"errors"
+	"testing"
+
+	"subvault/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Collection{}, &models.CollectionMember{}, &models.Subscription{}, &models.Credential{}, &models.Memo{}, &models.SyncRemoval{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createUser(t *testing.T, db *gorm.DB, username string) models.User {
+	user := models.User{Username: username, VaultID: "vault-" + username}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func visibleNames(t *testing.T, db *gorm.DB, scope func(*gorm.DB) *gorm.DB) map[string]bool {
+	var subs []models.Subscription
+	if err := db.Scopes(scope).Find(&subs).Error; err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		names[sub.Name] = true
+	}
+	return names
+}
+
+func TestScopesFollowMembershipAndRole(t *testing.T) {
+	db := openTestDB(t)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	carol := createUser(t, db, "carol")
+
+	home, err := Create(db, alice.VaultID, "家庭")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.Subscription{VaultID: alice.VaultID, Name: "personal", Cost: 1})
+	db.Create(&models.Subscription{VaultID: alice.VaultID, Name: "netflix", Cost: 1, CollectionID: &home.ID})
+	db.Create(&models.Subscription{VaultID: bob.VaultID, Name: "bob-own", Cost: 1})
+
+	member, err := AddMember(db, home.ID, alice.VaultID, "BOB", models.CollectionRoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := visibleNames(t, db, Readable(bob.VaultID))
+	if !got["netflix"] || !got["bob-own"] || got["personal"] {
+		t.Fatalf("成员应看到共享订阅和自己的订阅，看不到所有者的个人订阅: %v", got)
+	}
+	if got := visibleNames(t, db, Writable(bob.VaultID)); got["netflix"] {
+		t.Fatal("viewer 不应能修改共享订阅")
+	}
+	if got := visibleNames(t, db, Readable(carol.VaultID)); len(got) != 0 {
+		t.Fatalf("非成员不应看到任何共享订阅: %v", got)
+	}
+
+	if err := UpdateMember(db, home.ID, alice.VaultID, member.ID, models.CollectionRoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	if got := visibleNames(t, db, Writable(bob.VaultID)); !got["netflix"] {
+		t.Fatal("editor 应能修改共享订阅")
+	}
+
+	if err := RemoveMember(db, home.ID, bob.VaultID, member.ID); err != nil {
+		t.Fatalf("成员应能退出集合: %v", err)
+	}
+	if got := visibleNames(t, db, Readable(bob.VaultID)); got["netflix"] {
+		t.Fatal("退出后不应再看到共享订阅")
+	}
+}
+
+func TestOnlyOwnerManagesCollection(t *testing.T) {
+	db := openTestDB(t)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	createUser(t, db, "carol")
+
+	home, _ := Create(db, alice.VaultID, "家庭")
+	if _, err := AddMember(db, home.ID, alice.VaultID, "bob", models.CollectionRoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AddMember(db, home.ID, bob.VaultID, "carol", models.CollectionRoleViewer); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("editor 不应能邀请成员: %v", err)
+	}
+	if _, err := Rename(db, home.ID, bob.VaultID, "改名"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("editor 不应能重命名集合: %v", err)
+	}
+	if err := Delete(db, home.ID, bob.VaultID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("editor 不应能删除集合: %v", err)
+	}
+	if _, err := AddMember(db, home.ID, alice.VaultID, "bob", models.CollectionRoleViewer); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("重复添加应报错: %v", err)
+	}
+	if _, err := AddMember(db, home.ID, alice.VaultID, "alice", models.CollectionRoleViewer); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("所有者不能作为成员加入: %v", err)
+	}
+	if _, err := AddMember(db, home.ID, alice.VaultID, "carol", "admin"); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("未知角色应被拒绝: %v", err)
+	}
+	if _, err := RoleOf(db, home.ID, "vault-carol"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("非成员应看不到集合: %v", err)
+	}
+
+	list, err := List(db, bob.VaultID)
+	if err != nil || len(list) != 1 || list[0].Role != models.CollectionRoleEditor || len(list[0].Members) != 2 {
+		t.Fatalf("成员应能列出集合及成员: %+v %v", list, err)
+	}
+}
+
+func TestDeleteReturnsItemsToCreators(t *testing.T) {
+	db := openTestDB(t)
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+	home, _ := Create(db, alice.VaultID, "家庭")
+	AddMember(db, home.ID, alice.VaultID, "bob", models.CollectionRoleEditor)
+
+	cred := models.Credential{VaultID: bob.VaultID, Label: "wifi", Username: "home", CollectionID: &home.ID}
+	db.Create(&cred)
+
+	if err := Delete(db, home.ID, alice.VaultID); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&cred, "id = ?", cred.ID)
+	if cred.CollectionID != nil || cred.VaultID != bob.VaultID {
+		t.Fatalf("删除集合后记录应退回创建者: %+v", cred)
+	}
+	var members int64
+	db.Model(&models.CollectionMember{}).Count(&members)
+	if members != 0 {
+		t.Fatal("删除集合应同时删除成员")
+	}
+	var removals []models.SyncRemoval
+	db.Find(&removals)
+	if len(removals) != 1 || removals[0].VaultID != alice.VaultID || removals[0].Kind != "credentials" || removals[0].RecordID != cred.ID {
+		t.Fatalf("所有者看不到成员的记录了，应为其记录移除: %+v", removals)
+	}
+}
@@ -0,0 +1,616 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/sharing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewSQL 返回基于 gorm 的实现，可见范围用 sharing.Readable / sharing.Writable 计算
+func NewSQL(db *gorm.DB) *Store {
+	st := &Store{
+		Subscriptions: &sqlSubscriptions{sqlRecords{db: db, kind: "subscriptions", model: func() interface{} { return &models.Subscription{} }, unlink: unlinkSubscriptionTags}},
+		Credentials:   &sqlCredentials{sqlRecords{db: db, kind: "credentials", model: func() interface{} { return &models.Credential{} }, unlink: unlinkCredentials}},
+		Memos:         &sqlMemos{sqlRecords{db: db, kind: "memos", model: func() interface{} { return &models.Memo{} }}},
+		Tags:          &sqlTags{db: db},
+		Settings:      &sqlSettings{db: db},
+		Backups:       &sqlBackups{db: db},
+	}
+	st.Transaction = func(fn func(tx *Store) error) error {
+		return db.Transaction(func(tx *gorm.DB) error { return fn(NewSQL(tx)) })
+	}
+	return st
+}
+
+// notFound 把 gorm 的未找到错误统一为 ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type sqlRecords struct {
+	db *gorm.DB
+	// kind 记录所在的表名，写入增量同步的移除记录
+	kind string
+	// model 每次返回新的模型指针：gorm 会把更新时间、删除时间等回写到传入的模型上，不能在并发请求间共用
+	model func() interface{}
+	// unlink 彻底删除前解除其他表对这些记录的引用，ids 为待删除记录 ID 的子查询
+	unlink func(tx *gorm.DB, ids *gorm.DB) error
+}
+
+func (r sqlRecords) Locate(vaultID, id string) (Placement, error) {
+	var p Placement
+	err := r.db.Model(r.model()).Scopes(sharing.Readable(vaultID)).Select("vault_id", "collection_id").Where("id = ?", id).Take(&p).Error
+	return p, notFound(err)
+}
+
+func (r sqlRecords) SetCollection(id string, collectionID *string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var p Placement
+		err := tx.Model(r.model()).Select("vault_id", "collection_id").Where("id = ?", id).Take(&p).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(r.model()).Where("id = ?", id).Updates(bumpVersion(map[string]interface{}{"collection_id": collectionID})).Error; err != nil {
+			return err
+		}
+		return sharing.RecordMove(tx, r.kind, id, p.VaultID, p.CollectionID, collectionID)
+	})
+}
+
+func (r sqlRecords) SetCategory(vaultID, id, category string) (bool, error) {
+	result := r.db.Model(r.model()).Scopes(sharing.Writable(vaultID)).Where("id = ?", id).Updates(bumpVersion(map[string]interface{}{"category": category}))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r sqlRecords) FillEmptyCategory(vaultID, category string) error {
+	return r.db.Model(r.model()).Where("vault_id = ? AND (category = '' OR category IS NULL)", vaultID).
+		Updates(bumpVersion(map[string]interface{}{"category": category})).Error
+}
+
+func (r sqlRecords) SetAllCategories(vaultID, category string) error {
+	return r.db.Model(r.model()).Where("vault_id = ?", vaultID).Updates(bumpVersion(map[string]interface{}{"category": category})).Error
+}
+
+func (r sqlRecords) Delete(id string) error {
+	return r.db.Where("id = ?", id).Delete(r.model()).Error
+}
+
+func (r sqlRecords) LocateDeleted(vaultID, id string) (Placement, error) {
+	var p Placement
+	err := r.db.Unscoped().Model(r.model()).Scopes(sharing.Writable(vaultID)).Select("vault_id", "collection_id").
+		Where("id = ? AND deleted_at IS NOT NULL", id).Take(&p).Error
+	return p, notFound(err)
+}
+
+func (r sqlRecords) Restore(id string) error {
+	return r.db.Unscoped().Model(r.model()).Where("id = ?", id).Updates(bumpVersion(map[string]interface{}{"deleted_at": nil})).Error
+}
+
+// Purge 彻底删除后回收站中不再有这条记录，为此前能看到它的保险库记录移除，
+// 否则删除之前取得游标、还没同步到删除的客户端会一直保留它
+func (r sqlRecords) Purge(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var p Placement
+		err := tx.Unscoped().Model(r.model()).Select("vault_id", "collection_id").Where("id = ? AND deleted_at IS NOT NULL", id).Take(&p).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		vaults, err := sharing.Audience(tx, p.VaultID, p.CollectionID)
+		if err != nil {
+			return err
+		}
+		if err := sharing.RecordRemovals(tx, r.kind, id, vaults); err != nil {
+			return err
+		}
+		_, err = purge(tx, r.model(), r.unlink, tx.Unscoped().Model(r.model()).Select("id").Where("id = ?", id))
+		return err
+	})
+}
+
+func (r sqlRecords) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	return purge(r.db, r.model(), r.unlink, r.db.Unscoped().Model(r.model()).Select("id").Where("deleted_at < ?", cutoff))
+}
+
+func (r sqlRecords) ListDeletedSince(vaultID string, since time.Time) ([]Tombstone, error) {
+	var out []Tombstone
+	err := r.db.Unscoped().Model(r.model()).Scopes(sharing.Readable(vaultID)).Select("id", "deleted_at").
+		Where("deleted_at > ?", since).Order("deleted_at").Find(&out).Error
+	return out, err
+}
+
+func (r sqlRecords) ListRemovedSince(vaultID string, since time.Time) ([]Tombstone, error) {
+	var out []Tombstone
+	err := r.db.Model(&models.SyncRemoval{}).Select("record_id AS id, created_at AS deleted_at").
+		Where("vault_id = ? AND kind = ? AND created_at > ?", vaultID, r.kind, since).Order("created_at").Scan(&out).Error
+	return out, err
+}
+
+// listChanged 读取 vaultID 可见、since 之后修改过或随加入集合新近可见的记录
+func (r sqlRecords) listChanged(vaultID string, since time.Time, dest interface{}) error {
+	return r.db.Scopes(sharing.Readable(vaultID), sharing.ChangedSince(vaultID, since)).Order("updated_at").Find(dest).Error
+}
+
+// listDeleted 按删除时间倒序读取回收站中 vaultID 可编辑的记录
+func (r sqlRecords) listDeleted(vaultID string, dest interface{}) error {
+	return r.db.Unscoped().Scopes(sharing.Writable(vaultID)).Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(dest).Error
+}
+
+// bumpVersion 在按列更新时同时把版本号加一
+func bumpVersion(columns map[string]interface{}) map[string]interface{} {
+	columns["version"] = gorm.Expr("version + 1")
+	return columns
+}
+
+// saveVersioned 只在数据库中的版本号仍为 *version 时保存 model 的全部字段（不含关联），并把版本号加一。
+// 版本不符或记录已移入回收站时返回 ErrConflict，*version 保持不变
+func saveVersioned(db *gorm.DB, model interface{}, version *int64) error {
+	expected := *version
+	*version = expected + 1
+	result := db.Model(model).Select("*").Omit(clause.Associations).Where("version = ?", expected).Updates(model)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrConflict
+	}
+	if result.Error != nil {
+		*version = expected
+	}
+	return result.Error
+}
+
+// purge 在一个事务内解除引用并彻底删除 ids 子查询选出的记录
+func purge(db *gorm.DB, model interface{}, unlink func(tx *gorm.DB, ids *gorm.DB) error, ids *gorm.DB) (int64, error) {
+	var n int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if unlink != nil {
+			if err := unlink(tx, ids); err != nil {
+				return err
+			}
+		}
+		result := tx.Unscoped().Where("id IN (?)", ids).Delete(model)
+		n = result.RowsAffected
+		return result.Error
+	})
+	return n, err
+}
+
+func unlinkSubscriptionTags(tx *gorm.DB, ids *gorm.DB) error {
+	return tx.Exec("DELETE FROM subscription_tags WHERE subscription_id IN (?)", ids).Error
+}
+
+func unlinkTagSubscriptions(tx *gorm.DB, ids *gorm.DB) error {
+	return tx.Exec("DELETE FROM subscription_tags WHERE tag_id IN (?)", ids).Error
+}
+
+// unlinkCredentials 解除订阅（含回收站中的订阅）对凭证的引用，并删除凭证的历史版本
+func unlinkCredentials(tx *gorm.DB, ids *gorm.DB) error {
+	if err := tx.Unscoped().Model(&models.Subscription{}).Where("credential_id IN (?)", ids).Update("credential_id", nil).Error; err != nil {
+		return err
+	}
+	return tx.Where("credential_id IN (?)", ids).Delete(&models.CredentialHistory{}).Error
+}
+
+// === 订阅 ===
+
+type sqlSubscriptions struct{ sqlRecords }
+
+func (r *sqlSubscriptions) ListReadable(vaultID string) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.db.Scopes(sharing.Readable(vaultID)).Find(&subs).Error
+	return subs, err
+}
+
+func (r *sqlSubscriptions) ListChangedSince(vaultID string, since time.Time) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.listChanged(vaultID, since, &subs)
+	return subs, err
+}
+
+func (r *sqlSubscriptions) ListOwned(vaultID string) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.db.Where("vault_id = ?", vaultID).Find(&subs).Error
+	return subs, err
+}
+
+func (r *sqlSubscriptions) ListAutoRotate() ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.db.Where("auto_rotate = ? AND active = ?", true, true).Find(&subs).Error
+	return subs, err
+}
+
+func (r *sqlSubscriptions) GetReadable(vaultID, id string) (models.Subscription, error) {
+	var sub models.Subscription
+	err := r.db.Scopes(sharing.Readable(vaultID)).Where("id = ?", id).First(&sub).Error
+	return sub, notFound(err)
+}
+
+func (r *sqlSubscriptions) Create(sub *models.Subscription) error {
+	return r.db.Create(sub).Error
+}
+
+func (r *sqlSubscriptions) Save(sub *models.Subscription) error {
+	return saveVersioned(r.db, sub, &sub.Version)
+}
+
+func (r *sqlSubscriptions) ListDeleted(vaultID string) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := r.listDeleted(vaultID, &subs)
+	return subs, err
+}
+
+func (r *sqlSubscriptions) RecordRotation(sub models.Subscription) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(bumpVersion(map[string]interface{}{
+			"start_date":   sub.StartDate,
+			"renewal_date": sub.RenewalDate,
+		})).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RenewalEvent{
+			VaultID:        sub.VaultID,
+			SubscriptionID: sub.ID,
+			Amount:         sub.Cost,
+			Currency:       sub.Currency,
+			OccurredOn:     sub.StartDate,
+			Source:         "rotate",
+		}).Error
+	})
+}
+
+func (r *sqlSubscriptions) RenewalEvents(vaultID string) ([]models.RenewalEvent, error) {
+	var events []models.RenewalEvent
+	err := r.db.Where("vault_id = ?", vaultID).Find(&events).Error
+	return events, err
+}
+
+func (r *sqlSubscriptions) RecordPriceChange(change *models.PriceHistory) error {
+	return r.db.Create(change).Error
+}
+
+func (r *sqlSubscriptions) RecentPriceChanges(vaultID string, limit int) ([]models.PriceHistory, error) {
+	var changes []models.PriceHistory
+	err := r.db.Where("vault_id = ?", vaultID).Order("created_at desc").Limit(limit).Find(&changes).Error
+	return changes, err
+}
+
+// === 凭证 ===
+
+type sqlCredentials struct{ sqlRecords }
+
+func (r *sqlCredentials) ListReadable(vaultID string) ([]models.Credential, error) {
+	var creds []models.Credential
+	err := r.db.Scopes(sharing.Readable(vaultID)).Find(&creds).Error
+	return creds, err
+}
+
+func (r *sqlCredentials) ListChangedSince(vaultID string, since time.Time) ([]models.Credential, error) {
+	var creds []models.Credential
+	err := r.listChanged(vaultID, since, &creds)
+	return creds, err
+}
+
+func (r *sqlCredentials) ListOwned(vaultID string) ([]models.Credential, error) {
+	var creds []models.Credential
+	err := r.db.Where("vault_id = ?", vaultID).Find(&creds).Error
+	return creds, err
+}
+
+func (r *sqlCredentials) GetReadable(vaultID, id string) (models.Credential, error) {
+	var cred models.Credential
+	err := r.db.Scopes(sharing.Readable(vaultID)).Where("id = ?", id).First(&cred).Error
+	return cred, notFound(err)
+}
+
+func (r *sqlCredentials) Create(cred *models.Credential) error {
+	return r.db.Create(cred).Error
+}
+
+func (r *sqlCredentials) Save(cred *models.Credential) error {
+	return saveVersioned(r.db, cred, &cred.Version)
+}
+
+func (r *sqlCredentials) ListDeleted(vaultID string) ([]models.Credential, error) {
+	var creds []models.Credential
+	err := r.listDeleted(vaultID, &creds)
+	return creds, err
+}
+
+func (r *sqlCredentials) SaveWithHistory(cred *models.Credential, previous *models.CredentialHistory, limit int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveVersioned(tx, cred, &cred.Version); err != nil {
+			return err
+		}
+		if err := tx.Create(previous).Error; err != nil {
+			return err
+		}
+		var ids []string
+		err := tx.Model(&models.CredentialHistory{}).Where("credential_id = ?", cred.ID).
+			Order("created_at desc, id desc").Pluck("id", &ids).Error
+		if err != nil || len(ids) <= limit {
+			return err
+		}
+		return tx.Where("id IN ?", ids[limit:]).Delete(&models.CredentialHistory{}).Error
+	})
+}
+
+func (r *sqlCredentials) History(credentialID string) ([]models.CredentialHistory, error) {
+	var entries []models.CredentialHistory
+	err := r.db.Where("credential_id = ?", credentialID).Order("created_at desc, id desc").Find(&entries).Error
+	return entries, err
+}
+
+func (r *sqlCredentials) GetHistory(credentialID, id string) (models.CredentialHistory, error) {
+	var entry models.CredentialHistory
+	err := r.db.Where("id = ? AND credential_id = ?", id, credentialID).First(&entry).Error
+	return entry, notFound(err)
+}
+
+// === 备忘录 ===
+
+type sqlMemos struct{ sqlRecords }
+
+func (r *sqlMemos) ListReadable(vaultID string) ([]models.Memo, error) {
+	var memos []models.Memo
+	err := r.db.Scopes(sharing.Readable(vaultID)).Find(&memos).Error
+	return memos, err
+}
+
+func (r *sqlMemos) ListChangedSince(vaultID string, since time.Time) ([]models.Memo, error) {
+	var memos []models.Memo
+	err := r.listChanged(vaultID, since, &memos)
+	return memos, err
+}
+
+func (r *sqlMemos) GetReadable(vaultID, id string) (models.Memo, error) {
+	var memo models.Memo
+	err := r.db.Scopes(sharing.Readable(vaultID)).Where("id = ?", id).First(&memo).Error
+	return memo, notFound(err)
+}
+
+func (r *sqlMemos) Create(memo *models.Memo) error {
+	return r.db.Create(memo).Error
+}
+
+func (r *sqlMemos) Save(memo *models.Memo) error {
+	return saveVersioned(r.db, memo, &memo.Version)
+}
+
+func (r *sqlMemos) ListDeleted(vaultID string) ([]models.Memo, error) {
+	var memos []models.Memo
+	err := r.listDeleted(vaultID, &memos)
+	return memos, err
+}
+
+// === 分组 ===
+
+type sqlTags struct{ db *gorm.DB }
+
+func (r *sqlTags) List(vaultID string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.db.Where("vault_id = ?", vaultID).Order("created_at asc").Find(&tags).Error
+	return tags, err
+}
+
+func (r *sqlTags) Get(vaultID, id string) (models.Tag, error) {
+	var tag models.Tag
+	err := r.db.Where("id = ? AND vault_id = ?", id, vaultID).First(&tag).Error
+	return tag, notFound(err)
+}
+
+func (r *sqlTags) Create(tag *models.Tag) error {
+	return r.db.Create(tag).Error
+}
+
+func (r *sqlTags) Save(tag *models.Tag) error {
+	return r.db.Save(tag).Error
+}
+
+func (r *sqlTags) Delete(vaultID, id string) (bool, error) {
+	result := r.db.Where("id = ? AND vault_id = ?", id, vaultID).Delete(&models.Tag{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *sqlTags) ListDeleted(vaultID string) ([]models.Tag, error) {
+	var tags []models.Tag
+	err := r.db.Unscoped().Where("vault_id = ? AND deleted_at IS NOT NULL", vaultID).Order("deleted_at desc").Find(&tags).Error
+	return tags, err
+}
+
+func (r *sqlTags) GetDeleted(vaultID, id string) (models.Tag, error) {
+	var tag models.Tag
+	err := r.db.Unscoped().Where("id = ? AND vault_id = ? AND deleted_at IS NOT NULL", id, vaultID).First(&tag).Error
+	return tag, notFound(err)
+}
+
+func (r *sqlTags) Restore(id string) error {
+	return r.db.Unscoped().Model(&models.Tag{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+func (r *sqlTags) Purge(id string) error {
+	_, err := purge(r.db, &models.Tag{}, unlinkTagSubscriptions, r.db.Unscoped().Model(&models.Tag{}).Select("id").Where("id = ? AND deleted_at IS NOT NULL", id))
+	return err
+}
+
+func (r *sqlTags) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	return purge(r.db, &models.Tag{}, unlinkTagSubscriptions, r.db.Unscoped().Model(&models.Tag{}).Select("id").Where("deleted_at < ?", cutoff))
+}
+
+// === 通知设置 ===
+
+type sqlSettings struct{ db *gorm.DB }
+
+func (r *sqlSettings) Get(vaultID string) (models.NotificationSetting, error) {
+	var setting models.NotificationSetting
+	err := r.db.Where("vault_id = ?", vaultID).First(&setting).Error
+	return setting, notFound(err)
+}
+
+func (r *sqlSettings) FindByCalendarToken(token string) (models.NotificationSetting, error) {
+	var setting models.NotificationSetting
+	err := r.db.Where("calendar_token = ?", token).First(&setting).Error
+	return setting, notFound(err)
+}
+
+func (r *sqlSettings) ListWebhookEnabled() ([]models.NotificationSetting, error) {
+	var settings []models.NotificationSetting
+	err := r.db.Where("webhook_enabled = ? AND webhook_url <> ?", true, "").Find(&settings).Error
+	return settings, err
+}
+
+func (r *sqlSettings) Create(setting *models.NotificationSetting) error {
+	return r.db.Create(setting).Error
+}
+
+func (r *sqlSettings) Save(setting *models.NotificationSetting) error {
+	return r.db.Save(setting).Error
+}
+
+// === 整库备份 ===
+
+type sqlBackups struct{ db *gorm.DB }
+
+func (r *sqlBackups) Export(vaultID string) (Snapshot, error) {
+	var snap Snapshot
+	for _, dest := range []interface{}{&snap.Subscriptions, &snap.Credentials, &snap.Memos, &snap.Tags, &snap.PriceHistory, &snap.RenewalEvents} {
+		if err := r.db.Where("vault_id = ?", vaultID).Order("created_at asc").Find(dest).Error; err != nil {
+			return Snapshot{}, err
+		}
+	}
+	var settings models.NotificationSetting
+	err := r.db.Where("vault_id = ?", vaultID).First(&settings).Error
+	if err == nil {
+		snap.Settings = &settings
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+func (r *sqlBackups) Import(vaultID string, snap Snapshot, replace bool) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if replace {
+			if err := wipeVault(tx, vaultID); err != nil {
+				return err
+			}
+		}
+		inactive, settingsDisabled := falseDefaults(snap)
+		if snap.Settings != nil {
+			if err := tx.Where("vault_id = ?", vaultID).Delete(&models.NotificationSetting{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(snap.Settings).Error; err != nil {
+				return err
+			}
+		}
+		// gorm 不接受空切片，逐类跳过没有记录的表
+		batches := []struct {
+			rows interface{}
+			n    int
+		}{
+			{&snap.Tags, len(snap.Tags)},
+			{&snap.Credentials, len(snap.Credentials)},
+			{&snap.Subscriptions, len(snap.Subscriptions)},
+			{&snap.Memos, len(snap.Memos)},
+			{&snap.PriceHistory, len(snap.PriceHistory)},
+			{&snap.RenewalEvents, len(snap.RenewalEvents)},
+		}
+		for _, batch := range batches {
+			if batch.n == 0 {
+				continue
+			}
+			if err := tx.Omit(clause.Associations).Create(batch.rows).Error; err != nil {
+				return err
+			}
+		}
+		if len(inactive) > 0 {
+			if err := tx.Model(&models.Subscription{}).Where("id IN ?", inactive).UpdateColumn("active", false).Error; err != nil {
+				return err
+			}
+		}
+		if settingsDisabled {
+			return tx.Model(&models.NotificationSetting{}).Where("id = ?", snap.Settings.ID).UpdateColumn("enabled", false).Error
+		}
+		return nil
+	})
+}
+
+// falseDefaults 记下带 default:true 的布尔字段中为 false 的记录。
+// gorm 插入时会把这些 false 换成默认值并回写到结构体上，所以要在插入前记录，插入后再补写回去
+func falseDefaults(snap Snapshot) (inactive []string, settingsDisabled bool) {
+	for _, sub := range snap.Subscriptions {
+		sub.NormalizeStatus()
+		if !sub.Active {
+			inactive = append(inactive, sub.ID)
+		}
+	}
+	return inactive, snap.Settings != nil && !snap.Settings.Enabled
+}
+
+// wipeVault 彻底删除保险库自己的订阅、凭证、备忘录、分组（含回收站）及调价、续费记录。
+// 与 Purge 一样，先为能看到这些记录的保险库（含共享集合的成员）记录移除，增量同步才能通知它们的客户端
+func wipeVault(tx *gorm.DB, vaultID string) error {
+	owned := func(model interface{}) *gorm.DB {
+		return tx.Unscoped().Model(model).Select("id").Where("vault_id = ?", vaultID)
+	}
+	for _, kind := range []struct {
+		name  string
+		model interface{}
+	}{
+		{"subscriptions", &models.Subscription{}},
+		{"credentials", &models.Credential{}},
+		{"memos", &models.Memo{}},
+	} {
+		if err := recordWipe(tx, kind.name, kind.model, vaultID); err != nil {
+			return err
+		}
+	}
+	if _, err := purge(tx, &models.Subscription{}, unlinkSubscriptionTags, owned(&models.Subscription{})); err != nil {
+		return err
+	}
+	if _, err := purge(tx, &models.Credential{}, unlinkCredentials, owned(&models.Credential{})); err != nil {
+		return err
+	}
+	if _, err := purge(tx, &models.Memo{}, nil, owned(&models.Memo{})); err != nil {
+		return err
+	}
+	if _, err := purge(tx, &models.Tag{}, unlinkTagSubscriptions, owned(&models.Tag{})); err != nil {
+		return err
+	}
+	if err := tx.Where("vault_id = ?", vaultID).Delete(&models.PriceHistory{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("vault_id = ?", vaultID).Delete(&models.RenewalEvent{}).Error
+}
+
+// recordWipe 为保险库自己的 kind 记录（含回收站）逐条记录移除
+func recordWipe(tx *gorm.DB, kind string, model interface{}, vaultID string) error {
+	var records []struct {
+		ID           string
+		CollectionID *string
+	}
+	if err := tx.Unscoped().Model(model).Select("id", "collection_id").Where("vault_id = ?", vaultID).Scan(&records).Error; err != nil {
+		return err
+	}
+	for _, record := range records {
+		vaults, err := sharing.Audience(tx, vaultID, record.CollectionID)
+		if err != nil {
+			return err
+		}
+		if err := sharing.RecordRemovals(tx, kind, record.ID, vaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package store 定义订阅、凭证、备忘录、分组和通知设置的存取接口。
+// 处理器和后台任务通过构造函数拿到 Store，不直接访问数据库；
+// SQL 实现见 NewSQL，测试用的内存实现见 storetest 包。
+package store
+
+import (
+	"errors"
+	"time"
+
+	"subvault/internal/models"
+)
+
+var (
+	// ErrNotFound 记录不存在，或对当前保险库不可见
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict 保存时记录已被修改（版本号与读取时不同）、已移入回收站或不存在
+	ErrConflict = errors.New("record version conflict")
+)
+
+// Store 汇总各类记录的存取接口
+type Store struct {
+	Subscriptions SubscriptionRepository
+	Credentials   CredentialRepository
+	Memos         MemoRepository
+	Tags          TagRepository
+	Settings      SettingsRepository
+	Backups       BackupRepository
+	// Transaction 在一个事务中执行 fn，fn 内须通过参数 tx 存取；fn 返回错误时全部回滚
+	Transaction func(fn func(tx *Store) error) error
+}
+
+// Placement 记录的归属：创建者的保险库和所在共享集合（空表示个人数据）
+type Placement struct {
+	VaultID      string
+	CollectionID *string
+}
+
+// Tombstone 移入回收站或不再可见的记录，供增量同步通知客户端删除
+type Tombstone struct {
+	ID        string
+	DeletedAt time.Time
+}
+
+// Records 订阅、凭证、备忘录共有的操作。
+// “可见”指自己保险库的记录加上所在共享集合中的记录，“可编辑”只算以 owner/editor 身份共享的记录，规则与 sharing 包一致。
+// 删除是软删除：记录移入回收站，除 *Deleted 方法和 Restore、Purge 外的操作都看不到回收站中的记录。
+// 记录的 Version 在每次修改时加一：Save 只在版本号与读取时相同时写入，其余修改记录的方法直接加一。
+type Records interface {
+	// Locate 返回 vaultID 可见的记录的归属，不可见时返回 ErrNotFound
+	Locate(vaultID, id string) (Placement, error)
+	// SetCollection 把记录移入共享集合，collectionID 为 nil 时移回个人保险库；因此看不到记录的保险库记录移除
+	SetCollection(id string, collectionID *string) error
+	// SetCategory 修改 vaultID 可编辑的记录的分组，只读共享或不可见的记录返回 false
+	SetCategory(vaultID, id, category string) (bool, error)
+	// FillEmptyCategory 把保险库中未分组的记录归入 category
+	FillEmptyCategory(vaultID, category string) error
+	// SetAllCategories 把保险库中全部记录归入 category，仅用于首次建立默认分组
+	SetAllCategories(vaultID, category string) error
+	// Delete 把记录移入回收站
+	Delete(id string) error
+	// LocateDeleted 返回回收站中 vaultID 可编辑的记录的归属，不存在时返回 ErrNotFound
+	LocateDeleted(vaultID, id string) (Placement, error)
+	// Restore 把记录移出回收站
+	Restore(id string) error
+	// Purge 彻底删除回收站中的记录，并为能看到它的保险库记录移除
+	Purge(id string) error
+	// PurgeDeletedBefore 彻底删除所有保险库中在 cutoff 之前移入回收站的记录，返回删除条数
+	PurgeDeletedBefore(cutoff time.Time) (int64, error)
+	// ListDeletedSince 返回 since 之后移入回收站、vaultID 可见的记录。
+	// 与 ListDeleted 不同，只读共享的记录也包含在内：只读成员同样需要得知记录已删除
+	ListDeletedSince(vaultID string, since time.Time) ([]Tombstone, error)
+	// ListRemovedSince 返回 since 之后从 vaultID 视野中消失、回收站里查不到的记录：
+	// 移出共享集合、被移出或退出集合、集合被删除、彻底删除。DeletedAt 为消失的时间
+	ListRemovedSince(vaultID string, since time.Time) ([]Tombstone, error)
+}
+
+// SubscriptionRepository 订阅及其续费、调价记录
+type SubscriptionRepository interface {
+	Records
+	// ListReadable 返回 vaultID 可见的全部订阅
+	ListReadable(vaultID string) ([]models.Subscription, error)
+	// ListChangedSince 返回 vaultID 可见、在 since 之后创建或修改过的订阅，以及 since 之后加入的集合中的订阅
+	ListChangedSince(vaultID string, since time.Time) ([]models.Subscription, error)
+	// ListOwned 只返回保险库自己的订阅，不含共享
+	ListOwned(vaultID string) ([]models.Subscription, error)
+	// ListAutoRotate 返回所有保险库中开启自动续期的有效订阅
+	ListAutoRotate() ([]models.Subscription, error)
+	GetReadable(vaultID, id string) (models.Subscription, error)
+	Create(sub *models.Subscription) error
+	// Save 保存全部字段（不含标签关联）并把 sub.Version 加一；数据库中的版本已不是 sub.Version 时返回 ErrConflict
+	Save(sub *models.Subscription) error
+	// ListDeleted 按删除时间倒序返回回收站中 vaultID 可编辑的订阅
+	ListDeleted(vaultID string) ([]models.Subscription, error)
+	// RecordRotation 保存轮转后的起止日期并记一笔续费
+	RecordRotation(sub models.Subscription) error
+	RenewalEvents(vaultID string) ([]models.RenewalEvent, error)
+	RecordPriceChange(change *models.PriceHistory) error
+	// RecentPriceChanges 按时间倒序返回最近 limit 条调价记录
+	RecentPriceChanges(vaultID string, limit int) ([]models.PriceHistory, error)
+}
+
+// CredentialRepository 凭证，密码和备注以密文读写
+type CredentialRepository interface {
+	Records
+	ListReadable(vaultID string) ([]models.Credential, error)
+	ListChangedSince(vaultID string, since time.Time) ([]models.Credential, error)
+	ListOwned(vaultID string) ([]models.Credential, error)
+	GetReadable(vaultID, id string) (models.Credential, error)
+	Create(cred *models.Credential) error
+	// Save 与 SubscriptionRepository.Save 相同，按版本号保存
+	Save(cred *models.Credential) error
+	// ListDeleted 按删除时间倒序返回回收站中 vaultID 可编辑的凭证。
+	// 在回收站中的凭证仍保留订阅关联和历史版本，以便恢复；Purge 时才解除引用它的订阅关联（共享凭证可能被其他成员的订阅引用）并删除历史版本
+	ListDeleted(vaultID string) ([]models.Credential, error)
+	// SaveWithHistory 在一个事务内按版本号保存凭证并追加一条历史版本，该凭证只保留最近 limit 条历史
+	SaveWithHistory(cred *models.Credential, previous *models.CredentialHistory, limit int) error
+	// History 按被替换的时间倒序返回凭证的历史版本
+	History(credentialID string) ([]models.CredentialHistory, error)
+	GetHistory(credentialID, id string) (models.CredentialHistory, error)
+}
+
+// MemoRepository 备忘录，内容以密文读写
+type MemoRepository interface {
+	Records
+	ListReadable(vaultID string) ([]models.Memo, error)
+	ListChangedSince(vaultID string, since time.Time) ([]models.Memo, error)
+	GetReadable(vaultID, id string) (models.Memo, error)
+	Create(memo *models.Memo) error
+	// Save 按版本号保存，见 SubscriptionRepository.Save
+	Save(memo *models.Memo) error
+	ListDeleted(vaultID string) ([]models.Memo, error)
+}
+
+// TagRepository 分组，删除同样是软删除
+type TagRepository interface {
+	// List 按创建时间返回保险库的全部分组
+	List(vaultID string) ([]models.Tag, error)
+	Get(vaultID, id string) (models.Tag, error)
+	Create(tag *models.Tag) error
+	Save(tag *models.Tag) error
+	// Delete 把保险库的分组移入回收站，不存在时返回 false
+	Delete(vaultID, id string) (bool, error)
+	// ListDeleted 按删除时间倒序返回回收站中的分组
+	ListDeleted(vaultID string) ([]models.Tag, error)
+	GetDeleted(vaultID, id string) (models.Tag, error)
+	Restore(id string) error
+	// Purge 彻底删除回收站中的分组及其与订阅的关联
+	Purge(id string) error
+	PurgeDeletedBefore(cutoff time.Time) (int64, error)
+}
+
+// SettingsRepository 通知设置，每个保险库至多一条
+type SettingsRepository interface {
+	Get(vaultID string) (models.NotificationSetting, error)
+	FindByCalendarToken(token string) (models.NotificationSetting, error)
+	// ListWebhookEnabled 返回启用了 Webhook 且填写了地址的设置
+	ListWebhookEnabled() ([]models.NotificationSetting, error)
+	Create(setting *models.NotificationSetting) error
+	Save(setting *models.NotificationSetting) error
+}
+
+// Snapshot 保险库自己的全部数据，不含共享给它的记录和回收站；密码、备注和备忘录内容保持密文
+type Snapshot struct {
+	Subscriptions []models.Subscription
+	Credentials   []models.Credential
+	Memos         []models.Memo
+	Tags          []models.Tag
+	Settings      *models.NotificationSetting // 未保存过通知设置时为 nil
+	PriceHistory  []models.PriceHistory
+	RenewalEvents []models.RenewalEvent
+}
+
+// BackupRepository 整库备份的读取和写入
+type BackupRepository interface {
+	Export(vaultID string) (Snapshot, error)
+	// Import 在一个事务内写入 snap 中的记录，ID 由调用方确定。
+	// replace 为 true 时先彻底删除保险库自己的数据（含回收站）；snap.Settings 非空时替换保险库的通知设置
+	Import(vaultID string, snap Snapshot, replace bool) error
+}
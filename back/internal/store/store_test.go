@@ -0,0 +1,682 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/store"
+	"subvault/internal/store/storetest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// backend 一种 store 实现，share 让 vaultID 成为 bob 所建集合 collectionID 的成员
+type backend struct {
+	st    *store.Store
+	share func(t *testing.T, vaultID, collectionID string, editable bool)
+}
+
+func sqlBackend(t *testing.T) backend {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Collection{}, &models.CollectionMember{}, &models.Subscription{}, &models.Credential{}, &models.CredentialHistory{},
+		&models.Memo{}, &models.Tag{}, &models.NotificationSetting{}, &models.RenewalEvent{}, &models.PriceHistory{}, &models.SyncRemoval{}); err != nil {
+		t.Fatal(err)
+	}
+	share := func(t *testing.T, vaultID, collectionID string, editable bool) {
+		role := models.CollectionRoleViewer
+		if editable {
+			role = models.CollectionRoleEditor
+		}
+		if err := db.Where("id = ?", collectionID).FirstOrCreate(&models.Collection{ID: collectionID, OwnerVaultID: "bob", Name: collectionID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		db.Where("collection_id = ? AND vault_id = ?", collectionID, vaultID).Delete(&models.CollectionMember{})
+		if err := db.Create(&models.CollectionMember{CollectionID: collectionID, VaultID: vaultID, Role: role}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return backend{st: store.NewSQL(db), share: share}
+}
+
+func memoryBackend(t *testing.T) backend {
+	mem := storetest.New()
+	return backend{st: mem.Store(), share: func(_ *testing.T, vaultID, collectionID string, editable bool) {
+		mem.Share(vaultID, collectionID, editable)
+	}}
+}
+
+// forEachBackend 对 SQL 实现和内存实现运行同一组用例，保证两者行为一致
+func forEachBackend(t *testing.T, fn func(t *testing.T, b backend)) {
+	t.Run("sql", func(t *testing.T) { fn(t, sqlBackend(t)) })
+	t.Run("memory", func(t *testing.T) { fn(t, memoryBackend(t)) })
+}
+
+func ptr(s string) *string { return &s }
+
+func TestSubscriptionSharingScopes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		subs := b.st.Subscriptions
+		own := models.Subscription{VaultID: "alice", Name: "Netflix", Cost: 15, Category: "娱乐", Status: "active"}
+		shared := models.Subscription{VaultID: "bob", Name: "水电", Cost: 200, Category: "生活", Status: "active", CollectionID: ptr("family")}
+		for _, sub := range []*models.Subscription{&own, &shared} {
+			if err := subs.Create(sub); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if own.ID == "" {
+			t.Fatal("创建后应生成 ID")
+		}
+
+		list, _ := subs.ListReadable("alice")
+		if len(list) != 1 {
+			t.Fatalf("未加入集合时只能看到自己的订阅，实际 %d 条", len(list))
+		}
+		if _, err := subs.GetReadable("alice", shared.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("不可见的订阅应返回 ErrNotFound，实际 %v", err)
+		}
+
+		b.share(t, "alice", "family", false)
+		list, _ = subs.ListReadable("alice")
+		if len(list) != 2 {
+			t.Fatalf("加入集合后应看到共享订阅，实际 %d 条", len(list))
+		}
+		owned, _ := subs.ListOwned("alice")
+		if len(owned) != 1 || owned[0].ID != own.ID {
+			t.Fatalf("ListOwned 不应包含共享订阅: %+v", owned)
+		}
+		place, err := subs.Locate("alice", shared.ID)
+		if err != nil || place.VaultID != "bob" || place.CollectionID == nil || *place.CollectionID != "family" {
+			t.Fatalf("Locate 应返回创建者和集合: %+v %v", place, err)
+		}
+
+		if ok, _ := subs.SetCategory("alice", shared.ID, "家庭"); ok {
+			t.Fatal("只读成员不应能修改分组")
+		}
+		b.share(t, "alice", "family", true)
+		if ok, _ := subs.SetCategory("alice", shared.ID, "家庭"); !ok {
+			t.Fatal("编辑者应能修改分组")
+		}
+		got, _ := subs.GetReadable("bob", shared.ID)
+		if got.Category != "家庭" {
+			t.Fatalf("分组未保存: %q", got.Category)
+		}
+
+		if err := subs.SetCollection(shared.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := subs.GetReadable("alice", shared.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("移回个人保险库后其他成员不应再可见")
+		}
+	})
+}
+
+func TestSubscriptionSaveAndHistory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		subs := b.st.Subscriptions
+		sub := models.Subscription{VaultID: "alice", Name: "iCloud", Cost: 6, Currency: "CNY", Category: "工具", Status: "active",
+			FrequencyAmount: 1, FrequencyUnit: "MONTHS", AutoRotate: true, RenewalDate: "2024-01-01"}
+		if err := subs.Create(&sub); err != nil {
+			t.Fatal(err)
+		}
+		sub.Cost = 21
+		sub.Status = "paused"
+		if err := subs.Save(&sub); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := subs.GetReadable("alice", sub.ID)
+		if got.Cost != 21 || got.Active {
+			t.Fatalf("Save 未保存全部字段: %+v", got)
+		}
+		if rotating, _ := subs.ListAutoRotate(); len(rotating) != 0 {
+			t.Fatal("暂停的订阅不应参与自动续期")
+		}
+
+		sub.StartDate, sub.RenewalDate = "2024-01-01", "2024-02-01"
+		if err := subs.RecordRotation(sub); err != nil {
+			t.Fatal(err)
+		}
+		got, _ = subs.GetReadable("alice", sub.ID)
+		events, _ := subs.RenewalEvents("alice")
+		if got.RenewalDate != "2024-02-01" || len(events) != 1 || events[0].Amount != 21 || events[0].OccurredOn != "2024-01-01" {
+			t.Fatalf("轮转结果不正确: %+v %+v", got, events)
+		}
+
+		for _, cost := range []float64{25, 30, 35} {
+			if err := subs.RecordPriceChange(&models.PriceHistory{VaultID: "alice", SubscriptionID: sub.ID, NewCost: cost}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		recent, _ := subs.RecentPriceChanges("alice", 2)
+		if len(recent) != 2 || recent[0].NewCost != 35 || recent[1].NewCost != 30 {
+			t.Fatalf("调价记录应按时间倒序并限制条数: %+v", recent)
+		}
+
+		if err := subs.Delete(sub.ID); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := subs.ListOwned("alice"); len(list) != 0 {
+			t.Fatal("删除后不应再返回")
+		}
+	})
+}
+
+func TestCredentialPurgeUnlinksSubscriptions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		cred := models.Credential{VaultID: "alice", Label: "Netflix", Username: "a@example.com", Category: "娱乐"}
+		if err := b.st.Credentials.Create(&cred); err != nil {
+			t.Fatal(err)
+		}
+		sub := models.Subscription{VaultID: "alice", Name: "Netflix", Category: "娱乐", Status: "active", CredentialID: ptr(cred.ID)}
+		if err := b.st.Subscriptions.Create(&sub); err != nil {
+			t.Fatal(err)
+		}
+
+		cred.Password = "ciphertext"
+		if err := b.st.Credentials.Save(&cred); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := b.st.Credentials.GetReadable("alice", cred.ID)
+		if got.Password != "ciphertext" {
+			t.Fatalf("密文未保存: %q", got.Password)
+		}
+
+		if err := b.st.Credentials.Delete(cred.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.st.Credentials.GetReadable("alice", cred.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("回收站中的凭证不应再可见")
+		}
+		linked, _ := b.st.Subscriptions.GetReadable("alice", sub.ID)
+		if linked.CredentialID == nil {
+			t.Fatal("移入回收站时应保留订阅关联，以便恢复")
+		}
+
+		if err := b.st.Credentials.Purge(cred.ID); err != nil {
+			t.Fatal(err)
+		}
+		linked, _ = b.st.Subscriptions.GetReadable("alice", sub.ID)
+		if linked.CredentialID != nil {
+			t.Fatal("彻底删除凭证后订阅应解除关联")
+		}
+	})
+}
+
+func TestCredentialHistoryKeepsNewest(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		cred := models.Credential{VaultID: "alice", Label: "GitHub", Password: "v0"}
+		if err := b.st.Credentials.Create(&cred); err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 3; i++ {
+			previous := &models.CredentialHistory{VaultID: "alice", CredentialID: cred.ID, Password: cred.Password}
+			cred.Password = "v" + string(rune('0'+i))
+			if err := b.st.Credentials.SaveWithHistory(&cred, previous, 2); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		got, _ := b.st.Credentials.GetReadable("alice", cred.ID)
+		if got.Password != "v3" {
+			t.Fatalf("凭证应保存最新值，实际 %q", got.Password)
+		}
+		entries, err := b.st.Credentials.History(cred.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Password != "v2" || entries[1].Password != "v1" {
+			t.Fatalf("应按时间倒序保留最近 2 条历史: %+v", entries)
+		}
+		if _, err := b.st.Credentials.GetHistory("other", entries[0].ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("历史版本应只能按所属凭证读取")
+		}
+
+		b.st.Credentials.Delete(cred.ID)
+		if entries, _ := b.st.Credentials.History(cred.ID); len(entries) != 2 {
+			t.Fatal("移入回收站时应保留历史版本")
+		}
+		if err := b.st.Credentials.Purge(cred.ID); err != nil {
+			t.Fatal(err)
+		}
+		if entries, _ := b.st.Credentials.History(cred.ID); len(entries) != 0 {
+			t.Fatalf("彻底删除凭证后历史版本应一并删除: %+v", entries)
+		}
+	})
+}
+
+func TestMemoCategories(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		memo := models.Memo{VaultID: "alice", Title: "Wi-Fi", Category: "生活"}
+		if err := b.st.Memos.Create(&memo); err != nil {
+			t.Fatal(err)
+		}
+		memo.Category = ""
+		if err := b.st.Memos.Save(&memo); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.st.Memos.FillEmptyCategory("alice", "默认"); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := b.st.Memos.GetReadable("alice", memo.ID)
+		if got.Category != "默认" {
+			t.Fatalf("未分组的备忘录应归入默认分组: %q", got.Category)
+		}
+		if err := b.st.Memos.SetAllCategories("alice", "其他"); err != nil {
+			t.Fatal(err)
+		}
+		list, _ := b.st.Memos.ListReadable("alice")
+		if len(list) != 1 || list[0].Category != "其他" {
+			t.Fatalf("SetAllCategories 未生效: %+v", list)
+		}
+	})
+}
+
+func TestTagsScopedToVault(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		tags := b.st.Tags
+		for _, name := range []string{"默认", "工作"} {
+			if err := tags.Create(&models.Tag{VaultID: "alice", Name: name, Color: "#3B82F6"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		list, _ := tags.List("alice")
+		if len(list) != 2 || list[0].Name != "默认" {
+			t.Fatalf("分组应按创建时间排列: %+v", list)
+		}
+		if _, err := tags.Get("bob", list[1].ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("不应读到其他保险库的分组")
+		}
+		if ok, _ := tags.Delete("bob", list[1].ID); ok {
+			t.Fatal("不应删除其他保险库的分组")
+		}
+
+		list[1].Color = "#EF4444"
+		if err := tags.Save(&list[1]); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := tags.Get("alice", list[1].ID)
+		if got.Color != "#EF4444" {
+			t.Fatalf("颜色未保存: %q", got.Color)
+		}
+		if ok, _ := tags.Delete("alice", got.ID); !ok {
+			t.Fatal("应能删除自己的分组")
+		}
+	})
+}
+
+func TestNotificationSettings(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		settings := b.st.Settings
+		if _, err := settings.Get("alice"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("未保存时应返回 ErrNotFound，实际 %v", err)
+		}
+		setting := models.NotificationSetting{VaultID: "alice", Enabled: true, CalendarToken: "token-a", BaseCurrency: "CNY"}
+		if err := settings.Create(&setting); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := settings.FindByCalendarToken("token-a"); err != nil || got.VaultID != "alice" {
+			t.Fatalf("应能按日历令牌找到设置: %+v %v", got, err)
+		}
+		if enabled, _ := settings.ListWebhookEnabled(); len(enabled) != 0 {
+			t.Fatal("未启用 Webhook 时不应返回")
+		}
+
+		setting.WebhookEnabled = true
+		setting.WebhookURL = "https://hooks.example.com/a"
+		if err := settings.Save(&setting); err != nil {
+			t.Fatal(err)
+		}
+		enabled, _ := settings.ListWebhookEnabled()
+		if len(enabled) != 1 || enabled[0].WebhookURL != setting.WebhookURL {
+			t.Fatalf("启用 Webhook 后应返回: %+v", enabled)
+		}
+	})
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		memos := b.st.Memos
+		own := models.Memo{VaultID: "alice", Title: "门禁密码", Category: "生活"}
+		shared := models.Memo{VaultID: "bob", Title: "家庭 Wi-Fi", Category: "生活", CollectionID: ptr("family")}
+		for _, memo := range []*models.Memo{&own, &shared} {
+			if err := memos.Create(memo); err != nil {
+				t.Fatal(err)
+			}
+			if err := memos.Delete(memo.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if list, _ := memos.ListReadable("alice"); len(list) != 0 {
+			t.Fatalf("回收站中的记录不应出现在列表中: %+v", list)
+		}
+		if ok, _ := memos.SetCategory("alice", own.ID, "工作"); ok {
+			t.Fatal("回收站中的记录不应能修改")
+		}
+
+		// 只读成员看不到共享记录的回收站，编辑者可以
+		b.share(t, "alice", "family", false)
+		if deleted, _ := memos.ListDeleted("alice"); len(deleted) != 1 || deleted[0].ID != own.ID {
+			t.Fatalf("只读成员的回收站只应有自己的记录: %+v", deleted)
+		}
+		if _, err := memos.LocateDeleted("alice", shared.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("只读成员不应能恢复共享记录")
+		}
+		b.share(t, "alice", "family", true)
+		if deleted, _ := memos.ListDeleted("alice"); len(deleted) != 2 || deleted[0].ID != shared.ID {
+			t.Fatalf("回收站应按删除时间倒序列出可编辑的记录: %+v", deleted)
+		}
+
+		if _, err := memos.LocateDeleted("alice", own.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := memos.Restore(own.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := memos.GetReadable("alice", own.ID); err != nil || got.Title != own.Title {
+			t.Fatalf("恢复后应重新可见: %+v %v", got, err)
+		}
+		if _, err := memos.LocateDeleted("alice", own.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("恢复后不应再在回收站中")
+		}
+
+		if n, _ := memos.PurgeDeletedBefore(time.Now().Add(-time.Hour)); n != 0 {
+			t.Fatalf("未到保留期的记录不应清除，实际清除 %d 条", n)
+		}
+		if n, _ := memos.PurgeDeletedBefore(time.Now().Add(time.Second)); n != 1 {
+			t.Fatalf("应清除回收站中的 1 条记录，实际 %d", n)
+		}
+		if deleted, _ := memos.ListDeleted("bob"); len(deleted) != 0 {
+			t.Fatal("彻底删除后回收站应为空")
+		}
+		if _, err := memos.GetReadable("alice", own.ID); err != nil {
+			t.Fatal("清除回收站不应影响已恢复的记录")
+		}
+	})
+}
+
+func TestTagTrash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		tags := b.st.Tags
+		tag := models.Tag{VaultID: "alice", Name: "工作"}
+		if err := tags.Create(&tag); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := tags.Delete("alice", tag.ID); !ok {
+			t.Fatal("应能删除分组")
+		}
+		if ok, _ := tags.Delete("alice", tag.ID); ok {
+			t.Fatal("已在回收站中的分组不应再次删除")
+		}
+		if _, err := tags.GetDeleted("bob", tag.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatal("不应读到其他保险库回收站中的分组")
+		}
+		if err := tags.Restore(tag.ID); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := tags.List("alice"); len(list) != 1 {
+			t.Fatalf("恢复后应重新出现在列表中: %+v", list)
+		}
+
+		tags.Delete("alice", tag.ID)
+		if err := tags.Purge(tag.ID); err != nil {
+			t.Fatal(err)
+		}
+		if deleted, _ := tags.ListDeleted("alice"); len(deleted) != 0 {
+			t.Fatal("彻底删除后回收站应为空")
+		}
+	})
+}
+
+func TestBackupExportAndReplace(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		sub := models.Subscription{VaultID: "alice", Name: "Netflix", Status: "paused"}
+		b.st.Subscriptions.Create(&sub)
+		b.st.Subscriptions.RecordPriceChange(&models.PriceHistory{VaultID: "alice", SubscriptionID: sub.ID, OldCost: 10, NewCost: 15})
+		trashed := models.Memo{VaultID: "alice", Title: "旧备忘录"}
+		b.st.Memos.Create(&trashed)
+		b.st.Memos.Delete(trashed.ID)
+		b.st.Settings.Create(&models.NotificationSetting{VaultID: "alice", BaseCurrency: "USD", CalendarToken: "token"})
+		bobs := models.Credential{VaultID: "bob", Label: "GitHub"}
+		b.st.Credentials.Create(&bobs)
+
+		snap, err := b.st.Backups.Export("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snap.Subscriptions) != 1 || len(snap.Memos) != 0 || len(snap.Credentials) != 0 || len(snap.PriceHistory) != 1 ||
+			snap.Settings == nil || snap.Settings.BaseCurrency != "USD" {
+			t.Fatalf("导出应只含 alice 自己且不在回收站中的数据: %+v", snap)
+		}
+
+		settings := *snap.Settings
+		settings.BaseCurrency, settings.Enabled = "EUR", false
+		replacement := store.Snapshot{
+			Credentials: []models.Credential{{ID: "c1", VaultID: "alice", Label: "Wi-Fi"}},
+			Settings:    &settings,
+		}
+		if err := b.st.Backups.Import("alice", replacement, true); err != nil {
+			t.Fatal(err)
+		}
+
+		after, _ := b.st.Backups.Export("alice")
+		if len(after.Subscriptions) != 0 || len(after.PriceHistory) != 0 || len(after.Credentials) != 1 || after.Credentials[0].ID != "c1" {
+			t.Fatalf("替换导入后应只剩导入的记录: %+v", after)
+		}
+		if after.Settings == nil || after.Settings.BaseCurrency != "EUR" || after.Settings.Enabled {
+			t.Fatalf("通知设置应被替换: %+v", after.Settings)
+		}
+		if deleted, _ := b.st.Memos.ListDeleted("alice"); len(deleted) != 0 {
+			t.Fatal("替换导入应清空回收站")
+		}
+		if _, err := b.st.Credentials.GetReadable("bob", bobs.ID); err != nil {
+			t.Fatal("不应影响其他保险库的数据")
+		}
+
+		// 清除的记录为能看到它的保险库记录移除，包括共享集合的成员
+		shared := models.Memo{VaultID: "alice", Title: "门锁密码", CollectionID: ptr("family")}
+		b.st.Memos.Create(&shared)
+		b.share(t, "carol", "family", false)
+		since := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		if err := b.st.Backups.Import("alice", store.Snapshot{}, true); err != nil {
+			t.Fatal(err)
+		}
+		for _, vaultID := range []string{"alice", "carol"} {
+			removed, _ := b.st.Memos.ListRemovedSince(vaultID, since)
+			if len(removed) != 1 || removed[0].ID != shared.ID {
+				t.Fatalf("%s 应收到替换导入清除的备忘录: %+v", vaultID, removed)
+			}
+		}
+	})
+}
+
+func TestTransactionRollsBack(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		kept := models.Credential{VaultID: "alice", Label: "GitHub", Category: "工作"}
+		b.st.Credentials.Create(&kept)
+
+		failed := errors.New("中途失败")
+		err := b.st.Transaction(func(tx *store.Store) error {
+			if err := tx.Credentials.Create(&models.Credential{VaultID: "alice", Label: "Wi-Fi"}); err != nil {
+				return err
+			}
+			if err := tx.Tags.Create(&models.Tag{VaultID: "alice", Name: "家庭"}); err != nil {
+				return err
+			}
+			if _, err := tx.Credentials.SetCategory("alice", kept.ID, "家庭"); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("应返回 fn 的错误: %v", err)
+		}
+		creds, _ := b.st.Credentials.ListOwned("alice")
+		tags, _ := b.st.Tags.List("alice")
+		if len(creds) != 1 || creds[0].Category != "工作" || len(tags) != 0 {
+			t.Fatalf("出错后应全部回滚: %+v %+v", creds, tags)
+		}
+
+		if err := b.st.Transaction(func(tx *store.Store) error {
+			return tx.Credentials.Create(&models.Credential{VaultID: "alice", Label: "Wi-Fi"})
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if creds, _ := b.st.Credentials.ListOwned("alice"); len(creds) != 2 {
+			t.Fatalf("成功时应提交: %d 条", len(creds))
+		}
+	})
+}
+
+func TestSaveChecksVersion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		memo := models.Memo{VaultID: "alice", Title: "Wi-Fi", Category: "家庭"}
+		b.st.Memos.Create(&memo)
+		if memo.Version != 1 {
+			t.Fatalf("新记录的版本号应为 1: %d", memo.Version)
+		}
+
+		first, _ := b.st.Memos.GetReadable("alice", memo.ID)
+		second, _ := b.st.Memos.GetReadable("alice", memo.ID)
+		first.Title = "客厅 Wi-Fi"
+		if err := b.st.Memos.Save(&first); err != nil || first.Version != 2 {
+			t.Fatalf("保存后版本号应加一: %d %v", first.Version, err)
+		}
+		second.Title = "书房 Wi-Fi"
+		if err := b.st.Memos.Save(&second); !errors.Is(err, store.ErrConflict) || second.Version != 1 {
+			t.Fatalf("基于旧版本保存应返回 ErrConflict 且不改动版本号: %d %v", second.Version, err)
+		}
+		if got, _ := b.st.Memos.GetReadable("alice", memo.ID); got.Title != "客厅 Wi-Fi" {
+			t.Fatalf("冲突时不应覆盖: %s", got.Title)
+		}
+
+		// 调整分组等按列修改同样使版本号加一
+		b.st.Memos.SetCategory("alice", memo.ID, "工作")
+		if got, _ := b.st.Memos.GetReadable("alice", memo.ID); got.Version != 3 {
+			t.Fatalf("调整分组后版本号应加一: %d", got.Version)
+		}
+		if err := b.st.Memos.Save(&first); !errors.Is(err, store.ErrConflict) {
+			t.Fatalf("分组调整后旧版本应冲突: %v", err)
+		}
+
+		b.st.Memos.Delete(memo.ID)
+		current := first
+		current.Version = 3
+		if err := b.st.Memos.Save(&current); !errors.Is(err, store.ErrConflict) {
+			t.Fatalf("回收站中的记录不能保存: %v", err)
+		}
+	})
+}
+
+func TestChangesSince(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		creds := b.st.Credentials
+		old := models.Credential{VaultID: "alice", Label: "GitHub"}
+		gone := models.Credential{VaultID: "bob", Label: "路由器", CollectionID: ptr("family")}
+		moved := models.Credential{VaultID: "bob", Label: "电表", CollectionID: ptr("family")}
+		for _, cred := range []*models.Credential{&old, &gone, &moved} {
+			creds.Create(cred)
+		}
+		b.share(t, "alice", "family", false)
+
+		time.Sleep(10 * time.Millisecond)
+		since := time.Now()
+		time.Sleep(10 * time.Millisecond)
+
+		fresh := models.Credential{VaultID: "alice", Label: "邮箱"}
+		creds.Create(&fresh)
+		creds.SetCategory("alice", old.ID, "工作")
+		creds.Delete(gone.ID)
+		creds.Create(&models.Credential{VaultID: "carol", Label: "别人的"})
+		creds.SetCollection(moved.ID, nil)
+
+		changed, err := creds.ListChangedSince("alice", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := map[string]bool{}
+		for _, cred := range changed {
+			ids[cred.ID] = true
+		}
+		if len(changed) != 2 || !ids[fresh.ID] || !ids[old.ID] {
+			t.Fatalf("应返回新建和修改过的可见凭证: %+v", changed)
+		}
+
+		// 只读成员也应收到共享记录的删除
+		deleted, err := creds.ListDeletedSince("alice", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != 1 || deleted[0].ID != gone.ID || deleted[0].DeletedAt.Before(since) {
+			t.Fatalf("应返回 since 之后删除的共享凭证: %+v", deleted)
+		}
+		if deleted, _ := creds.ListDeletedSince("alice", time.Now()); len(deleted) != 0 {
+			t.Fatalf("之后没有删除时应为空: %+v", deleted)
+		}
+
+		// 移出集合后成员看不到记录，回收站中也没有，只能从移除记录得知
+		removed, err := creds.ListRemovedSince("alice", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(removed) != 1 || removed[0].ID != moved.ID || removed[0].DeletedAt.Before(since) {
+			t.Fatalf("应返回移出集合的凭证: %+v", removed)
+		}
+		if removed, _ := creds.ListRemovedSince("bob", since); len(removed) != 0 {
+			t.Fatalf("创建者仍能看到移出集合的记录: %+v", removed)
+		}
+		if removed, _ := b.st.Memos.ListRemovedSince("alice", since); len(removed) != 0 {
+			t.Fatalf("移除记录应按类型区分: %+v", removed)
+		}
+	})
+}
+
+func TestChangesSinceJoinAndPurge(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		memos := b.st.Memos
+		existing := models.Memo{VaultID: "bob", Title: "门锁密码", CollectionID: ptr("family")}
+		memos.Create(&existing)
+
+		time.Sleep(10 * time.Millisecond)
+		since := time.Now()
+		time.Sleep(10 * time.Millisecond)
+
+		// 加入前就已存在的记录修改时间早于 since，加入后也要作为新增返回
+		b.share(t, "alice", "family", false)
+		changed, err := memos.ListChangedSince("alice", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changed) != 1 || changed[0].ID != existing.ID {
+			t.Fatalf("应返回新加入集合中的备忘录: %+v", changed)
+		}
+		if changed, _ := memos.ListChangedSince("bob", since); len(changed) != 0 {
+			t.Fatalf("创建者没有新加入集合，不应返回: %+v", changed)
+		}
+
+		// 彻底删除后回收站中查不到，能看到它的保险库都应记录移除
+		memos.Delete(existing.ID)
+		if err := memos.Purge(existing.ID); err != nil {
+			t.Fatal(err)
+		}
+		for _, vaultID := range []string{"alice", "bob"} {
+			removed, err := memos.ListRemovedSince(vaultID, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(removed) != 1 || removed[0].ID != existing.ID {
+				t.Fatalf("%s 应收到彻底删除的记录: %+v", vaultID, removed)
+			}
+		}
+		if removed, _ := memos.ListRemovedSince("carol", since); len(removed) != 0 {
+			t.Fatalf("看不到记录的保险库不应收到移除: %+v", removed)
+		}
+	})
+}
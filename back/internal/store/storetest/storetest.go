@@ -0,0 +1,1136 @@
+// Package storetest 提供 store 接口的内存实现，供不需要真实数据库的处理器测试使用。
+// 行为与 SQL 实现一致，由 store 包的测试对两种实现运行同一组用例保证。
+package storetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"subvault/internal/models"
+	"subvault/internal/store"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Memory 把记录保存在内存中。共享集合不在 store 的范围内，用 Share 声明成员关系来模拟 sharing 的可见范围。
+type Memory struct {
+	mu       sync.Mutex
+	subs     []*models.Subscription
+	creds    []*models.Credential
+	history  []models.CredentialHistory
+	memos    []*models.Memo
+	tags     []*models.Tag
+	settings []*models.NotificationSetting
+	events   []models.RenewalEvent
+	prices   []models.PriceHistory
+	removals []removal
+	// grants[vaultID][collectionID] 成员关系
+	grants map[string]map[string]grant
+}
+
+// grant 成员关系：editable 为 true 表示可编辑，false 表示只读；joined 为加入时间
+type grant struct {
+	editable bool
+	joined   time.Time
+}
+
+// removal 增量同步的移除记录，对应 models.SyncRemoval
+type removal struct {
+	vaultID  string
+	kind     string
+	recordID string
+	at       time.Time
+}
+
+// New 返回空的内存存储
+func New() *Memory {
+	return &Memory{grants: map[string]map[string]grant{}}
+}
+
+var (
+	_ store.SubscriptionRepository = (*memSubscriptions)(nil)
+	_ store.CredentialRepository   = (*memCredentials)(nil)
+	_ store.MemoRepository         = (*memMemos)(nil)
+	_ store.TagRepository          = (*memTags)(nil)
+	_ store.SettingsRepository     = (*memSettings)(nil)
+	_ store.BackupRepository       = (*memBackups)(nil)
+)
+
+// Store 返回由本内存存储实现的 store.Store
+func (m *Memory) Store() *store.Store {
+	st := &store.Store{
+		Subscriptions: &memSubscriptions{memRecords{m, "subscriptions", m.subRows, m.removeSubs}},
+		Credentials:   &memCredentials{memRecords{m, "credentials", m.credRows, m.removeCreds}},
+		Memos:         &memMemos{memRecords{m, "memos", m.memoRows, m.removeMemos}},
+		Tags:          &memTags{m},
+		Settings:      &memSettings{m},
+		Backups:       &memBackups{m},
+	}
+	st.Transaction = m.transaction
+	return st
+}
+
+// transaction 执行前保存全部记录的副本，fn 返回错误时恢复。不隔离同时进行的其他写入，测试中够用
+func (m *Memory) transaction(fn func(tx *store.Store) error) error {
+	m.mu.Lock()
+	saved := m.snapshot()
+	m.mu.Unlock()
+
+	if err := fn(m.Store()); err != nil {
+		m.mu.Lock()
+		m.subs, m.creds, m.history, m.memos = saved.subs, saved.creds, saved.history, saved.memos
+		m.tags, m.settings, m.events, m.prices = saved.tags, saved.settings, saved.events, saved.prices
+		m.removals = saved.removals
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// snapshot 复制全部记录，记录以指针保存且会被原地修改，需要逐条复制
+func (m *Memory) snapshot() *Memory {
+	saved := &Memory{
+		history: append([]models.CredentialHistory(nil), m.history...),
+		events:  append([]models.RenewalEvent(nil), m.events...),
+		prices:  append([]models.PriceHistory(nil), m.prices...),
+		// 移除记录只追加，不会原地修改
+		removals: append([]removal(nil), m.removals...),
+	}
+	for _, sub := range m.subs {
+		cp := *sub
+		saved.subs = append(saved.subs, &cp)
+	}
+	for _, cred := range m.creds {
+		cp := *cred
+		saved.creds = append(saved.creds, &cp)
+	}
+	for _, memo := range m.memos {
+		cp := *memo
+		saved.memos = append(saved.memos, &cp)
+	}
+	for _, tag := range m.tags {
+		cp := *tag
+		saved.tags = append(saved.tags, &cp)
+	}
+	for _, setting := range m.settings {
+		cp := *setting
+		saved.settings = append(saved.settings, &cp)
+	}
+	return saved
+}
+
+// Share 让 vaultID 可以看到集合中的记录，editable 为 true 时也可以修改。
+// 与重新添加成员一样，加入时间记为当前时间
+func (m *Memory) Share(vaultID, collectionID string, editable bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.grants[vaultID] == nil {
+		m.grants[vaultID] = map[string]grant{}
+	}
+	m.grants[vaultID][collectionID] = grant{editable: editable, joined: time.Now()}
+}
+
+func (m *Memory) readable(vaultID, recordVaultID string, collectionID *string) bool {
+	if recordVaultID == vaultID {
+		return true
+	}
+	if collectionID == nil {
+		return false
+	}
+	_, ok := m.grants[vaultID][*collectionID]
+	return ok
+}
+
+func (m *Memory) writable(vaultID, recordVaultID string, collectionID *string) bool {
+	if recordVaultID == vaultID {
+		return true
+	}
+	return collectionID != nil && m.grants[vaultID][*collectionID].editable
+}
+
+// joinedSince vaultID 在 since 之后加入了记录所在的集合，与 sharing.ChangedSince 一致
+func (m *Memory) joinedSince(vaultID string, collectionID *string, since time.Time) bool {
+	if collectionID == nil {
+		return false
+	}
+	g, ok := m.grants[vaultID][*collectionID]
+	return ok && g.joined.After(since)
+}
+
+// changedSince 记录在 since 之后修改过，或随加入集合新近可见
+func (m *Memory) changedSince(vaultID string, collectionID *string, updatedAt, since time.Time) bool {
+	return updatedAt.After(since) || m.joinedSince(vaultID, collectionID, since)
+}
+
+// audience 能看到记录的保险库：创建者加上集合的全部成员，与 sharing.Audience 一致
+func (m *Memory) audience(recordVaultID string, collectionID *string) []string {
+	vaults := []string{recordVaultID}
+	if collectionID == nil || *collectionID == "" {
+		return vaults
+	}
+	members := make([]string, 0, len(m.grants))
+	for vaultID, grants := range m.grants {
+		if _, ok := grants[*collectionID]; ok && vaultID != recordVaultID {
+			members = append(members, vaultID)
+		}
+	}
+	sort.Strings(members)
+	return append(vaults, members...)
+}
+
+// recordRemovals 调用时已持有锁
+func (m *Memory) recordRemovals(kind, recordID string, vaultIDs []string) {
+	now := time.Now()
+	for _, vaultID := range vaultIDs {
+		m.removals = append(m.removals, removal{vaultID: vaultID, kind: kind, recordID: recordID, at: now})
+	}
+}
+
+func newID(id string) string {
+	if id == "" {
+		return uuid.New().String()
+	}
+	return id
+}
+
+// initialVersion 与模型的 BeforeCreate 一致，新记录的版本号从 1 开始
+func initialVersion(v int64) int64 {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
+
+// row 三类记录共有字段的指针视图
+type row struct {
+	id           string
+	vaultID      string
+	collectionID **string
+	category     *string
+	updatedAt    *time.Time
+	deletedAt    *gorm.DeletedAt
+	version      *int64
+}
+
+func (m *Memory) subRows() []row {
+	out := make([]row, 0, len(m.subs))
+	for _, s := range m.subs {
+		out = append(out, row{s.ID, s.VaultID, &s.CollectionID, &s.Category, &s.UpdatedAt, &s.DeletedAt, &s.Version})
+	}
+	return out
+}
+
+func (m *Memory) credRows() []row {
+	out := make([]row, 0, len(m.creds))
+	for _, c := range m.creds {
+		out = append(out, row{c.ID, c.VaultID, &c.CollectionID, &c.Category, &c.UpdatedAt, &c.DeletedAt, &c.Version})
+	}
+	return out
+}
+
+func (m *Memory) memoRows() []row {
+	out := make([]row, 0, len(m.memos))
+	for _, n := range m.memos {
+		out = append(out, row{n.ID, n.VaultID, &n.CollectionID, &n.Category, &n.UpdatedAt, &n.DeletedAt, &n.Version})
+	}
+	return out
+}
+
+// removeSubs 等彻底删除 ids 中的记录，调用时已持有锁
+func (m *Memory) removeSubs(ids map[string]bool) {
+	kept := m.subs[:0]
+	for _, s := range m.subs {
+		if !ids[s.ID] {
+			kept = append(kept, s)
+		}
+	}
+	m.subs = kept
+}
+
+func (m *Memory) removeCreds(ids map[string]bool) {
+	for _, s := range m.subs {
+		if s.CredentialID != nil && ids[*s.CredentialID] {
+			s.CredentialID = nil
+		}
+	}
+	kept := m.creds[:0]
+	for _, c := range m.creds {
+		if !ids[c.ID] {
+			kept = append(kept, c)
+		}
+	}
+	m.creds = kept
+	history := m.history[:0]
+	for _, h := range m.history {
+		if !ids[h.CredentialID] {
+			history = append(history, h)
+		}
+	}
+	m.history = history
+}
+
+func (m *Memory) removeMemos(ids map[string]bool) {
+	kept := m.memos[:0]
+	for _, n := range m.memos {
+		if !ids[n.ID] {
+			kept = append(kept, n)
+		}
+	}
+	m.memos = kept
+}
+
+type memRecords struct {
+	m *Memory
+	// kind 与 SQL 实现中的表名一致，写入移除记录
+	kind   string
+	rows   func() []row
+	remove func(ids map[string]bool)
+}
+
+// live 不在回收站中的记录
+func (r memRecords) live() []row {
+	var out []row
+	for _, rec := range r.rows() {
+		if !rec.deletedAt.Valid {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func (r memRecords) Locate(vaultID, id string) (store.Placement, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.live() {
+		if rec.id == id && r.m.readable(vaultID, rec.vaultID, *rec.collectionID) {
+			return store.Placement{VaultID: rec.vaultID, CollectionID: copyString(*rec.collectionID)}, nil
+		}
+	}
+	return store.Placement{}, store.ErrNotFound
+}
+
+func (r memRecords) SetCollection(id string, collectionID *string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.rows() {
+		if rec.id != id {
+			continue
+		}
+		still := map[string]bool{}
+		for _, vaultID := range r.m.audience(rec.vaultID, collectionID) {
+			still[vaultID] = true
+		}
+		var lost []string
+		for _, vaultID := range r.m.audience(rec.vaultID, *rec.collectionID) {
+			if !still[vaultID] {
+				lost = append(lost, vaultID)
+			}
+		}
+		r.m.recordRemovals(r.kind, id, lost)
+		*rec.collectionID = copyString(collectionID)
+		*rec.updatedAt = time.Now()
+		*rec.version++
+	}
+	return nil
+}
+
+func (r memRecords) SetCategory(vaultID, id, category string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.live() {
+		if rec.id == id && r.m.writable(vaultID, rec.vaultID, *rec.collectionID) {
+			*rec.category = category
+			*rec.updatedAt = time.Now()
+			*rec.version++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r memRecords) FillEmptyCategory(vaultID, category string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.live() {
+		if rec.vaultID == vaultID && *rec.category == "" {
+			*rec.category = category
+			*rec.updatedAt = time.Now()
+			*rec.version++
+		}
+	}
+	return nil
+}
+
+func (r memRecords) SetAllCategories(vaultID, category string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.live() {
+		if rec.vaultID == vaultID {
+			*rec.category = category
+			*rec.updatedAt = time.Now()
+			*rec.version++
+		}
+	}
+	return nil
+}
+
+func (r memRecords) Delete(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.live() {
+		if rec.id == id {
+			*rec.deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (r memRecords) LocateDeleted(vaultID, id string) (store.Placement, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.rows() {
+		if rec.id == id && rec.deletedAt.Valid && r.m.writable(vaultID, rec.vaultID, *rec.collectionID) {
+			return store.Placement{VaultID: rec.vaultID, CollectionID: copyString(*rec.collectionID)}, nil
+		}
+	}
+	return store.Placement{}, store.ErrNotFound
+}
+
+func (r memRecords) Restore(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.rows() {
+		if rec.id == id {
+			*rec.deletedAt = gorm.DeletedAt{}
+			*rec.updatedAt = time.Now()
+			*rec.version++
+		}
+	}
+	return nil
+}
+
+func (r memRecords) Purge(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, rec := range r.rows() {
+		if rec.id == id && rec.deletedAt.Valid {
+			r.m.recordRemovals(r.kind, id, r.m.audience(rec.vaultID, *rec.collectionID))
+			r.remove(map[string]bool{id: true})
+			break
+		}
+	}
+	return nil
+}
+
+func (r memRecords) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ids := map[string]bool{}
+	for _, rec := range r.rows() {
+		if rec.deletedAt.Valid && rec.deletedAt.Time.Before(cutoff) {
+			ids[rec.id] = true
+		}
+	}
+	r.remove(ids)
+	return int64(len(ids)), nil
+}
+
+func (r memRecords) ListDeletedSince(vaultID string, since time.Time) ([]store.Tombstone, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []store.Tombstone
+	for _, rec := range r.rows() {
+		if rec.deletedAt.Valid && rec.deletedAt.Time.After(since) && r.m.readable(vaultID, rec.vaultID, *rec.collectionID) {
+			out = append(out, store.Tombstone{ID: rec.id, DeletedAt: rec.deletedAt.Time})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DeletedAt.Before(out[j].DeletedAt) })
+	return out, nil
+}
+
+func (r memRecords) ListRemovedSince(vaultID string, since time.Time) ([]store.Tombstone, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []store.Tombstone
+	for _, rm := range r.m.removals {
+		if rm.vaultID == vaultID && rm.kind == r.kind && rm.at.After(since) {
+			out = append(out, store.Tombstone{ID: rm.recordID, DeletedAt: rm.at})
+		}
+	}
+	return out, nil
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+// === 订阅 ===
+
+type memSubscriptions struct{ memRecords }
+
+func (r *memSubscriptions) list(keep func(*models.Subscription) bool) []models.Subscription {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.Subscription
+	for _, s := range r.m.subs {
+		if keep(s) {
+			out = append(out, copySubscription(s))
+		}
+	}
+	return out
+}
+
+func (r *memSubscriptions) ListReadable(vaultID string) ([]models.Subscription, error) {
+	return r.list(func(s *models.Subscription) bool {
+		return !s.DeletedAt.Valid && r.m.readable(vaultID, s.VaultID, s.CollectionID)
+	}), nil
+}
+
+func (r *memSubscriptions) ListChangedSince(vaultID string, since time.Time) ([]models.Subscription, error) {
+	subs := r.list(func(s *models.Subscription) bool {
+		return !s.DeletedAt.Valid && r.m.readable(vaultID, s.VaultID, s.CollectionID) && r.m.changedSince(vaultID, s.CollectionID, s.UpdatedAt, since)
+	})
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].UpdatedAt.Before(subs[j].UpdatedAt) })
+	return subs, nil
+}
+
+func (r *memSubscriptions) ListOwned(vaultID string) ([]models.Subscription, error) {
+	return r.list(func(s *models.Subscription) bool { return !s.DeletedAt.Valid && s.VaultID == vaultID }), nil
+}
+
+func (r *memSubscriptions) ListAutoRotate() ([]models.Subscription, error) {
+	return r.list(func(s *models.Subscription) bool { return !s.DeletedAt.Valid && s.AutoRotate && s.Active }), nil
+}
+
+func (r *memSubscriptions) ListDeleted(vaultID string) ([]models.Subscription, error) {
+	subs := r.list(func(s *models.Subscription) bool {
+		return s.DeletedAt.Valid && r.m.writable(vaultID, s.VaultID, s.CollectionID)
+	})
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].DeletedAt.Time.After(subs[j].DeletedAt.Time) })
+	return subs, nil
+}
+
+func (r *memSubscriptions) GetReadable(vaultID, id string) (models.Subscription, error) {
+	subs := r.list(func(s *models.Subscription) bool {
+		return s.ID == id && !s.DeletedAt.Valid && r.m.readable(vaultID, s.VaultID, s.CollectionID)
+	})
+	if len(subs) == 0 {
+		return models.Subscription{}, store.ErrNotFound
+	}
+	return subs[0], nil
+}
+
+func (r *memSubscriptions) Create(sub *models.Subscription) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	sub.ID = newID(sub.ID)
+	sub.Version = initialVersion(sub.Version)
+	sub.NormalizeStatus()
+	sub.CreatedAt, sub.UpdatedAt = time.Now(), time.Now()
+	row := copySubscription(sub)
+	r.m.subs = append(r.m.subs, &row)
+	return nil
+}
+
+func (r *memSubscriptions) Save(sub *models.Subscription) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for i, s := range r.m.subs {
+		if s.ID == sub.ID && !s.DeletedAt.Valid {
+			if s.Version != sub.Version {
+				return store.ErrConflict
+			}
+			sub.NormalizeStatus()
+			sub.UpdatedAt = time.Now()
+			sub.Version++
+			row := copySubscription(sub)
+			r.m.subs[i] = &row
+			return nil
+		}
+	}
+	return store.ErrConflict
+}
+
+func (r *memSubscriptions) RecordRotation(sub models.Subscription) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, s := range r.m.subs {
+		if s.ID == sub.ID && !s.DeletedAt.Valid {
+			s.StartDate, s.RenewalDate = sub.StartDate, sub.RenewalDate
+			s.UpdatedAt = time.Now()
+			s.Version++
+		}
+	}
+	r.m.events = append(r.m.events, models.RenewalEvent{
+		ID:             uuid.New().String(),
+		VaultID:        sub.VaultID,
+		SubscriptionID: sub.ID,
+		Amount:         sub.Cost,
+		Currency:       sub.Currency,
+		OccurredOn:     sub.StartDate,
+		Source:         "rotate",
+		CreatedAt:      time.Now(),
+	})
+	return nil
+}
+
+func (r *memSubscriptions) RenewalEvents(vaultID string) ([]models.RenewalEvent, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.RenewalEvent
+	for _, ev := range r.m.events {
+		if ev.VaultID == vaultID {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func (r *memSubscriptions) RecordPriceChange(change *models.PriceHistory) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	change.ID = newID(change.ID)
+	change.CreatedAt = time.Now()
+	r.m.prices = append(r.m.prices, *change)
+	return nil
+}
+
+func (r *memSubscriptions) RecentPriceChanges(vaultID string, limit int) ([]models.PriceHistory, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.PriceHistory
+	for i := len(r.m.prices) - 1; i >= 0 && len(out) < limit; i-- {
+		if r.m.prices[i].VaultID == vaultID {
+			out = append(out, r.m.prices[i])
+		}
+	}
+	return out, nil
+}
+
+func copySubscription(s *models.Subscription) models.Subscription {
+	out := *s
+	out.CollectionID = copyString(s.CollectionID)
+	out.CredentialID = copyString(s.CredentialID)
+	out.Tags = nil
+	return out
+}
+
+// === 凭证 ===
+
+type memCredentials struct{ memRecords }
+
+func (r *memCredentials) list(keep func(*models.Credential) bool) []models.Credential {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.Credential
+	for _, c := range r.m.creds {
+		if keep(c) {
+			row := *c
+			row.CollectionID = copyString(c.CollectionID)
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func (r *memCredentials) ListReadable(vaultID string) ([]models.Credential, error) {
+	return r.list(func(c *models.Credential) bool {
+		return !c.DeletedAt.Valid && r.m.readable(vaultID, c.VaultID, c.CollectionID)
+	}), nil
+}
+
+func (r *memCredentials) ListChangedSince(vaultID string, since time.Time) ([]models.Credential, error) {
+	creds := r.list(func(c *models.Credential) bool {
+		return !c.DeletedAt.Valid && r.m.readable(vaultID, c.VaultID, c.CollectionID) && r.m.changedSince(vaultID, c.CollectionID, c.UpdatedAt, since)
+	})
+	sort.SliceStable(creds, func(i, j int) bool { return creds[i].UpdatedAt.Before(creds[j].UpdatedAt) })
+	return creds, nil
+}
+
+func (r *memCredentials) ListOwned(vaultID string) ([]models.Credential, error) {
+	return r.list(func(c *models.Credential) bool { return !c.DeletedAt.Valid && c.VaultID == vaultID }), nil
+}
+
+func (r *memCredentials) ListDeleted(vaultID string) ([]models.Credential, error) {
+	creds := r.list(func(c *models.Credential) bool {
+		return c.DeletedAt.Valid && r.m.writable(vaultID, c.VaultID, c.CollectionID)
+	})
+	sort.SliceStable(creds, func(i, j int) bool { return creds[i].DeletedAt.Time.After(creds[j].DeletedAt.Time) })
+	return creds, nil
+}
+
+func (r *memCredentials) GetReadable(vaultID, id string) (models.Credential, error) {
+	creds := r.list(func(c *models.Credential) bool {
+		return c.ID == id && !c.DeletedAt.Valid && r.m.readable(vaultID, c.VaultID, c.CollectionID)
+	})
+	if len(creds) == 0 {
+		return models.Credential{}, store.ErrNotFound
+	}
+	return creds[0], nil
+}
+
+func (r *memCredentials) Create(cred *models.Credential) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	cred.ID = newID(cred.ID)
+	cred.Version = initialVersion(cred.Version)
+	cred.CreatedAt, cred.UpdatedAt = time.Now(), time.Now()
+	row := *cred
+	row.CollectionID = copyString(cred.CollectionID)
+	r.m.creds = append(r.m.creds, &row)
+	return nil
+}
+
+func (r *memCredentials) Save(cred *models.Credential) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.save(cred)
+}
+
+func (r *memCredentials) save(cred *models.Credential) error {
+	for i, c := range r.m.creds {
+		if c.ID == cred.ID && !c.DeletedAt.Valid {
+			if c.Version != cred.Version {
+				return store.ErrConflict
+			}
+			cred.UpdatedAt = time.Now()
+			cred.Version++
+			row := *cred
+			row.CollectionID = copyString(cred.CollectionID)
+			r.m.creds[i] = &row
+			return nil
+		}
+	}
+	return store.ErrConflict
+}
+
+func (r *memCredentials) SaveWithHistory(cred *models.Credential, previous *models.CredentialHistory, limit int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.save(cred); err != nil {
+		return err
+	}
+	previous.ID = newID(previous.ID)
+	previous.CreatedAt = time.Now()
+	r.m.history = append(r.m.history, *previous)
+
+	// history 按追加顺序排列，从尾部往前数保留最近 limit 条
+	kept := 0
+	for i := len(r.m.history) - 1; i >= 0; i-- {
+		if r.m.history[i].CredentialID != cred.ID {
+			continue
+		}
+		if kept < limit {
+			kept++
+			continue
+		}
+		r.m.history = append(r.m.history[:i], r.m.history[i+1:]...)
+	}
+	return nil
+}
+
+func (r *memCredentials) History(credentialID string) ([]models.CredentialHistory, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.CredentialHistory
+	for i := len(r.m.history) - 1; i >= 0; i-- {
+		if r.m.history[i].CredentialID == credentialID {
+			out = append(out, r.m.history[i])
+		}
+	}
+	return out, nil
+}
+
+func (r *memCredentials) GetHistory(credentialID, id string) (models.CredentialHistory, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, h := range r.m.history {
+		if h.ID == id && h.CredentialID == credentialID {
+			return h, nil
+		}
+	}
+	return models.CredentialHistory{}, store.ErrNotFound
+}
+
+// === 备忘录 ===
+
+type memMemos struct{ memRecords }
+
+func (r *memMemos) list(keep func(*models.Memo) bool) []models.Memo {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.Memo
+	for _, n := range r.m.memos {
+		if keep(n) {
+			row := *n
+			row.CollectionID = copyString(n.CollectionID)
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func (r *memMemos) ListReadable(vaultID string) ([]models.Memo, error) {
+	return r.list(func(n *models.Memo) bool {
+		return !n.DeletedAt.Valid && r.m.readable(vaultID, n.VaultID, n.CollectionID)
+	}), nil
+}
+
+func (r *memMemos) ListChangedSince(vaultID string, since time.Time) ([]models.Memo, error) {
+	memos := r.list(func(n *models.Memo) bool {
+		return !n.DeletedAt.Valid && r.m.readable(vaultID, n.VaultID, n.CollectionID) && r.m.changedSince(vaultID, n.CollectionID, n.UpdatedAt, since)
+	})
+	sort.SliceStable(memos, func(i, j int) bool { return memos[i].UpdatedAt.Before(memos[j].UpdatedAt) })
+	return memos, nil
+}
+
+func (r *memMemos) ListDeleted(vaultID string) ([]models.Memo, error) {
+	memos := r.list(func(n *models.Memo) bool {
+		return n.DeletedAt.Valid && r.m.writable(vaultID, n.VaultID, n.CollectionID)
+	})
+	sort.SliceStable(memos, func(i, j int) bool { return memos[i].DeletedAt.Time.After(memos[j].DeletedAt.Time) })
+	return memos, nil
+}
+
+func (r *memMemos) GetReadable(vaultID, id string) (models.Memo, error) {
+	memos := r.list(func(n *models.Memo) bool {
+		return n.ID == id && !n.DeletedAt.Valid && r.m.readable(vaultID, n.VaultID, n.CollectionID)
+	})
+	if len(memos) == 0 {
+		return models.Memo{}, store.ErrNotFound
+	}
+	return memos[0], nil
+}
+
+func (r *memMemos) Create(memo *models.Memo) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	memo.ID = newID(memo.ID)
+	memo.Version = initialVersion(memo.Version)
+	memo.CreatedAt, memo.UpdatedAt = time.Now(), time.Now()
+	row := *memo
+	row.CollectionID = copyString(memo.CollectionID)
+	r.m.memos = append(r.m.memos, &row)
+	return nil
+}
+
+func (r *memMemos) Save(memo *models.Memo) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for i, n := range r.m.memos {
+		if n.ID == memo.ID && !n.DeletedAt.Valid {
+			if n.Version != memo.Version {
+				return store.ErrConflict
+			}
+			memo.UpdatedAt = time.Now()
+			memo.Version++
+			row := *memo
+			row.CollectionID = copyString(memo.CollectionID)
+			r.m.memos[i] = &row
+			return nil
+		}
+	}
+	return store.ErrConflict
+}
+
+// === 分组 ===
+
+type memTags struct{ m *Memory }
+
+func (r *memTags) list(keep func(*models.Tag) bool) []models.Tag {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.Tag
+	for _, t := range r.m.tags {
+		if keep(t) {
+			out = append(out, *t)
+		}
+	}
+	return out
+}
+
+func (r *memTags) List(vaultID string) ([]models.Tag, error) {
+	tags := r.list(func(t *models.Tag) bool { return t.VaultID == vaultID && !t.DeletedAt.Valid })
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].CreatedAt.Before(tags[j].CreatedAt) })
+	return tags, nil
+}
+
+func (r *memTags) Get(vaultID, id string) (models.Tag, error) {
+	tags := r.list(func(t *models.Tag) bool { return t.ID == id && t.VaultID == vaultID && !t.DeletedAt.Valid })
+	if len(tags) == 0 {
+		return models.Tag{}, store.ErrNotFound
+	}
+	return tags[0], nil
+}
+
+func (r *memTags) Create(tag *models.Tag) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	tag.ID = newID(tag.ID)
+	tag.CreatedAt = time.Now()
+	row := *tag
+	r.m.tags = append(r.m.tags, &row)
+	return nil
+}
+
+func (r *memTags) Save(tag *models.Tag) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, t := range r.m.tags {
+		if t.ID == tag.ID {
+			*t = *tag
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (r *memTags) Delete(vaultID, id string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, t := range r.m.tags {
+		if t.ID == id && t.VaultID == vaultID && !t.DeletedAt.Valid {
+			t.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memTags) ListDeleted(vaultID string) ([]models.Tag, error) {
+	tags := r.list(func(t *models.Tag) bool { return t.VaultID == vaultID && t.DeletedAt.Valid })
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].DeletedAt.Time.After(tags[j].DeletedAt.Time) })
+	return tags, nil
+}
+
+func (r *memTags) GetDeleted(vaultID, id string) (models.Tag, error) {
+	tags := r.list(func(t *models.Tag) bool { return t.ID == id && t.VaultID == vaultID && t.DeletedAt.Valid })
+	if len(tags) == 0 {
+		return models.Tag{}, store.ErrNotFound
+	}
+	return tags[0], nil
+}
+
+func (r *memTags) Restore(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, t := range r.m.tags {
+		if t.ID == id {
+			t.DeletedAt = gorm.DeletedAt{}
+		}
+	}
+	return nil
+}
+
+func (r *memTags) Purge(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.remove(func(t *models.Tag) bool { return t.ID == id && t.DeletedAt.Valid })
+	return nil
+}
+
+func (r *memTags) PurgeDeletedBefore(cutoff time.Time) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.remove(func(t *models.Tag) bool { return t.DeletedAt.Valid && t.DeletedAt.Time.Before(cutoff) }), nil
+}
+
+// remove 彻底删除符合条件的分组，调用时已持有锁
+func (r *memTags) remove(match func(*models.Tag) bool) int64 {
+	var n int64
+	kept := r.m.tags[:0]
+	for _, t := range r.m.tags {
+		if match(t) {
+			n++
+			continue
+		}
+		kept = append(kept, t)
+	}
+	r.m.tags = kept
+	return n
+}
+
+// === 通知设置 ===
+
+type memSettings struct{ m *Memory }
+
+func (r *memSettings) find(match func(*models.NotificationSetting) bool) (models.NotificationSetting, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, s := range r.m.settings {
+		if match(s) {
+			return *s, nil
+		}
+	}
+	return models.NotificationSetting{}, store.ErrNotFound
+}
+
+func (r *memSettings) Get(vaultID string) (models.NotificationSetting, error) {
+	return r.find(func(s *models.NotificationSetting) bool { return s.VaultID == vaultID })
+}
+
+func (r *memSettings) FindByCalendarToken(token string) (models.NotificationSetting, error) {
+	return r.find(func(s *models.NotificationSetting) bool { return s.CalendarToken == token })
+}
+
+func (r *memSettings) ListWebhookEnabled() ([]models.NotificationSetting, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var out []models.NotificationSetting
+	for _, s := range r.m.settings {
+		if s.WebhookEnabled && s.WebhookURL != "" {
+			out = append(out, *s)
+		}
+	}
+	return out, nil
+}
+
+func (r *memSettings) Create(setting *models.NotificationSetting) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	setting.ID = newID(setting.ID)
+	setting.CreatedAt, setting.UpdatedAt = time.Now(), time.Now()
+	row := *setting
+	r.m.settings = append(r.m.settings, &row)
+	return nil
+}
+
+func (r *memSettings) Save(setting *models.NotificationSetting) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	setting.UpdatedAt = time.Now()
+	for _, s := range r.m.settings {
+		if s.ID == setting.ID {
+			*s = *setting
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+// === 整库备份 ===
+
+type memBackups struct{ m *Memory }
+
+func (r *memBackups) Export(vaultID string) (store.Snapshot, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var snap store.Snapshot
+	for _, s := range r.m.subs {
+		if s.VaultID == vaultID && !s.DeletedAt.Valid {
+			snap.Subscriptions = append(snap.Subscriptions, copySubscription(s))
+		}
+	}
+	for _, c := range r.m.creds {
+		if c.VaultID == vaultID && !c.DeletedAt.Valid {
+			row := *c
+			row.CollectionID = copyString(c.CollectionID)
+			snap.Credentials = append(snap.Credentials, row)
+		}
+	}
+	for _, n := range r.m.memos {
+		if n.VaultID == vaultID && !n.DeletedAt.Valid {
+			row := *n
+			row.CollectionID = copyString(n.CollectionID)
+			snap.Memos = append(snap.Memos, row)
+		}
+	}
+	for _, t := range r.m.tags {
+		if t.VaultID == vaultID && !t.DeletedAt.Valid {
+			snap.Tags = append(snap.Tags, *t)
+		}
+	}
+	for _, s := range r.m.settings {
+		if s.VaultID == vaultID {
+			row := *s
+			snap.Settings = &row
+		}
+	}
+	for _, p := range r.m.prices {
+		if p.VaultID == vaultID {
+			snap.PriceHistory = append(snap.PriceHistory, p)
+		}
+	}
+	for _, ev := range r.m.events {
+		if ev.VaultID == vaultID {
+			snap.RenewalEvents = append(snap.RenewalEvents, ev)
+		}
+	}
+	return snap, nil
+}
+
+func (r *memBackups) Import(vaultID string, snap store.Snapshot, replace bool) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if replace {
+		// 与 SQL 实现一致，先为能看到这些记录的保险库记录移除
+		owned := func(kind string, rows []row) map[string]bool {
+			ids := map[string]bool{}
+			for _, row := range rows {
+				if row.vaultID == vaultID {
+					ids[row.id] = true
+					r.m.recordRemovals(kind, row.id, r.m.audience(row.vaultID, *row.collectionID))
+				}
+			}
+			return ids
+		}
+		r.m.removeSubs(owned("subscriptions", r.m.subRows()))
+		r.m.removeCreds(owned("credentials", r.m.credRows()))
+		r.m.removeMemos(owned("memos", r.m.memoRows()))
+		(&memTags{r.m}).remove(func(t *models.Tag) bool { return t.VaultID == vaultID })
+		prices := r.m.prices[:0]
+		for _, p := range r.m.prices {
+			if p.VaultID != vaultID {
+				prices = append(prices, p)
+			}
+		}
+		r.m.prices = prices
+		events := r.m.events[:0]
+		for _, ev := range r.m.events {
+			if ev.VaultID != vaultID {
+				events = append(events, ev)
+			}
+		}
+		r.m.events = events
+	}
+	if snap.Settings != nil {
+		settings := r.m.settings[:0]
+		for _, s := range r.m.settings {
+			if s.VaultID != vaultID {
+				settings = append(settings, s)
+			}
+		}
+		row := *snap.Settings
+		r.m.settings = append(settings, &row)
+	}
+	for i := range snap.Tags {
+		row := snap.Tags[i]
+		r.m.tags = append(r.m.tags, &row)
+	}
+	for i := range snap.Credentials {
+		row := snap.Credentials[i]
+		row.CollectionID = copyString(row.CollectionID)
+		row.Version = initialVersion(row.Version)
+		r.m.creds = append(r.m.creds, &row)
+	}
+	for i := range snap.Subscriptions {
+		row := copySubscription(&snap.Subscriptions[i])
+		row.Version = initialVersion(row.Version)
+		r.m.subs = append(r.m.subs, &row)
+	}
+	for i := range snap.Memos {
+		row := snap.Memos[i]
+		row.CollectionID = copyString(row.CollectionID)
+		row.Version = initialVersion(row.Version)
+		r.m.memos = append(r.m.memos, &row)
+	}
+	r.m.prices = append(r.m.prices, snap.PriceHistory...)
+	r.m.events = append(r.m.events, snap.RenewalEvents...)
+	return nil
+}
@@ -0,0 +1,143 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 只实现 WebAuthn 用到的 CBOR 子集（RFC 8949）：
+// 整数、字节串、文本串、数组、映射和 true/false/null，不支持不定长编码和浮点数。
+
+var errCBOR = errors.New("malformed cbor")
+
+// maxCBORDepth 嵌套层数上限，防止恶意输入耗尽栈
+const maxCBORDepth = 16
+
+// decodeCBOR 解码 data 开头的一个 CBOR 数据项，返回值和消耗的字节数。
+// 映射解码为 map[interface{}]interface{}，整数统一为 int64。
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, fmt.Errorf("%w: nesting too deep", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, 0, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22:
+			return nil, 1, nil
+		}
+		return nil, 0, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+	}
+
+	arg, n, err := readArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(data)-n) {
+			return nil, 0, fmt.Errorf("%w: string exceeds input", errCBOR)
+		}
+		end := n + int(arg)
+		buf := make([]byte, arg)
+		copy(buf, data[n:end])
+		if major == 3 {
+			return string(buf), end, nil
+		}
+		return buf, end, nil
+	case 4:
+		if arg > uint64(len(data)) {
+			return nil, 0, fmt.Errorf("%w: array exceeds input", errCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, m, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += m
+		}
+		return items, n, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, 0, fmt.Errorf("%w: map exceeds input", errCBOR)
+		}
+		out := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, m, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += m
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			value, m, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += m
+			out[key] = value
+		}
+		return out, n, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+}
+
+// readArgument 读取数据项头部的参数（长度或整数值），返回参数和头部字节数
+func readArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			break
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			break
+		}
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: indefinite length not supported", errCBOR)
+	}
+	return 0, 0, fmt.Errorf("%w: unexpected end", errCBOR)
+}
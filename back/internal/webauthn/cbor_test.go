@@ -0,0 +1,39 @@
+package webauthn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: 2, "a": h'0102', -1: [true, null]}
+	data := []byte{0xa3, 0x01, 0x02, 0x61, 'a', 0x42, 0x01, 0x02, 0x20, 0x82, 0xf5, 0xf6}
+	item, n, err := decodeCBOR(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("解码失败: %v %d", err, n)
+	}
+	m := item.(map[interface{}]interface{})
+	if m[int64(1)] != int64(2) || !bytes.Equal(m["a"].([]byte), []byte{1, 2}) {
+		t.Fatalf("解码结果不对: %#v", m)
+	}
+	if arr := m[int64(-1)].([]interface{}); len(arr) != 2 || arr[0] != true || arr[1] != nil {
+		t.Fatalf("数组解码不对: %#v", arr)
+	}
+}
+
+func TestDecodeCBORRejectsMalformed(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, maxCBORDepth+2)
+	cases := map[string][]byte{
+		"截断的字节串": {0x45, 0x01},
+		"超长数组":   {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"不定长编码":  {0x5f},
+		"嵌套过深":   append(deep, 0x00),
+		"浮点数":    {0xf9, 0x00, 0x00},
+	}
+	for name, data := range cases {
+		if _, _, err := decodeCBOR(data); !errors.Is(err, errCBOR) {
+			t.Errorf("%s 应解码失败: %v", name, err)
+		}
+	}
+}
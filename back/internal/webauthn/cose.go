@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE 算法标识（RFC 9053），注册时按此顺序声明偏好
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms 注册时声明支持的签名算法
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE 密钥参数
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // EC2/OKP 曲线；RSA 时为 n
+	coseX   = -2 // EC2/OKP 公钥 x；RSA 时为 e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+var errUnsupportedKey = errors.New("unsupported credential public key")
+
+// publicKey 解析后的凭证公钥
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey 解析 COSE_Key 编码的公钥，只接受 ES256、EdDSA 和 RS256
+func parsePublicKey(cose []byte) (publicKey, error) {
+	item, n, err := decodeCBOR(cose)
+	if err != nil {
+		return publicKey{}, err
+	}
+	if n != len(cose) {
+		return publicKey{}, fmt.Errorf("%w: trailing bytes", errCBOR)
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return publicKey{}, errUnsupportedKey
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, errUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return publicKey{}, errUnsupportedKey
+		}
+		return publicKey{alg: alg, key: pub}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errUnsupportedKey
+		}
+		return publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		nBytes, _ := m[int64(coseCrv)].([]byte)
+		eBytes, _ := m[int64(coseX)].([]byte)
+		if len(nBytes) < 256 || len(eBytes) == 0 || len(eBytes) > 4 {
+			return publicKey{}, errUnsupportedKey
+		}
+		e := new(big.Int).SetBytes(eBytes)
+		return publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(e.Int64())}}, nil
+	}
+	return publicKey{}, errUnsupportedKey
+}
+
+// verify 校验 message 上的签名；ES256 为 ASN.1 DER 编码
+func (p publicKey) verify(message, signature []byte) bool {
+	switch key := p.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, message, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,393 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 依据 W3C Web Authentication Level 2 实现依赖方（服务端）校验的最小子集：
+// 只接受 none 和 packed 自证明，不校验证书链——证明只说明认证器型号，不影响凭证本身的安全性。
+
+var (
+	// ErrVerification 客户端数据、认证器数据或签名校验失败
+	ErrVerification = errors.New("webauthn verification failed")
+	// ErrSignCount 签名计数回退，认证器可能被克隆
+	ErrSignCount = errors.New("webauthn sign count did not increase")
+)
+
+// ChallengeTimeoutMillis 浏览器等待用户操作的超时（毫秒），与服务端挑战有效期一致
+const ChallengeTimeoutMillis = 5 * 60 * 1000
+
+// 认证器数据标志位
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// RelyingParty 依赖方配置：RP ID 为站点域名，Origins 为允许发起请求的前端来源
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// NewChallenge 生成 32 字节随机挑战，以 base64url（无填充）返回
+func NewChallenge() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// === 传给 navigator.credentials.create / get 的选项，二进制字段均为 base64url ===
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions 注册选项。discoverable 为 true 时要求可发现凭证（通行密钥）和用户验证，用于免密码解锁。
+func (rp RelyingParty) CreationOptions(challenge, userID, username string, exclude []CredentialDescriptor, discoverable bool) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	selection := AuthenticatorSelection{ResidentKey: "discouraged", UserVerification: "preferred"}
+	if discoverable {
+		selection = AuthenticatorSelection{ResidentKey: "required", UserVerification: "required"}
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		Challenge:              challenge,
+		RP:                     RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:                   UserEntity{ID: base64.RawURLEncoding.EncodeToString([]byte(userID)), Name: username, DisplayName: username},
+		PubKeyCredParams:       params,
+		Timeout:                ChallengeTimeoutMillis,
+		ExcludeCredentials:     exclude,
+		AuthenticatorSelection: selection,
+		Attestation:            "none",
+	}
+}
+
+// RequestOptions 断言选项。allow 为空时由浏览器列出可发现凭证。
+func (rp RelyingParty) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          ChallengeTimeoutMillis,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// === 浏览器返回的 PublicKeyCredential，二进制字段均为 base64url ===
+
+type AttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+type RegistrationResponse struct {
+	ID       string              `json:"id"`
+	RawID    string              `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+type AssertionData struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+type AssertionResponse struct {
+	ID       string        `json:"id"`
+	RawID    string        `json:"rawId"`
+	Type     string        `json:"type"`
+	Response AssertionData `json:"response"`
+}
+
+// Credential 注册成功的凭证，PublicKey 为 COSE_Key 编码
+type Credential struct {
+	ID           string // base64url
+	PublicKey    []byte
+	SignCount    uint32
+	AAGUID       []byte
+	UserVerified bool
+	Transports   []string
+}
+
+// Assertion 断言校验结果
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	aaguid    []byte
+	credID    []byte
+	publicKey []byte
+}
+
+func verificationError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrVerification, fmt.Sprintf(format, args...))
+}
+
+// decodeBase64 兼容带填充和不带填充的 base64url
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// verifyClientData 校验类型、挑战和来源，返回 clientDataJSON 的原始字节
+func (rp RelyingParty) verifyClientData(encoded, wantType, challenge string) ([]byte, error) {
+	raw, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, verificationError("invalid clientDataJSON encoding")
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, verificationError("invalid clientDataJSON")
+	}
+	if data.Type != wantType {
+		return nil, verificationError("unexpected type %q", data.Type)
+	}
+	if challenge == "" || data.Challenge != challenge {
+		return nil, verificationError("challenge mismatch")
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return raw, nil
+		}
+	}
+	return nil, verificationError("origin %q not allowed", data.Origin)
+}
+
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, verificationError("authenticator data too short")
+	}
+	out := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if out.flags&flagAttested == 0 {
+		return out, nil
+	}
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, verificationError("attested credential data too short")
+	}
+	out.aaguid = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return authenticatorData{}, verificationError("credential id exceeds data")
+	}
+	out.credID = rest[:idLen]
+	rest = rest[idLen:]
+	if _, n, err := decodeCBOR(rest); err != nil {
+		return authenticatorData{}, verificationError("invalid credential public key")
+	} else {
+		out.publicKey = rest[:n]
+	}
+	return out, nil
+}
+
+// verifyAuthenticatorData 校验 RP ID 哈希和用户在场/验证标志
+func (rp RelyingParty) verifyAuthenticatorData(auth authenticatorData, requireUV bool) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(auth.rpIDHash, want[:]) {
+		return verificationError("rp id mismatch")
+	}
+	if auth.flags&flagUserPresent == 0 {
+		return verificationError("user not present")
+	}
+	if requireUV && auth.flags&flagUserVerified == 0 {
+		return verificationError("user not verified")
+	}
+	return nil
+}
+
+// VerifyRegistration 校验注册响应，返回新凭证。requireUV 为 true 时要求认证器完成用户验证（PIN、生物识别）。
+func (rp RelyingParty) VerifyRegistration(challenge string, resp RegistrationResponse, requireUV bool) (Credential, error) {
+	if resp.Type != "public-key" {
+		return Credential{}, verificationError("unexpected credential type %q", resp.Type)
+	}
+	clientDataJSON, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	rawAttestation, err := decodeBase64(resp.Response.AttestationObject)
+	if err != nil {
+		return Credential{}, verificationError("invalid attestationObject encoding")
+	}
+	item, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return Credential{}, verificationError("invalid attestationObject")
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, verificationError("invalid attestationObject")
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	auth, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.verifyAuthenticatorData(auth, requireUV); err != nil {
+		return Credential{}, err
+	}
+	if auth.flags&flagAttested == 0 || len(auth.credID) == 0 {
+		return Credential{}, verificationError("missing attested credential data")
+	}
+	rawID, err := decodeBase64(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, auth.credID) {
+		return Credential{}, verificationError("credential id mismatch")
+	}
+	key, err := parsePublicKey(auth.publicKey)
+	if err != nil {
+		return Credential{}, verificationError("%v", err)
+	}
+
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return Credential{}, verificationError("none attestation with statement")
+		}
+	case "packed":
+		// 只支持自证明：用凭证私钥对 authData || clientDataHash 签名
+		if _, hasCert := statement["x5c"]; hasCert {
+			return Credential{}, verificationError("packed attestation with certificate is not supported")
+		}
+		alg, _ := statement["alg"].(int64)
+		sig, _ := statement["sig"].([]byte)
+		clientHash := sha256.Sum256(clientDataJSON)
+		if alg != key.alg || !key.verify(append(append([]byte{}, rawAuthData...), clientHash[:]...), sig) {
+			return Credential{}, verificationError("invalid packed self attestation")
+		}
+	default:
+		return Credential{}, verificationError("unsupported attestation format %q", format)
+	}
+
+	return Credential{
+		ID:           base64.RawURLEncoding.EncodeToString(auth.credID),
+		PublicKey:    auth.publicKey,
+		SignCount:    auth.signCount,
+		AAGUID:       auth.aaguid,
+		UserVerified: auth.flags&flagUserVerified != 0,
+		Transports:   resp.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion 用已注册的公钥校验断言。storedCount 为上次记录的签名计数，
+// 计数不递增（且不是都为 0 的不计数认证器）时返回 ErrSignCount。
+func (rp RelyingParty) VerifyAssertion(challenge string, resp AssertionResponse, publicKeyCOSE []byte, storedCount uint32, requireUV bool) (Assertion, error) {
+	if resp.Type != "public-key" {
+		return Assertion{}, verificationError("unexpected credential type %q", resp.Type)
+	}
+	clientDataJSON, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return Assertion{}, err
+	}
+	rawAuthData, err := decodeBase64(resp.Response.AuthenticatorData)
+	if err != nil {
+		return Assertion{}, verificationError("invalid authenticatorData encoding")
+	}
+	auth, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Assertion{}, err
+	}
+	if err := rp.verifyAuthenticatorData(auth, requireUV); err != nil {
+		return Assertion{}, err
+	}
+
+	key, err := parsePublicKey(publicKeyCOSE)
+	if err != nil {
+		return Assertion{}, verificationError("%v", err)
+	}
+	signature, err := decodeBase64(resp.Response.Signature)
+	if err != nil {
+		return Assertion{}, verificationError("invalid signature encoding")
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientHash[:]...)
+	if !key.verify(signed, signature) {
+		return Assertion{}, verificationError("invalid signature")
+	}
+
+	if (auth.signCount != 0 || storedCount != 0) && auth.signCount <= storedCount {
+		return Assertion{}, ErrSignCount
+	}
+	return Assertion{SignCount: auth.signCount, UserVerified: auth.flags&flagUserVerified != 0}, nil
+}
@@ -0,0 +1,89 @@
+package webauthn_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"subvault/internal/webauthn"
+	"subvault/internal/webauthn/webauthntest"
+)
+
+var rp = webauthn.RelyingParty{ID: "localhost", Name: "SubVault", Origins: []string{"http://localhost:5173"}}
+
+func register(t *testing.T, auth *webauthntest.Authenticator) webauthn.Credential {
+	t.Helper()
+	challenge, _ := webauthn.NewChallenge()
+	cred, err := rp.VerifyRegistration(challenge, auth.Register(challenge), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	auth := webauthntest.New("localhost", "http://localhost:5173")
+	cred := register(t, auth)
+	if cred.ID != auth.CredentialID() || !cred.UserVerified || len(cred.PublicKey) == 0 {
+		t.Fatalf("注册结果不对: %+v", cred)
+	}
+
+	challenge, _ := webauthn.NewChallenge()
+	result, err := rp.VerifyAssertion(challenge, auth.Assert(challenge), cred.PublicKey, cred.SignCount, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SignCount != 1 || !result.UserVerified {
+		t.Fatalf("断言结果不对: %+v", result)
+	}
+
+	// 同一个断言不能换挑战重放，签名计数也不能回退
+	stale := auth.Assert(challenge)
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyAssertion(other, stale, cred.PublicKey, result.SignCount, true); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("挑战不符应拒绝: %v", err)
+	}
+	if _, err := rp.VerifyAssertion(challenge, stale, cred.PublicKey, 5, true); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Fatalf("签名计数回退应拒绝: %v", err)
+	}
+}
+
+func TestVerificationRejectsMismatches(t *testing.T) {
+	challenge, _ := webauthn.NewChallenge()
+
+	evil := webauthntest.New("localhost", "https://evil.example")
+	if _, err := rp.VerifyRegistration(challenge, evil.Register(challenge), false); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("来源不在白名单应拒绝: %v", err)
+	}
+	otherRP := webauthntest.New("evil.example", "http://localhost:5173")
+	if _, err := rp.VerifyRegistration(challenge, otherRP.Register(challenge), false); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("RP ID 不符应拒绝: %v", err)
+	}
+
+	noUV := webauthntest.New("localhost", "http://localhost:5173")
+	noUV.UserVerified = false
+	if _, err := rp.VerifyRegistration(challenge, noUV.Register(challenge), true); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("要求用户验证时应拒绝未验证的认证器: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(challenge, noUV.Register(challenge), false)
+	if err != nil {
+		t.Fatalf("不要求用户验证时应接受: %v", err)
+	}
+
+	// 用另一个认证器的签名冒充
+	impostor := webauthntest.New("localhost", "http://localhost:5173")
+	assertion := impostor.Assert(challenge)
+	assertion.ID, assertion.RawID = noUV.CredentialID(), noUV.CredentialID()
+	if _, err := rp.VerifyAssertion(challenge, assertion, cred.PublicKey, 0, false); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("签名不符应拒绝: %v", err)
+	}
+
+	// 篡改 authenticatorData 后签名失效
+	assertion = noUV.Assert(challenge)
+	raw, _ := base64.RawURLEncoding.DecodeString(assertion.Response.AuthenticatorData)
+	raw[len(raw)-1] ^= 0xff
+	assertion.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(raw)
+	if _, err := rp.VerifyAssertion(challenge, assertion, cred.PublicKey, 0, false); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("篡改认证器数据应拒绝: %v", err)
+	}
+}
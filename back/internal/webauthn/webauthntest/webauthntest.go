@@ -0,0 +1,196 @@
+// Package webauthntest 提供测试用的软件认证器，按浏览器的格式生成注册和断言响应。
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"subvault/internal/webauthn"
+)
+
+// Authenticator 基于 P-256（ES256）的软件认证器，只保存一个凭证
+type Authenticator struct {
+	Origin string
+	RPID   string
+	// UserVerified 是否在认证器数据中声明已完成用户验证
+	UserVerified bool
+
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	signCount uint32
+}
+
+// New 创建软件认证器，origin 为模拟的前端来源
+func New(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	credID := make([]byte, 16)
+	if _, err := rand.Read(credID); err != nil {
+		panic(err)
+	}
+	return &Authenticator{Origin: origin, RPID: rpID, UserVerified: true, key: key, credID: credID}
+}
+
+// CredentialID 凭证 ID（base64url）
+func (a *Authenticator) CredentialID() string {
+	return base64.RawURLEncoding.EncodeToString(a.credID)
+}
+
+// Register 对注册挑战生成 none 证明的注册响应
+func (a *Authenticator) Register(challenge string) webauthn.RegistrationResponse {
+	clientDataJSON := a.clientData("webauthn.create", challenge)
+	authData := a.authData(true)
+	attestation := encodeMap([]mapEntry{
+		{key: "fmt", value: "none"},
+		{key: "attStmt", value: []mapEntry{}},
+		{key: "authData", value: authData},
+	})
+	return webauthn.RegistrationResponse{
+		ID:    a.CredentialID(),
+		RawID: a.CredentialID(),
+		Type:  "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    b64(clientDataJSON),
+			AttestationObject: b64(attestation),
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+// Assert 对断言挑战签名，每次调用签名计数加一
+func (a *Authenticator) Assert(challenge string) webauthn.AssertionResponse {
+	a.signCount++
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	authData := a.authData(false)
+	clientHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return webauthn.AssertionResponse{
+		ID:    a.CredentialID(),
+		RawID: a.CredentialID(),
+		Type:  "public-key",
+		Response: webauthn.AssertionData{
+			ClientDataJSON:    b64(clientDataJSON),
+			AuthenticatorData: b64(authData),
+			Signature:         b64(sig),
+		},
+	}
+}
+
+func (a *Authenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (a *Authenticator) authData(attested bool) []byte {
+	rpHash := sha256.Sum256([]byte(a.RPID))
+	flags := byte(0x01)
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	if attested {
+		flags |= 0x40
+	}
+	out := append([]byte{}, rpHash[:]...)
+	out = append(out, flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	if attested {
+		out = append(out, make([]byte, 16)...) // AAGUID 全零
+		out = binary.BigEndian.AppendUint16(out, uint16(len(a.credID)))
+		out = append(out, a.credID...)
+		out = append(out, a.coseKey()...)
+	}
+	return out
+}
+
+func (a *Authenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	return encodeMap([]mapEntry{
+		{key: int64(1), value: int64(2)},
+		{key: int64(3), value: int64(webauthn.AlgES256)},
+		{key: int64(-1), value: int64(1)},
+		{key: int64(-2), value: x},
+		{key: int64(-3), value: y},
+	})
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// === 最小 CBOR 编码，只覆盖上面用到的类型 ===
+
+type mapEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func encodeMap(entries []mapEntry) []byte {
+	// 按编码后的键排序，与 CTAP2 规范编码一致
+	encoded := make([][2][]byte, 0, len(entries))
+	for _, e := range entries {
+		encoded = append(encoded, [2][]byte{encode(e.key), encode(e.value)})
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		ki, kj := encoded[i][0], encoded[j][0]
+		if len(ki) != len(kj) {
+			return len(ki) < len(kj)
+		}
+		return string(ki) < string(kj)
+	})
+	out := header(5, uint64(len(entries)))
+	for _, e := range encoded {
+		out = append(out, e[0]...)
+		out = append(out, e[1]...)
+	}
+	return out
+}
+
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v >= 0 {
+			return header(0, uint64(v))
+		}
+		return header(1, uint64(-1-v))
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case []mapEntry:
+		return encodeMap(v)
+	}
+	panic("webauthntest: unsupported cbor value")
+}
+
+func header(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	}
+}
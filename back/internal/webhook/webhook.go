@@ -84,6 +84,24 @@ func BuildText(sub models.Subscription, daysLeft int) string {
 		sub.Name, when, sub.RenewalDate, FormatAmount(sub.Currency, sub.Cost))
 }
 
+// BuildLockoutText 连续解锁失败触发锁定时的安全提醒
+func BuildLockoutText(username, ip string, lockedFor time.Duration) string {
+	return fmt.Sprintf("【SubVault 安全提醒】\n账户 %s 连续解锁失败，已锁定 %s\n来源 IP：%s\n如果不是你本人操作，请尽快更换主密钥并检查已登录设备。",
+		username, FormatDuration(lockedFor), ip)
+}
+
+// FormatDuration 以分钟、小时等可读形式显示时长，不足一分钟按秒
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d 秒", int((d+time.Second-1)/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%d 分钟", int((d+time.Minute-1)/time.Minute))
+	default:
+		return fmt.Sprintf("%d 小时", int((d+time.Hour-1)/time.Hour))
+	}
+}
+
 func BuildTestText() string {
 	return "【SubVault 测试提醒】\n这是一条测试消息。如果能看到它，说明 Webhook 已接通，到期前会按设定天数提醒。"
 }
@@ -1,28 +1,65 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"os"
 
+	"subvault/internal/accounts"
 	"subvault/internal/config"
 	"subvault/internal/database"
 	"subvault/internal/jobs"
+	"subvault/internal/keyring"
 	"subvault/internal/router"
+	"subvault/internal/store"
 )
 
 func main() {
 	// 加载配置
 	cfg := config.Load()
 
-	// 初始化数据库
-	if err := database.Init(cfg.DatabasePath); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+		runRotateKey(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
+	// 初始化数据库并执行迁移；数据库版本比本程序新时拒绝启动，避免旧程序写坏新结构
+	db, err := database.Init(cfg.DatabaseTarget())
+	if err != nil {
+		if errors.Is(err, database.ErrSchemaTooNew) {
+			log.Fatalf("%v，请升级程序后再启动", err)
+		}
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	jobs.Start()
+	// 升级前的唯一保险库认领为管理员账户
+	if adopted, err := accounts.AdoptLegacyVault(db, cfg.AdminUsername, cfg.MasterKey); err != nil {
+		log.Fatalf("Failed to adopt legacy vault: %v", err)
+	} else if adopted {
+		log.Printf("已将原有保险库认领为管理员账户 %s，请使用该用户名和 MASTER_KEY 解锁", cfg.AdminUsername)
+	}
+
+	// 还没有任何用户时，第一个注册的用户成为管理员，需要初始化令牌或 ADMIN_USERNAME + MASTER_KEY
+	if setup, err := accounts.NeedsSetup(db); err != nil {
+		log.Fatalf("Failed to check users: %v", err)
+	} else if setup && cfg.SetupTokenGenerated {
+		log.Printf("尚未注册管理员，首次注册请使用初始化令牌: %s（可用 SETUP_TOKEN 固定）", cfg.SetupToken)
+	}
+
+	// 保险库数据密钥缓存，由路由和后台任务共享
+	keys := keyring.New(cfg)
+
+	// 订阅、凭证、备忘录等记录经由 store 读写，其余数据由各处理器直接使用 db
+	st := store.NewSQL(db)
+
+	jobs.Start(db, st, keys, cfg.TrashRetention)
 
 	// 设置路由
-	r := router.Setup(cfg)
+	r := router.Setup(cfg, keys, db, st)
 
 	// 启动服务器
 	port := os.Getenv("PORT")
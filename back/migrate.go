@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"subvault/internal/config"
+	"subvault/internal/database"
+)
+
+// runMigrate 用法:
+//
+//	subvault migrate [-dry-run]
+//
+// 服务启动时会自动执行待执行的迁移；本命令用于升级前单独执行或查看计划。
+// -dry-run 只列出当前版本和待执行的迁移及其语句，不修改数据库。
+func runMigrate(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只列出待执行的迁移，不修改数据库")
+	_ = fs.Parse(args)
+
+	db, err := database.Open(cfg.DatabaseTarget())
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	plan, err := database.Migrate(db, *dryRun)
+	if err != nil {
+		log.Fatalf("迁移失败: %v", err)
+	}
+	if len(plan.Pending) == 0 {
+		log.Printf("数据库已是最新版本 %d", plan.Current)
+		return
+	}
+	if plan.Legacy {
+		log.Print("数据库由旧版本建立，将先按基线补齐缺少的表、索引和列")
+	}
+	for _, m := range plan.Pending {
+		if !*dryRun {
+			log.Printf("已执行 %04d_%s", m.Version, m.Name)
+			continue
+		}
+		log.Printf("待执行 %04d_%s:", m.Version, m.Name)
+		for _, stmt := range database.Statements(m.SQL) {
+			log.Printf("  %s", stmt)
+		}
+	}
+	if *dryRun {
+		log.Printf("当前版本 %d，执行后为 %d（未做任何修改）", plan.Current, plan.Latest)
+	} else {
+		log.Printf("数据库已从版本 %d 升级到 %d", plan.Current, plan.Latest)
+	}
+}
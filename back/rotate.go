@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"subvault/internal/config"
+	"subvault/internal/database"
+	"subvault/internal/rotation"
+)
+
+// runRotateKey 用法:
+//
+//	subvault rotate-key -old <旧密钥[,更早的密钥]> -new <新密钥>
+//
+// 未指定时 -new 取 ENCRYPTION_KEY，-old 取 ENCRYPTION_KEY_PREVIOUS。
+// 推荐流程：先把新密钥设为 ENCRYPTION_KEY、旧密钥放进 ENCRYPTION_KEY_PREVIOUS 并重启，
+// 服务在轮换期间可同时读取新旧数据；再执行本命令，完成后即可移除 ENCRYPTION_KEY_PREVIOUS。
+func runRotateKey(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	oldFlag := fs.String("old", strings.Join(cfg.PreviousEncryptionKeys, ","), "旧加密密钥，多个用逗号分隔")
+	newFlag := fs.String("new", cfg.EncryptionKey, "新加密密钥")
+	_ = fs.Parse(args)
+
+	var oldKeys []string
+	for _, key := range strings.Split(*oldFlag, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			oldKeys = append(oldKeys, key)
+		}
+	}
+	if len(oldKeys) == 0 {
+		log.Fatal("请通过 -old 或 ENCRYPTION_KEY_PREVIOUS 提供旧密钥")
+	}
+	if strings.TrimSpace(*newFlag) == "" {
+		log.Fatal("请通过 -new 或 ENCRYPTION_KEY 提供新密钥")
+	}
+
+	db, err := database.Init(cfg.DatabaseTarget())
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	report, err := rotation.Rotate(db, oldKeys, *newFlag, cfg.KDF)
+	if err != nil {
+		log.Fatalf("密钥轮换失败，数据未做任何修改: %v", err)
+	}
+	for table, n := range report {
+		if table != "vaults" && n > 0 {
+			log.Printf("%s: 迁移到数据密钥 %d 行", table, n)
+		}
+	}
+	log.Printf("密钥轮换完成，已重新包裹 %d 个保险库的数据密钥", report["vaults"])
+}
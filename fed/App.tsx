@@ -10,10 +10,17 @@ const App: React.FC = () => {
     isLoading: authLoading,
     error: authError,
     unlock,
+    register,
+    registrationEnabled,
+    setupRequired,
     lock,
     totpRequired,
     unlockWithTotp,
     cancelTotp,
+    passkeyAvailable,
+    unlockWithPasskey,
+    passwordlessAvailable,
+    unlockPasswordless,
   } = useAuth();
 
   const {
@@ -21,11 +28,13 @@ const App: React.FC = () => {
     vaultData,
     error: vaultError,
     loadVault,
+    syncVault,
     addSubscription,
     updateSubscription,
     deleteSubscription,
     addCredential,
     updateCredential,
+    restoreCredentialVersion,
     batchAddCredentials,
     batchUpdateCredentialGroups,
     batchUpdateSubscriptionGroups,
@@ -41,6 +50,18 @@ const App: React.FC = () => {
     }
   }, [isAuthenticated, loadVault]);
 
+  // 切回页面时增量同步其他设备上的修改
+  useEffect(() => {
+    if (!isAuthenticated) return;
+    const onVisible = () => {
+      if (document.visibilityState === 'visible') {
+        syncVault();
+      }
+    };
+    document.addEventListener('visibilitychange', onVisible);
+    return () => document.removeEventListener('visibilitychange', onVisible);
+  }, [isAuthenticated, syncVault]);
+
   // 初始化检查中
   if (authLoading && !isAuthenticated) {
     return (
@@ -55,11 +76,18 @@ const App: React.FC = () => {
     return (
       <LoginPage
         onUnlock={unlock}
+        onRegister={register}
+        registrationEnabled={registrationEnabled}
+        setupRequired={setupRequired}
         isLoading={authLoading}
         error={authError}
         totpRequired={totpRequired}
         onUnlockWithTotp={unlockWithTotp}
         onCancelTotp={cancelTotp}
+        passkeyAvailable={passkeyAvailable}
+        onUnlockWithPasskey={unlockWithPasskey}
+        passwordlessAvailable={passwordlessAvailable}
+        onUnlockPasswordless={unlockPasswordless}
       />
     );
   }
@@ -101,6 +129,7 @@ const App: React.FC = () => {
       onDeleteSubscription={deleteSubscription}
       onAddCredential={addCredential}
       onUpdateCredential={updateCredential}
+      onRestoreCredentialVersion={restoreCredentialVersion}
       onBatchAddCredentials={batchAddCredentials}
       onBatchUpdateCredentialGroups={batchUpdateCredentialGroups}
       onBatchUpdateSubscriptionGroups={batchUpdateSubscriptionGroups}
@@ -1,7 +1,8 @@
-import React, { useState } from 'react';
-import { Credential } from '../../types';
-import { KeyIcon, GlobeIcon, CopyIcon, CheckIcon, EyeIcon, EditIcon, TrashIcon } from '../Icons';
+import React, { useEffect, useState } from 'react';
+import { Credential, CredentialHistoryEntry } from '../../types';
+import { KeyIcon, GlobeIcon, CopyIcon, CheckIcon, EyeIcon, EditIcon, TrashIcon, RefreshIcon } from '../Icons';
 import { copyToClipboard } from '../../utils/clipboard';
+import { api } from '../../services/api';
 import { ModalOverlay } from './ModalOverlay';
 import { GroupBadge } from '../GroupBadge';
 import { VaultGroup } from '../../utils/groups';
@@ -13,6 +14,7 @@ interface CredentialDetailModalProps {
   onClose: () => void;
   onEdit?: (credential: Credential) => void;
   onDelete?: (id: string) => void;
+  onRestoreVersion?: (historyId: string) => Promise<void>;
 }
 
 export const CredentialDetailModal: React.FC<CredentialDetailModalProps> = ({
@@ -21,10 +23,19 @@ export const CredentialDetailModal: React.FC<CredentialDetailModalProps> = ({
   groups = [],
   onClose,
   onEdit,
-  onDelete
+  onDelete,
+  onRestoreVersion
 }) => {
   const [showPassword, setShowPassword] = useState(false);
   const [copiedField, setCopiedField] = useState<string | null>(null);
+  const [history, setHistory] = useState<CredentialHistoryEntry[] | null>(null);
+  const [historyError, setHistoryError] = useState('');
+
+  // 切换凭证时收起历史版本
+  useEffect(() => {
+    setHistory(null);
+    setHistoryError('');
+  }, [credential?.id]);
 
   if (!isOpen || !credential) return null;
 
@@ -50,6 +61,26 @@ export const CredentialDetailModal: React.FC<CredentialDetailModalProps> = ({
     }
   };
 
+  const loadHistory = async () => {
+    setHistoryError('');
+    try {
+      setHistory(await api.getCredentialHistory(credential.id));
+    } catch (err: any) {
+      setHistoryError(err.message || '读取历史版本失败');
+    }
+  };
+
+  const handleRestoreVersion = async (entry: CredentialHistoryEntry) => {
+    if (!onRestoreVersion || !confirm('确定恢复到这个版本吗？当前密码和备注会保存为新的历史版本。')) return;
+    setHistoryError('');
+    try {
+      await onRestoreVersion(entry.id);
+      await loadHistory();
+    } catch (err: any) {
+      setHistoryError(err.message || '恢复历史版本失败');
+    }
+  };
+
   const InfoRow = ({ label, value, canCopy, isSensitive, isLink }: {
     label: string;
     value?: string;
@@ -154,6 +185,46 @@ export const CredentialDetailModal: React.FC<CredentialDetailModalProps> = ({
               </span>
             </div>
           )}
+
+          <div className="pt-3 mt-2 border-t border-slate-100">
+            {history === null ? (
+              <button
+                onClick={loadHistory}
+                className="flex items-center space-x-1 text-xs text-slate-500 hover:text-blue-600 cursor-pointer"
+              >
+                <RefreshIcon className="w-3.5 h-3.5" />
+                <span>查看历史版本</span>
+              </button>
+            ) : history.length === 0 ? (
+              <p className="text-xs text-slate-400">没有历史版本，修改密码或备注后会保留旧值</p>
+            ) : (
+              <div className="space-y-2">
+                <span className="text-xs font-medium text-slate-400 uppercase tracking-wider">历史版本</span>
+                {history.map(entry => (
+                  <div key={entry.id} className="p-2 rounded-lg bg-slate-50 text-sm">
+                    <div className="flex items-center justify-between">
+                      <span className="text-xs text-slate-400">
+                        替换于 {new Date(entry.createdAt).toLocaleString('zh-CN')}
+                      </span>
+                      {onRestoreVersion && (
+                        <button
+                          onClick={() => handleRestoreVersion(entry)}
+                          className="text-xs text-blue-600 hover:text-blue-700 cursor-pointer"
+                        >
+                          恢复
+                        </button>
+                      )}
+                    </div>
+                    {entry.password && (
+                      <p className="mt-1 font-mono break-all">{showPassword ? entry.password : '••••••••••••'}</p>
+                    )}
+                    {entry.notes && <p className="mt-1 text-xs text-slate-500 break-all">{entry.notes}</p>}
+                  </div>
+                ))}
+              </div>
+            )}
+            {historyError && <p className="mt-2 text-xs text-rose-600">{historyError}</p>}
+          </div>
         </div>
 
         {/* 底部操作 */}
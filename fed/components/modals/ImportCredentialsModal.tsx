@@ -1,5 +1,6 @@
 import React, { useState, useRef } from 'react';
-import { Credential } from '../../types';
+import { Credential, CredentialImportItem } from '../../types';
+import { api } from '../../services/api';
 import { UploadIcon } from '../Icons';
 import { ModalOverlay } from './ModalOverlay';
 
@@ -9,106 +10,68 @@ interface ImportCredentialsModalProps {
   onImport: (credentials: Partial<Credential>[]) => void;
 }
 
-interface ParsedCredential {
-  name: string;
-  url: string;
-  username: string;
-  password: string;
+interface ParsedCredential extends CredentialImportItem {
   selected: boolean;
 }
 
+const FORMAT_LABELS: Record<string, string> = {
+  'bitwarden-json': 'Bitwarden JSON',
+  'bitwarden-csv': 'Bitwarden CSV',
+  '1password-1pux': '1Password 1PUX',
+  '1password-csv': '1Password CSV',
+  'keepass-xml': 'KeePass XML',
+  'chrome-csv': 'Chrome / Edge CSV',
+  'firefox-csv': 'Firefox CSV',
+};
+
+// 读取文件原始内容并转成 base64，1PUX 是 zip 包，不能按文本读取
+const readFileAsBase64 = (file: File): Promise<string> => new Promise((resolve, reject) => {
+  const reader = new FileReader();
+  reader.onload = () => {
+    const bytes = new Uint8Array(reader.result as ArrayBuffer);
+    let binary = '';
+    for (let i = 0; i < bytes.length; i += 0x8000) {
+      binary += String.fromCharCode(...bytes.subarray(i, i + 0x8000));
+    }
+    resolve(btoa(binary));
+  };
+  reader.onerror = () => reject(new Error('文件读取失败'));
+  reader.readAsArrayBuffer(file);
+});
+
 export const ImportCredentialsModal: React.FC<ImportCredentialsModalProps> = ({
   isOpen,
   onClose,
   onImport
 }) => {
   const [parsedData, setParsedData] = useState<ParsedCredential[]>([]);
+  const [format, setFormat] = useState('');
+  const [unsupported, setUnsupported] = useState(0);
   const [error, setError] = useState('');
+  const [loading, setLoading] = useState(false);
   const [step, setStep] = useState<'upload' | 'preview'>('upload');
   const fileInputRef = useRef<HTMLInputElement>(null);
 
-  const handleFileSelect = (e: React.ChangeEvent<HTMLInputElement>) => {
+  const handleFileSelect = async (e: React.ChangeEvent<HTMLInputElement>) => {
     const file = e.target.files?.[0];
     if (!file) return;
 
-    const reader = new FileReader();
-    reader.onload = (event) => {
-      try {
-        const text = event.target?.result as string;
-        const parsed = parseCSV(text);
-        if (parsed.length === 0) {
-          setError('未找到有效的凭证数据');
-          return;
-        }
-        setParsedData(parsed.map(p => ({ ...p, selected: true })));
-        setStep('preview');
-        setError('');
-      } catch (err) {
-        setError('CSV 解析失败，请确保文件格式正确');
-      }
-    };
-    reader.readAsText(file);
-  };
-
-  // 解析 CSV（支持 Chrome/Edge/Firefox 格式）
-  const parseCSV = (text: string): Omit<ParsedCredential, 'selected'>[] => {
-    const lines = text.split('\n').filter(line => line.trim());
-    if (lines.length < 2) return [];
-
-    const header = lines[0].toLowerCase();
-    let nameIdx = -1, urlIdx = -1, usernameIdx = -1, passwordIdx = -1;
-
-    // 解析表头
-    const headers = parseCSVLine(lines[0]);
-    headers.forEach((h, i) => {
-      const col = h.toLowerCase().trim();
-      if (col === 'name' || col === '名称' || col === 'title') nameIdx = i;
-      if (col === 'url' || col === 'website' || col === '网址' || col === 'origin') urlIdx = i;
-      if (col === 'username' || col === 'login' || col === '用户名' || col === 'email') usernameIdx = i;
-      if (col === 'password' || col === '密码') passwordIdx = i;
-    });
-
-    if (usernameIdx === -1 || passwordIdx === -1) {
-      throw new Error('CSV 格式不正确');
-    }
-
-    const results: Omit<ParsedCredential, 'selected'>[] = [];
-    for (let i = 1; i < lines.length; i++) {
-      const cols = parseCSVLine(lines[i]);
-      if (cols.length <= Math.max(usernameIdx, passwordIdx)) continue;
-
-      const username = cols[usernameIdx]?.trim();
-      const password = cols[passwordIdx]?.trim();
-      if (!username) continue;
-
-      results.push({
-        name: nameIdx >= 0 ? cols[nameIdx]?.trim() || '' : '',
-        url: urlIdx >= 0 ? cols[urlIdx]?.trim() || '' : '',
-        username,
-        password: password || '',
-      });
-    }
-    return results;
-  };
-
-  // 解析 CSV 行（处理引号）
-  const parseCSVLine = (line: string): string[] => {
-    const result: string[] = [];
-    let current = '';
-    let inQuotes = false;
-    for (let i = 0; i < line.length; i++) {
-      const char = line[i];
-      if (char === '"') {
-        inQuotes = !inQuotes;
-      } else if (char === ',' && !inQuotes) {
-        result.push(current);
-        current = '';
-      } else {
-        current += char;
-      }
+    setLoading(true);
+    setError('');
+    try {
+      const content = await readFileAsBase64(file);
+      const preview = await api.previewCredentialImport(file.name, content);
+      // 已存在的凭证导入时会被跳过，默认不勾选
+      setParsedData(preview.items.map(item => ({ ...item, selected: !item.exists })));
+      setFormat(preview.format);
+      setUnsupported(preview.unsupported);
+      setStep('preview');
+    } catch (err: any) {
+      setError(err.message || '文件解析失败，请确保文件格式正确');
+    } finally {
+      setLoading(false);
+      if (fileInputRef.current) fileInputRef.current.value = '';
     }
-    result.push(current);
-    return result;
   };
 
   const handleToggleAll = (checked: boolean) => {
@@ -122,26 +85,21 @@ export const ImportCredentialsModal: React.FC<ImportCredentialsModalProps> = ({
   const handleImport = () => {
     const selected = parsedData.filter(p => p.selected);
     const credentials: Partial<Credential>[] = selected.map(p => ({
-      label: p.name || extractDomain(p.url) || p.username,
+      label: p.label,
       username: p.username,
       password: p.password,
-      notes: p.url ? `来源: ${p.url}` : undefined,
+      notes: p.notes,
+      website: p.website,
+      category: p.category,
     }));
     onImport(credentials);
     handleClose();
   };
 
-  const extractDomain = (url: string): string => {
-    try {
-      const domain = new URL(url).hostname.replace('www.', '');
-      return domain.split('.')[0];
-    } catch {
-      return '';
-    }
-  };
-
   const handleClose = () => {
     setParsedData([]);
+    setFormat('');
+    setUnsupported(0);
     setError('');
     setStep('upload');
     if (fileInputRef.current) fileInputRef.current.value = '';
@@ -167,27 +125,30 @@ export const ImportCredentialsModal: React.FC<ImportCredentialsModalProps> = ({
             <div className="space-y-4">
               <div className="bg-slate-50 border-2 border-dashed border-slate-200 rounded-xl p-8 text-center">
                 <UploadIcon className="w-10 h-10 text-slate-300 mx-auto mb-3" />
-                <p className="text-sm text-slate-600 mb-2">选择从浏览器导出的 CSV 文件</p>
-                <p className="text-xs text-slate-400 mb-4">支持 Chrome、Edge、Firefox 导出格式</p>
+                <p className="text-sm text-slate-600 mb-2">选择从密码管理器或浏览器导出的文件</p>
+                <p className="text-xs text-slate-400 mb-4">支持 Bitwarden、1Password、KeePass、Chrome、Edge、Firefox，原文件夹会作为分组</p>
                 <input
                   ref={fileInputRef}
                   type="file"
-                  accept=".csv"
+                  accept=".csv,.json,.xml,.1pux"
                   onChange={handleFileSelect}
                   className="hidden"
                   id="csv-upload"
                 />
                 <label
                   htmlFor="csv-upload"
-                  className="inline-block px-4 py-2 bg-blue-600 hover:bg-blue-700 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors"
+                  className={`inline-block px-4 py-2 bg-blue-600 hover:bg-blue-700 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors ${loading ? 'opacity-50 pointer-events-none' : ''}`}
                 >
-                  选择文件
+                  {loading ? '解析中...' : '选择文件'}
                 </label>
               </div>
               {error && <p className="text-rose-500 text-sm">{error}</p>}
               <div className="bg-amber-50 border border-amber-200 rounded-lg p-3">
-                <p className="text-xs text-amber-700 font-medium mb-1">如何导出浏览器密码？</p>
+                <p className="text-xs text-amber-700 font-medium mb-1">如何导出密码？</p>
                 <ul className="text-xs text-amber-600 space-y-1">
+                  <li>• Bitwarden: 工具 → 导出密码库 → .json 或 .csv（不要选加密格式）</li>
+                  <li>• 1Password: 文件 → 导出 → 1PUX 或 CSV</li>
+                  <li>• KeePass: 文件 → 导出 → KeePass XML (2.x)</li>
                   <li>• Chrome: 设置 → 密码管理器 → 导出密码</li>
                   <li>• Edge: 设置 → 密码 → 导出密码</li>
                   <li>• Firefox: 设置 → 密码 → ⋯ → 导出登录信息</li>
@@ -206,6 +167,9 @@ export const ImportCredentialsModal: React.FC<ImportCredentialsModalProps> = ({
                   />
                   <span className="text-slate-600">全选</span>
                 </label>
+                <span className="text-xs text-slate-400">
+                  {FORMAT_LABELS[format] || format}{unsupported > 0 ? ` · ${unsupported} 条不支持的条目已忽略` : ''}
+                </span>
                 <button
                   onClick={() => setStep('upload')}
                   className="text-blue-600 hover:text-blue-700 text-xs cursor-pointer"
@@ -228,11 +192,15 @@ export const ImportCredentialsModal: React.FC<ImportCredentialsModalProps> = ({
                       className="w-4 h-4 rounded border-slate-300 text-blue-600 cursor-pointer"
                     />
                     <div className="flex-1 min-w-0">
-                      <p className="text-sm font-medium text-slate-800 truncate">
-                        {item.name || extractDomain(item.url) || item.username}
-                      </p>
+                      <p className="text-sm font-medium text-slate-800 truncate">{item.label}</p>
                       <p className="text-xs text-slate-400 truncate">{item.username}</p>
                     </div>
+                    {item.category && (
+                      <span className="text-xs text-slate-500 bg-slate-100 px-2 py-0.5 rounded flex-shrink-0">{item.category}</span>
+                    )}
+                    {item.exists && (
+                      <span className="text-xs text-amber-600 bg-amber-50 px-2 py-0.5 rounded flex-shrink-0">已存在</span>
+                    )}
                   </label>
                 ))}
               </div>
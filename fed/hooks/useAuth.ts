@@ -1,5 +1,7 @@
 import { useState, useEffect } from 'react';
 import { api } from '../services/api';
+import { WebAuthnChallenge } from '../types';
+import { getDeviceSecret, getPasskeyAssertion, isWebAuthnSupported } from '../utils/webauthn';
 
 export const useAuth = () => {
   const [isAuthenticated, setIsAuthenticated] = useState<boolean>(false);
@@ -7,6 +9,12 @@ export const useAuth = () => {
   const [error, setError] = useState<string>('');
   const [totpRequired, setTotpRequired] = useState<boolean>(false);
   const [pendingMasterKey, setPendingMasterKey] = useState<string>('');
+  const [pendingUsername, setPendingUsername] = useState<string>('');
+  // 注册了通行密钥时，解锁第二步可改用通行密钥
+  const [passkeyChallenge, setPasskeyChallenge] = useState<WebAuthnChallenge | null>(null);
+  const [registrationEnabled, setRegistrationEnabled] = useState<boolean>(false);
+  // 还没有任何用户，注册的是管理员，需要初始化令牌
+  const [setupRequired, setSetupRequired] = useState<boolean>(false);
 
   // 初始化时检查是否有有效 token
   useEffect(() => {
@@ -25,25 +33,45 @@ export const useAuth = () => {
     };
 
     checkAuth();
+    api.getRegistrationStatus()
+      .then((status) => {
+        setRegistrationEnabled(status.enabled);
+        setSetupRequired(!!status.setupRequired);
+      })
+      .catch(() => setRegistrationEnabled(false));
   }, []);
 
-  const unlock = async (masterKey: string, totpCode?: string) => {
+  const unlock = async (
+    username: string,
+    masterKey: string,
+    totpCode?: string,
+    passkey?: { challengeId: string; assertion: unknown }
+  ) => {
     setIsLoading(true);
     setError('');
     try {
-      await api.unlock(masterKey, totpCode);
+      await api.unlock(username, masterKey, totpCode, passkey);
       setIsAuthenticated(true);
       setTotpRequired(false);
+      setPasskeyChallenge(null);
       setPendingMasterKey('');
+      setPendingUsername('');
     } catch (err: any) {
-      if (err.status === 403 && err.data?.totp_required) {
+      if (err.status === 403 && (err.data?.totp_required || err.data?.webauthn_required)) {
         setTotpRequired(true);
+        setPasskeyChallenge(err.data.webauthn || null);
         setPendingMasterKey(masterKey);
+        setPendingUsername(username);
         setError('');
       } else {
         setError(err.message || '解锁失败');
-        setTotpRequired(false);
-        setPendingMasterKey('');
+        // 通行密钥验证失败时留在验证页，由 unlockWithPasskey 重新获取挑战
+        if (!passkey) {
+          setTotpRequired(false);
+          setPasskeyChallenge(null);
+          setPendingMasterKey('');
+          setPendingUsername('');
+        }
       }
       throw err;
     } finally {
@@ -51,17 +79,78 @@ export const useAuth = () => {
     }
   };
 
+  const register = async (username: string, masterKey: string, setupToken?: string) => {
+    setIsLoading(true);
+    setError('');
+    try {
+      await api.register(username, masterKey, setupToken);
+      setIsAuthenticated(true);
+    } catch (err: any) {
+      setError(err.message || '注册失败');
+      throw err;
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   const unlockWithTotp = async (totpCode: string) => {
     if (!pendingMasterKey) {
       setError('请先输入主密钥');
       return;
     }
-    await unlock(pendingMasterKey, totpCode);
+    await unlock(pendingUsername, pendingMasterKey, totpCode);
+  };
+
+  // 第二步改用通行密钥；挑战只能用一次，失败后重新提交主密钥获取新挑战
+  const unlockWithPasskey = async () => {
+    if (!pendingMasterKey || !passkeyChallenge) {
+      setError('请先输入主密钥');
+      return;
+    }
+    let assertion: unknown;
+    try {
+      assertion = await getPasskeyAssertion(passkeyChallenge);
+    } catch {
+      setError('未完成通行密钥验证');
+      return;
+    }
+    try {
+      await unlock(pendingUsername, pendingMasterKey, undefined, {
+        challengeId: passkeyChallenge.challengeId,
+        assertion,
+      });
+    } catch {
+      await api.unlock(pendingUsername, pendingMasterKey).catch((err: any) => {
+        if (err.data?.webauthn) setPasskeyChallenge(err.data.webauthn);
+      });
+    }
+  };
+
+  // 本设备注册过免密码通行密钥时，可不输入主密钥直接解锁
+  const passwordlessAvailable = isWebAuthnSupported() && !!getDeviceSecret();
+
+  const unlockPasswordless = async () => {
+    const deviceSecret = getDeviceSecret();
+    if (!deviceSecret) return;
+    setIsLoading(true);
+    setError('');
+    try {
+      const challenge = await api.beginPasskeyUnlock();
+      const assertion = await getPasskeyAssertion(challenge);
+      await api.passkeyUnlock(challenge.challengeId, assertion, deviceSecret);
+      setIsAuthenticated(true);
+    } catch (err: any) {
+      setError(err.status ? err.message || '解锁失败' : '未完成通行密钥验证');
+    } finally {
+      setIsLoading(false);
+    }
   };
 
   const cancelTotp = () => {
     setTotpRequired(false);
+    setPasskeyChallenge(null);
     setPendingMasterKey('');
+    setPendingUsername('');
     setError('');
   };
 
@@ -69,7 +158,9 @@ export const useAuth = () => {
     api.lock();
     setIsAuthenticated(false);
     setTotpRequired(false);
+    setPasskeyChallenge(null);
     setPendingMasterKey('');
+    setPendingUsername('');
   };
 
   return {
@@ -78,9 +169,16 @@ export const useAuth = () => {
     error,
     setError,
     unlock,
+    register,
+    registrationEnabled,
+    setupRequired,
     lock,
     totpRequired,
     unlockWithTotp,
     cancelTotp,
+    passkeyAvailable: !!passkeyChallenge,
+    unlockWithPasskey,
+    passwordlessAvailable,
+    unlockPasswordless,
   };
 };
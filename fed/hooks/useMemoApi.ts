@@ -1,6 +1,7 @@
 import { useState, useCallback } from 'react';
 import { api } from '../services/api';
 import { GroupAssignment, Memo } from '../types';
+import { saveWithVersion } from '../utils/conflict';
 
 export const useMemoApi = () => {
   const [memos, setMemos] = useState<Memo[]>([]);
@@ -61,7 +62,13 @@ export const useMemoApi = () => {
     if (updates.isPinned !== undefined) updateData.isPinned = updates.isPinned;
 
     try {
-      const updated = await api.updateMemo(id, updateData);
+      const updated = await saveWithVersion(
+        version => api.updateMemo(id, updateData, version),
+        memos.find(m => m.id === id)?.version,
+        latest => setMemos(prev => prev.map(m => m.id === id ? latest : m)),
+        '该备忘录已在其他设备上修改，确定用你的修改覆盖吗？',
+      );
+      if (!updated) return;
       setMemos(prev => prev.map(m => m.id === id ? { ...m, ...updated } : m));
       setError('');
       return updated;
@@ -76,7 +83,7 @@ export const useMemoApi = () => {
     try {
       await api.updateMemoGroups(assignments);
       const byId = new Map(assignments.map(item => [item.id, item.category]));
-      setMemos(prev => prev.map(memo => byId.has(memo.id) ? { ...memo, category: byId.get(memo.id) } : memo));
+      setMemos(prev => prev.map(memo => byId.has(memo.id) ? { ...memo, category: byId.get(memo.id), version: (memo.version || 1) + 1 } : memo));
       setError('');
     } catch (err: any) {
       setError(err.message || '批量调整分组失败');
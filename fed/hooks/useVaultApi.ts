@@ -1,23 +1,43 @@
-import { useState, useCallback } from 'react';
+import { useState, useCallback, useRef } from 'react';
 import { api } from '../services/api';
-import { VaultData, Subscription, Credential, Memo, GroupAssignment, BatchImportResult } from '../types';
+import { VaultData, VaultChanges, Subscription, Credential, Memo, GroupAssignment, BatchImportResult, BatchResultItem } from '../types';
 import { calculateNextRenewal } from '../utils/subscription';
+import { saveWithVersion } from '../utils/conflict';
+
+// mergeChanges 按 id 用增量同步返回的记录覆盖本地记录，再去掉已删除的
+const mergeChanges = <T extends { id: string }>(current: T[], changed: T[], deleted: Set<string>): T[] => {
+  const byId = new Map(changed.map(item => [item.id, item]));
+  const merged = current
+    .filter(item => !deleted.has(item.id))
+    .map(item => byId.get(item.id) || item);
+  const known = new Set(current.map(item => item.id));
+  return [...merged, ...changed.filter(item => !known.has(item.id) && !deleted.has(item.id))];
+};
+
+const deletedIds = (changes: VaultChanges, kind: string) =>
+  new Set(changes.deleted.filter(t => t.kind === kind).map(t => t.id));
 
 export const useVaultApi = () => {
   const [isLoading, setIsLoading] = useState<boolean>(false);
   const [vaultData, setVaultData] = useState<VaultData | null>(null);
   const [error, setError] = useState<string>('');
+  // 游标单独保存，本地修改不会改变它
+  const cursorRef = useRef<string>('');
+  const vaultRef = useRef<VaultData | null>(null);
+  vaultRef.current = vaultData;
 
   const loadVault = useCallback(async () => {
     setIsLoading(true);
     setError('');
     try {
       const data = await api.getVault();
+      cursorRef.current = data.cursor || '';
       setVaultData({
         credentials: data.credentials || [],
         subscriptions: data.subscriptions || [],
         memos: data.memos || [],
         lastUpdated: data.lastUpdated || Date.now(),
+        cursor: data.cursor,
       });
     } catch (err: any) {
       setError(err.message || '加载数据失败');
@@ -26,6 +46,33 @@ export const useVaultApi = () => {
     }
   }, []);
 
+  // 只拉取上次同步之后的变化；游标过期或无效时退回完整加载
+  const syncVault = useCallback(async () => {
+    const current = vaultRef.current;
+    if (!cursorRef.current || !current) {
+      return loadVault();
+    }
+    let changes: VaultChanges;
+    try {
+      changes = await api.getVaultChanges(cursorRef.current);
+    } catch (err: any) {
+      if (err.status === 410 || err.status === 400) {
+        return loadVault();
+      }
+      return;
+    }
+
+    const next: VaultData = {
+      credentials: mergeChanges(current.credentials, changes.credentials, deletedIds(changes, 'credentials')),
+      subscriptions: mergeChanges(current.subscriptions, changes.subscriptions, deletedIds(changes, 'subscriptions')),
+      memos: mergeChanges(current.memos, changes.memos, deletedIds(changes, 'memos')),
+      lastUpdated: Date.now(),
+      cursor: changes.cursor,
+    };
+    cursorRef.current = changes.cursor;
+    setVaultData(next);
+  }, [loadVault]);
+
   const addSubscription = async (newSub: Partial<Subscription>) => {
     if (!newSub.name || !newSub.cost) return;
     
@@ -100,7 +147,13 @@ export const useVaultApi = () => {
     };
 
     try {
-      const updated = await api.updateSubscription(id, subData);
+      const updated = await saveWithVersion(
+        version => api.updateSubscription(id, subData, version),
+        vaultData?.subscriptions.find(s => s.id === id)?.version,
+        latest => replaceSubscription(latest),
+        `「${updates.name}」已在其他设备上修改，确定用你的修改覆盖吗？`,
+      );
+      if (!updated) return;
       setVaultData(prev => prev ? {
         ...prev,
         subscriptions: prev.subscriptions.map(s => s.id === id ? { ...s, ...updated, ...subData, id } : s),
@@ -112,6 +165,21 @@ export const useVaultApi = () => {
     }
   };
 
+  // 保存冲突时用服务端的最新内容替换本地记录
+  const replaceSubscription = (latest: Subscription) => {
+    setVaultData(prev => prev ? {
+      ...prev,
+      subscriptions: prev.subscriptions.map(s => s.id === latest.id ? latest : s),
+    } : null);
+  };
+
+  const replaceCredential = (latest: Credential) => {
+    setVaultData(prev => prev ? {
+      ...prev,
+      credentials: prev.credentials.map(c => c.id === latest.id ? latest : c),
+    } : null);
+  };
+
   const deleteSubscription = async (id: string) => {
     if (!confirm('确定移除该记录？')) return;
     
@@ -165,7 +233,13 @@ export const useVaultApi = () => {
     };
 
     try {
-      const updated = await api.updateCredential(id, credData);
+      const updated = await saveWithVersion(
+        version => api.updateCredential(id, credData, version),
+        vaultData?.credentials.find(c => c.id === id)?.version,
+        replaceCredential,
+        `「${updates.label}」已在其他设备上修改，确定用你的修改覆盖吗？`,
+      );
+      if (!updated) return;
       setVaultData(prev => prev ? {
         ...prev,
         credentials: prev.credentials.map(c => c.id === id ? { ...c, ...updated } : c),
@@ -177,6 +251,28 @@ export const useVaultApi = () => {
     }
   };
 
+  // 恢复到历史版本，返回恢复后的凭证
+  const restoreCredentialVersion = async (id: string, historyId: string) => {
+    try {
+      const restored = await saveWithVersion(
+        version => api.restoreCredentialHistory(id, historyId, version),
+        vaultData?.credentials.find(c => c.id === id)?.version,
+        replaceCredential,
+        '该凭证已在其他设备上修改，确定仍要恢复到这个历史版本吗？',
+      );
+      if (!restored) return null;
+      setVaultData(prev => prev ? {
+        ...prev,
+        credentials: prev.credentials.map(c => c.id === id ? { ...c, ...restored } : c),
+        lastUpdated: Date.now(),
+      } : null);
+      return restored;
+    } catch (err: any) {
+      setError(err.message || '恢复历史版本失败');
+      throw err;
+    }
+  };
+
   const batchAddCredentials = async (credentials: Partial<Credential>[]): Promise<BatchImportResult> => {
     const items = credentials
       .filter(cred => (cred.label || '').trim())
@@ -190,23 +286,32 @@ export const useVaultApi = () => {
       }));
 
     try {
-      const result = await api.batchCreateCredentials(items);
-      if (result.created?.length) {
+      // 服务端单次最多 200 条，分批提交
+      const created: Credential[] = [];
+      const skipped: BatchResultItem[] = [];
+      const failed: BatchResultItem[] = [];
+      for (let i = 0; i < items.length; i += 200) {
+        const result = await api.batchCreateCredentials(items.slice(i, i + 200));
+        created.push(...(result.created || []));
+        skipped.push(...(result.skipped || []));
+        failed.push(...(result.failed || []));
+      }
+      if (created.length) {
         setVaultData(prev => prev ? {
           ...prev,
-          credentials: [...prev.credentials, ...result.created],
+          credentials: [...prev.credentials, ...created],
           lastUpdated: Date.now(),
         } : null);
       }
-      if (result.failedCount > 0) {
-        setError(`部分导入失败: ${(result.failed || []).map(item => `${item.label}: ${item.reason}`).join(', ')}`);
+      if (failed.length > 0) {
+        setError(`部分导入失败: ${failed.map(item => `${item.label}: ${item.reason}`).join(', ')}`);
       }
       return {
-        created: result.createdCount,
-        skipped: result.skippedCount,
-        failed: result.failedCount,
-        skippedItems: result.skipped,
-        failedItems: result.failed,
+        created: created.length,
+        skipped: skipped.length,
+        failed: failed.length,
+        skippedItems: skipped,
+        failedItems: failed,
       };
     } catch (err: any) {
       setError(err.message || '批量导入失败');
@@ -221,7 +326,7 @@ export const useVaultApi = () => {
       const byId = new Map(assignments.map(item => [item.id, item.category]));
       setVaultData(prev => prev ? {
         ...prev,
-        credentials: prev.credentials.map(cred => byId.has(cred.id) ? { ...cred, category: byId.get(cred.id) } : cred),
+        credentials: prev.credentials.map(cred => byId.has(cred.id) ? { ...cred, category: byId.get(cred.id), version: (cred.version || 1) + 1 } : cred),
         lastUpdated: Date.now(),
       } : null);
     } catch (err: any) {
@@ -237,7 +342,7 @@ export const useVaultApi = () => {
       const byId = new Map(assignments.map(item => [item.id, item.category]));
       setVaultData(prev => prev ? {
         ...prev,
-        subscriptions: prev.subscriptions.map(sub => byId.has(sub.id) ? { ...sub, category: byId.get(sub.id)! } : sub),
+        subscriptions: prev.subscriptions.map(sub => byId.has(sub.id) ? { ...sub, category: byId.get(sub.id)!, version: (sub.version || 1) + 1 } : sub),
         lastUpdated: Date.now(),
       } : null);
     } catch (err: any) {
@@ -255,11 +360,13 @@ export const useVaultApi = () => {
     const newRenewalDate = calculateNextRenewal(today, sub.frequencyAmount, sub.frequencyUnit);
 
     try {
-      const updated = await api.updateSubscription(id, {
-        ...sub,
-        startDate: today,
-        renewalDate: newRenewalDate,
-      });
+      const updated = await saveWithVersion(
+        version => api.updateSubscription(id, { ...sub, startDate: today, renewalDate: newRenewalDate }, version),
+        sub.version,
+        replaceSubscription,
+        `「${sub.name}」已在其他设备上修改，确定仍要从今天重新计算到期日吗？`,
+      );
+      if (!updated) return;
       setVaultData(prev => prev ? {
         ...prev,
         subscriptions: prev.subscriptions.map(s => s.id === id ? { ...s, ...updated, startDate: today, renewalDate: newRenewalDate } : s),
@@ -377,11 +484,13 @@ export const useVaultApi = () => {
     error,
     setError,
     loadVault,
+    syncVault,
     addSubscription,
     updateSubscription,
     deleteSubscription,
     addCredential,
     updateCredential,
+    restoreCredentialVersion,
     batchAddCredentials,
     batchUpdateCredentialGroups,
     batchUpdateSubscriptionGroups,
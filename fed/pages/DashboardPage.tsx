@@ -42,6 +42,7 @@ interface DashboardPageProps {
   onDeleteSubscription: (id: string) => void;
   onAddCredential: (cred: Partial<Credential>) => void;
   onUpdateCredential?: (id: string, cred: Partial<Credential>) => void;
+  onRestoreCredentialVersion?: (id: string, historyId: string) => Promise<Credential | null>;
   onBatchAddCredentials: (creds: Partial<Credential>[]) => Promise<BatchImportResult> | BatchImportResult | void;
   onBatchUpdateCredentialGroups: (assignments: GroupAssignment[]) => Promise<void> | void;
   onBatchUpdateSubscriptionGroups: (assignments: GroupAssignment[]) => Promise<void> | void;
@@ -59,6 +60,7 @@ export const DashboardPage: React.FC<DashboardPageProps> = ({
   onDeleteSubscription,
   onAddCredential,
   onUpdateCredential,
+  onRestoreCredentialVersion,
   onBatchAddCredentials,
   onBatchUpdateCredentialGroups,
   onBatchUpdateSubscriptionGroups,
@@ -753,6 +755,11 @@ export const DashboardPage: React.FC<DashboardPageProps> = ({
         }}
         onEdit={handleEditCredential}
         onDelete={onDeleteCredential}
+        onRestoreVersion={onRestoreCredentialVersion && (async (historyId) => {
+          if (!selectedCredential) return;
+          const restored = await onRestoreCredentialVersion(selectedCredential.id, historyId);
+          if (restored) setSelectedCredential({ ...selectedCredential, ...restored });
+        })}
       />
 
       <ImportCredentialsModal
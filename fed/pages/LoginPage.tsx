@@ -2,23 +2,41 @@ import React, { useState } from 'react';
 import { LockIcon } from '../components/Icons';
 
 interface LoginPageProps {
-  onUnlock: (masterKey: string, totpCode?: string) => Promise<void>;
+  onUnlock: (username: string, masterKey: string, totpCode?: string) => Promise<void>;
+  onRegister: (username: string, masterKey: string, setupToken?: string) => Promise<void>;
+  registrationEnabled: boolean;
+  setupRequired: boolean;
   isLoading: boolean;
   error: string;
   totpRequired: boolean;
   onUnlockWithTotp: (totpCode: string) => Promise<void>;
   onCancelTotp: () => void;
+  passkeyAvailable: boolean;
+  onUnlockWithPasskey: () => Promise<void>;
+  passwordlessAvailable: boolean;
+  onUnlockPasswordless: () => Promise<void>;
 }
 
 export const LoginPage: React.FC<LoginPageProps> = ({
   onUnlock,
+  onRegister,
+  registrationEnabled,
+  setupRequired,
   isLoading,
   error,
   totpRequired,
   onUnlockWithTotp,
   onCancelTotp,
+  passkeyAvailable,
+  onUnlockWithPasskey,
+  passwordlessAvailable,
+  onUnlockPasswordless,
 }) => {
+  const [username, setUsername] = useState('');
   const [masterKey, setMasterKey] = useState('');
+  const [setupToken, setSetupToken] = useState('');
+  const [mode, setMode] = useState<'unlock' | 'register'>('unlock');
+  const isRegister = mode === 'register' && !totpRequired;
   const [totpCode, setTotpCode] = useState('');
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -31,7 +49,11 @@ export const LoginPage: React.FC<LoginPageProps> = ({
       }
     } else {
       try {
-        await onUnlock(masterKey);
+        if (isRegister) {
+          await onRegister(username, masterKey, setupRequired ? setupToken : undefined);
+        } else {
+          await onUnlock(username, masterKey);
+        }
       } catch {
         // error handled in useAuth
       }
@@ -53,14 +75,14 @@ export const LoginPage: React.FC<LoginPageProps> = ({
         </div>
         <h1 className="text-2xl font-bold text-center mb-2 text-slate-900 tracking-tight">SubVault</h1>
         <p className="text-center text-slate-400 mb-8 text-[12px] font-medium tracking-wide uppercase">
-          {totpRequired ? '两步验证' : '安全订阅管理平台'}
+          {totpRequired ? '两步验证' : isRegister ? '创建账户' : '安全订阅管理平台'}
         </p>
 
         <form onSubmit={handleSubmit} className="space-y-4">
           {totpRequired ? (
             <div className="space-y-1.5">
               <p className="text-sm text-slate-500 text-center mb-4">
-                请输入身份验证器中的6位验证码，或一次性恢复码
+                {passkeyAvailable ? '请使用通行密钥验证，或输入身份验证器中的6位验证码、一次性恢复码' : '请输入身份验证器中的6位验证码，或一次性恢复码'}
               </p>
               <label htmlFor="totp-code" className="sr-only">验证码</label>
               <input
@@ -78,18 +100,45 @@ export const LoginPage: React.FC<LoginPageProps> = ({
               />
             </div>
           ) : (
-            <div className="space-y-1.5">
+            <div className="space-y-3">
+              <label htmlFor="username" className="sr-only">用户名</label>
+              <input
+                id="username"
+                type="text"
+                autoComplete="username"
+                autoCapitalize="none"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                placeholder={isRegister ? '设置用户名' : '用户名'}
+                className="w-full bg-slate-50 border border-slate-100 text-slate-800 px-5 py-4 rounded-2xl focus:ring-2 focus:ring-brand-500/20 focus:border-brand-500 outline-none transition-colors duration-200 placeholder:text-slate-300 text-sm font-medium"
+                autoFocus
+              />
               <label htmlFor="master-key" className="sr-only">主密钥</label>
               <input
                 id="master-key"
                 type="password"
+                autoComplete={isRegister ? 'new-password' : 'current-password'}
                 value={masterKey}
                 onChange={(e) => setMasterKey(e.target.value)}
-                placeholder="输入主密钥"
+                placeholder={isRegister ? '设置主密钥（至少 8 位）' : '输入主密钥'}
                 className="w-full bg-slate-50 border border-slate-100 text-slate-800 px-5 py-4 rounded-2xl focus:ring-2 focus:ring-brand-500/20 focus:border-brand-500 outline-none transition-colors duration-200 placeholder:text-slate-300 text-sm font-medium"
-                autoFocus
                 aria-describedby={error ? "error-message" : undefined}
               />
+              {isRegister && setupRequired && (
+                <>
+                  <label htmlFor="setup-token" className="sr-only">初始化令牌</label>
+                  <input
+                    id="setup-token"
+                    type="text"
+                    autoComplete="off"
+                    autoCapitalize="none"
+                    value={setupToken}
+                    onChange={(e) => setSetupToken(e.target.value.trim())}
+                    placeholder="初始化令牌（见服务器启动日志）"
+                    className="w-full bg-slate-50 border border-slate-100 text-slate-800 px-5 py-4 rounded-2xl focus:ring-2 focus:ring-brand-500/20 focus:border-brand-500 outline-none transition-colors duration-200 placeholder:text-slate-300 text-sm font-mono"
+                  />
+                </>
+              )}
             </div>
           )}
 
@@ -101,12 +150,44 @@ export const LoginPage: React.FC<LoginPageProps> = ({
 
           <button
             type="submit"
-            disabled={isLoading || (totpRequired ? totpCode.length < 6 : !masterKey)}
+            disabled={isLoading || (totpRequired ? totpCode.length < 6 : !masterKey || (isRegister && !username))}
             className="w-full bg-slate-900 hover:bg-black text-white font-bold py-4 rounded-2xl transition-colors duration-200 shadow-md active:scale-95 text-sm cursor-pointer disabled:cursor-not-allowed disabled:opacity-60"
           >
-            {isLoading ? '验证中...' : totpRequired ? '验证' : '进入空间'}
+            {isLoading ? '验证中...' : totpRequired ? '验证' : isRegister ? '注册并进入' : '进入空间'}
           </button>
 
+          {totpRequired && passkeyAvailable && (
+            <button
+              type="button"
+              onClick={onUnlockWithPasskey}
+              disabled={isLoading}
+              className="w-full bg-slate-50 hover:bg-slate-100 text-slate-700 border border-slate-100 font-bold py-4 rounded-2xl transition-colors duration-200 text-sm cursor-pointer disabled:cursor-not-allowed disabled:opacity-60"
+            >
+              使用通行密钥验证
+            </button>
+          )}
+
+          {!totpRequired && !isRegister && passwordlessAvailable && (
+            <button
+              type="button"
+              onClick={onUnlockPasswordless}
+              disabled={isLoading}
+              className="w-full bg-slate-50 hover:bg-slate-100 text-slate-700 border border-slate-100 font-bold py-4 rounded-2xl transition-colors duration-200 text-sm cursor-pointer disabled:cursor-not-allowed disabled:opacity-60"
+            >
+              使用通行密钥解锁
+            </button>
+          )}
+
+          {!totpRequired && registrationEnabled && (
+            <button
+              type="button"
+              onClick={() => setMode(isRegister ? 'unlock' : 'register')}
+              className="w-full text-slate-400 hover:text-slate-600 text-sm font-medium py-2 cursor-pointer transition-colors"
+            >
+              {isRegister ? '已有账户？解锁' : '没有账户？注册'}
+            </button>
+          )}
+
           {totpRequired && (
             <button
               type="button"
@@ -119,7 +200,7 @@ export const LoginPage: React.FC<LoginPageProps> = ({
         </form>
 
         <p className="mt-8 pt-6 border-t border-slate-50 text-center text-[10px] text-slate-300">
-          {totpRequired ? '打开身份验证器应用获取验证码' : '请输入主密钥解锁保险库'}
+          {totpRequired ? (passkeyAvailable ? '插入安全密钥或使用设备上的通行密钥' : '打开身份验证器应用获取验证码') : isRegister ? (setupRequired ? '第一个用户将成为管理员，主密钥无法找回，请牢记' : '主密钥无法找回，请牢记') : '请输入用户名和主密钥解锁保险库'}
         </p>
       </div>
     </div>
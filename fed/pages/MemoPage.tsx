@@ -332,7 +332,7 @@ export const MemoPage: React.FC<MemoPageProps> = ({
                 确认删除
               </h3>
               <p className="text-slate-500 text-sm">
-                确定要删除这个备忘录吗？此操作无法撤销。
+                确定要删除这个备忘录吗？删除后可在设置的回收站中恢复。
               </p>
             </div>
             <div className="px-6 pb-6 flex flex-col-reverse sm:flex-row sm:justify-end gap-2 sm:space-x-3">
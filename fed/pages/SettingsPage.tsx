@@ -2,6 +2,8 @@ import React, { useState, useEffect } from 'react';
 import { QRCodeSVG } from 'qrcode.react';
 import { api } from '../services/api';
 import { TrashIcon, PlusIcon, BellIcon } from '../components/Icons';
+import { ApiToken, AuditEvent, BackupFile, BackupImportMode, Collection, CredentialExportFormat, TrashContents, TrashKind, WebAuthnCredential } from '../types';
+import { createPasskey, forgetDeviceSecret, isWebAuthnSupported, setDeviceSecret } from '../utils/webauthn';
 
 interface Tag {
   id: string;
@@ -23,6 +25,37 @@ const TAG_COLORS = [
   '#EC4899', '#06B6D4', '#84CC16', '#F97316', '#6366F1'
 ];
 
+const AUDIT_ACTION_LABELS: Record<string, string> = {
+  'auth.unlock': '主密钥解锁',
+  'auth.passkey_unlock': '免密码解锁',
+  'auth.register': '注册',
+  'auth.logout': '退出登录',
+  'totp.setup': '设置两步验证',
+  'totp.enable': '启用两步验证',
+  'totp.disable': '禁用两步验证',
+  'totp.recovery_regenerate': '重新生成恢复码',
+  'webauthn.register': '添加通行密钥',
+  'webauthn.delete': '删除通行密钥',
+  'credentials.read': '读取凭证',
+  'credentials.shared_read': '共享凭证被读取',
+  'backup.export': '导出备份',
+  'backup.import': '导入备份',
+  'credentials.export': '导出凭证',
+};
+
+const TRASH_KIND_LABELS: Record<TrashKind, string> = {
+  subscriptions: '订阅',
+  credentials: '账号',
+  memos: '备忘录',
+  tags: '分组',
+};
+
+const AUDIT_OUTCOME_LABELS: Record<AuditEvent['outcome'], string> = {
+  success: '成功',
+  failure: '失败',
+  locked: '已锁定',
+};
+
 // Shield icon for security tab
 const ShieldIcon = ({ className }: { className?: string }) => (
   <svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round" className={className}>
@@ -31,7 +64,7 @@ const ShieldIcon = ({ className }: { className?: string }) => (
 );
 
 export const SettingsPage: React.FC = () => {
-  const [activeSection, setActiveSection] = useState<'tags' | 'notifications' | 'security'>('tags');
+  const [activeSection, setActiveSection] = useState<'tags' | 'notifications' | 'sharing' | 'trash' | 'security'>('tags');
   const [tags, setTags] = useState<Tag[]>([]);
   const [newTagName, setNewTagName] = useState('');
   const [newTagColor, setNewTagColor] = useState(TAG_COLORS[0]);
@@ -57,7 +90,50 @@ export const SettingsPage: React.FC = () => {
   const [totpMessage, setTotpMessage] = useState('');
   const [totpError, setTotpError] = useState('');
   const [totpLoading, setTotpLoading] = useState(false);
+  const [recoveryRemaining, setRecoveryRemaining] = useState<number | null>(null);
+  const [recoveryLow, setRecoveryLow] = useState(false);
+  const [regenerateCode, setRegenerateCode] = useState('');
   const [showSecret, setShowSecret] = useState(false);
+  const [isAdmin, setIsAdmin] = useState(false);
+  const [registrationEnabled, setRegistrationEnabled] = useState(false);
+  const [collections, setCollections] = useState<Collection[]>([]);
+  const [newCollectionName, setNewCollectionName] = useState('');
+  const [memberInputs, setMemberInputs] = useState<Record<string, { username: string; role: 'viewer' | 'editor' }>>({});
+  const [sharingError, setSharingError] = useState('');
+  const [apiTokens, setApiTokens] = useState<ApiToken[]>([]);
+  const [availableScopes, setAvailableScopes] = useState<string[]>([]);
+  const [newTokenName, setNewTokenName] = useState('');
+  const [newTokenScopes, setNewTokenScopes] = useState<string[]>([]);
+  const [newTokenDays, setNewTokenDays] = useState(90);
+  const [createdToken, setCreatedToken] = useState('');
+  const [tokenError, setTokenError] = useState('');
+  const [passkeys, setPasskeys] = useState<WebAuthnCredential[]>([]);
+  const [newPasskeyName, setNewPasskeyName] = useState('');
+  const [newPasskeyPasswordless, setNewPasskeyPasswordless] = useState(false);
+  const [passkeyMasterKey, setPasskeyMasterKey] = useState('');
+  const [passkeyTotpCode, setPasskeyTotpCode] = useState('');
+  const [passkeyError, setPasskeyError] = useState('');
+  const [passkeyLoading, setPasskeyLoading] = useState(false);
+  const [auditEvents, setAuditEvents] = useState<AuditEvent[]>([]);
+  const [auditTotal, setAuditTotal] = useState(0);
+  const [auditPage, setAuditPage] = useState(1);
+  const [auditFailuresOnly, setAuditFailuresOnly] = useState(false);
+  const [trash, setTrash] = useState<TrashContents | null>(null);
+  const [trashError, setTrashError] = useState('');
+  const [historyLimit, setHistoryLimit] = useState(10);
+  const [backupPassphrase, setBackupPassphrase] = useState('');
+  const [backupMasterKey, setBackupMasterKey] = useState('');
+  const [backupTotpCode, setBackupTotpCode] = useState('');
+  const [backupMode, setBackupMode] = useState<BackupImportMode>('merge');
+  const [backupMessage, setBackupMessage] = useState('');
+  const [backupError, setBackupError] = useState('');
+  const [backupBusy, setBackupBusy] = useState(false);
+  const [exportFormat, setExportFormat] = useState<CredentialExportFormat>('bitwarden-json');
+  const [exportMasterKey, setExportMasterKey] = useState('');
+  const [exportTotpCode, setExportTotpCode] = useState('');
+  const [exportMessage, setExportMessage] = useState('');
+  const [exportError, setExportError] = useState('');
+  const [exportBusy, setExportBusy] = useState(false);
 
   useEffect(() => {
     loadData();
@@ -91,17 +167,344 @@ export const SettingsPage: React.FC = () => {
       const status = await api.getTotpStatus();
       setTotpEnabled(status.enabled);
       setTotpVerified(status.verified);
+      setRecoveryRemaining(status.recoveryCodesRemaining ?? null);
+      setRecoveryLow(!!status.recoveryCodesLow);
     } catch (err) {
       console.error('加载2FA状态失败:', err);
     }
   };
 
+  const loadAdminSettings = async () => {
+    try {
+      const me = await api.verify();
+      setIsAdmin(!!me.isAdmin);
+      if (me.isAdmin) {
+        const registration = await api.getAdminRegistration();
+        setRegistrationEnabled(registration.enabled);
+      }
+    } catch (err) {
+      console.error('加载管理员设置失败:', err);
+    }
+  };
+
+  const loadApiTokens = async () => {
+    try {
+      const data = await api.getApiTokens();
+      setApiTokens(data.tokens);
+      setAvailableScopes(data.availableScopes);
+    } catch (err) {
+      console.error('加载访问令牌失败:', err);
+    }
+  };
+
+  const loadPasskeys = async () => {
+    try {
+      setPasskeys(await api.getPasskeys());
+    } catch (err) {
+      console.error('加载通行密钥失败:', err);
+    }
+  };
+
+  const loadAuditEvents = async (page = 1, failuresOnly = auditFailuresOnly) => {
+    try {
+      const data = await api.getAuditEvents({ outcome: failuresOnly ? 'failure' : undefined, page, pageSize: 20 });
+      setAuditEvents(data.events);
+      setAuditTotal(data.total);
+      setAuditPage(data.page);
+    } catch (err) {
+      console.error('加载审计日志失败:', err);
+    }
+  };
+
+  const handleRegisterPasskey = async () => {
+    if (!newPasskeyName.trim() || !passkeyMasterKey) return;
+    setPasskeyLoading(true);
+    setPasskeyError('');
+    try {
+      const challenge = await api.beginPasskeyRegistration(newPasskeyPasswordless, passkeyMasterKey, passkeyTotpCode || undefined);
+      const credential = await createPasskey(challenge);
+      const result = await api.finishPasskeyRegistration({
+        challengeId: challenge.challengeId,
+        name: newPasskeyName.trim(),
+        passwordless: newPasskeyPasswordless,
+        credential,
+      });
+      if (result.deviceSecret) {
+        setDeviceSecret(result.credential.id, result.deviceSecret);
+      }
+      setNewPasskeyName('');
+      setNewPasskeyPasswordless(false);
+      setPasskeyMasterKey('');
+      setPasskeyTotpCode('');
+      await loadPasskeys();
+    } catch (err: any) {
+      if (err.data?.totp_required) {
+        setPasskeyError('请输入两步验证码');
+      } else {
+        setPasskeyError(err.status ? err.message || '注册通行密钥失败' : '未完成通行密钥注册');
+      }
+    } finally {
+      setPasskeyLoading(false);
+    }
+  };
+
+  const handleDeletePasskey = async (id: string) => {
+    if (!confirm('删除后将不能再用该通行密钥解锁，确定删除？')) return;
+    try {
+      await api.deletePasskey(id);
+      forgetDeviceSecret(id);
+      setPasskeys(prev => prev.filter(p => p.id !== id));
+    } catch (err: any) {
+      setPasskeyError(err.message || '删除通行密钥失败');
+    }
+  };
+
+  const toggleTokenScope = (scope: string) => {
+    setNewTokenScopes(prev => prev.includes(scope) ? prev.filter(s => s !== scope) : [...prev, scope]);
+  };
+
+  const handleCreateApiToken = async () => {
+    if (!newTokenName.trim() || newTokenScopes.length === 0) return;
+    setTokenError('');
+    try {
+      const result = await api.createApiToken({ name: newTokenName.trim(), scopes: newTokenScopes, expiresInDays: newTokenDays });
+      setCreatedToken(result.token);
+      setNewTokenName('');
+      setNewTokenScopes([]);
+      await loadApiTokens();
+    } catch (err: any) {
+      setTokenError(err.message || '创建令牌失败');
+    }
+  };
+
+  const handleRevokeApiToken = async (id: string) => {
+    if (!confirm('吊销后使用该令牌的脚本会立即失效，确定吊销？')) return;
+    try {
+      await api.revokeApiToken(id);
+      setApiTokens(prev => prev.filter(t => t.id !== id));
+    } catch (err: any) {
+      setTokenError(err.message || '吊销令牌失败');
+    }
+  };
+
+  const handleToggleRegistration = async () => {
+    try {
+      const result = await api.updateAdminRegistration(!registrationEnabled);
+      setRegistrationEnabled(result.enabled);
+    } catch (err) {
+      console.error('保存注册设置失败:', err);
+    }
+  };
+
+  const loadCollections = async () => {
+    try {
+      setCollections(await api.getCollections());
+    } catch (err) {
+      console.error('加载共享集合失败:', err);
+    }
+  };
+
+  const handleCreateCollection = async () => {
+    if (!newCollectionName.trim()) return;
+    setSharingError('');
+    try {
+      await api.createCollection(newCollectionName.trim());
+      setNewCollectionName('');
+      await loadCollections();
+    } catch (err: any) {
+      setSharingError(err.message || '创建失败');
+    }
+  };
+
+  const handleDeleteCollection = async (collection: Collection) => {
+    if (!confirm(`删除共享集合「${collection.name}」？其中的记录会退回各自创建者。`)) return;
+    setSharingError('');
+    try {
+      await api.deleteCollection(collection.id);
+      await loadCollections();
+    } catch (err: any) {
+      setSharingError(err.message || '删除失败');
+    }
+  };
+
+  const handleAddMember = async (collectionId: string) => {
+    const input = memberInputs[collectionId];
+    if (!input?.username.trim()) return;
+    setSharingError('');
+    try {
+      await api.addCollectionMember(collectionId, input.username.trim(), input.role);
+      setMemberInputs(prev => ({ ...prev, [collectionId]: { username: '', role: input.role } }));
+      await loadCollections();
+    } catch (err: any) {
+      setSharingError(err.message || '添加成员失败');
+    }
+  };
+
+  const handleMemberRole = async (collectionId: string, memberId: string, role: 'viewer' | 'editor') => {
+    setSharingError('');
+    try {
+      await api.updateCollectionMember(collectionId, memberId, role);
+      await loadCollections();
+    } catch (err: any) {
+      setSharingError(err.message || '修改角色失败');
+    }
+  };
+
+  const handleRemoveMember = async (collectionId: string, memberId: string) => {
+    setSharingError('');
+    try {
+      await api.removeCollectionMember(collectionId, memberId);
+      await loadCollections();
+    } catch (err: any) {
+      setSharingError(err.message || '移除成员失败');
+    }
+  };
+
   useEffect(() => {
     if (activeSection === 'security') {
       loadTotpStatus();
+      loadAdminSettings();
+      loadApiTokens();
+      loadPasskeys();
+      loadAuditEvents();
+      api.getPasswordHistoryLimit().then(r => setHistoryLimit(r.limit)).catch(() => {});
+    }
+    if (activeSection === 'sharing') {
+      loadCollections();
+    }
+    if (activeSection === 'trash') {
+      loadTrash();
     }
   }, [activeSection]);
 
+  const handleHistoryLimitChange = async (limit: number) => {
+    const previous = historyLimit;
+    setHistoryLimit(limit);
+    try {
+      await api.savePasswordHistoryLimit(limit);
+    } catch (err: any) {
+      setHistoryLimit(previous);
+      alert(err.message || '保存失败');
+    }
+  };
+
+  const handleExportCredentials = async () => {
+    setExportMessage('');
+    setExportError('');
+    setExportBusy(true);
+    try {
+      const { blob, fileName } = await api.exportCredentials(exportFormat, exportMasterKey, exportTotpCode || undefined);
+      const url = URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = fileName;
+      a.click();
+      URL.revokeObjectURL(url);
+      setExportMasterKey('');
+      setExportTotpCode('');
+      setExportMessage('已下载，文件中的密码为明文，导入其他工具后请立即删除');
+    } catch (err: any) {
+      setExportError(err.data?.totp_required ? '请输入两步验证码' : (err.message || '导出失败'));
+    } finally {
+      setExportBusy(false);
+    }
+  };
+
+  const handleExportBackup = async () => {
+    setBackupMessage('');
+    setBackupError('');
+    setBackupBusy(true);
+    try {
+      const file = await api.exportBackup(backupPassphrase, backupMasterKey, backupTotpCode || undefined);
+      const blob = new Blob([JSON.stringify(file, null, 2)], { type: 'application/json' });
+      const url = URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = `SubVault_Backup_${new Date().toISOString().split('T')[0]}.json`;
+      a.click();
+      URL.revokeObjectURL(url);
+      setBackupTotpCode('');
+      setBackupMessage('备份已下载，请妥善保管文件和口令，忘记口令将无法恢复');
+    } catch (err: any) {
+      setBackupError(err.data?.totp_required ? '请输入两步验证码' : (err.message || '导出失败'));
+    } finally {
+      setBackupBusy(false);
+    }
+  };
+
+  const handleImportBackup = () => {
+    const input = document.createElement('input');
+    input.type = 'file';
+    input.accept = '.json';
+    input.onchange = async (e) => {
+      const selected = (e.target as HTMLInputElement).files?.[0];
+      if (!selected) return;
+      if (backupMode === 'replace' && !confirm('替换导入会彻底删除当前保险库中自己的全部数据（包括回收站），确定继续？')) return;
+      setBackupMessage('');
+      setBackupError('');
+      setBackupBusy(true);
+      try {
+        let file: BackupFile;
+        try {
+          file = JSON.parse(await selected.text());
+        } catch {
+          throw new Error('不是有效的备份文件');
+        }
+        const result = await api.importBackup(file, backupPassphrase, backupMode, backupMasterKey, backupTotpCode || undefined);
+        setBackupTotpCode('');
+        const skipped = result.skipped ? `，跳过已存在的 ${result.skipped} 条` : '';
+        setBackupMessage(`导入完成：${result.subscriptions} 个订阅，${result.credentials} 个凭证，${result.memos} 个备忘录，${result.tags} 个分组${skipped}。刷新页面后可在列表中看到。`);
+        setTags(await api.getTags());
+      } catch (err: any) {
+        setBackupError(err.data?.totp_required ? '请输入两步验证码' : (err.message || '导入失败'));
+      } finally {
+        setBackupBusy(false);
+      }
+    };
+    input.click();
+  };
+
+  const loadTrash = async () => {
+    try {
+      setTrash(await api.getTrash());
+    } catch (err) {
+      console.error('加载回收站失败:', err);
+    }
+  };
+
+  const handleRestoreTrashItem = async (kind: TrashKind, id: string) => {
+    setTrashError('');
+    try {
+      await api.restoreTrashItem(kind, id);
+      await loadTrash();
+      if (kind === 'tags') setTags(await api.getTags());
+    } catch (err: any) {
+      setTrashError(err.message || '恢复失败');
+    }
+  };
+
+  const handlePurgeTrashItem = async (kind: TrashKind, id: string) => {
+    if (!confirm('彻底删除后无法恢复，确定删除？')) return;
+    setTrashError('');
+    try {
+      await api.purgeTrashItem(kind, id);
+      await loadTrash();
+    } catch (err: any) {
+      setTrashError(err.message || '删除失败');
+    }
+  };
+
+  const handleEmptyTrash = async () => {
+    if (!confirm('清空回收站后其中的记录都无法恢复，确定清空？')) return;
+    setTrashError('');
+    try {
+      await api.emptyTrash();
+      await loadTrash();
+    } catch (err: any) {
+      setTrashError(err.message || '清空回收站失败');
+    }
+  };
+
   const handleCreateTag = async () => {
     if (!newTagName.trim()) return;
     try {
@@ -116,7 +519,7 @@ export const SettingsPage: React.FC = () => {
 
   const handleDeleteTag = async (id: string) => {
     if (tags.find(t => t.id === id)?.name === '默认') return;
-    if (!confirm('确定删除此分组？该分组下的内容不会删除。')) return;
+    if (!confirm('确定删除此分组？分组会移入回收站，该分组下的内容不会删除。')) return;
     try {
       await api.deleteTag(id);
       setTags(prev => prev.filter(t => t.id !== id));
@@ -194,6 +597,7 @@ export const SettingsPage: React.FC = () => {
       setTotpUri('');
       setTotpSecret('');
       setRecoveryCodes(result.recoveryCodes || []);
+      setRecoveryRemaining(result.recoveryCodes?.length ?? null);
       setTotpMessage(result.recoveryCodes?.length ? '两步验证已启用，请立刻保存恢复码' : '两步验证已成功启用');
     } catch (err: any) {
       setTotpError(err.message || '验证失败');
@@ -202,6 +606,25 @@ export const SettingsPage: React.FC = () => {
     }
   };
 
+  const handleRegenerateRecoveryCodes = async () => {
+    if (regenerateCode.length !== 6) return;
+    setTotpLoading(true);
+    setTotpError('');
+    setTotpMessage('');
+    try {
+      const result = await api.regenerateRecoveryCodes(regenerateCode);
+      setRegenerateCode('');
+      setRecoveryCodes(result.recoveryCodes);
+      setRecoveryRemaining(result.recoveryCodes.length);
+      setRecoveryLow(false);
+      setTotpMessage('已生成新的恢复码，旧恢复码已失效，请立刻保存');
+    } catch (err: any) {
+      setTotpError(err.message || '重新生成失败');
+    } finally {
+      setTotpLoading(false);
+    }
+  };
+
   const handleDisableTotp = async () => {
     if (!confirm('确定禁用两步验证？禁用后登录将不再需要验证码。')) return;
     setTotpLoading(true);
@@ -214,6 +637,7 @@ export const SettingsPage: React.FC = () => {
       setTotpUri('');
       setTotpSecret('');
       setRecoveryCodes([]);
+      setRecoveryRemaining(null);
       setTotpMessage('两步验证已禁用');
     } catch (err: any) {
       setTotpError(err.message || '禁用失败');
@@ -243,7 +667,7 @@ export const SettingsPage: React.FC = () => {
         {/* 头部 */}
         <div className="hidden md:block">
           <h2 className="text-2xl font-bold text-slate-900">设置</h2>
-          <p className="text-slate-400 text-sm mt-1">管理分组、通知提醒和安全设置</p>
+          <p className="text-slate-400 text-sm mt-1">管理分组、通知提醒、家庭共享、回收站和安全设置</p>
         </div>
 
         {/* 切换标签 */}
@@ -251,11 +675,13 @@ export const SettingsPage: React.FC = () => {
           {[
             { key: 'tags', label: '分组管理' },
             { key: 'notifications', label: '到期提醒' },
+            { key: 'sharing', label: '家庭共享' },
+            { key: 'trash', label: '回收站' },
             { key: 'security', label: '安全设置' },
           ].map(tab => (
             <button
               key={tab.key}
-              onClick={() => setActiveSection(tab.key as 'tags' | 'notifications' | 'security')}
+              onClick={() => setActiveSection(tab.key as 'tags' | 'notifications' | 'sharing' | 'trash' | 'security')}
               className={`flex-1 md:flex-none px-3 md:px-4 py-2.5 text-sm font-medium rounded-md cursor-pointer transition-colors whitespace-nowrap min-h-[40px] ${
                 activeSection === tab.key
                   ? 'bg-blue-600 text-white'
@@ -512,6 +938,174 @@ export const SettingsPage: React.FC = () => {
           </div>
         )}
 
+        {/* 家庭共享 */}
+        {activeSection === 'sharing' && (
+          <div className="space-y-4">
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <h3 className="text-sm font-semibold text-slate-700 mb-1">创建共享集合</h3>
+              <p className="text-xs text-slate-400 mb-4">放入集合的订阅、账号和备忘录对成员可见；查看者只读，编辑者可以修改。个人数据始终只有自己可见。</p>
+              <div className="flex items-center gap-3">
+                <input
+                  type="text"
+                  value={newCollectionName}
+                  onChange={e => setNewCollectionName(e.target.value)}
+                  placeholder="集合名称，如家庭"
+                  className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400 min-h-[44px]"
+                  onKeyPress={e => e.key === 'Enter' && handleCreateCollection()}
+                />
+                <button
+                  onClick={handleCreateCollection}
+                  disabled={!newCollectionName.trim()}
+                  className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:bg-slate-300 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors min-h-[44px] min-w-[44px]"
+                >
+                  <PlusIcon className="w-4 h-4" />
+                </button>
+              </div>
+              {sharingError && <p className="text-xs text-rose-500 mt-3">{sharingError}</p>}
+            </div>
+
+            {collections.map(collection => {
+              const input = memberInputs[collection.id] || { username: '', role: 'viewer' as const };
+              const isOwner = collection.role === 'owner';
+              return (
+                <div key={collection.id} className="bg-white rounded-xl border border-slate-200/60 p-5">
+                  <div className="flex items-center justify-between mb-4">
+                    <div>
+                      <h3 className="text-sm font-semibold text-slate-700">{collection.name}</h3>
+                      <p className="text-xs text-slate-400">
+                        {isOwner ? '我创建的' : collection.role === 'editor' ? '我可以编辑' : '我只能查看'}
+                      </p>
+                    </div>
+                    {isOwner && (
+                      <button
+                        onClick={() => handleDeleteCollection(collection)}
+                        className="text-slate-400 hover:text-rose-500 cursor-pointer transition-colors p-2"
+                      >
+                        <TrashIcon className="w-4 h-4" />
+                      </button>
+                    )}
+                  </div>
+                  <ul className="divide-y divide-slate-100">
+                    {collection.members.map(member => (
+                      <li key={member.id || member.username} className="flex items-center justify-between py-2 text-sm">
+                        <span className="text-slate-700">{member.username}</span>
+                        {member.role === 'owner' ? (
+                          <span className="text-xs text-slate-400">所有者</span>
+                        ) : isOwner && member.id ? (
+                          <div className="flex items-center gap-2">
+                            <select
+                              value={member.role}
+                              onChange={e => handleMemberRole(collection.id, member.id!, e.target.value as 'viewer' | 'editor')}
+                              className="bg-slate-50 border border-slate-200 rounded-lg px-2 py-1 text-xs outline-none"
+                            >
+                              <option value="viewer">查看者</option>
+                              <option value="editor">编辑者</option>
+                            </select>
+                            <button
+                              onClick={() => handleRemoveMember(collection.id, member.id!)}
+                              className="text-slate-400 hover:text-rose-500 cursor-pointer transition-colors p-1"
+                            >
+                              <TrashIcon className="w-3 h-3" />
+                            </button>
+                          </div>
+                        ) : (
+                          <span className="text-xs text-slate-400">{member.role === 'editor' ? '编辑者' : '查看者'}</span>
+                        )}
+                      </li>
+                    ))}
+                  </ul>
+                  {isOwner && (
+                    <div className="flex items-center gap-2 mt-4">
+                      <input
+                        type="text"
+                        value={input.username}
+                        onChange={e => setMemberInputs(prev => ({ ...prev, [collection.id]: { ...input, username: e.target.value } }))}
+                        placeholder="成员用户名"
+                        className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2 text-sm outline-none focus:border-blue-400"
+                      />
+                      <select
+                        value={input.role}
+                        onChange={e => setMemberInputs(prev => ({ ...prev, [collection.id]: { ...input, role: e.target.value as 'viewer' | 'editor' } }))}
+                        className="bg-slate-50 border border-slate-200 rounded-lg px-2 py-2 text-sm outline-none"
+                      >
+                        <option value="viewer">查看者</option>
+                        <option value="editor">编辑者</option>
+                      </select>
+                      <button
+                        onClick={() => handleAddMember(collection.id)}
+                        disabled={!input.username.trim()}
+                        className="px-3 py-2 bg-blue-600 hover:bg-blue-700 disabled:bg-slate-300 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors"
+                      >
+                        添加
+                      </button>
+                    </div>
+                  )}
+                </div>
+              );
+            })}
+          </div>
+        )}
+
+        {/* 回收站 */}
+        {activeSection === 'trash' && (() => {
+          const items = trash
+            ? [
+                ...trash.subscriptions.map(s => ({ kind: 'subscriptions' as TrashKind, id: s.id, name: s.name, deletedAt: s.deletedAt })),
+                ...trash.credentials.map(c => ({ kind: 'credentials' as TrashKind, id: c.id, name: c.label, deletedAt: c.deletedAt })),
+                ...trash.memos.map(m => ({ kind: 'memos' as TrashKind, id: m.id, name: m.title, deletedAt: m.deletedAt })),
+                ...trash.tags.map(t => ({ kind: 'tags' as TrashKind, id: t.id, name: t.name, deletedAt: t.deletedAt })),
+              ].sort((a, b) => new Date(b.deletedAt).getTime() - new Date(a.deletedAt).getTime())
+            : [];
+          return (
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <div className="flex items-center justify-between mb-1">
+                <h3 className="text-sm font-semibold text-slate-700">回收站 ({items.length})</h3>
+                {items.length > 0 && (
+                  <button onClick={handleEmptyTrash} className="text-xs text-rose-500 hover:text-rose-600 cursor-pointer">
+                    清空回收站
+                  </button>
+                )}
+              </div>
+              <p className="text-xs text-slate-400 mb-4">
+                删除的订阅、账号、备忘录和分组会在这里保留{trash ? ` ${trash.retentionDays} 天` : ''}，之后自动彻底删除。
+              </p>
+              {trashError && <p className="text-xs text-rose-500 mb-3">{trashError}</p>}
+              {items.length === 0 ? (
+                <p className="text-slate-400 text-sm text-center py-4">回收站是空的</p>
+              ) : (
+                <ul className="divide-y divide-slate-100">
+                  {items.map(item => (
+                    <li key={`${item.kind}-${item.id}`} className="py-2.5 flex items-center justify-between gap-3">
+                      <div className="min-w-0">
+                        <p className="text-sm text-slate-700 truncate">
+                          <span className="mr-2 text-xs text-slate-400">{TRASH_KIND_LABELS[item.kind]}</span>
+                          {item.name}
+                        </p>
+                        <p className="text-xs text-slate-400">删除于 {new Date(item.deletedAt).toLocaleString()}</p>
+                      </div>
+                      <div className="flex items-center space-x-3 shrink-0">
+                        <button
+                          onClick={() => handleRestoreTrashItem(item.kind, item.id)}
+                          className="text-xs text-blue-600 hover:text-blue-700 cursor-pointer"
+                        >
+                          恢复
+                        </button>
+                        <button
+                          onClick={() => handlePurgeTrashItem(item.kind, item.id)}
+                          className="text-slate-400 hover:text-rose-500 cursor-pointer p-1"
+                          title="彻底删除"
+                        >
+                          <TrashIcon className="w-3.5 h-3.5" />
+                        </button>
+                      </div>
+                    </li>
+                  ))}
+                </ul>
+              )}
+            </div>
+          );
+        })()}
+
         {/* 安全设置 */}
         {activeSection === 'security' && (
           <div className="space-y-4">
@@ -666,6 +1260,32 @@ export const SettingsPage: React.FC = () => {
                       </button>
                     </div>
                   )}
+                  {recoveryRemaining !== null && (
+                    <div className={`mb-4 p-4 rounded-xl border ${recoveryLow ? 'bg-amber-50 border-amber-200' : 'bg-slate-50 border-slate-200'}`}>
+                      <p className={`text-sm mb-3 ${recoveryLow ? 'text-amber-800 font-medium' : 'text-slate-600'}`}>
+                        剩余 {recoveryRemaining} 个未使用的恢复码{recoveryLow && '，即将用完，建议重新生成'}
+                      </p>
+                      <div className="flex flex-col sm:flex-row sm:items-center gap-3">
+                        <input
+                          type="text"
+                          inputMode="numeric"
+                          autoComplete="one-time-code"
+                          value={regenerateCode}
+                          onChange={e => setRegenerateCode(e.target.value.replace(/\D/g, '').slice(0, 6))}
+                          placeholder="当前验证码"
+                          className="w-full sm:flex-1 bg-white border border-slate-200 rounded-lg px-3 py-2.5 text-sm font-mono outline-none focus:border-blue-400"
+                          maxLength={6}
+                        />
+                        <button
+                          onClick={handleRegenerateRecoveryCodes}
+                          disabled={totpLoading || regenerateCode.length !== 6}
+                          className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:bg-slate-300 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors whitespace-nowrap"
+                        >
+                          重新生成恢复码
+                        </button>
+                      </div>
+                    </div>
+                  )}
                   <button
                     onClick={handleDisableTotp}
                     disabled={totpLoading}
@@ -677,6 +1297,364 @@ export const SettingsPage: React.FC = () => {
               )}
             </div>
 
+            {/* 通行密钥 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <h3 className="text-sm font-semibold text-slate-700 mb-1">通行密钥</h3>
+              <p className="text-xs text-slate-400 mb-4">注册安全密钥或设备上的通行密钥后，解锁时可代替验证码作为第二步验证。勾选「免密码」的通行密钥可在本设备上不输入主密钥直接解锁。添加时需再次输入主密钥。</p>
+              {isWebAuthnSupported() ? (
+                <div className="space-y-3">
+                  <div className="flex flex-col sm:flex-row gap-3">
+                    <input
+                      type="text"
+                      value={newPasskeyName}
+                      onChange={e => setNewPasskeyName(e.target.value)}
+                      placeholder="名称，如 YubiKey、我的手机"
+                      className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                    />
+                    <label className="flex items-center space-x-1.5 text-sm text-slate-600 cursor-pointer">
+                      <input type="checkbox" checked={newPasskeyPasswordless} onChange={e => setNewPasskeyPasswordless(e.target.checked)} />
+                      <span>免密码</span>
+                    </label>
+                  </div>
+                  <div className="flex flex-col sm:flex-row gap-3">
+                    <input
+                      type="password"
+                      value={passkeyMasterKey}
+                      onChange={e => setPasskeyMasterKey(e.target.value)}
+                      placeholder="主密钥"
+                      autoComplete="current-password"
+                      className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                    />
+                    {totpEnabled && totpVerified && (
+                      <input
+                        type="text"
+                        inputMode="numeric"
+                        value={passkeyTotpCode}
+                        onChange={e => setPasskeyTotpCode(e.target.value.replace(/\D/g, '').slice(0, 6))}
+                        placeholder="两步验证码"
+                        autoComplete="one-time-code"
+                        className="sm:w-36 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                      />
+                    )}
+                    <button
+                      onClick={handleRegisterPasskey}
+                      disabled={!newPasskeyName.trim() || !passkeyMasterKey || passkeyLoading}
+                      className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:bg-slate-300 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors"
+                    >
+                      {passkeyLoading ? '等待认证器...' : '添加通行密钥'}
+                    </button>
+                  </div>
+                  {passkeyError && <p className="text-xs text-rose-500">{passkeyError}</p>}
+                </div>
+              ) : (
+                <p className="text-xs text-slate-400">当前浏览器不支持通行密钥</p>
+              )}
+              {passkeys.length > 0 && (
+                <ul className="divide-y divide-slate-100 mt-4">
+                  {passkeys.map(passkey => (
+                    <li key={passkey.id} className="flex items-center justify-between py-2.5">
+                      <div className="min-w-0">
+                        <p className="text-sm text-slate-700">{passkey.name}{passkey.passwordless && <span className="ml-2 text-xs text-emerald-600">免密码</span>}</p>
+                        <p className="text-xs text-slate-400 truncate">
+                          {new Date(passkey.createdAt).toLocaleDateString()} 添加 · {passkey.lastUsedAt ? `最近使用 ${new Date(passkey.lastUsedAt).toLocaleString()}` : '从未使用'}
+                        </p>
+                      </div>
+                      <button
+                        onClick={() => handleDeletePasskey(passkey.id)}
+                        className="text-slate-400 hover:text-rose-500 cursor-pointer transition-colors p-2"
+                      >
+                        <TrashIcon className="w-4 h-4" />
+                      </button>
+                    </li>
+                  ))}
+                </ul>
+              )}
+            </div>
+
+            {/* 审计日志 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <div className="flex items-center justify-between mb-1">
+                <h3 className="text-sm font-semibold text-slate-700">审计日志</h3>
+                <label className="flex items-center space-x-1.5 text-xs text-slate-500 cursor-pointer">
+                  <input
+                    type="checkbox"
+                    checked={auditFailuresOnly}
+                    onChange={e => {
+                      setAuditFailuresOnly(e.target.checked);
+                      loadAuditEvents(1, e.target.checked);
+                    }}
+                  />
+                  <span>仅显示失败</span>
+                </label>
+              </div>
+              <p className="text-xs text-slate-400 mb-4">解锁、两步验证变更、通行密钥变更和凭证读取记录，只能追加不能删除。</p>
+              {auditEvents.length === 0 ? (
+                <p className="text-xs text-slate-400">暂无记录</p>
+              ) : (
+                <ul className="divide-y divide-slate-100">
+                  {auditEvents.map(event => (
+                    <li key={event.id} className="py-2.5">
+                      <p className="text-sm text-slate-700">
+                        {AUDIT_ACTION_LABELS[event.action] || event.action}
+                        <span className={`ml-2 text-xs ${event.outcome === 'success' ? 'text-emerald-600' : 'text-rose-500'}`}>{AUDIT_OUTCOME_LABELS[event.outcome]}</span>
+                        {event.detail && <span className="ml-2 text-xs text-slate-400">{event.detail}</span>}
+                      </p>
+                      <p className="text-xs text-slate-400 truncate">
+                        {new Date(event.createdAt).toLocaleString()} · {event.ip} · {event.userAgent || '未知设备'}
+                      </p>
+                    </li>
+                  ))}
+                </ul>
+              )}
+              {auditTotal > 20 && (
+                <div className="flex items-center justify-end space-x-3 mt-3 text-xs text-slate-500">
+                  <button
+                    onClick={() => loadAuditEvents(auditPage - 1)}
+                    disabled={auditPage <= 1}
+                    className="cursor-pointer disabled:text-slate-300"
+                  >
+                    上一页
+                  </button>
+                  <span>{auditPage} / {Math.ceil(auditTotal / 20)}</span>
+                  <button
+                    onClick={() => loadAuditEvents(auditPage + 1)}
+                    disabled={auditPage * 20 >= auditTotal}
+                    className="cursor-pointer disabled:text-slate-300"
+                  >
+                    下一页
+                  </button>
+                </div>
+              )}
+            </div>
+
+            {/* 凭证历史版本 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <div className="flex items-center justify-between">
+                <div>
+                  <h3 className="text-sm font-semibold text-slate-700 mb-1">凭证历史版本</h3>
+                  <p className="text-xs text-slate-400">修改密码或备注时加密保留旧值，可在凭证详情中查看和恢复。每个凭证保留的版本数：</p>
+                </div>
+                <select
+                  value={historyLimit}
+                  onChange={e => handleHistoryLimitChange(Number(e.target.value))}
+                  className="bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none"
+                >
+                  {[5, 10, 20, 50, 100].includes(historyLimit) ? null : <option value={historyLimit}>{historyLimit} 个</option>}
+                  <option value={5}>5 个</option>
+                  <option value={10}>10 个</option>
+                  <option value={20}>20 个</option>
+                  <option value={50}>50 个</option>
+                  <option value={100}>100 个</option>
+                </select>
+              </div>
+            </div>
+
+            {/* 加密备份 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <h3 className="text-sm font-semibold text-slate-700 mb-1">加密备份</h3>
+              <p className="text-xs text-slate-400 mb-4">导出订阅、凭证、备忘录、分组、通知设置及续费记录，用你设置的口令加密，换服务器或重新部署后也能导入。不含共享给你的数据和回收站。导出和导入都需要再次输入主密钥{totpEnabled && totpVerified ? '和两步验证码' : ''}。</p>
+              <div className="space-y-3">
+                <input
+                  type="password"
+                  value={backupPassphrase}
+                  onChange={e => setBackupPassphrase(e.target.value)}
+                  placeholder="备份口令，至少 8 位"
+                  autoComplete="new-password"
+                  className="w-full bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                />
+                <div className="flex flex-col sm:flex-row gap-3">
+                  <input
+                    type="password"
+                    value={backupMasterKey}
+                    onChange={e => setBackupMasterKey(e.target.value)}
+                    placeholder="主密钥"
+                    autoComplete="current-password"
+                    className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                  />
+                  {totpEnabled && totpVerified && (
+                    <input
+                      type="text"
+                      inputMode="numeric"
+                      value={backupTotpCode}
+                      onChange={e => setBackupTotpCode(e.target.value.replace(/\D/g, '').slice(0, 6))}
+                      placeholder="两步验证码"
+                      autoComplete="one-time-code"
+                      className="sm:w-36 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                    />
+                  )}
+                </div>
+                <div className="flex flex-col sm:flex-row gap-3">
+                  <button
+                    onClick={handleExportBackup}
+                    disabled={backupBusy || backupPassphrase.length < 8 || !backupMasterKey}
+                    className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:opacity-50 text-white text-sm font-medium rounded-lg cursor-pointer"
+                  >
+                    导出备份
+                  </button>
+                  <select
+                    value={backupMode}
+                    onChange={e => setBackupMode(e.target.value as BackupImportMode)}
+                    className="bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none"
+                  >
+                    <option value="merge">合并：保留现有数据，跳过已存在的记录</option>
+                    <option value="replace">替换：清空现有数据后导入</option>
+                  </select>
+                  <button
+                    onClick={handleImportBackup}
+                    disabled={backupBusy || !backupPassphrase || !backupMasterKey}
+                    className="px-4 py-2.5 border border-slate-200 hover:bg-slate-50 disabled:opacity-50 text-slate-700 text-sm font-medium rounded-lg cursor-pointer"
+                  >
+                    选择文件导入
+                  </button>
+                </div>
+                {backupMessage && <p className="text-xs text-emerald-600">{backupMessage}</p>}
+                {backupError && <p className="text-xs text-rose-600">{backupError}</p>}
+              </div>
+            </div>
+
+            {/* 导出凭证 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <h3 className="text-sm font-semibold text-slate-700 mb-1">导出凭证</h3>
+              <p className="text-xs text-slate-400 mb-4">把自己的凭证导出为 Bitwarden、KeePass 或通用 CSV 文件，分组对应文件夹。文件不加密，需要再次输入主密钥{totpEnabled && totpVerified ? '和两步验证码' : ''}。</p>
+              <div className="space-y-3">
+                <select
+                  value={exportFormat}
+                  onChange={e => setExportFormat(e.target.value as CredentialExportFormat)}
+                  className="w-full bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none"
+                >
+                  <option value="bitwarden-json">Bitwarden JSON</option>
+                  <option value="keepass-xml">KeePass XML</option>
+                  <option value="csv">CSV（Chrome、Edge 等可直接导入）</option>
+                </select>
+                <div className="flex flex-col sm:flex-row gap-3">
+                  <input
+                    type="password"
+                    value={exportMasterKey}
+                    onChange={e => setExportMasterKey(e.target.value)}
+                    placeholder="主密钥"
+                    autoComplete="current-password"
+                    className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                  />
+                  {totpEnabled && totpVerified && (
+                    <input
+                      type="text"
+                      inputMode="numeric"
+                      value={exportTotpCode}
+                      onChange={e => setExportTotpCode(e.target.value.replace(/\D/g, '').slice(0, 6))}
+                      placeholder="两步验证码"
+                      autoComplete="one-time-code"
+                      className="sm:w-36 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                    />
+                  )}
+                  <button
+                    onClick={handleExportCredentials}
+                    disabled={exportBusy || !exportMasterKey}
+                    className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:opacity-50 text-white text-sm font-medium rounded-lg cursor-pointer"
+                  >
+                    导出
+                  </button>
+                </div>
+                {exportMessage && <p className="text-xs text-emerald-600">{exportMessage}</p>}
+                {exportError && <p className="text-xs text-rose-600">{exportError}</p>}
+              </div>
+            </div>
+
+            {/* 个人访问令牌 */}
+            <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+              <h3 className="text-sm font-semibold text-slate-700 mb-1">个人访问令牌</h3>
+              <p className="text-xs text-slate-400 mb-4">供定时脚本等自动化调用 API，按需授予权限，可随时吊销。令牌只显示一次，请立即保存。</p>
+              <div className="space-y-3">
+                <div className="flex flex-col sm:flex-row gap-3">
+                  <input
+                    type="text"
+                    value={newTokenName}
+                    onChange={e => setNewTokenName(e.target.value)}
+                    placeholder="令牌名称，如续费提醒脚本"
+                    className="flex-1 bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none focus:border-blue-400"
+                  />
+                  <select
+                    value={newTokenDays}
+                    onChange={e => setNewTokenDays(Number(e.target.value))}
+                    className="bg-slate-50 border border-slate-200 rounded-lg px-3 py-2.5 text-sm outline-none"
+                  >
+                    <option value={30}>30 天</option>
+                    <option value={90}>90 天</option>
+                    <option value={365}>365 天</option>
+                    <option value={0}>永不过期</option>
+                  </select>
+                </div>
+                <div className="flex flex-wrap gap-2">
+                  {availableScopes.map(scope => (
+                    <label key={scope} className="flex items-center space-x-1.5 text-xs text-slate-600 bg-slate-50 border border-slate-200 rounded-full px-3 py-1.5 cursor-pointer">
+                      <input type="checkbox" checked={newTokenScopes.includes(scope)} onChange={() => toggleTokenScope(scope)} />
+                      <span>{scope}</span>
+                    </label>
+                  ))}
+                </div>
+                <button
+                  onClick={handleCreateApiToken}
+                  disabled={!newTokenName.trim() || newTokenScopes.length === 0}
+                  className="px-4 py-2.5 bg-blue-600 hover:bg-blue-700 disabled:bg-slate-300 text-white text-sm font-medium rounded-lg cursor-pointer transition-colors"
+                >
+                  创建令牌
+                </button>
+                {tokenError && <p className="text-xs text-rose-500">{tokenError}</p>}
+                {createdToken && (
+                  <div className="bg-amber-50 border border-amber-200 rounded-lg p-3">
+                    <p className="text-xs text-amber-700 mb-2">新令牌（只显示这一次）：</p>
+                    <code className="block text-xs text-slate-800 break-all select-all">{createdToken}</code>
+                  </div>
+                )}
+              </div>
+              {apiTokens.length > 0 && (
+                <ul className="divide-y divide-slate-100 mt-4">
+                  {apiTokens.map(token => (
+                    <li key={token.id} className="flex items-center justify-between py-2.5">
+                      <div className="min-w-0">
+                        <p className="text-sm text-slate-700">{token.name} <span className="text-xs text-slate-400 font-mono">{token.prefix}…</span></p>
+                        <p className="text-xs text-slate-400 truncate">
+                          {token.scopes.join(', ')} · {token.expiresAt ? `${new Date(token.expiresAt).toLocaleDateString()} 过期` : '永不过期'} · {token.lastUsedAt ? `最近使用 ${new Date(token.lastUsedAt).toLocaleString()}` : '从未使用'}
+                        </p>
+                      </div>
+                      <button
+                        onClick={() => handleRevokeApiToken(token.id)}
+                        className="text-slate-400 hover:text-rose-500 cursor-pointer transition-colors p-2"
+                      >
+                        <TrashIcon className="w-4 h-4" />
+                      </button>
+                    </li>
+                  ))}
+                </ul>
+              )}
+            </div>
+
+            {/* 用户注册（仅管理员） */}
+            {isAdmin && (
+              <div className="bg-white rounded-xl border border-slate-200/60 p-5">
+                <div className="flex items-center justify-between">
+                  <div>
+                    <h3 className="text-sm font-semibold text-slate-700 mb-1">允许新用户注册</h3>
+                    <p className="text-xs text-slate-400">开启后登录页会显示注册入口，每个用户拥有独立的保险库</p>
+                  </div>
+                  <button
+                    type="button"
+                    role="switch"
+                    aria-checked={registrationEnabled}
+                    onClick={handleToggleRegistration}
+                    className={`w-11 h-6 rounded-full cursor-pointer transition-colors ${
+                      registrationEnabled ? 'bg-blue-600' : 'bg-slate-200'
+                    }`}
+                  >
+                    <div
+                      className={`w-5 h-5 bg-white rounded-full shadow transition-transform mt-0.5 ${
+                        registrationEnabled ? 'translate-x-5 ml-0.5' : 'translate-x-0.5'
+                      }`}
+                    />
+                  </button>
+                </div>
+              </div>
+            )}
+
             {/* 安全说明 */}
             <div className="bg-white rounded-xl border border-slate-200/60 p-5">
               <h3 className="text-sm font-semibold text-slate-700 mb-3">安全说明</h3>
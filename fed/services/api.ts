@@ -1,18 +1,43 @@
-import { BatchResultItem, Credential, GroupAssignment, Memo } from '../types';
+import { ApiToken, AuditEvent, BackupFile, BackupImportMode, BackupImportResult, BatchResultItem, Collection, CollectionMember, Credential, CredentialExportFormat, CredentialHistoryEntry, CredentialImportPreview, GroupAssignment, Memo, TrashContents, TrashKind, VaultChanges, WebAuthnChallenge, WebAuthnCredential } from '../types';
 
 const API_BASE = import.meta.env.VITE_API_URL || '/api/v1';
 
+// 更新时必须带上读取时的版本号，记录已被修改过时服务端返回 409 而不是覆盖，缺少时返回 428
+const ifMatch = (version: number): Record<string, string> => ({ 'If-Match': `"${version}"` });
+
+type AuthTokens = {
+  token: string;
+  refreshToken: string;
+  expiresIn: number;
+  vaultId: string;
+  isNew: boolean;
+};
+
 class ApiService {
   private token: string | null = null;
+  private refreshToken: string | null = null;
+  private refreshing: Promise<boolean> | null = null;
 
   constructor() {
     this.token = localStorage.getItem('auth_token');
+    this.refreshToken = localStorage.getItem('refresh_token');
   }
 
   private async request<T>(
     endpoint: string,
-    options: RequestInit = {}
+    options: RequestInit = {},
+    retry = true
   ): Promise<T> {
+    const response = await this.send(endpoint, options, retry);
+    return response.json();
+  }
+
+  // 发送请求并处理令牌刷新和错误，返回原始响应，供下载文件等非 JSON 响应使用
+  private async send(
+    endpoint: string,
+    options: RequestInit = {},
+    retry = true
+  ): Promise<Response> {
     const headers: HeadersInit = {
       'Content-Type': 'application/json',
       ...options.headers,
@@ -27,6 +52,13 @@ class ApiService {
       headers,
     });
 
+    // 访问令牌过期时用刷新令牌换一次再重试
+    if (response.status === 401 && retry && this.refreshToken && !endpoint.startsWith('/auth/')) {
+      if (await this.refreshSession()) {
+        return this.send(endpoint, options, false);
+      }
+    }
+
     if (!response.ok) {
       const error = await response.json().catch(() => ({ error: '请求失败' }));
       const err = new Error(error.error || '请求失败') as any;
@@ -35,7 +67,7 @@ class ApiService {
       throw err;
     }
 
-    return response.json();
+    return response;
   }
 
   setToken(token: string) {
@@ -43,9 +75,40 @@ class ApiService {
     localStorage.setItem('auth_token', token);
   }
 
+  setRefreshToken(refreshToken: string) {
+    this.refreshToken = refreshToken;
+    localStorage.setItem('refresh_token', refreshToken);
+  }
+
   clearToken() {
     this.token = null;
+    this.refreshToken = null;
     localStorage.removeItem('auth_token');
+    localStorage.removeItem('refresh_token');
+  }
+
+  // 并发请求共用同一次刷新，刷新令牌每次都会轮转
+  async refreshSession(): Promise<boolean> {
+    if (!this.refreshToken) return false;
+    if (!this.refreshing) {
+      this.refreshing = this.request<AuthTokens>('/auth/refresh', {
+        method: 'POST',
+        body: JSON.stringify({ refreshToken: this.refreshToken }),
+      }, false)
+        .then((data) => {
+          this.setToken(data.token);
+          this.setRefreshToken(data.refreshToken);
+          return true;
+        })
+        .catch(() => {
+          this.clearToken();
+          return false;
+        })
+        .finally(() => {
+          this.refreshing = null;
+        });
+    }
+    return this.refreshing;
   }
 
   getToken() {
@@ -57,23 +120,80 @@ class ApiService {
   }
 
   // === 解锁 ===
-  async unlock(masterKey: string, totpCode?: string) {
-    const body: Record<string, string> = { masterKey };
+  async unlock(
+    username: string,
+    masterKey: string,
+    totpCode?: string,
+    passkey?: { challengeId: string; assertion: unknown }
+  ) {
+    const body: Record<string, unknown> = { username, masterKey };
     if (totpCode) body.totpCode = totpCode;
-    const data = await this.request<{ token: string; vaultId: string; isNew: boolean }>('/unlock', {
+    if (passkey) {
+      body.challengeId = passkey.challengeId;
+      body.webauthn = passkey.assertion;
+    }
+    const data = await this.request<AuthTokens>('/unlock', {
       method: 'POST',
       body: JSON.stringify(body),
     });
     this.setToken(data.token);
+    this.setRefreshToken(data.refreshToken);
+    return data;
+  }
+
+  // 免密码解锁：先取挑战，再提交通行密钥断言和设备密钥
+  async beginPasskeyUnlock() {
+    return this.request<WebAuthnChallenge>('/auth/webauthn/begin', { method: 'POST' }, false);
+  }
+
+  async passkeyUnlock(challengeId: string, credential: unknown, deviceSecret: string) {
+    const data = await this.request<AuthTokens>('/auth/webauthn/unlock', {
+      method: 'POST',
+      body: JSON.stringify({ challengeId, credential, deviceSecret }),
+    }, false);
+    this.setToken(data.token);
+    this.setRefreshToken(data.refreshToken);
+    return data;
+  }
+
+  // === 注册 ===
+  // 第一个用户（管理员）注册时需要初始化令牌，见服务器启动日志或 SETUP_TOKEN
+  async register(username: string, masterKey: string, setupToken?: string) {
+    const data = await this.request<AuthTokens>('/auth/register', {
+      method: 'POST',
+      body: JSON.stringify({ username, masterKey, setupToken: setupToken || undefined }),
+    });
+    this.setToken(data.token);
+    this.setRefreshToken(data.refreshToken);
     return data;
   }
 
+  async getRegistrationStatus() {
+    return this.request<{ enabled: boolean; setupRequired?: boolean }>('/auth/registration', {}, false);
+  }
+
   // 验证 token 是否有效
   async verify() {
-    return this.request<{ vaultId: string; valid: boolean }>('/verify');
+    return this.request<{ vaultId: string; valid: boolean; username?: string; isAdmin?: boolean }>('/verify');
+  }
+
+  // === 管理员 ===
+  async getAdminRegistration() {
+    return this.request<{ enabled: boolean }>('/admin/registration');
+  }
+
+  async updateAdminRegistration(enabled: boolean) {
+    return this.request<{ enabled: boolean }>('/admin/registration', {
+      method: 'PUT',
+      body: JSON.stringify({ enabled }),
+    });
   }
 
   lock() {
+    if (this.token) {
+      // 服务端吊销会话，失败也不影响本地锁定
+      this.request('/auth/logout', { method: 'POST' }, false).catch(() => {});
+    }
     this.clearToken();
   }
 
@@ -84,9 +204,15 @@ class ApiService {
       subscriptions: any[];
       memos: any[];
       lastUpdated: number;
+      cursor: string;
     }>('/vault');
   }
 
+  // 游标过期时抛出 status 为 410 的错误，需重新 getVault
+  async getVaultChanges(since: string): Promise<VaultChanges> {
+    return this.request<VaultChanges>(`/vault/changes?since=${encodeURIComponent(since)}`);
+  }
+
   // === 订阅 ===
   async getSubscriptions() {
     return this.request<any[]>('/subscriptions');
@@ -99,9 +225,10 @@ class ApiService {
     });
   }
 
-  async updateSubscription(id: string, data: any) {
+  async updateSubscription(id: string, data: any, version: number) {
     return this.request<any>(`/subscriptions/${id}`, {
       method: 'PUT',
+      headers: ifMatch(version),
       body: JSON.stringify(data),
     });
   }
@@ -124,18 +251,35 @@ class ApiService {
     });
   }
 
-  async batchCreateCredentials(items: Partial<Credential>[]) {
-    return this.request<{
+  // content 为文件原始内容的 base64，由服务端识别 Bitwarden、1Password、KeePass 和浏览器导出格式
+  async previewCredentialImport(fileName: string, content: string) {
+    return this.request<CredentialImportPreview>('/credentials/import/preview', {
+      method: 'POST',
+      body: JSON.stringify({ fileName, content }),
+    });
+  }
+
+  // 每批带一个 Idempotency-Key，网络中断时用同一个键重试一次：服务端已写入时直接返回第一次的结果，不会重复导入
+  async batchCreateCredentials(items: Partial<Credential>[], idempotencyKey: string = crypto.randomUUID()) {
+    type BatchCreateResult = {
       created: Credential[];
       skipped: BatchResultItem[];
       failed: BatchResultItem[];
       createdCount: number;
       skippedCount: number;
       failedCount: number;
-    }>('/credentials/batch', {
+    };
+    const options: RequestInit = {
       method: 'POST',
+      headers: { 'Idempotency-Key': idempotencyKey },
       body: JSON.stringify({ items }),
-    });
+    };
+    try {
+      return await this.request<BatchCreateResult>('/credentials/batch', options);
+    } catch (err) {
+      if (!(err instanceof TypeError)) throw err;
+      return this.request<BatchCreateResult>('/credentials/batch', options);
+    }
   }
 
   async updateCredentialGroups(assignments: GroupAssignment[]) {
@@ -159,9 +303,10 @@ class ApiService {
     });
   }
 
-  async updateCredential(id: string, data: any) {
+  async updateCredential(id: string, data: any, version: number) {
     return this.request<any>(`/credentials/${id}`, {
       method: 'PUT',
+      headers: ifMatch(version),
       body: JSON.stringify(data),
     });
   }
@@ -172,6 +317,28 @@ class ApiService {
     });
   }
 
+  async getCredentialHistory(id: string) {
+    return this.request<CredentialHistoryEntry[]>(`/credentials/${id}/history`);
+  }
+
+  async restoreCredentialHistory(id: string, historyId: string, version: number) {
+    return this.request<Credential>(`/credentials/${id}/history/${historyId}/restore`, {
+      method: 'POST',
+      headers: ifMatch(version),
+    });
+  }
+
+  async getPasswordHistoryLimit() {
+    return this.request<{ limit: number }>('/credentials/history-limit');
+  }
+
+  async savePasswordHistoryLimit(limit: number) {
+    return this.request<{ limit: number }>('/credentials/history-limit', {
+      method: 'PUT',
+      body: JSON.stringify({ limit }),
+    });
+  }
+
   // === 备忘录 ===
   async getMemos(): Promise<Memo[]> {
     return this.request<Memo[]>('/memos');
@@ -184,9 +351,10 @@ class ApiService {
     });
   }
 
-  async updateMemo(id: string, data: Partial<Memo>): Promise<Memo> {
+  async updateMemo(id: string, data: Partial<Memo>, version: number): Promise<Memo> {
     return this.request<Memo>(`/memos/${id}`, {
       method: 'PUT',
+      headers: ifMatch(version),
       body: JSON.stringify(data),
     });
   }
@@ -336,7 +504,50 @@ class ApiService {
   }
 
   async getTotpStatus() {
-    return this.request<{ enabled: boolean; verified: boolean }>('/totp/status');
+    return this.request<{ enabled: boolean; verified: boolean; recoveryCodesRemaining?: number; recoveryCodesLow?: boolean }>('/totp/status');
+  }
+
+  async regenerateRecoveryCodes(code: string) {
+    return this.request<{ message: string; recoveryCodes: string[] }>('/totp/recovery-codes', {
+      method: 'POST',
+      body: JSON.stringify({ code }),
+    });
+  }
+
+  // === 通行密钥 (WebAuthn) ===
+  // 需再次输入主密钥，开启两步验证时还需验证码
+  async beginPasskeyRegistration(passwordless: boolean, masterKey: string, totpCode?: string) {
+    return this.request<WebAuthnChallenge>('/webauthn/register/begin', {
+      method: 'POST',
+      body: JSON.stringify({ passwordless, masterKey, totpCode }),
+    });
+  }
+
+  async finishPasskeyRegistration(data: { challengeId: string; name: string; passwordless: boolean; credential: unknown }) {
+    return this.request<{ credential: WebAuthnCredential; deviceSecret?: string }>('/webauthn/register/finish', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    });
+  }
+
+  async getPasskeys() {
+    return this.request<WebAuthnCredential[]>('/webauthn/credentials');
+  }
+
+  async deletePasskey(id: string) {
+    return this.request<void>(`/webauthn/credentials/${id}`, {
+      method: 'DELETE',
+    });
+  }
+
+  // === 审计日志 ===
+  async getAuditEvents(params: { action?: string; outcome?: string; page?: number; pageSize?: number } = {}) {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') query.set(key, String(value));
+    });
+    const qs = query.toString();
+    return this.request<{ events: AuditEvent[]; total: number; page: number; pageSize: number }>(`/audit${qs ? `?${qs}` : ''}`);
   }
 
   // === 标签 ===
@@ -369,6 +580,128 @@ class ApiService {
     });
   }
 
+  // === 回收站 ===
+  async getTrash() {
+    return this.request<TrashContents>('/trash');
+  }
+
+  async restoreTrashItem(kind: TrashKind, id: string) {
+    return this.request<{ message: string }>(`/trash/${kind}/${id}/restore`, {
+      method: 'POST',
+    });
+  }
+
+  async purgeTrashItem(kind: TrashKind, id: string) {
+    return this.request<void>(`/trash/${kind}/${id}`, {
+      method: 'DELETE',
+    });
+  }
+
+  async emptyTrash() {
+    return this.request<{ purged: number }>('/trash', {
+      method: 'DELETE',
+    });
+  }
+
+  // === 凭证导出 ===
+  // 返回明文文件，需再次输入主密钥；开启两步验证时缺少验证码会返回 403 且 data.totp_required 为 true
+  async exportCredentials(format: CredentialExportFormat, masterKey: string, totpCode?: string) {
+    const response = await this.send('/export/credentials', {
+      method: 'POST',
+      body: JSON.stringify({ format, masterKey, totpCode }),
+    });
+    const disposition = response.headers.get('Content-Disposition') || '';
+    const fileName = disposition.match(/filename="([^"]+)"/)?.[1] || 'subvault-credentials';
+    return { blob: await response.blob(), fileName };
+  }
+
+  // === 整库备份 ===
+  // 导出和导入都需再次输入主密钥，开启两步验证时还需验证码
+  async exportBackup(passphrase: string, masterKey: string, totpCode?: string) {
+    return this.request<BackupFile>('/backup/export', {
+      method: 'POST',
+      body: JSON.stringify({ passphrase, masterKey, totpCode }),
+    });
+  }
+
+  async importBackup(file: BackupFile, passphrase: string, mode: BackupImportMode, masterKey: string, totpCode?: string) {
+    return this.request<BackupImportResult>('/backup/import', {
+      method: 'POST',
+      body: JSON.stringify({ file, passphrase, mode, masterKey, totpCode }),
+    });
+  }
+
+  // === 个人访问令牌 ===
+  async getApiTokens() {
+    return this.request<{ tokens: ApiToken[]; availableScopes: string[] }>('/tokens');
+  }
+
+  async createApiToken(data: { name: string; scopes: string[]; expiresInDays: number }) {
+    return this.request<{ token: string; info: ApiToken }>('/tokens', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    });
+  }
+
+  async revokeApiToken(id: string) {
+    return this.request<void>(`/tokens/${id}`, {
+      method: 'DELETE',
+    });
+  }
+
+  // === 共享集合 ===
+  async getCollections() {
+    return this.request<Collection[]>('/collections');
+  }
+
+  async createCollection(name: string) {
+    return this.request<Collection>('/collections', {
+      method: 'POST',
+      body: JSON.stringify({ name }),
+    });
+  }
+
+  async renameCollection(id: string, name: string) {
+    return this.request<Collection>(`/collections/${id}`, {
+      method: 'PUT',
+      body: JSON.stringify({ name }),
+    });
+  }
+
+  async deleteCollection(id: string) {
+    return this.request<void>(`/collections/${id}`, {
+      method: 'DELETE',
+    });
+  }
+
+  async addCollectionMember(id: string, username: string, role: 'viewer' | 'editor') {
+    return this.request<CollectionMember>(`/collections/${id}/members`, {
+      method: 'POST',
+      body: JSON.stringify({ username, role }),
+    });
+  }
+
+  async updateCollectionMember(id: string, memberId: string, role: 'viewer' | 'editor') {
+    return this.request<void>(`/collections/${id}/members/${memberId}`, {
+      method: 'PUT',
+      body: JSON.stringify({ role }),
+    });
+  }
+
+  async removeCollectionMember(id: string, memberId: string) {
+    return this.request<void>(`/collections/${id}/members/${memberId}`, {
+      method: 'DELETE',
+    });
+  }
+
+  // 把记录放入共享集合，collectionId 为 null 时移回个人
+  async assignCollection(kind: 'subscriptions' | 'credentials' | 'memos', id: string, collectionId: string | null) {
+    return this.request<{ id: string; collectionId: string | null }>(`/${kind}/${id}/collection`, {
+      method: 'PUT',
+      body: JSON.stringify({ collectionId }),
+    });
+  }
+
   // === 通知设置 ===
   async getNotificationSettings() {
     return this.request<{
@@ -6,9 +6,21 @@ export interface Credential {
   notes?: string;
   website?: string;
   category?: string;
+  collectionId?: string; // 所在共享集合，空表示个人数据
+  vaultId?: string;
+  version?: number; // 每次修改加一，更新时作为 If-Match 带上
   createdAt: number;
 }
 
+// 凭证被修改前的密码和备注，createdAt 为被替换的时间
+export interface CredentialHistoryEntry {
+  id: string;
+  credentialId: string;
+  password?: string;
+  notes?: string;
+  createdAt: string;
+}
+
 export type CredentialCategory = '社交' | '购物' | '工作' | '娱乐' | '开发' | '金融' | '教育' | '其他';
 
 export const CREDENTIAL_CATEGORIES: CredentialCategory[] = ['社交', '购物', '工作', '娱乐', '开发', '金融', '教育', '其他'];
@@ -39,6 +51,9 @@ export interface Subscription {
   promoEndsOn?: string;
   reminderDays?: string;
   notes?: string;
+  collectionId?: string;
+  vaultId?: string;
+  version?: number;
 }
 
 export interface Memo {
@@ -47,6 +62,9 @@ export interface Memo {
   content: string;
   category: string;
   isPinned: boolean;
+  collectionId?: string;
+  vaultId?: string;
+  version?: number;
   createdAt: number;
   updatedAt: number;
 }
@@ -55,11 +73,115 @@ export type MemoCategory = '个人信息' | '银行卡' | '地址' | '其他';
 
 export const MEMO_CATEGORIES: MemoCategory[] = ['个人信息', '银行卡', '地址', '其他'];
 
+export type CollectionRole = 'owner' | 'editor' | 'viewer';
+
+export interface CollectionMember {
+  id?: string; // 所有者没有成员记录
+  username: string;
+  role: CollectionRole;
+}
+
+// 共享集合：viewer 只读，editor 可新增、修改、删除其中的记录
+export interface Collection {
+  id: string;
+  name: string;
+  ownerVaultId: string;
+  role: CollectionRole;
+  members: CollectionMember[];
+}
+
+// 个人访问令牌，明文只在创建时返回一次
+export interface ApiToken {
+  id: string;
+  name: string;
+  prefix: string;
+  scopes: string[];
+  expiresAt: string | null;
+  lastUsedAt: string | null;
+  lastUsedIp: string;
+  createdAt: string;
+}
+
+export interface WebAuthnCredential {
+  id: string;
+  name: string;
+  aaguid: string;
+  passwordless: boolean;
+  lastUsedAt: string | null;
+  createdAt: string;
+}
+
+export interface AuditEvent {
+  id: string;
+  vaultId: string;
+  actorVaultId: string;
+  action: string;
+  outcome: 'success' | 'failure' | 'locked';
+  targetId: string;
+  detail: string;
+  ip: string;
+  userAgent: string;
+  createdAt: string;
+}
+
+export type TrashKind = 'subscriptions' | 'credentials' | 'memos' | 'tags';
+
+// 回收站内容，凭证和备忘录不含密文；超过 retentionDays 天后由服务端彻底删除
+export interface TrashContents {
+  subscriptions: (Subscription & { deletedAt: string })[];
+  credentials: (Omit<Credential, 'createdAt'> & { deletedAt: string })[];
+  memos: (Omit<Memo, 'createdAt' | 'updatedAt'> & { deletedAt: string })[];
+  tags: { id: string; name: string; color: string; deletedAt: string }[];
+  retentionDays: number;
+}
+
+// 用口令加密的整库备份文件，内容只有服务端用口令才能解开
+export interface BackupFile {
+  format: string;
+  version: number;
+  kdf: string;
+  salt: string;
+  data: string;
+}
+
+export type BackupImportMode = 'merge' | 'replace';
+
+export interface BackupImportResult {
+  mode: BackupImportMode;
+  subscriptions: number;
+  credentials: number;
+  memos: number;
+  tags: number;
+  skipped: number;
+}
+
+// 服务端下发的 navigator.credentials 选项，二进制字段为 base64url
+export interface WebAuthnChallenge {
+  challengeId: string;
+  publicKey: Record<string, any>;
+}
+
 export interface VaultData {
   credentials: Credential[];
   subscriptions: Subscription[];
   memos: Memo[];
   lastUpdated: number;
+  cursor?: string; // 增量同步游标
+}
+
+// 增量同步中已删除的记录
+export interface SyncTombstone {
+  kind: 'subscriptions' | 'credentials' | 'memos';
+  id: string;
+  deletedAt: string;
+}
+
+export interface VaultChanges {
+  credentials: Credential[];
+  subscriptions: Subscription[];
+  memos: Memo[];
+  deleted: SyncTombstone[];
+  cursor: string;
 }
 
 export interface EncryptedStorage {
@@ -85,6 +207,25 @@ export interface BatchResultItem {
   reason: string;
 }
 
+// 其他密码管理器导出文件的解析结果，exists 表示已有相同名称、账号和网址的凭证
+export interface CredentialImportItem {
+  label: string;
+  username: string;
+  password: string;
+  notes: string;
+  website: string;
+  category: string;
+  exists: boolean;
+}
+
+export interface CredentialImportPreview {
+  format: string;
+  items: CredentialImportItem[];
+  unsupported: number;
+}
+
+export type CredentialExportFormat = 'bitwarden-json' | 'keepass-xml' | 'csv';
+
 export interface BatchImportResult {
   created: number;
   skipped: number;
@@ -0,0 +1,23 @@
+// 乐观并发控制：更新时必须在 If-Match 中带上读取时的版本号，记录已在其他设备上修改时服务端返回 409 和当前内容
+
+// 带版本号保存。冲突时先用 onLatest 把本地记录换成最新内容，用户确认覆盖后基于最新版本重新保存，取消时返回 null。
+// 本地记录没有版本号（不在已加载的数据中）时不发请求，服务端不接受不带版本的修改
+export async function saveWithVersion<T extends { version?: number }>(
+  save: (version: number) => Promise<T>,
+  version: number | undefined,
+  onLatest: (latest: T) => void,
+  message: string,
+): Promise<T | null> {
+  if (!version) {
+    throw new Error('记录不在当前数据中，请刷新后重试');
+  }
+  try {
+    return await save(version);
+  } catch (err: any) {
+    if (err?.status !== 409 || !err.data?.current?.version) throw err;
+    const latest = err.data.current as T;
+    onLatest(latest);
+    if (!confirm(message)) return null;
+    return save(latest.version as number);
+  }
+}
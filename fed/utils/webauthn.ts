@@ -0,0 +1,92 @@
+import { WebAuthnChallenge } from '../types';
+
+// 免密码解锁用的设备密钥，只保存在注册该通行密钥的浏览器上
+const DEVICE_SECRET_KEY = 'passkey_device_secret';
+const DEVICE_CREDENTIAL_KEY = 'passkey_device_credential';
+
+const toBase64Url = (buffer: ArrayBuffer): string => {
+  let binary = '';
+  const bytes = new Uint8Array(buffer);
+  for (let i = 0; i < bytes.byteLength; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return window.btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+const fromBase64Url = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = window.atob(base64 + '='.repeat((4 - (base64.length % 4)) % 4));
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+};
+
+const decodeDescriptors = (list: { id: string; type: string; transports?: string[] }[] = []) =>
+  list.map((d) => ({ ...d, id: fromBase64Url(d.id) })) as PublicKeyCredentialDescriptor[];
+
+export const isWebAuthnSupported = () =>
+  typeof window !== 'undefined' && !!window.PublicKeyCredential && !!navigator.credentials;
+
+// 调用 navigator.credentials.create，返回可直接提交给 /webauthn/register/finish 的 JSON
+export const createPasskey = async ({ publicKey }: WebAuthnChallenge) => {
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64Url(publicKey.challenge),
+      user: { ...publicKey.user, id: fromBase64Url(publicKey.user.id) },
+      excludeCredentials: decodeDescriptors(publicKey.excludeCredentials),
+    } as PublicKeyCredentialCreationOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) throw new Error('已取消');
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64Url(response.clientDataJSON),
+      attestationObject: toBase64Url(response.attestationObject),
+      transports: typeof response.getTransports === 'function' ? response.getTransports() : [],
+    },
+  };
+};
+
+// 调用 navigator.credentials.get，返回断言响应 JSON
+export const getPasskeyAssertion = async ({ publicKey }: WebAuthnChallenge) => {
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64Url(publicKey.challenge),
+      allowCredentials: decodeDescriptors(publicKey.allowCredentials),
+    } as PublicKeyCredentialRequestOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) throw new Error('已取消');
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64Url(response.clientDataJSON),
+      authenticatorData: toBase64Url(response.authenticatorData),
+      signature: toBase64Url(response.signature),
+      userHandle: response.userHandle ? toBase64Url(response.userHandle) : undefined,
+    },
+  };
+};
+
+export const getDeviceSecret = () => localStorage.getItem(DEVICE_SECRET_KEY);
+
+export const setDeviceSecret = (credentialId: string, secret: string) => {
+  localStorage.setItem(DEVICE_SECRET_KEY, secret);
+  localStorage.setItem(DEVICE_CREDENTIAL_KEY, credentialId);
+};
+
+// 删除的通行密钥正是本设备的免密码凭证时，一并清除设备密钥
+export const forgetDeviceSecret = (credentialId: string) => {
+  if (localStorage.getItem(DEVICE_CREDENTIAL_KEY) !== credentialId) return;
+  localStorage.removeItem(DEVICE_SECRET_KEY);
+  localStorage.removeItem(DEVICE_CREDENTIAL_KEY);
+};